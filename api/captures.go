@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// A capture session spans from capture_start to its matching capture_stop.
+// Sessions are matched by workflow_id and, lacking that, by capture_source and collection_uid.
+
+const (
+	DEFAULT_CAPTURE_MAX_DURATION   = 6 * time.Hour
+	DEFAULT_CAPTURE_CHECK_INTERVAL = 5 * time.Minute
+)
+
+type CaptureSession struct {
+	ID               int64       `boil:"id" json:"id"`
+	WorkflowID       null.String `boil:"workflow_id" json:"workflow_id"`
+	CaptureSource    null.String `boil:"capture_source" json:"capture_source"`
+	CollectionUID    null.String `boil:"collection_uid" json:"collection_uid"`
+	StartOperationID null.Int64  `boil:"start_operation_id" json:"start_operation_id"`
+	StopOperationID  null.Int64  `boil:"stop_operation_id" json:"stop_operation_id"`
+	StartedAt        null.Time   `boil:"started_at" json:"started_at"`
+	StoppedAt        null.Time   `boil:"stopped_at" json:"stopped_at"`
+	AlertedAt        null.Time   `boil:"alerted_at" json:"alerted_at"`
+}
+
+type ActiveCapture struct {
+	CaptureSession
+	Duration float64 `json:"duration"`
+	Stale    bool    `json:"stale"`
+}
+
+func ActiveCapturesHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	resp, err := handleActiveCaptures(c.MustGet("MDB").(*sql.DB), CaptureMaxDuration())
+	concludeRequest(c, resp, err)
+}
+
+func handleActiveCaptures(exec boil.Executor, maxDuration time.Duration) ([]*ActiveCapture, *HttpError) {
+	var sessions []*CaptureSession
+	err := queries.Raw(exec,
+		`SELECT * FROM capture_sessions
+		 WHERE stopped_at IS NULL AND start_operation_id IS NOT NULL
+		 ORDER BY started_at`).
+		Bind(&sessions)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	now := time.Now()
+	data := make([]*ActiveCapture, len(sessions))
+	for i := range sessions {
+		d := now.Sub(sessions[i].StartedAt.Time)
+		data[i] = &ActiveCapture{
+			CaptureSession: *sessions[i],
+			Duration:       d.Seconds(),
+			Stale:          d > maxDuration,
+		}
+	}
+
+	return data, nil
+}
+
+// CaptureMaxDuration returns the configured time after which an open capture is considered stale.
+func CaptureMaxDuration() time.Duration {
+	if d := viper.GetDuration("captures.max-duration"); d > 0 {
+		return d
+	}
+	return DEFAULT_CAPTURE_MAX_DURATION
+}
+
+func startCaptureSession(exec boil.Executor, op *models.Operation, r CaptureStartRequest) error {
+	_, err := queries.Raw(exec,
+		`INSERT INTO capture_sessions (workflow_id, capture_source, collection_uid, start_operation_id, started_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		null.NewString(r.WorkflowID, r.WorkflowID != ""),
+		null.NewString(r.CaptureSource, r.CaptureSource != ""),
+		null.NewString(r.CollectionUID, r.CollectionUID != ""),
+		op.ID,
+		op.CreatedAt).
+		Exec()
+	return errors.Wrap(err, "Insert capture session")
+}
+
+// stopCaptureSession closes the matching open capture session.
+// If none is found we record a stop only session and return an event about it.
+func stopCaptureSession(exec boil.Executor, op *models.Operation, r CaptureStopRequest) (*events.Event, error) {
+	var id int64
+	err := queries.Raw(exec,
+		`SELECT id FROM capture_sessions
+		 WHERE stopped_at IS NULL AND start_operation_id IS NOT NULL
+		   AND (($1 <> '' AND workflow_id = $1) OR
+		        ($1 = '' AND capture_source = $2 AND collection_uid = $3))
+		 ORDER BY started_at DESC
+		 LIMIT 1`,
+		r.WorkflowID, r.CaptureSource, r.CollectionUID).
+		QueryRow().
+		Scan(&id)
+	if err == nil {
+		_, err = queries.Raw(exec,
+			`UPDATE capture_sessions SET stop_operation_id = $1, stopped_at = $2 WHERE id = $3`,
+			op.ID, op.CreatedAt, id).
+			Exec()
+		return nil, errors.Wrap(err, "Update capture session")
+	}
+	if err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Lookup capture session")
+	}
+
+	log.Warnf("capture_stop without capture_start: workflow_id [%s] capture_source [%s] collection_uid [%s]",
+		r.WorkflowID, r.CaptureSource, r.CollectionUID)
+
+	_, err = queries.Raw(exec,
+		`INSERT INTO capture_sessions (workflow_id, capture_source, collection_uid, stop_operation_id, stopped_at, alerted_at)
+		 VALUES ($1, $2, $3, $4, $5, now_utc())`,
+		null.NewString(r.WorkflowID, r.WorkflowID != ""),
+		null.NewString(r.CaptureSource, r.CaptureSource != ""),
+		null.NewString(r.CollectionUID, r.CollectionUID != ""),
+		op.ID,
+		op.CreatedAt).
+		Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert capture session")
+	}
+
+	e := events.CaptureStopWithoutStartEvent(op, r.CaptureSource, r.CollectionUID)
+	return &e, nil
+}
+
+// CheckStaleCaptures marks open capture sessions older than maxDuration as alerted
+// and returns an event for each one of them. Every session is alerted only once.
+func CheckStaleCaptures(exec boil.Executor, maxDuration time.Duration) ([]events.Event, error) {
+	var sessions []*CaptureSession
+	err := queries.Raw(exec,
+		`UPDATE capture_sessions SET alerted_at = now_utc()
+		 WHERE stopped_at IS NULL AND alerted_at IS NULL AND started_at < $1
+		 RETURNING *`,
+		time.Now().Add(-maxDuration)).
+		Bind(&sessions)
+	if err != nil {
+		return nil, errors.Wrap(err, "Update stale capture sessions")
+	}
+
+	evnts := make([]events.Event, len(sessions))
+	for i, s := range sessions {
+		log.Warnf("Stale capture: workflow_id [%s] capture_source [%s] collection_uid [%s] started at %s",
+			s.WorkflowID.String, s.CaptureSource.String, s.CollectionUID.String, s.StartedAt.Time)
+		evnts[i] = events.CaptureStaleEvent(s.WorkflowID.String, s.CaptureSource.String,
+			s.CollectionUID.String, s.StartedAt.Time)
+	}
+
+	return evnts, nil
+}
+
+// RunStaleCapturesChecker checks for stale captures every interval until stop is closed.
+func RunStaleCapturesChecker(db *sql.DB, emitter events.EventEmitter, interval time.Duration, stop <-chan struct{}) {
+	if interval <= 0 {
+		interval = DEFAULT_CAPTURE_CHECK_INTERVAL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			evnts, err := CheckStaleCaptures(db, CaptureMaxDuration())
+			if err != nil {
+				log.Errorf("Check stale captures: %+v", err)
+				continue
+			}
+			emitter.Emit(evnts...)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/volatiletech/sqlboiler/queries"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+type CapturesSuite struct {
+	suite.Suite
+	utils.TestDBManager
+	tx *sql.Tx
+}
+
+func (suite *CapturesSuite) SetupSuite() {
+	suite.Require().Nil(suite.InitTestDB())
+	suite.Require().Nil(common.InitTypeRegistries(suite.DB))
+}
+
+func (suite *CapturesSuite) TearDownSuite() {
+	suite.Require().Nil(suite.DestroyTestDB())
+}
+
+func (suite *CapturesSuite) SetupTest() {
+	var err error
+	suite.tx, err = suite.DB.Begin()
+	suite.Require().Nil(err)
+}
+
+func (suite *CapturesSuite) TearDownTest() {
+	err := suite.tx.Rollback()
+	suite.Require().Nil(err)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestCaptures(t *testing.T) {
+	suite.Run(t, new(CapturesSuite))
+}
+
+func (suite *CapturesSuite) TestStartStopPairing() {
+	// matched by workflow_id
+	startA := suite.captureStart("c100000001", "mltcap", "abcdefgh")
+	// matched by capture_source and collection_uid
+	startB := suite.captureStart("", "archcap", "bcdefghi")
+
+	stopA, evnts := suite.captureStop("c100000001", "mltcap", "other123", "0123456789abcdef0123456789abcdef01234567")
+	suite.Empty(evnts, "stop A events")
+	stopB, evnts := suite.captureStop("", "archcap", "bcdefghi", "0123456789abcdef0123456789abcdef01234568")
+	suite.Empty(evnts, "stop B events")
+
+	sessions := suite.sessions()
+	suite.Require().Len(sessions, 2, "sessions")
+	suite.Equal(startA.ID, sessions[0].StartOperationID.Int64, "A: start")
+	suite.Equal(stopA.ID, sessions[0].StopOperationID.Int64, "A: stop")
+	suite.True(sessions[0].StoppedAt.Valid, "A: stopped_at")
+	suite.Equal(startB.ID, sessions[1].StartOperationID.Int64, "B: start")
+	suite.Equal(stopB.ID, sessions[1].StopOperationID.Int64, "B: stop")
+
+	// stop without start
+	stopC, evnts := suite.captureStop("c100000009", "mltcap", "abcdefgh", "0123456789abcdef0123456789abcdef01234569")
+	if suite.Len(evnts, 1, "stop C events") {
+		suite.Equal(events.E_CAPTURE_STOP_WITHOUT_START, evnts[0].Type, "stop C event type")
+		suite.Equal(stopC.ID, evnts[0].Payload["id"], "stop C event operation")
+	}
+
+	sessions = suite.sessions()
+	suite.Require().Len(sessions, 3, "sessions")
+	suite.False(sessions[2].StartOperationID.Valid, "C: start")
+	suite.Equal(stopC.ID, sessions[2].StopOperationID.Int64, "C: stop")
+	suite.True(sessions[2].AlertedAt.Valid, "C: alerted_at")
+
+	active, herr := handleActiveCaptures(suite.tx, time.Hour)
+	suite.Require().Nil(herr)
+	suite.Empty(active, "active captures")
+}
+
+func (suite *CapturesSuite) TestCheckStaleCaptures() {
+	stale := suite.captureStart("c100000001", "mltcap", "abcdefgh")
+	fresh := suite.captureStart("c100000002", "mltcap", "bcdefghi")
+	stopped := suite.captureStart("c100000003", "mltcap", "cdefghij")
+	suite.captureStop("c100000003", "mltcap", "cdefghij", "0123456789abcdef0123456789abcdef01234567")
+
+	_, err := queries.Raw(suite.tx,
+		`UPDATE capture_sessions SET started_at = started_at - interval '2 hours' WHERE start_operation_id IN ($1, $2)`,
+		stale.ID, stopped.ID).
+		Exec()
+	suite.Require().Nil(err)
+
+	evnts, err := CheckStaleCaptures(suite.tx, time.Hour)
+	suite.Require().Nil(err)
+	if suite.Len(evnts, 1, "stale events") {
+		suite.Equal(events.E_CAPTURE_STALE, evnts[0].Type, "event type")
+		suite.Equal("c100000001", evnts[0].Payload["workflow_id"], "event workflow_id")
+	}
+
+	// alerted only once
+	evnts, err = CheckStaleCaptures(suite.tx, time.Hour)
+	suite.Require().Nil(err)
+	suite.Empty(evnts, "stale events on second check")
+
+	active, herr := handleActiveCaptures(suite.tx, time.Hour)
+	suite.Require().Nil(herr)
+	suite.Require().Len(active, 2, "active captures")
+	suite.Equal(stale.ID, active[0].StartOperationID.Int64, "oldest first")
+	suite.True(active[0].Stale, "stale")
+	suite.True(active[0].AlertedAt.Valid, "stale: alerted_at")
+	suite.Equal(fresh.ID, active[1].StartOperationID.Int64, "fresh")
+	suite.False(active[1].Stale, "fresh: stale")
+	suite.False(active[1].AlertedAt.Valid, "fresh: alerted_at")
+}
+
+func (suite *CapturesSuite) captureStart(workflowID, captureSource, collectionUID string) *models.Operation {
+	op, _, err := handleCaptureStart(suite.tx, CaptureStartRequest{
+		Operation: Operation{
+			Station:    "Capture station",
+			User:       "operator@dev.com",
+			WorkflowID: workflowID,
+		},
+		FileName:      "heb_o_rav_2016-09-14_lesson.mp4",
+		CaptureSource: captureSource,
+		CollectionUID: collectionUID,
+	})
+	suite.Require().Nil(err)
+	return op
+}
+
+func (suite *CapturesSuite) captureStop(workflowID, captureSource, collectionUID, sha1 string) (*models.Operation, []events.Event) {
+	op, evnts, err := handleCaptureStop(suite.tx, CaptureStopRequest{
+		Operation: Operation{
+			Station:    "Capture station",
+			User:       "operator@dev.com",
+			WorkflowID: workflowID,
+		},
+		File: File{
+			FileName:  "heb_o_rav_2016-09-14_lesson.mp4",
+			Sha1:      sha1,
+			Size:      98737,
+			CreatedAt: &Timestamp{Time: time.Now()},
+		},
+		CaptureSource: captureSource,
+		CollectionUID: collectionUID,
+	})
+	suite.Require().Nil(err)
+	return op, evnts
+}
+
+func (suite *CapturesSuite) sessions() []*CaptureSession {
+	var sessions []*CaptureSession
+	err := queries.Raw(suite.tx, `SELECT * FROM capture_sessions ORDER BY id`).Bind(&sessions)
+	suite.Require().Nil(err)
+	return sessions
+}
@@ -43,9 +43,14 @@ func NewInternalError(err error) *HttpError {
 
 type FileNotFound struct {
 	Sha1 string
+	Algo string
+	Hash string
 }
 
 func (x FileNotFound) Error() string {
+	if x.Algo != "" {
+		return fmt.Sprintf("File not found, %s = %s", x.Algo, x.Hash)
+	}
 	return fmt.Sprintf("File not found, sha1 = %s", x.Sha1)
 }
 
@@ -64,4 +69,12 @@ type CollectionNotFound struct {
 
 func (x CollectionNotFound) Error() string {
 	return fmt.Sprintf("Collection not found, CaptureID = %s", x.CaptureID)
-}
\ No newline at end of file
+}
+
+type WorkflowNotFound struct {
+	WorkflowID string
+}
+
+func (x WorkflowNotFound) Error() string {
+	return fmt.Sprintf("Workflow not found, workflow_id = %s", x.WorkflowID)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// Fixity status of a file copy on a storage (files_storages.fixity_status)
+const (
+	FIXITY_STATUS_OK       = "ok"
+	FIXITY_STATUS_MISMATCH = "mismatch"
+	FIXITY_STATUS_MISSING  = "missing"
+)
+
+const (
+	FIXITY_FORMAT_CSV  = "csv"
+	FIXITY_FORMAT_JSON = "json"
+)
+
+// Columns expected in the header row of a csv fixity report.
+// verified_sha1 is empty when the storage node could not read the file.
+// verified_at is RFC3339, defaults to the time of ingest.
+var FIXITY_CSV_COLUMNS = []string{"storage", "sha1", "verified_sha1", "verified_at"}
+
+// FixityRecord is a single line in a fixity report sent by a storage node.
+// Sha1 identifies the copy (storage keeps files by sha1) and VerifiedSha1 is what the node computed.
+type FixityRecord struct {
+	Storage      string    `json:"storage"`
+	Sha1         string    `json:"sha1"`
+	VerifiedSha1 string    `json:"verified_sha1"`
+	VerifiedAt   time.Time `json:"verified_at"`
+}
+
+type FixityMismatch struct {
+	FileID       int64  `json:"file_id"`
+	Storage      string `json:"storage"`
+	Sha1         string `json:"sha1"`
+	VerifiedSha1 string `json:"verified_sha1"`
+}
+
+type FixityReportResponse struct {
+	Total      int               `json:"total"`
+	OK         int               `json:"ok"`
+	Mismatch   int               `json:"mismatch"`
+	Missing    int               `json:"missing"`
+	Unknown    int               `json:"unknown"` // unknown storage, file or copy
+	Mismatches []*FixityMismatch `json:"mismatches"`
+}
+
+// StorageFixity is the last verification of a file copy on a storage
+type StorageFixity struct {
+	VerifiedAt   time.Time   `json:"verified_at"`
+	VerifiedSha1 null.String `json:"verified_sha1"`
+	Status       string      `json:"status"`
+}
+
+// Ingest a fixity report from a storage node.
+// Report format is taken from the format query param or the request's content type (csv or json).
+func FixityReportsHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	format := c.Query("format")
+	if format == "" {
+		if strings.Contains(c.ContentType(), "csv") {
+			format = FIXITY_FORMAT_CSV
+		} else {
+			format = FIXITY_FORMAT_JSON
+		}
+	}
+
+	records, err := ParseFixityReport(c.Request.Body, format)
+	if err != nil {
+		NewBadRequestError(err).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, evnts, err := IngestFixityReport(tx, records)
+	var herr *HttpError
+	if err != nil {
+		herr = NewInternalError(err)
+	}
+	mustConcludeTx(tx, herr)
+
+	if herr == nil {
+		emitEvents(c, evnts...)
+	}
+
+	concludeRequest(c, resp, herr)
+}
+
+// ParseFixityReport reads fixity records in csv (with header row) or json (array of records) format.
+func ParseFixityReport(r io.Reader, format string) ([]*FixityRecord, error) {
+	var records []*FixityRecord
+
+	switch format {
+	case FIXITY_FORMAT_JSON:
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, errors.Wrap(err, "json.Decode")
+		}
+	case FIXITY_FORMAT_CSV:
+		var err error
+		records, err = parseFixityCSV(r)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("Unknown fixity report format %s", format)
+	}
+
+	for i, x := range records {
+		x.Storage = strings.TrimSpace(x.Storage)
+		x.Sha1 = strings.ToLower(strings.TrimSpace(x.Sha1))
+		x.VerifiedSha1 = strings.ToLower(strings.TrimSpace(x.VerifiedSha1))
+		if x.Storage == "" {
+			return nil, errors.Errorf("record %d: missing storage", i+1)
+		}
+		if err := ValidateHash(HASH_SHA1, x.Sha1); err != nil {
+			return nil, errors.Wrapf(err, "record %d: sha1", i+1)
+		}
+		if x.VerifiedSha1 != "" {
+			if err := ValidateHash(HASH_SHA1, x.VerifiedSha1); err != nil {
+				return nil, errors.Wrapf(err, "record %d: verified_sha1", i+1)
+			}
+		}
+	}
+
+	return records, nil
+}
+
+func parseFixityCSV(r io.Reader) ([]*FixityRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "Read csv header")
+	}
+	idx := make(map[string]int, len(header))
+	for i, h := range header {
+		idx[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, col := range FIXITY_CSV_COLUMNS[:3] {
+		if _, ok := idx[col]; !ok {
+			return nil, errors.Errorf("Missing csv column %s", col)
+		}
+	}
+
+	records := make([]*FixityRecord, 0)
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Read csv row")
+		}
+
+		x := &FixityRecord{
+			Storage:      row[idx["storage"]],
+			Sha1:         row[idx["sha1"]],
+			VerifiedSha1: row[idx["verified_sha1"]],
+		}
+		if i, ok := idx["verified_at"]; ok && strings.TrimSpace(row[i]) != "" {
+			x.VerifiedAt, err = time.Parse(time.RFC3339, strings.TrimSpace(row[i]))
+			if err != nil {
+				return nil, errors.Wrapf(err, "record %d: verified_at", len(records)+1)
+			}
+		}
+		records = append(records, x)
+	}
+
+	return records, nil
+}
+
+// Status of a fixity record given the file's sha1 in MDB
+func (x *FixityRecord) Status(sha1 string) string {
+	if x.VerifiedSha1 == "" {
+		return FIXITY_STATUS_MISSING
+	}
+	if x.VerifiedSha1 != sha1 {
+		return FIXITY_STATUS_MISMATCH
+	}
+	return FIXITY_STATUS_OK
+}
+
+// IngestFixityReport updates the verification columns of known file copies.
+// Records of unknown storages, files or copies are counted and skipped.
+// Returns a FILE_FIXITY_MISMATCH event for every copy whose hash doesn't match MDB's sha1.
+func IngestFixityReport(exec boil.Executor, records []*FixityRecord) (*FixityReportResponse, []events.Event, error) {
+	resp := &FixityReportResponse{
+		Total:      len(records),
+		Mismatches: make([]*FixityMismatch, 0),
+	}
+	evnts := make([]events.Event, 0)
+	if len(records) == 0 {
+		return resp, evnts, nil
+	}
+
+	storages, err := models.Storages(exec).All()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load storages")
+	}
+	storagesByName := make(map[string]*models.Storage, len(storages))
+	for _, s := range storages {
+		storagesByName[s.Name] = s
+	}
+
+	files, err := loadFilesBySha1(exec, records)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	for _, x := range records {
+		s, ok := storagesByName[x.Storage]
+		if !ok {
+			resp.Unknown++
+			continue
+		}
+		f, ok := files[x.Sha1]
+		if !ok {
+			resp.Unknown++
+			continue
+		}
+
+		status := x.Status(hex.EncodeToString(f.Sha1.Bytes))
+		verifiedAt := x.VerifiedAt
+		if verifiedAt.IsZero() {
+			verifiedAt = now
+		}
+		var verifiedSha1 []byte
+		if x.VerifiedSha1 != "" {
+			verifiedSha1, _ = hex.DecodeString(x.VerifiedSha1)
+		}
+
+		res, err := queries.Raw(exec,
+			`UPDATE files_storages SET verified_at = $1, verified_sha1 = $2, fixity_status = $3
+WHERE file_id = $4 AND storage_id = $5`,
+			verifiedAt, verifiedSha1, status, f.ID, s.ID).Exec()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Update files_storages [%d, %d]", f.ID, s.ID)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, nil, errors.Wrap(err, "RowsAffected")
+		} else if n == 0 {
+			resp.Unknown++
+			continue
+		}
+
+		switch status {
+		case FIXITY_STATUS_OK:
+			resp.OK++
+		case FIXITY_STATUS_MISSING:
+			resp.Missing++
+		case FIXITY_STATUS_MISMATCH:
+			resp.Mismatch++
+			resp.Mismatches = append(resp.Mismatches, &FixityMismatch{
+				FileID:       f.ID,
+				Storage:      s.Name,
+				Sha1:         x.Sha1,
+				VerifiedSha1: x.VerifiedSha1,
+			})
+			evnts = append(evnts, events.FileFixityMismatchEvent(f, s, x.VerifiedSha1))
+		}
+	}
+
+	return resp, evnts, nil
+}
+
+func loadFilesBySha1(exec boil.Executor, records []*FixityRecord) (map[string]*models.File, error) {
+	seen := make(map[string]bool, len(records))
+	sha1s := make([][]byte, 0, len(records))
+	for _, x := range records {
+		if seen[x.Sha1] {
+			continue
+		}
+		seen[x.Sha1] = true
+		b, _ := hex.DecodeString(x.Sha1)
+		sha1s = append(sha1s, b)
+	}
+
+	files, err := models.Files(exec, qm.Where("sha1 = ANY(?)", pq.ByteaArray(sha1s))).All()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load files by sha1")
+	}
+
+	m := make(map[string]*models.File, len(files))
+	for _, f := range files {
+		m[hex.EncodeToString(f.Sha1.Bytes)] = f
+	}
+
+	return m, nil
+}
+
+// FindFileStoragesFixity returns the last verification of a file's copies keyed by storage id.
+func FindFileStoragesFixity(exec boil.Executor, fileID int64) (map[int64]*StorageFixity, error) {
+	rows, err := queries.Raw(exec, `SELECT storage_id, verified_at, verified_sha1, fixity_status
+FROM files_storages WHERE file_id = $1 AND verified_at IS NOT NULL`, fileID).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load files_storages fixity")
+	}
+	defer rows.Close()
+
+	m := make(map[int64]*StorageFixity)
+	for rows.Next() {
+		var sID int64
+		var verifiedSha1 []byte
+		var status sql.NullString
+		x := new(StorageFixity)
+		if err := rows.Scan(&sID, &x.VerifiedAt, &verifiedSha1, &status); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		if verifiedSha1 != nil {
+			x.VerifiedSha1 = null.StringFrom(hex.EncodeToString(verifiedSha1))
+		}
+		x.Status = status.String
+		m[sID] = x
+	}
+
+	return m, errors.Wrap(rows.Err(), "Iterate rows")
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFixityReport(t *testing.T) {
+	sha1 := strings.Repeat("ab", 20)
+	other := strings.Repeat("cd", 20)
+
+	csvReport := "storage,sha1,verified_sha1,verified_at\n" +
+		"il-1," + strings.ToUpper(sha1) + "," + sha1 + ",2026-10-01T10:00:00Z\n" +
+		"il-2," + sha1 + "," + other + ",\n" +
+		"de-1," + sha1 + ",,\n"
+	records, err := ParseFixityReport(strings.NewReader(csvReport), FIXITY_FORMAT_CSV)
+	if assert.Nil(t, err) && assert.Len(t, records, 3) {
+		assert.Equal(t, "il-1", records[0].Storage)
+		assert.Equal(t, sha1, records[0].Sha1, "lower case")
+		assert.Equal(t, time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), records[0].VerifiedAt)
+		assert.Equal(t, FIXITY_STATUS_OK, records[0].Status(sha1))
+		assert.True(t, records[1].VerifiedAt.IsZero())
+		assert.Equal(t, FIXITY_STATUS_MISMATCH, records[1].Status(sha1))
+		assert.Equal(t, FIXITY_STATUS_MISSING, records[2].Status(sha1))
+	}
+
+	jsonReport := `[{"storage": "il-1", "sha1": "` + sha1 + `", "verified_sha1": "` + other + `", "verified_at": "2026-10-01T10:00:00Z"}]`
+	records, err = ParseFixityReport(strings.NewReader(jsonReport), FIXITY_FORMAT_JSON)
+	if assert.Nil(t, err) && assert.Len(t, records, 1) {
+		assert.Equal(t, other, records[0].VerifiedSha1)
+	}
+
+	_, err = ParseFixityReport(strings.NewReader("storage,sha1\nil-1,"+sha1+"\n"), FIXITY_FORMAT_CSV)
+	assert.NotNil(t, err, "missing column")
+	_, err = ParseFixityReport(strings.NewReader("storage,sha1,verified_sha1\nil-1,xyz,\n"), FIXITY_FORMAT_CSV)
+	assert.NotNil(t, err, "bad sha1")
+	_, err = ParseFixityReport(strings.NewReader(`[{"sha1": "`+sha1+`"}]`), FIXITY_FORMAT_JSON)
+	assert.NotNil(t, err, "missing storage")
+	_, err = ParseFixityReport(strings.NewReader(""), "xml")
+	assert.NotNil(t, err, "unknown format")
+}
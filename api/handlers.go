@@ -20,6 +20,7 @@ import (
 	"github.com/Bnei-Baruch/mdb/common"
 	"github.com/Bnei-Baruch/mdb/events"
 	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/subtitles"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
@@ -235,7 +236,12 @@ func handleCaptureStart(exec boil.Executor, input interface{}) (*models.Operatio
 		UID:  uid,
 		Name: r.FileName,
 	}
-	return operation, nil, operation.AddFiles(exec, true, &file)
+	if err := operation.AddFiles(exec, true, &file); err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("Starting capture session")
+	return operation, nil, startCaptureSession(exec, operation, r)
 }
 
 func handleCaptureStop(exec boil.Executor, input interface{}) (*models.Operation, []events.Event, error) {
@@ -285,7 +291,19 @@ func handleCaptureStop(exec boil.Executor, input interface{}) (*models.Operation
 	}
 
 	log.Info("Associating file to operation")
-	return operation, nil, operation.AddFiles(exec, false, file)
+	if err := operation.AddFiles(exec, false, file); err != nil {
+		return nil, nil, err
+	}
+
+	log.Info("Stopping capture session")
+	evnt, err := stopCaptureSession(exec, operation, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if evnt != nil {
+		return operation, []events.Event{*evnt}, nil
+	}
+	return operation, nil, nil
 }
 
 func handleDemux(exec boil.Executor, input interface{}) (*models.Operation, []events.Event, error) {
@@ -311,6 +329,9 @@ func handleDemux(exec boil.Executor, input interface{}) (*models.Operation, []ev
 	props = map[string]interface{}{
 		"duration": r.Original.Duration,
 	}
+	if err := probeAVFile(r.Original, "", props); err != nil {
+		return nil, nil, err
+	}
 	original, err := CreateFile(exec, parent, r.Original.File, props)
 	if err != nil {
 		return nil, nil, err
@@ -322,6 +343,9 @@ func handleDemux(exec boil.Executor, input interface{}) (*models.Operation, []ev
 		props = map[string]interface{}{
 			"duration": r.Proxy.Duration,
 		}
+		if err := probeAVFile(*r.Proxy, "", props); err != nil {
+			return nil, nil, err
+		}
 		proxy, err := CreateFile(exec, parent, r.Proxy.File, props)
 		if err != nil {
 			return nil, nil, err
@@ -372,6 +396,9 @@ func handleTrim(exec boil.Executor, input interface{}) (*models.Operation, []eve
 	props = map[string]interface{}{
 		"duration": r.Original.Duration,
 	}
+	if err := probeAVFile(r.Original, "", props); err != nil {
+		return nil, nil, err
+	}
 	originalTrim, err := CreateFile(exec, original, r.Original.File, props)
 	if err != nil {
 		return nil, nil, err
@@ -383,6 +410,9 @@ func handleTrim(exec boil.Executor, input interface{}) (*models.Operation, []eve
 		props = map[string]interface{}{
 			"duration": r.Proxy.Duration,
 		}
+		if err := probeAVFile(*r.Proxy, "", props); err != nil {
+			return nil, nil, err
+		}
 		proxyTrim, err := CreateFile(exec, proxy, r.Proxy.File, props)
 		if err != nil {
 			return nil, nil, err
@@ -399,11 +429,36 @@ func handleTrim(exec boil.Executor, input interface{}) (*models.Operation, []eve
 func handleSend(exec boil.Executor, input interface{}) (*models.Operation, []events.Event, error) {
 	r := input.(SendRequest)
 
+	if err := validateSendFileName("original", &r.Original); err != nil {
+		return nil, nil, err
+	}
+	if r.Proxy != nil {
+		if err := validateSendFileName("proxy", r.Proxy); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	mode := "new"
+	if r.Mode.Valid {
+		mode = r.Mode.String
+	}
+
 	// Original
 	original, _, err := FindFileBySHA1(exec, r.Original.Sha1)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Lookup original file")
 	}
+
+	// Keep a snapshot of everything we're about to change so we could revert it later on
+	var snapshot *OperationSnapshot
+	if mode == "new" {
+		log.Info("Taking revert snapshot")
+		snapshot, err = takeSendSnapshot(exec, r.Metadata, original, nil)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Take revert snapshot")
+		}
+	}
+
 	if original.Name == r.Original.FileName {
 		log.Info("Original's name hasn't change")
 	} else {
@@ -424,6 +479,11 @@ func handleSend(exec boil.Executor, input interface{}) (*models.Operation, []eve
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "Lookup proxy file")
 		}
+		if snapshot != nil {
+			if err := snapshot.addFiles(exec, proxy.ID); err != nil {
+				return nil, nil, errors.Wrap(err, "Add proxy to revert snapshot")
+			}
+		}
 		opFiles = append(opFiles, proxy)
 		if proxy.Name == r.Proxy.FileName {
 			log.Info("Proxy's name hasn't change")
@@ -439,11 +499,6 @@ func handleSend(exec boil.Executor, input interface{}) (*models.Operation, []eve
 		log.Info("Proxy not provided. Skipping possible rename")
 	}
 
-	mode := "new"
-	if r.Mode.Valid {
-		mode = r.Mode.String
-	}
-
 	log.Infof("Processing CIT Metadata: %s mode", mode)
 	var evnts []events.Event
 	if mode == "new" {
@@ -464,6 +519,13 @@ func handleSend(exec boil.Executor, input interface{}) (*models.Operation, []eve
 	if err = json.Unmarshal(b, &props); err != nil {
 		return nil, nil, errors.Wrap(err, "json Unmarshal")
 	}
+	if snapshot != nil {
+		snapshot.CreatedUnits = []int64{original.ContentUnitID.Int64}
+		if err := snapshot.conclude(exec, evnts); err != nil {
+			return nil, nil, errors.Wrap(err, "Conclude revert snapshot")
+		}
+		props[REVERT_SNAPSHOT_KEY] = snapshot
+	}
 	operation, err := CreateOperation(exec, common.OP_SEND, r.Operation, props)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Create operation")
@@ -487,6 +549,23 @@ func handleSend(exec boil.Executor, input interface{}) (*models.Operation, []eve
 		return nil, nil, errors.Wrapf(err, "unit workflow_id: %d", original.ContentUnitID.Int64)
 	}
 
+	if mode == "new" {
+		log.Info("Seeding unit segments from trim")
+		trim, err := FindTrimOperation(exec, original.ID)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Find trim operation")
+		}
+		if trim != nil {
+			seeded, err := SeedContentUnitSegments(exec, original.R.ContentUnit, trim)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "Seed unit segments: %d", original.ContentUnitID.Int64)
+			}
+			if seeded {
+				evnts = append(evnts, events.ContentUnitSegmentsChangeEvent(original.R.ContentUnit))
+			}
+		}
+	}
+
 	return operation, evnts, nil
 }
 
@@ -535,14 +614,18 @@ func handleConvert(exec boil.Executor, input interface{}) (*models.Operation, []
 	evnts := make([]events.Event, 0)
 	files := make([]*models.File, len(uniq)+1)
 	files[0] = in
-	props := make(map[string]interface{})
 	i := 0
 	for _, v := range uniq {
 		x := r.Output[v]
-		props["duration"] = x.Duration
+		props := map[string]interface{}{
+			"duration": x.Duration,
+		}
 		if x.VideoSize != "" {
 			props["video_size"] = x.VideoSize
 		}
+		if err := probeAVFile(x, "", props); err != nil {
+			return nil, nil, err
+		}
 
 		// lookup by sha1 as it might be a "reconvert"
 		f, _, err := FindFileBySHA1(exec, x.Sha1)
@@ -615,6 +698,9 @@ func handleUpload(exec boil.Executor, input interface{}) (*models.Operation, []e
 	}
 	fileProps["url"] = r.Url
 	fileProps["duration"] = r.Duration
+	if err := probeAVFile(r.AVFile, "", fileProps); err != nil {
+		return nil, nil, err
+	}
 	fpa, _ := json.Marshal(fileProps)
 	file.Properties = null.JSONFrom(fpa)
 
@@ -741,6 +827,21 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 		log.Infof("Found content unit %d", cu.ID)
 	}
 
+	// Keep a snapshot of existing units we might change so we could revert it later on
+	var snapshot *OperationSnapshot
+	if r.Mode == "new" {
+		snapshot = new(OperationSnapshot)
+		if cu != nil {
+			cuIDs := []int64{cu.ID}
+			for _, cud := range cu.R.SourceContentUnitDerivations {
+				cuIDs = append(cuIDs, cud.DerivedID)
+			}
+			if err := snapshot.addUnits(exec, cuIDs...); err != nil {
+				return nil, nil, errors.Wrap(err, "Take revert snapshot")
+			}
+		}
+	}
+
 	var parent *models.File
 	if r.ParentSha1 != "" {
 		log.Info("Looking up parent file by sha1")
@@ -756,6 +857,15 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 		}
 	}
 
+	var subsReport *subtitles.Report
+	if r.InsertType == "subtitles" || r.InsertType == "transcript" {
+		log.Infof("%s, validating local file", r.InsertType)
+		subsReport, err = validateSubtitlesInsert(r, cu)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	log.Info("Creating operation")
 	props := map[string]interface{}{
 		"insert_type": r.InsertType,
@@ -770,7 +880,7 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 	log.Info("Processing metadata")
 	if r.File.Type == "" {
 		switch r.InsertType {
-		case "akladot", "tamlil", "kitei-makor", "article":
+		case "akladot", "tamlil", "kitei-makor", "article", "subtitles", "transcript":
 			r.File.Type = "text"
 		case "sirtutim", "publication":
 			r.File.Type = "image"
@@ -787,6 +897,19 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 	if r.AVFile.VideoSize != "" {
 		props["video_size"] = r.AVFile.VideoSize
 	}
+	if r.File.Type == "video" || r.File.Type == "audio" {
+		if err := probeAVFile(r.AVFile, r.LocalPath, props); err != nil {
+			return nil, nil, err
+		}
+	}
+	if r.InsertType == "subtitles" || r.InsertType == "transcript" {
+		if r.File.SubType == "" {
+			r.File.SubType = r.InsertType
+		}
+		if subsReport != nil {
+			props["subtitles"] = subsReport
+		}
+	}
 
 	// create new file based on mode
 	if r.Mode == "new" || r.Mode == "update" {
@@ -818,6 +941,13 @@ func handleInsert(exec boil.Executor, input interface{}) (*models.Operation, []e
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "Update file")
 		}
+
+		if r.File.Sha256 != "" {
+			err = SaveFileHash(exec, file.ID, HASH_SHA256, r.File.Sha256)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "Save sha256")
+			}
+		}
 	}
 
 	opFiles = append(opFiles, file)
@@ -994,6 +1124,22 @@ FROM content_units cu
 		}
 	}
 
+	if snapshot != nil {
+		snapshot.CreatedFiles = []int64{file.ID}
+		if file.ContentUnitID.Valid && !snapshot.hasUnit(file.ContentUnitID.Int64) {
+			snapshot.CreatedUnits = []int64{file.ContentUnitID.Int64}
+		}
+		if err := snapshot.conclude(exec, evnts); err != nil {
+			return nil, nil, errors.Wrap(err, "Conclude revert snapshot")
+		}
+		err = UpdateOperationProperties(exec, operation, map[string]interface{}{
+			REVERT_SNAPSHOT_KEY: snapshot,
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Save revert snapshot")
+		}
+	}
+
 	log.Info("Associating files to operation")
 	return operation, evnts, operation.AddFiles(exec, false, opFiles...)
 }
@@ -1038,10 +1184,10 @@ func handleTranscode(exec boil.Executor, input interface{}) (*models.Operation,
 			return nil, nil, errors.Wrapf(err, "Lookup original file %s", r.OriginalSha1)
 		}
 
-		log.Info("Updating queue table")
-		_, err = queries.Raw(exec, "update batch_convert set operation_id=$1 where file_id=$2", operation.ID, original.ID).Exec()
+		log.Info("Updating transcode queue")
+		err = FailTranscodeItem(exec, original.ID, null.Int64From(operation.ID), r.Message)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "Update queue table")
+			return nil, nil, err
 		}
 
 		return operation, nil, operation.AddFiles(exec, false, original)
@@ -1095,10 +1241,10 @@ func handleTranscode(exec boil.Executor, input interface{}) (*models.Operation,
 		return nil, nil, errors.Wrapf(err, "Update secure published [%d]", file.ID)
 	}
 
-	log.Info("Updating queue table")
-	_, err = queries.Raw(exec, "update batch_convert set operation_id=$1 where file_id=$2", operation.ID, original.ID).Exec()
+	log.Info("Updating transcode queue")
+	err = CompleteTranscodeItem(exec, original.ID, operation.ID)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "Update queue table")
+		return nil, nil, err
 	}
 
 	opFiles := []*models.File{original, file}
@@ -1167,6 +1313,9 @@ func handleJoin(exec boil.Executor, input interface{}) (*models.Operation, []eve
 	props = map[string]interface{}{
 		"duration": r.Original.Duration,
 	}
+	if err := probeAVFile(r.Original, "", props); err != nil {
+		return nil, nil, err
+	}
 	original, err := CreateFile(exec, nil, r.Original.File, props)
 	if err != nil {
 		return nil, nil, err
@@ -1178,6 +1327,9 @@ func handleJoin(exec boil.Executor, input interface{}) (*models.Operation, []eve
 		props = map[string]interface{}{
 			"duration": r.Proxy.Duration,
 		}
+		if err := probeAVFile(*r.Proxy, "", props); err != nil {
+			return nil, nil, err
+		}
 		proxy, err := CreateFile(exec, nil, r.Proxy.File, props)
 		if err != nil {
 			return nil, nil, err
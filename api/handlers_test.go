@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"net/http"
 	"testing"
 	"time"
 
@@ -528,11 +529,11 @@ func (suite *HandlersSuite) TestHandleSend() {
 		},
 		Original: Rename{
 			Sha1:     ofi.Sha1,
-			FileName: "original_renamed.mp4",
+			FileName: "heb_o_rav_2016-09-14_lesson_renamed_o.mp4",
 		},
 		Proxy: &Rename{
 			Sha1:     pfi.Sha1,
-			FileName: "proxy_renamed.mp4",
+			FileName: "heb_o_rav_2016-09-14_lesson_renamed_p.mp4",
 		},
 		Metadata: CITMetadata{
 			ContentType: common.CT_LESSON_PART,
@@ -594,7 +595,7 @@ func (suite *HandlersSuite) TestHandleSendNoProxy() {
 		},
 		Original: Rename{
 			Sha1:     ofi.Sha1,
-			FileName: "original_renamed.mp4",
+			FileName: "heb_o_rav_2016-09-14_lesson_renamed_o.mp4",
 		},
 		Metadata: CITMetadata{
 			ContentType: common.CT_LESSON_PART,
@@ -631,6 +632,61 @@ func (suite *HandlersSuite) TestHandleSendNoProxy() {
 	suite.Equal(input.Original.Sha1, hex.EncodeToString(original.Sha1.Bytes), "Original: SHA1")
 }
 
+func (suite *HandlersSuite) TestHandleSendRevert() {
+	// Create dummy original trimmed file
+	ofi := File{
+		FileName:  "dummy original trimmed file",
+		CreatedAt: &Timestamp{time.Now()},
+		Sha1:      "012356789abcdef012356789abcdef9876543210",
+		Size:      math.MaxInt64,
+	}
+	_, err := CreateFile(suite.tx, nil, ofi, nil)
+	suite.Require().Nil(err)
+
+	// Do send operation
+	input := SendRequest{
+		Operation: Operation{
+			Station:    "Trimmer station",
+			User:       "operator@dev.com",
+			WorkflowID: "t123456789",
+		},
+		Original: Rename{
+			Sha1:     ofi.Sha1,
+			FileName: "heb_o_rav_2016-09-14_lesson_renamed_o.mp4",
+		},
+		Metadata: CITMetadata{
+			ContentType: common.CT_LESSON_PART,
+		},
+	}
+
+	op, _, err := handleSend(suite.tx, input)
+	suite.Require().Nil(err)
+
+	original, _, err := FindFileBySHA1(suite.tx, ofi.Sha1)
+	suite.Require().Nil(err)
+	suite.Require().True(original.ContentUnitID.Valid, "Original: ContentUnitID")
+	cuID := original.ContentUnitID.Int64
+
+	// Revert
+	_, evnts, herr := handleRevertOperation(suite.tx, op.ID)
+	suite.Require().Nil(herr)
+	suite.NotEmpty(evnts)
+
+	original, _, err = FindFileBySHA1(suite.tx, ofi.Sha1)
+	suite.Require().Nil(err)
+	suite.Equal(ofi.FileName, original.Name, "Original: Name")
+	suite.False(original.ContentUnitID.Valid, "Original: ContentUnitID")
+
+	exists, err := models.ContentUnitExists(suite.tx, cuID)
+	suite.Require().Nil(err)
+	suite.False(exists, "Content unit exists")
+
+	// Revert twice
+	_, _, herr = handleRevertOperation(suite.tx, op.ID)
+	suite.Require().NotNil(herr)
+	suite.Equal(http.StatusBadRequest, herr.Code, "Revert twice")
+}
+
 func (suite *HandlersSuite) TestHandleConvert() {
 	// Create dummy input file
 	fi := File{
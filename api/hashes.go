@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// File identity hashes.
+// sha1 lives in files.sha1 while all others are kept in the file_hashes table.
+const (
+	HASH_SHA1   = "sha1"
+	HASH_SHA256 = "sha256"
+)
+
+// Length of hex encoded hashes by algorithm, only algorithms we store
+var HASH_HEX_LENGTHS = map[string]int{
+	HASH_SHA1:   40,
+	HASH_SHA256: 64,
+}
+
+type FileWithHashes struct {
+	*MFile
+	Hashes map[string]string `json:"hashes"`
+}
+
+func FileByHashHandler(c *gin.Context) {
+	resp, err := handleFileByHash(c, c.MustGet("MDB").(*sql.DB), c.Param("algo"), c.Param("hash"))
+	concludeRequest(c, resp, err)
+}
+
+func handleFileByHash(cp utils.ContextProvider, exec boil.Executor, algo string, hash string) (*FileWithHashes, *HttpError) {
+	algo = strings.ToLower(algo)
+	hash = strings.ToLower(hash)
+	if err := ValidateHash(algo, hash); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	file, err := FindFileByHash(exec, algo, hash)
+	if err != nil {
+		if _, ok := err.(FileNotFound); ok {
+			return nil, NewNotFoundError()
+		}
+		return nil, NewInternalError(err)
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(file.Secure), common.PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	hashes, err := FindFileHashes(exec, file)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &FileWithHashes{
+		MFile:  NewMFile(file),
+		Hashes: hashes,
+	}, nil
+}
+
+// ValidateHash checks the algorithm is known and the hash is hex encoded in the right length.
+func ValidateHash(algo string, hash string) error {
+	l, ok := HASH_HEX_LENGTHS[algo]
+	if !ok {
+		return errors.Errorf("Unknown hash algorithm %s", algo)
+	}
+	if len(hash) != l {
+		return errors.Errorf("%s expects %d hex characters, got %d", algo, l, len(hash))
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return errors.Wrapf(err, "%s is not hexadecimal", algo)
+	}
+	return nil
+}
+
+// FindFileByHash looks up a file by any of its identity hashes.
+// Returns FileNotFound if no such file exist.
+func FindFileByHash(exec boil.Executor, algo string, hash string) (*models.File, error) {
+	if algo == HASH_SHA1 {
+		f, _, err := FindFileBySHA1(exec, hash)
+		return f, err
+	}
+
+	h, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "hex decode")
+	}
+
+	var f models.File
+	err = queries.Raw(exec,
+		`SELECT f.* FROM files f INNER JOIN file_hashes fh ON f.id = fh.file_id WHERE fh.algo = $1 AND fh.hash = $2`,
+		algo, h).
+		Bind(&f)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, FileNotFound{Algo: algo, Hash: hash}
+		}
+		return nil, errors.Wrap(err, "DB lookup")
+	}
+
+	return &f, nil
+}
+
+// FindFileHashes returns all known hashes of the file keyed by algorithm.
+func FindFileHashes(exec boil.Executor, file *models.File) (map[string]string, error) {
+	hashes := make(map[string]string)
+	if file.Sha1.Valid {
+		hashes[HASH_SHA1] = hex.EncodeToString(file.Sha1.Bytes)
+	}
+
+	rows, err := queries.Raw(exec, `SELECT algo, hash FROM file_hashes WHERE file_id = $1`, file.ID).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load file hashes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var algo string
+		var hash []byte
+		if err := rows.Scan(&algo, &hash); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		hashes[algo] = hex.EncodeToString(hash)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return hashes, nil
+}
+
+// SaveFileHash stores an additional identity hash of the file.
+// It's a no-op if we already know this hash and an error if we know a different one.
+func SaveFileHash(exec boil.Executor, fileID int64, algo string, hash string) error {
+	hash = strings.ToLower(hash)
+	if algo == HASH_SHA1 {
+		return errors.New("sha1 is stored on the file itself")
+	}
+	if err := ValidateHash(algo, hash); err != nil {
+		return err
+	}
+
+	h, _ := hex.DecodeString(hash)
+
+	var existing []byte
+	err := queries.Raw(exec,
+		`SELECT hash FROM file_hashes WHERE file_id = $1 AND algo = $2`,
+		fileID, algo).
+		QueryRow().
+		Scan(&existing)
+	if err == nil {
+		if bytes.Equal(existing, h) {
+			return nil
+		}
+		return errors.Errorf("File %d %s mismatch: %s != %s", fileID, algo, hash, hex.EncodeToString(existing))
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing hash")
+	}
+
+	_, err = queries.Raw(exec,
+		`INSERT INTO file_hashes (file_id, algo, hash) VALUES ($1, $2, $3)`,
+		fileID, algo, h).
+		Exec()
+	if err != nil {
+		return errors.Wrapf(err, "Insert %s", algo)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHash(t *testing.T) {
+	assert.Nil(t, ValidateHash(HASH_SHA1, strings.Repeat("a", 40)))
+	assert.Nil(t, ValidateHash(HASH_SHA256, strings.Repeat("b", 64)))
+
+	assert.NotNil(t, ValidateHash(HASH_SHA1, strings.Repeat("a", 64)), "wrong length")
+	assert.NotNil(t, ValidateHash(HASH_SHA256, strings.Repeat("z", 64)), "not hex")
+	assert.NotNil(t, ValidateHash("md5", strings.Repeat("a", 32)), "unknown algorithm")
+	assert.NotNil(t, ValidateHash("blake3", strings.Repeat("a", 64)), "not stored")
+}
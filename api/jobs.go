@@ -0,0 +1,161 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/jobs"
+)
+
+func JobsHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var err *HttpError
+	var resp interface{}
+	db := c.MustGet("MDB").(*sql.DB)
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		var r JobsRequest
+		if c.Bind(&r) != nil {
+			return
+		}
+		resp, err = handleJobsList(db, r)
+	case http.MethodPost:
+		var r JobRequest
+		if c.BindJSON(&r) != nil {
+			return
+		}
+		resp, err = handleStartJob(db, c.MustGet("EVENTS_EMITTER").(events.EventEmitter), r)
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func JobHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	job, err := jobs.FindJob(c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, job, jobsError(err))
+}
+
+func JobLogsHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r JobLogsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+	if r.Limit == 0 {
+		r.Limit = MAX_PAGE_SIZE
+	}
+
+	db := c.MustGet("MDB").(*sql.DB)
+	if _, err := jobs.FindJob(db, id); err != nil {
+		jobsError(err).Abort(c)
+		return
+	}
+
+	logs, err := jobs.FindJobLogs(db, id, r.After, r.Limit)
+	concludeRequest(c, logs, jobsError(err))
+}
+
+// Resume a failed job from its last checkpoint.
+// force=true takes over a job left running by a crashed process.
+func JobResumeHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	job, err := jobs.Resume(c.MustGet("MDB").(*sql.DB), c.MustGet("EVENTS_EMITTER").(events.EventEmitter), id,
+		c.Query("force") == "true")
+	concludeRequest(c, job, jobsError(err))
+}
+
+func JobTypesHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	concludeRequest(c, jobs.Definitions(), nil)
+}
+
+func handleJobsList(exec *sql.DB, r JobsRequest) (*JobsResponse, *HttpError) {
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	total, data, err := jobs.FindJobs(exec, r.Status, r.Type, limit, offset)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &JobsResponse{
+		ListResponse: ListResponse{Total: total},
+		Jobs:         data,
+	}, nil
+}
+
+func handleStartJob(db *sql.DB, emitter events.EventEmitter, r JobRequest) (*jobs.Job, *HttpError) {
+	job, err := jobs.Create(db, r.Type, r.Params)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	job, err = jobs.Resume(db, emitter, job.ID, false)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return job, nil
+}
+
+func jobsError(err error) *HttpError {
+	if err == nil {
+		return nil
+	}
+
+	switch errors.Cause(err).(type) {
+	case jobs.JobNotFound:
+		return NewNotFoundError()
+	case jobs.JobNotClaimable:
+		return NewBadRequestError(err)
+	default:
+		return NewInternalError(err)
+	}
+}
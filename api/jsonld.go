@@ -0,0 +1,63 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/exporter/jsonld"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func ContentUnitJSONLDHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleContentUnitJSONLD(c, c.MustGet("MDB").(*sql.DB), id)
+	if err != nil {
+		err.Abort(c)
+		return
+	}
+
+	b, e := jsonld.Marshal(resp)
+	if e != nil {
+		NewInternalError(e).Abort(c)
+		return
+	}
+	c.Data(http.StatusOK, jsonld.MIME_TYPE+"; charset=utf-8", b)
+}
+
+func handleContentUnitJSONLD(cp utils.ContextProvider, exec boil.Executor, id int64) (jsonld.Node, *HttpError) {
+	mods := append([]qm.QueryMod{qm.Where("id = ?", id)}, jsonld.UnitMods()...)
+	cu, err := models.ContentUnits(exec, mods...).One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(cu.Secure), common.PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	u, err := jsonld.NewUnit(cu, jsonld.NewSourcesCache(exec))
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return jsonld.UnitNode(u, jsonld.Options{BaseURL: viper.GetString("jsonld.base-url")}), nil
+}
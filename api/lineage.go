@@ -0,0 +1,398 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// File lineage export formats
+const (
+	LINEAGE_FORMAT_JSON    = "json"
+	LINEAGE_FORMAT_DOT     = "dot"
+	LINEAGE_FORMAT_MERMAID = "mermaid"
+)
+
+// Lineage node kinds
+const (
+	LINEAGE_NODE_FILE      = "file"
+	LINEAGE_NODE_OPERATION = "operation"
+	LINEAGE_NODE_UNIT      = "content_unit"
+)
+
+// Lineage edge kinds
+const (
+	LINEAGE_EDGE_PARENT    = "parent"    // parent file -> child file
+	LINEAGE_EDGE_OPERATION = "operation" // operation -> file it touched
+	LINEAGE_EDGE_UNIT      = "unit"      // file -> content unit it's assigned to
+)
+
+type LineageFile struct {
+	ID        int64     `json:"id"`
+	UID       string    `json:"uid"`
+	Name      string    `json:"name"`
+	Sha1      string    `json:"sha1,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	SubType   string    `json:"sub_type,omitempty"`
+	Language  string    `json:"language,omitempty"`
+	Published bool      `json:"published"`
+	Removed   bool      `json:"removed"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LineageOperation struct {
+	ID        int64     `json:"id"`
+	UID       string    `json:"uid"`
+	Type      string    `json:"type"`
+	Station   string    `json:"station,omitempty"`
+	User      string    `json:"user,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LineageUnit struct {
+	ID   int64  `json:"id"`
+	UID  string `json:"uid"`
+	Type string `json:"type"`
+}
+
+type LineageNode struct {
+	ID          string            `json:"id"`
+	Kind        string            `json:"kind"`
+	File        *LineageFile      `json:"file,omitempty"`
+	Operation   *LineageOperation `json:"operation,omitempty"`
+	ContentUnit *LineageUnit      `json:"content_unit,omitempty"`
+}
+
+type LineageEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+type LineageGraph struct {
+	FileID int64          `json:"file_id"`
+	Nodes  []*LineageNode `json:"nodes"`
+	Edges  []*LineageEdge `json:"edges"`
+}
+
+func FileLineageHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	format := c.DefaultQuery("format", LINEAGE_FORMAT_JSON)
+	if !isOneOf(format, []string{LINEAGE_FORMAT_JSON, LINEAGE_FORMAT_DOT, LINEAGE_FORMAT_MERMAID}) {
+		NewBadRequestError(errors.Errorf("Unknown format %s", format)).Abort(c)
+		return
+	}
+
+	graph, err := handleFileLineage(c, c.MustGet("MDB").(*sql.DB), id)
+	if err != nil {
+		err.Abort(c)
+		return
+	}
+
+	switch format {
+	case LINEAGE_FORMAT_DOT:
+		c.Data(http.StatusOK, "text/vnd.graphviz; charset=utf-8", []byte(graph.Dot()))
+	case LINEAGE_FORMAT_MERMAID:
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(graph.Mermaid()))
+	default:
+		c.JSON(http.StatusOK, graph)
+	}
+}
+
+func handleFileLineage(cp utils.ContextProvider, exec boil.Executor, id int64) (*LineageGraph, *HttpError) {
+	file, err := models.FindFile(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(file.Secure), common.PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	graph, err := FindFileLineage(exec, file)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return graph, nil
+}
+
+// FindFileLineage builds the graph of all ancestors and descendants of the given file
+// together with the operations which touched them and the units they're assigned to.
+func FindFileLineage(exec boil.Executor, file *models.File) (*LineageGraph, error) {
+	ancestors, err := FindFileAncestors(exec, file.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Find ancestors")
+	}
+	descendants, err := FindFileDescendants(exec, file.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Find descendants")
+	}
+
+	files := make([]*models.File, 0, len(ancestors)+len(descendants)+1)
+	files = append(files, ancestors...)
+	files = append(files, file)
+	files = append(files, descendants...)
+
+	fileIDs := make([]int64, len(files))
+	cuIDs := make([]int64, 0)
+	for i, f := range files {
+		fileIDs[i] = f.ID
+		if f.ContentUnitID.Valid {
+			cuIDs = append(cuIDs, f.ContentUnitID.Int64)
+		}
+	}
+
+	// files operations
+	fileOps := make(map[int64][]int64)
+	rows, err := queries.Raw(exec,
+		`SELECT file_id, operation_id FROM files_operations WHERE file_id = ANY($1)`,
+		pq.Array(fileIDs)).
+		Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load files operations")
+	}
+	defer rows.Close()
+
+	opIDs := make([]int64, 0)
+	for rows.Next() {
+		var fID, opID int64
+		if err := rows.Scan(&fID, &opID); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		fileOps[fID] = append(fileOps[fID], opID)
+		opIDs = append(opIDs, opID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	var ops []*models.Operation
+	if len(opIDs) > 0 {
+		ops, err = models.Operations(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(opIDs)...),
+			qm.Load("User")).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load operations")
+		}
+	}
+
+	var units []*models.ContentUnit
+	if len(cuIDs) > 0 {
+		units, err = models.ContentUnits(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(cuIDs)...)).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load content units")
+		}
+	}
+
+	return NewLineageGraph(file.ID, files, fileOps, ops, units), nil
+}
+
+// NewLineageGraph assembles nodes and edges. Nodes are ordered by kind, then by id.
+func NewLineageGraph(fileID int64, files []*models.File, fileOps map[int64][]int64,
+	ops []*models.Operation, units []*models.ContentUnit) *LineageGraph {
+	g := &LineageGraph{
+		FileID: fileID,
+		Nodes:  make([]*LineageNode, 0),
+		Edges:  make([]*LineageEdge, 0),
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].ID < files[j].ID })
+	sort.Slice(ops, func(i, j int) bool { return ops[i].ID < ops[j].ID })
+	sort.Slice(units, func(i, j int) bool { return units[i].ID < units[j].ID })
+
+	inGraph := make(map[int64]bool, len(files))
+	for _, f := range files {
+		inGraph[f.ID] = true
+	}
+
+	for _, f := range files {
+		x := &LineageFile{
+			ID:        f.ID,
+			UID:       f.UID,
+			Name:      f.Name,
+			Type:      f.Type,
+			SubType:   f.SubType,
+			Language:  f.Language.String,
+			Published: f.Published,
+			Removed:   f.RemovedAt.Valid,
+			CreatedAt: f.CreatedAt,
+		}
+		if f.Sha1.Valid {
+			x.Sha1 = fmt.Sprintf("%x", f.Sha1.Bytes)
+		}
+		g.Nodes = append(g.Nodes, &LineageNode{ID: lineageFileNodeID(f.ID), Kind: LINEAGE_NODE_FILE, File: x})
+
+		if f.ParentID.Valid && inGraph[f.ParentID.Int64] {
+			g.Edges = append(g.Edges, &LineageEdge{
+				From: lineageFileNodeID(f.ParentID.Int64),
+				To:   lineageFileNodeID(f.ID),
+				Kind: LINEAGE_EDGE_PARENT,
+			})
+		}
+	}
+
+	for _, op := range ops {
+		x := &LineageOperation{
+			ID:        op.ID,
+			UID:       op.UID,
+			Station:   op.Station.String,
+			CreatedAt: op.CreatedAt,
+		}
+		if t, ok := common.OPERATION_TYPE_REGISTRY.ByID[op.TypeID]; ok {
+			x.Type = t.Name
+		}
+		if op.R != nil && op.R.User != nil {
+			x.User = op.R.User.Email
+		}
+		g.Nodes = append(g.Nodes, &LineageNode{ID: lineageOperationNodeID(op.ID), Kind: LINEAGE_NODE_OPERATION, Operation: x})
+	}
+
+	for _, f := range files {
+		opIDs := fileOps[f.ID]
+		sort.Slice(opIDs, func(i, j int) bool { return opIDs[i] < opIDs[j] })
+		for _, opID := range opIDs {
+			g.Edges = append(g.Edges, &LineageEdge{
+				From: lineageOperationNodeID(opID),
+				To:   lineageFileNodeID(f.ID),
+				Kind: LINEAGE_EDGE_OPERATION,
+			})
+		}
+	}
+
+	for _, cu := range units {
+		x := &LineageUnit{ID: cu.ID, UID: cu.UID}
+		if t, ok := common.CONTENT_TYPE_REGISTRY.ByID[cu.TypeID]; ok {
+			x.Type = t.Name
+		}
+		g.Nodes = append(g.Nodes, &LineageNode{ID: lineageUnitNodeID(cu.ID), Kind: LINEAGE_NODE_UNIT, ContentUnit: x})
+	}
+
+	for _, f := range files {
+		if f.ContentUnitID.Valid {
+			g.Edges = append(g.Edges, &LineageEdge{
+				From: lineageFileNodeID(f.ID),
+				To:   lineageUnitNodeID(f.ContentUnitID.Int64),
+				Kind: LINEAGE_EDGE_UNIT,
+			})
+		}
+	}
+
+	return g
+}
+
+func (g *LineageGraph) Dot() string {
+	var b strings.Builder
+	b.WriteString("digraph lineage {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		switch n.Kind {
+		case LINEAGE_NODE_OPERATION:
+			shape = "ellipse"
+		case LINEAGE_NODE_UNIT:
+			shape = "folder"
+		}
+		attrs := fmt.Sprintf("shape=%s, label=%s", shape, strconv.Quote(n.Label()))
+		if n.File != nil && n.File.ID == g.FileID {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", n.ID, attrs)
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Kind == LINEAGE_EDGE_UNIT {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  %s -> %s%s;\n", e.From, e.To, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g *LineageGraph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for _, n := range g.Nodes {
+		label := strings.Replace(n.Label(), "\"", "#quot;", -1)
+		label = strings.Replace(label, "\n", "<br/>", -1)
+		switch n.Kind {
+		case LINEAGE_NODE_OPERATION:
+			fmt.Fprintf(&b, "  %s([\"%s\"])\n", n.ID, label)
+		case LINEAGE_NODE_UNIT:
+			fmt.Fprintf(&b, "  %s[[\"%s\"]]\n", n.ID, label)
+		default:
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", n.ID, label)
+		}
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind == LINEAGE_EDGE_UNIT {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s %s\n", e.From, arrow, e.To)
+	}
+	return b.String()
+}
+
+// Label is a short, human readable, description of the node
+func (n *LineageNode) Label() string {
+	switch {
+	case n.File != nil:
+		return n.File.Name
+	case n.Operation != nil:
+		parts := []string{n.Operation.Type}
+		if n.Operation.Station != "" {
+			parts = append(parts, n.Operation.Station)
+		}
+		if n.Operation.User != "" {
+			parts = append(parts, n.Operation.User)
+		}
+		parts = append(parts, n.Operation.CreatedAt.UTC().Format("2006-01-02 15:04:05"))
+		return strings.Join(parts, "\n")
+	case n.ContentUnit != nil:
+		return fmt.Sprintf("%s\n%s", n.ContentUnit.Type, n.ContentUnit.UID)
+	default:
+		return n.ID
+	}
+}
+
+func lineageFileNodeID(id int64) string {
+	return fmt.Sprintf("f%d", id)
+}
+
+func lineageOperationNodeID(id int64) string {
+	return fmt.Sprintf("o%d", id)
+}
+
+func lineageUnitNodeID(id int64) string {
+	return fmt.Sprintf("u%d", id)
+}
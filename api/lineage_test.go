@@ -0,0 +1,59 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func TestNewLineageGraph(t *testing.T) {
+	files := []*models.File{
+		{ID: 3, Name: "trimmed.mp4", ParentID: null.Int64From(1), ContentUnitID: null.Int64From(7)},
+		{ID: 1, Name: "capture.mp4"},
+		{ID: 2, Name: "orphan \"quoted\".mp4", ParentID: null.Int64From(99)},
+	}
+	fileOps := map[int64][]int64{1: {10}, 3: {11, 10}}
+	ops := []*models.Operation{
+		{ID: 11, Station: null.StringFrom("trimmer"), CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{ID: 10},
+	}
+	units := []*models.ContentUnit{{ID: 7, UID: "abcdefgh"}}
+
+	g := NewLineageGraph(3, files, fileOps, ops, units)
+
+	ids := make([]string, len(g.Nodes))
+	for i := range g.Nodes {
+		ids[i] = g.Nodes[i].ID
+	}
+	assert.Equal(t, []string{"f1", "f2", "f3", "o10", "o11", "u7"}, ids, "nodes")
+
+	edges := make([]string, len(g.Edges))
+	for i, e := range g.Edges {
+		edges[i] = e.From + ">" + e.To + ":" + e.Kind
+	}
+	assert.Equal(t, []string{
+		"f1>f3:parent",
+		"o10>f1:operation",
+		"o10>f3:operation",
+		"o11>f3:operation",
+		"f3>u7:unit",
+	}, edges, "edges")
+
+	dot := g.Dot()
+	assert.True(t, strings.HasPrefix(dot, "digraph lineage {"), "dot header")
+	assert.Contains(t, dot, `f3 [shape=box, label="trimmed.mp4", style=bold];`)
+	assert.Contains(t, dot, `f2 [shape=box, label="orphan \"quoted\".mp4"];`)
+	assert.Contains(t, dot, "f3 -> u7 [style=dashed];")
+
+	mermaid := g.Mermaid()
+	assert.True(t, strings.HasPrefix(mermaid, "graph LR\n"), "mermaid header")
+	assert.Contains(t, mermaid, `f2["orphan #quot;quoted#quot;.mp4"]`)
+	assert.Contains(t, mermaid, `o11(["<br/>trimmer<br/>2026-01-02 03:04:05"])`)
+	assert.Contains(t, mermaid, "f1 --> f3")
+	assert.Contains(t, mermaid, "f3 -.-> u7")
+}
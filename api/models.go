@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -10,7 +11,12 @@ import (
 	"github.com/volatiletech/sqlboiler/types"
 	"gopkg.in/volatiletech/null.v6"
 
+	"github.com/Bnei-Baruch/mdb/jobs"
 	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/naming"
+	"github.com/Bnei-Baruch/mdb/scheduler"
+	"github.com/Bnei-Baruch/mdb/social"
+	"github.com/Bnei-Baruch/mdb/storage/policy"
 )
 
 type (
@@ -25,6 +31,7 @@ type (
 	File struct {
 		FileName  string     `json:"file_name" binding:"required,max=255"`
 		Sha1      string     `json:"sha1" binding:"required,len=40,hexadecimal"`
+		Sha256    string     `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
 		Size      int64      `json:"size" binding:"required"`
 		CreatedAt *Timestamp `json:"created_at" binding:"required"`
 		Type      string     `json:"type" binding:"max=16"`
@@ -37,6 +44,7 @@ type (
 	MaybeFile struct {
 		FileName  string     `json:"file_name" binding:"omitempty,max=255"`
 		Sha1      string     `json:"sha1" binding:"omitempty,len=40,hexadecimal"`
+		Sha256    string     `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
 		Size      int64      `json:"size" binding:"omitempty"`
 		CreatedAt *Timestamp `json:"created_at" binding:"omitempty"`
 		Type      string     `json:"type" binding:"max=16"`
@@ -47,8 +55,10 @@ type (
 
 	AVFile struct {
 		File
-		Duration  float64 `json:"duration"`
-		VideoSize string  `json:"video_size"`
+		Duration  float64         `json:"duration"`
+		VideoSize string          `json:"video_size"`
+		FFProbe   json.RawMessage `json:"ffprobe"`    // ffprobe -print_format json -show_format -show_streams
+		MediaPath string          `json:"media_path"` // path to probe under the locally mounted storage
 	}
 
 	CITMetadataMajor struct {
@@ -158,6 +168,7 @@ type (
 		OldSha1        string       `json:"old_sha1" binding:"omitempty,len=40,hexadecimal"`
 		PublisherUID   string       `json:"publisher_uid" binding:"omitempty,len=8"`
 		Metadata       *CITMetadata `json:"metadata" binding:"omitempty"`
+		LocalPath      string       `json:"local_path" binding:"omitempty"`
 	}
 
 	TranscodeRequest struct {
@@ -201,6 +212,10 @@ type (
 		SHA1s []string `json:"sha1s" form:"sha1" binding:"omitempty"`
 	}
 
+	SHA256sFilter struct {
+		SHA256s []string `json:"sha256s" form:"sha256" binding:"omitempty"`
+	}
+
 	PatternsFilter struct {
 		Patterns []string `json:"patterns" form:"pattern" binding:"omitempty"`
 	}
@@ -278,6 +293,7 @@ type (
 		IDsFilter
 		UIDsFilter
 		SHA1sFilter
+		SHA256sFilter
 		DateRangeFilter
 		SecureFilter
 		PublishedFilter
@@ -300,6 +316,31 @@ type (
 		Operations []*models.Operation `json:"data"`
 	}
 
+	WorkflowsRequest struct {
+		ListRequest
+		DateRangeFilter
+		WithWarnings bool `json:"with_warnings" form:"with_warnings"`
+	}
+
+	WorkflowsResponse struct {
+		ListResponse
+		Workflows []*WorkflowSummary `json:"data"`
+	}
+
+	StoragesComplianceRequest struct {
+		ListRequest
+		Kind   string `json:"kind" form:"kind" binding:"omitempty,eq=under|eq=over"`
+		Policy string `json:"policy" form:"policy"`
+	}
+
+	StoragesComplianceResponse struct {
+		ListResponse
+		CheckedAt  time.Time           `json:"checked_at"`
+		Policies   []*policy.Summary   `json:"policies"`
+		Unmatched  int                 `json:"unmatched"`
+		Violations []*policy.Violation `json:"data"`
+	}
+
 	AuthorsResponse struct {
 		ListResponse
 		Authors []*Author `json:"data"`
@@ -349,6 +390,167 @@ type (
 		Storages []*models.Storage `json:"data"`
 	}
 
+	NewStorage struct {
+		Name     string `json:"name" binding:"required,max=255"`
+		Country  string `json:"country" binding:"required,len=2"`
+		Location string `json:"location" binding:"required,max=30"`
+		Status   string `json:"status" binding:"required,eq=online|eq=nearline|eq=offline"`
+		Access   string `json:"access" binding:"required,max=30"`
+	}
+
+	// PartialStorage same as NewStorage but all fields are optional. Name can't be changed.
+	PartialStorage struct {
+		Country  string `json:"country" binding:"omitempty,len=2"`
+		Location string `json:"location" binding:"omitempty,max=30"`
+		Status   string `json:"status" binding:"omitempty,eq=online|eq=nearline|eq=offline"`
+		Access   string `json:"access" binding:"omitempty,max=30"`
+	}
+
+	JobsRequest struct {
+		ListRequest
+		Status string `json:"status" form:"status" binding:"omitempty,eq=pending|eq=running|eq=succeeded|eq=failed"`
+		Type   string `json:"type" form:"type" binding:"omitempty,max=64"`
+	}
+
+	JobsResponse struct {
+		ListResponse
+		Jobs []*jobs.Job `json:"data"`
+	}
+
+	JobRequest struct {
+		Type   string          `json:"type" binding:"required,max=64"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	JobLogsRequest struct {
+		After int64 `json:"after" form:"after" binding:"omitempty,min=0"`
+		Limit int   `json:"limit" form:"limit" binding:"omitempty,min=1,max=1000"`
+	}
+
+	NamingValidateRequest struct {
+		FileName string `json:"file_name" form:"file_name" binding:"required,max=255"`
+	}
+
+	NamingValidateResponse struct {
+		Valid    bool              `json:"valid"`
+		Parsed   *naming.FileName  `json:"parsed,omitempty"`
+		Errors   naming.Violations `json:"errors,omitempty"`
+		Expected string            `json:"expected,omitempty"`
+	}
+
+	NamingSuggestRequest struct {
+		Metadata    CITMetadata `json:"metadata"`
+		FileType    string      `json:"file_type"`
+		Extension   string      `json:"extension" binding:"omitempty,max=10"`
+		Translation bool        `json:"translation"`
+	}
+
+	NamingSuggestResponse struct {
+		FileName string `json:"file_name"`
+	}
+
+	SchedulerRunsRequest struct {
+		ListRequest
+		Task   string `json:"task" form:"task" binding:"omitempty,max=64"`
+		Status string `json:"status" form:"status" binding:"omitempty,eq=running|eq=succeeded|eq=failed|eq=skipped"`
+	}
+
+	SchedulerRunsResponse struct {
+		ListResponse
+		Runs []*scheduler.Run `json:"data"`
+	}
+
+	BlogPostsRequest struct {
+		ListRequest
+		DateRangeFilter
+		SearchTermFilter
+		Blogs    []int64 `json:"blogs" form:"blog" binding:"omitempty"`
+		Language string  `json:"language" form:"language" binding:"omitempty,len=2"`
+		Filtered string  `json:"filtered" form:"filtered" binding:"omitempty,eq=true|eq=false"`
+	}
+
+	BlogPostsResponse struct {
+		ListResponse
+		Posts []*models.BlogPost `json:"data"`
+	}
+
+	TweetsRequest struct {
+		ListRequest
+		DateRangeFilter
+		SearchTermFilter
+		Accounts []int64 `json:"accounts" form:"account" binding:"omitempty"`
+		Language string  `json:"language" form:"language" binding:"omitempty,len=2"`
+		Filtered string  `json:"filtered" form:"filtered" binding:"omitempty,eq=true|eq=false"`
+	}
+
+	TweetsResponse struct {
+		ListResponse
+		Tweets []*models.TwitterTweet `json:"data"`
+	}
+
+	PostContentUnitRequest struct {
+		ContentUnitID int64 `json:"content_unit_id" binding:"required,min=1"`
+	}
+
+	SocialPostsRequest struct {
+		ListRequest
+		DateRangeFilter
+		SearchTermFilter
+		Platform string  `json:"platform" form:"platform" binding:"omitempty,eq=twitter|eq=telegram"`
+		Accounts []int64 `json:"accounts" form:"account" binding:"omitempty"`
+		Language string  `json:"language" form:"language" binding:"omitempty,len=2"`
+		WithRaw  bool    `json:"with_raw" form:"with_raw"`
+	}
+
+	SocialPostsResponse struct {
+		ListResponse
+		Posts []*social.Post `json:"data"`
+	}
+
+	TranscodeQueueRequest struct {
+		ListRequest
+		Status string `json:"status" form:"status" binding:"omitempty,eq=queued|eq=leased|eq=done|eq=failed"`
+		FileID int64  `json:"file_id" form:"file_id" binding:"omitempty,min=1"`
+	}
+
+	TranscodeQueueResponse struct {
+		ListResponse
+		Stats map[string]int64      `json:"stats"`
+		Items []*TranscodeQueueItem `json:"data"`
+	}
+
+	TranscodeEnqueueRequest struct {
+		ContentUnitIDs []int64 `json:"content_unit_ids"`
+		CollectionIDs  []int64 `json:"collection_ids"`
+		FileIDs        []int64 `json:"file_ids"`
+		Priority       int     `json:"priority"`
+		Format         string  `json:"format" binding:"omitempty,max=16"`
+	}
+
+	TranscodeEnqueueResponse struct {
+		Candidates int   `json:"candidates"`
+		Enqueued   int64 `json:"enqueued"`
+	}
+
+	TranscodeLeaseRequest struct {
+		Owner        string `json:"owner" binding:"required,max=255"`
+		Limit        int    `json:"limit" binding:"required,min=1,max=100"`
+		LeaseSeconds int    `json:"lease_seconds" binding:"omitempty,min=1"`
+	}
+
+	TranscodeRequeueRequest struct {
+		IDs []int64 `json:"ids" binding:"required,min=1"`
+	}
+
+	StoragesOfflineRequest struct {
+		IDs []int64 `json:"ids" binding:"required,min=1"`
+	}
+
+	StoragesOfflineImpactRequest struct {
+		ListRequest
+		IDsFilter
+	}
+
 	PublishersRequest struct {
 		ListRequest
 		IDsFilter
@@ -402,6 +604,11 @@ type (
 		Position    int          `json:"position"`
 	}
 
+	ContentUnitSubtitles struct {
+		Languages []string `json:"languages"`
+		Files     []*MFile `json:"files"`
+	}
+
 	ContentUnitDerivation struct {
 		Source  *ContentUnit `json:"source,omitempty"`
 		Derived *ContentUnit `json:"derived,omitempty"`
@@ -451,6 +658,7 @@ type (
 
 	Storage struct {
 		models.Storage
+		Fixity *StorageFixity `json:"fixity,omitempty"`
 	}
 
 	Publisher struct {
@@ -516,6 +724,10 @@ func NewOperationsResponse() *OperationsResponse {
 	return &OperationsResponse{Operations: make([]*models.Operation, 0)}
 }
 
+func NewWorkflowsResponse() *WorkflowsResponse {
+	return &WorkflowsResponse{Workflows: make([]*WorkflowSummary, 0)}
+}
+
 func NewSourcesResponse() *SourcesResponse {
 	return &SourcesResponse{Sources: make([]*Source, 0)}
 }
@@ -540,6 +752,7 @@ func (mf MaybeFile) AsFile() File {
 	return File{
 		FileName:  mf.FileName,
 		Sha1:      mf.Sha1,
+		Sha256:    mf.Sha256,
 		Size:      mf.Size,
 		CreatedAt: mf.CreatedAt,
 		Type:      mf.Type,
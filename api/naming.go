@@ -0,0 +1,94 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/naming"
+)
+
+func NamingValidateHandler(c *gin.Context) {
+	var r NamingValidateRequest
+	if c.Request.Method == http.MethodPost {
+		if c.BindJSON(&r) != nil {
+			return
+		}
+	} else if c.Bind(&r) != nil {
+		return
+	}
+
+	resp := new(NamingValidateResponse)
+	fn, err := naming.Parse(r.FileName)
+	if err != nil {
+		resp.Errors = err.(naming.Violations)
+		resp.Expected = naming.FORMAT
+	} else {
+		resp.Valid = true
+		resp.Parsed = fn
+	}
+
+	concludeRequest(c, resp, nil)
+}
+
+func NamingSuggestHandler(c *gin.Context) {
+	var r NamingSuggestRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	name, err := CITFileName(r.Metadata, r.FileType, r.Extension, r.Translation)
+	if err != nil {
+		NewBadRequestError(err).Abort(c)
+		return
+	}
+
+	concludeRequest(c, NamingSuggestResponse{FileName: name}, nil)
+}
+
+// CITFileName generates the canonical name of a file described by CIT metadata.
+// The extension is taken from the file type (video, audio...) unless given explicitly.
+func CITFileName(metadata CITMetadata, fileType, extension string, translation bool) (string, error) {
+	fn := &naming.FileName{
+		Language:  metadata.Language,
+		Original:  !translation,
+		Rav:       strings.ToLower(metadata.Lecturer) == "rav",
+		Date:      metadata.CaptureDate.Time,
+		Extension: extension,
+	}
+	if metadata.FilmDate != nil {
+		fn.Date = metadata.FilmDate.Time
+	}
+	if metadata.Part.Valid {
+		fn.Part = fmt.Sprintf("part%d", metadata.Part.Int)
+	}
+
+	ct := metadata.ContentType
+	if ct == common.CT_LESSON_PART {
+		ct = "lesson"
+	}
+	fn.Description = []string{ct}
+	if metadata.ArtifactType.Valid && metadata.ArtifactType.String != "main" {
+		fn.Description = append(fn.Description, metadata.ArtifactType.String)
+	}
+	if metadata.Number.Valid {
+		fn.Description = append(fn.Description, fmt.Sprintf("n%d", metadata.Number.Int))
+	}
+	if metadata.Episode.Valid {
+		fn.Description = append(fn.Description, metadata.Episode.String)
+	}
+
+	return naming.Generate(fn, fileType)
+}
+
+// validateSendFileName rejects names breaking the file naming convention
+func validateSendFileName(kind string, r *Rename) *HttpError {
+	if _, err := naming.Parse(r.FileName); err != nil {
+		return NewBadRequestError(errors.Wrapf(err, "%s file_name %s", kind, r.FileName))
+	}
+	return nil
+}
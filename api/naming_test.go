@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+func TestCITFileName(t *testing.T) {
+	metadata := CITMetadata{
+		ContentType: common.CT_LESSON_PART,
+		CaptureDate: Date{Time: time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC)},
+		Language:    common.LANG_HEBREW,
+		Lecturer:    "rav",
+		Part:        null.IntFrom(2),
+	}
+
+	name, err := CITFileName(metadata, "video", "", false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "heb_o_rav_part2_2016-09-14_lesson.mp4", name)
+	}
+
+	metadata.ContentType = common.CT_VIRTUAL_LESSON
+	metadata.Lecturer = "norav"
+	metadata.Language = common.LANG_RUSSIAN
+	metadata.Part = null.Int{}
+	metadata.ArtifactType = null.StringFrom("kitei_makor")
+	metadata.FilmDate = &Date{Time: time.Date(2016, 9, 12, 0, 0, 0, 0, time.UTC)}
+	name, err = CITFileName(metadata, "audio", "", true)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "rus_t_norav_2016-09-12_virtual-lesson_kitei-makor.mp3", name)
+	}
+
+	_, err = CITFileName(metadata, "unknown", "", false)
+	assert.NotNil(t, err, "unknown file type")
+
+	assert.Nil(t, validateSendFileName("original", &Rename{FileName: name}))
+	assert.NotNil(t, validateSendFileName("original", &Rename{FileName: "original_renamed.mp4"}))
+}
@@ -0,0 +1,474 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// tweets language is the one detected by twitter, iw being the legacy code of hebrew
+const TWEET_LANGUAGE_SQL = "(CASE WHEN raw->>'lang' = 'iw' THEN 'he' ELSE raw->>'lang' END)"
+
+// postUnitsTable links posts of some kind to the content units they discuss
+type postUnitsTable struct {
+	Name       string
+	PostColumn string
+}
+
+var (
+	BLOG_POST_UNITS = postUnitsTable{Name: "content_units_blog_posts", PostColumn: "blog_post_id"}
+	TWEET_UNITS     = postUnitsTable{Name: "content_units_tweets", PostColumn: "tweet_id"}
+)
+
+func BlogPostsListHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r BlogPostsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleBlogPostsList(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func BlogPostHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleGetBlogPost(c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, resp, err)
+}
+
+// BlogPostHideHandler and BlogPostUnhideHandler toggle the filtered flag of a blog post
+func BlogPostHideHandler(c *gin.Context) {
+	blogPostFilteredHandler(c, true)
+}
+
+func BlogPostUnhideHandler(c *gin.Context) {
+	blogPostFilteredHandler(c, false)
+}
+
+func blogPostFilteredHandler(c *gin.Context, filtered bool) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_METADATA_WRITE) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleSetBlogPostFiltered(tx, id, filtered)
+	mustConcludeTx(tx, err)
+
+	if err == nil {
+		emitEvents(c, events.BlogPostUpdateEvent(resp))
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func BlogPostContentUnitsHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == "" {
+		if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+			NewForbiddenError().Abort(c)
+			return
+		}
+		resp, err := handleGetPostContentUnits(c.MustGet("MDB").(*sql.DB), BLOG_POST_UNITS, id)
+		concludeRequest(c, resp, err)
+		return
+	}
+
+	cuID, ok := postContentUnitID(c)
+	if !ok {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	post, err := models.FindBlogPost(tx, id)
+	if err != nil {
+		utils.Must(tx.Rollback())
+		if err == sql.ErrNoRows {
+			NewNotFoundError().Abort(c)
+		} else {
+			NewInternalError(err).Abort(c)
+		}
+		return
+	}
+
+	cu, herr := handleChangePostContentUnit(c, tx, BLOG_POST_UNITS, id, cuID, c.Request.Method == http.MethodPost)
+	mustConcludeTx(tx, herr)
+
+	if herr == nil {
+		emitEvents(c, events.BlogPostUpdateEvent(post), events.ContentUnitUpdateEvent(cu))
+	}
+
+	concludeRequest(c, gin.H{"status": "ok"}, herr)
+}
+
+func TweetsListHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r TweetsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleTweetsList(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func TweetHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleGetTweet(c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, resp, err)
+}
+
+// TweetHideHandler and TweetUnhideHandler toggle the filtered flag of a tweet
+func TweetHideHandler(c *gin.Context) {
+	tweetFilteredHandler(c, true)
+}
+
+func TweetUnhideHandler(c *gin.Context) {
+	tweetFilteredHandler(c, false)
+}
+
+func tweetFilteredHandler(c *gin.Context, filtered bool) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_METADATA_WRITE) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleSetTweetFiltered(tx, id, filtered)
+	mustConcludeTx(tx, err)
+
+	if err == nil {
+		emitEvents(c, events.TweetUpdateEvent(resp))
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func TweetContentUnitsHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if c.Request.Method == http.MethodGet || c.Request.Method == "" {
+		if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+			NewForbiddenError().Abort(c)
+			return
+		}
+		resp, err := handleGetPostContentUnits(c.MustGet("MDB").(*sql.DB), TWEET_UNITS, id)
+		concludeRequest(c, resp, err)
+		return
+	}
+
+	cuID, ok := postContentUnitID(c)
+	if !ok {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	tweet, err := models.FindTwitterTweet(tx, id)
+	if err != nil {
+		utils.Must(tx.Rollback())
+		if err == sql.ErrNoRows {
+			NewNotFoundError().Abort(c)
+		} else {
+			NewInternalError(err).Abort(c)
+		}
+		return
+	}
+
+	cu, herr := handleChangePostContentUnit(c, tx, TWEET_UNITS, id, cuID, c.Request.Method == http.MethodPost)
+	mustConcludeTx(tx, herr)
+
+	if herr == nil {
+		emitEvents(c, events.TweetUpdateEvent(tweet), events.ContentUnitUpdateEvent(cu))
+	}
+
+	concludeRequest(c, gin.H{"status": "ok"}, herr)
+}
+
+// postContentUnitID reads the content unit to link (POST body) or unlink (DELETE path param)
+func postContentUnitID(c *gin.Context) (int64, bool) {
+	if c.Request.Method == http.MethodPost {
+		var r PostContentUnitRequest
+		if c.BindJSON(&r) != nil {
+			return 0, false
+		}
+		return r.ContentUnitID, true
+	}
+
+	cuID, e := strconv.ParseInt(c.Param("cuID"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "cuID expects int64")).Abort(c)
+		return 0, false
+	}
+	return cuID, true
+}
+
+// Handlers Logic
+
+func handleBlogPostsList(exec boil.Executor, r BlogPostsRequest) (*BlogPostsResponse, *HttpError) {
+	mods := make([]qm.QueryMod, 0)
+
+	// filters
+	if err := appendDateRangeFilterMods(&mods, r.DateRangeFilter, "posted_at"); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+	if len(r.Blogs) > 0 {
+		mods = append(mods, qm.WhereIn("blog_id in ?", utils.ConvertArgsInt64(r.Blogs)...))
+	}
+	if r.Language != "" {
+		mods = append(mods, qm.Where("blog_id in (select id from blogs where language = ?)", r.Language))
+	}
+	if r.Query != "" {
+		mods = append(mods, qm.Where("title ilike ?", "%"+r.Query+"%"))
+	}
+	if r.Filtered != "" {
+		mods = append(mods, qm.Where("filtered = ?", r.Filtered == "true"))
+	}
+
+	// count query
+	var total int64
+	countMods := append([]qm.QueryMod{qm.Select("count(DISTINCT id)")}, mods...)
+	err := models.BlogPosts(exec, countMods...).QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return &BlogPostsResponse{Posts: make([]*models.BlogPost, 0)}, nil
+	}
+
+	// order, limit, offset
+	if r.OrderBy == "" {
+		r.OrderBy = "posted_at desc"
+	}
+	if err = appendListMods(&mods, r.ListRequest); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// data query
+	data, err := models.BlogPosts(exec, mods...).All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &BlogPostsResponse{
+		ListResponse: ListResponse{Total: total},
+		Posts:        data,
+	}, nil
+}
+
+func handleGetBlogPost(exec boil.Executor, id int64) (*models.BlogPost, *HttpError) {
+	post, err := models.FindBlogPost(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	return post, nil
+}
+
+func handleSetBlogPostFiltered(exec boil.Executor, id int64, filtered bool) (*models.BlogPost, *HttpError) {
+	post, err := handleGetBlogPost(exec, id)
+	if err != nil {
+		return nil, err
+	}
+
+	post.Filtered = filtered
+	if err := post.Update(exec, "filtered"); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return post, nil
+}
+
+func handleTweetsList(exec boil.Executor, r TweetsRequest) (*TweetsResponse, *HttpError) {
+	mods := make([]qm.QueryMod, 0)
+
+	// filters
+	if err := appendDateRangeFilterMods(&mods, r.DateRangeFilter, "tweet_at"); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+	if len(r.Accounts) > 0 {
+		mods = append(mods, qm.WhereIn("user_id in ?", utils.ConvertArgsInt64(r.Accounts)...))
+	}
+	if r.Language != "" {
+		mods = append(mods, qm.Where(TWEET_LANGUAGE_SQL+" = ?", r.Language))
+	}
+	if r.Query != "" {
+		mods = append(mods, qm.Where("full_text ilike ?", "%"+r.Query+"%"))
+	}
+	if r.Filtered != "" {
+		mods = append(mods, qm.Where("filtered = ?", r.Filtered == "true"))
+	}
+
+	// count query
+	var total int64
+	countMods := append([]qm.QueryMod{qm.Select("count(DISTINCT id)")}, mods...)
+	err := models.TwitterTweets(exec, countMods...).QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return &TweetsResponse{Tweets: make([]*models.TwitterTweet, 0)}, nil
+	}
+
+	// order, limit, offset
+	if r.OrderBy == "" {
+		r.OrderBy = "tweet_at desc"
+	}
+	if err = appendListMods(&mods, r.ListRequest); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// data query
+	data, err := models.TwitterTweets(exec, mods...).All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &TweetsResponse{
+		ListResponse: ListResponse{Total: total},
+		Tweets:       data,
+	}, nil
+}
+
+func handleGetTweet(exec boil.Executor, id int64) (*models.TwitterTweet, *HttpError) {
+	tweet, err := models.FindTwitterTweet(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	return tweet, nil
+}
+
+func handleSetTweetFiltered(exec boil.Executor, id int64, filtered bool) (*models.TwitterTweet, *HttpError) {
+	tweet, err := handleGetTweet(exec, id)
+	if err != nil {
+		return nil, err
+	}
+
+	tweet.Filtered = filtered
+	if err := tweet.Update(exec, "filtered"); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return tweet, nil
+}
+
+func handleGetPostContentUnits(exec boil.Executor, t postUnitsTable, id int64) ([]*ContentUnit, *HttpError) {
+	units, err := models.ContentUnits(exec,
+		qm.Where(fmt.Sprintf("id in (select content_unit_id from %s where %s = ?)", t.Name, t.PostColumn), id),
+		qm.Load("ContentUnitI18ns")).
+		All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	data := make([]*ContentUnit, len(units))
+	for i, cu := range units {
+		x := &ContentUnit{ContentUnit: *cu}
+		data[i] = x
+		x.I18n = make(map[string]*models.ContentUnitI18n, len(cu.R.ContentUnitI18ns))
+		for _, i18n := range cu.R.ContentUnitI18ns {
+			x.I18n[i18n.Language] = i18n
+		}
+	}
+
+	return data, nil
+}
+
+// handleChangePostContentUnit links (add) or unlinks a content unit to an existing post
+func handleChangePostContentUnit(cp utils.ContextProvider, exec boil.Executor, t postUnitsTable, id, cuID int64, add bool) (*models.ContentUnit, *HttpError) {
+	cu, err := models.FindContentUnit(exec, cuID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewBadRequestError(errors.Errorf("Unknown content unit id %d", cuID))
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(cu.Secure), common.PERM_METADATA_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	var q string
+	if add {
+		q = fmt.Sprintf("INSERT INTO %s (content_unit_id, %s) VALUES ($1, $2) ON CONFLICT DO NOTHING", t.Name, t.PostColumn)
+	} else {
+		q = fmt.Sprintf("DELETE FROM %s WHERE content_unit_id = $1 AND %s = $2", t.Name, t.PostColumn)
+	}
+	if _, err := queries.Raw(exec, q, cuID, id).Exec(); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return cu, nil
+}
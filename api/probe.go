@@ -0,0 +1,87 @@
+package api
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/probe"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var (
+	// MediaProber probes AV files registered with a media path, nil disables local probing
+	MediaProber probe.Prober
+
+	// MediaRoot is the locally mounted storage media paths must be under
+	MediaRoot string
+)
+
+// InitMediaProber sets up local probing of AV files if a media root is configured
+func InitMediaProber() {
+	MediaRoot = viper.GetString("probe.root")
+	if MediaRoot == "" {
+		log.Info("No probe.root, local media probing is disabled")
+		return
+	}
+	MediaProber = probe.NewFFProbe(viper.GetString("probe.ffprobe"), viper.GetDuration("probe.timeout"))
+}
+
+// probeAVFile adds the probed properties of an AV file to props.
+// ffprobe output sent by the station is used if given, otherwise the file is probed at its media path (or localPath).
+// Declared values are kept, probed ones complete them.
+// Disagreements are logged and recorded in the probe_inconsistencies property.
+func probeAVFile(x AVFile, localPath string, props map[string]interface{}) error {
+	var res *probe.Result
+	var err error
+	if len(x.FFProbe) > 0 {
+		res, err = probe.ParseFFProbe(x.FFProbe)
+		if err != nil {
+			return NewBadRequestError(errors.WithMessagef(err, "ffprobe of %s", x.FileName))
+		}
+	} else {
+		path := x.MediaPath
+		if path == "" {
+			path = localPath
+		}
+		if path == "" || MediaProber == nil {
+			return nil
+		}
+
+		path, err = mediaPath(path)
+		if err != nil {
+			return NewBadRequestError(err)
+		}
+
+		res, err = MediaProber.Probe(path)
+		if err != nil {
+			log.Warnf("Probe %s: %s", path, err.Error())
+			return nil
+		}
+	}
+
+	for k, v := range res.Properties() {
+		if cur, ok := props[k]; !ok || cur == 0.0 || cur == "" {
+			props[k] = v
+		}
+	}
+
+	inconsistencies := probe.Check(probe.Declared{
+		Duration:  x.Duration,
+		VideoSize: x.VideoSize,
+		Size:      x.Size,
+	}, res)
+	if len(inconsistencies) > 0 {
+		for _, i := range inconsistencies {
+			log.Warnf("Probe %s [%s] %s", x.FileName, x.Sha1, i.String())
+		}
+		props["probe_inconsistencies"] = inconsistencies
+	}
+
+	return nil
+}
+
+// mediaPath resolves a media path under MediaRoot
+func mediaPath(path string) (string, error) {
+	return utils.PathUnder(MediaRoot, path)
+}
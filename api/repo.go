@@ -207,6 +207,38 @@ func FindOperationsByWorkflowID(exec boil.Executor, workflowID interface{}, opTy
 	).All()
 }
 
+func UpdateOperationProperties(exec boil.Executor, op *models.Operation, props map[string]interface{}) error {
+	if len(props) == 0 {
+		return nil
+	}
+
+	var p map[string]interface{}
+	if op.Properties.Valid {
+		err := op.Properties.Unmarshal(&p)
+		if err != nil {
+			return errors.Wrap(err, "json.Unmarshal")
+		}
+		for k, v := range props {
+			p[k] = v
+		}
+	} else {
+		p = props
+	}
+
+	fpa, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrap(err, "json Marshal")
+	}
+
+	op.Properties = null.JSONFrom(fpa)
+	err = op.Update(exec, "properties")
+	if err != nil {
+		return errors.Wrap(err, "Save properties to DB")
+	}
+
+	return nil
+}
+
 func CreateCollection(exec boil.Executor, contentType string, properties map[string]interface{}) (*models.Collection, error) {
 	ct, ok := common.CONTENT_TYPE_REGISTRY.ByName[contentType]
 	if !ok {
@@ -331,6 +363,9 @@ func DeleteContentUnit(exec boil.Executor, unit *models.ContentUnit) error {
 		"content_units_tags",
 		"content_units_publishers",
 		"content_unit_i18n",
+		"content_unit_segments",
+		"content_units_blog_posts",
+		"content_units_tweets",
 	}
 	for i := range tables {
 		q := fmt.Sprintf("DELETE FROM %s WHERE content_unit_id = $1", tables[i])
@@ -399,6 +434,13 @@ func CreateFile(exec boil.Executor, parent *models.File, f File, properties map[
 		return nil, errors.Wrap(err, "Save to DB")
 	}
 
+	if f.Sha256 != "" {
+		err = SaveFileHash(exec, file.ID, HASH_SHA256, f.Sha256)
+		if err != nil {
+			return nil, errors.Wrap(err, "Save sha256")
+		}
+	}
+
 	return file, nil
 }
 
@@ -428,6 +470,13 @@ func UpdateFile(exec boil.Executor, obj *models.File, parent *models.File, f Fil
 		return errors.Wrap(err, "update properties")
 	}
 
+	if f.Sha256 != "" {
+		err = SaveFileHash(exec, obj.ID, HASH_SHA256, f.Sha256)
+		if err != nil {
+			return errors.Wrap(err, "save sha256")
+		}
+	}
+
 	return nil
 }
 
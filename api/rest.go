@@ -1435,17 +1435,42 @@ func PublisherI18nHandler(c *gin.Context) {
 }
 
 func StoragesHandler(c *gin.Context) {
-	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
-		NewForbiddenError().Abort(c)
-		return
-	}
+	var err *HttpError
+	var resp interface{}
 
-	var r StoragesRequest
-	if c.Bind(&r) != nil {
-		return
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+			NewForbiddenError().Abort(c)
+			return
+		}
+
+		var r StoragesRequest
+		if c.Bind(&r) != nil {
+			return
+		}
+
+		resp, err = handleStoragesList(c.MustGet("MDB").(*sql.DB), r)
+	case http.MethodPost:
+		if !isAdmin(c) {
+			NewForbiddenError().Abort(c)
+			return
+		}
+
+		var s NewStorage
+		if c.BindJSON(&s) != nil {
+			return
+		}
+
+		tx := mustBeginTx(c)
+		resp, err = handleCreateStorage(tx, &s)
+		mustConcludeTx(tx, err)
+
+		if err == nil {
+			emitEvents(c, events.StorageCreateEvent(resp.(*models.Storage)))
+		}
 	}
 
-	resp, err := handleStoragesList(c.MustGet("MDB").(*sql.DB), r)
 	concludeRequest(c, resp, err)
 }
 
@@ -3172,6 +3197,9 @@ func handleFilesList(cp utils.ContextProvider, exec boil.Executor, r FilesReques
 	if err := appendSHA1sFilterMods(&mods, r.SHA1sFilter); err != nil {
 		return nil, NewBadRequestError(err)
 	}
+	if err := appendSHA256sFilterMods(&mods, r.SHA256sFilter); err != nil {
+		return nil, NewBadRequestError(err)
+	}
 	if err := appendDateRangeFilterMods(&mods, r.DateRangeFilter, "file_created_at"); err != nil {
 		return nil, NewBadRequestError(err)
 	}
@@ -3334,9 +3362,17 @@ func handleFileStorages(cp utils.ContextProvider, exec boil.Executor, id int64)
 		return nil, NewInternalError(err)
 	}
 
+	fixity, err := FindFileStoragesFixity(exec, id)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
 	data := make([]*Storage, len(storages))
 	for i := range storages {
-		data[i] = &Storage{Storage: *storages[i]}
+		data[i] = &Storage{
+			Storage: *storages[i],
+			Fixity:  fixity[storages[i].ID],
+		}
 	}
 
 	return data, nil
@@ -4180,8 +4216,21 @@ func appendListMods(mods *[]qm.QueryMod, r ListRequest) error {
 		*mods = append(*mods, qm.OrderBy(r.OrderBy))
 	}
 
-	var limit, offset int
+	limit, offset, err := listLimitOffset(r)
+	if err != nil {
+		return err
+	}
+
+	*mods = append(*mods, qm.Limit(limit))
+	if offset != 0 {
+		*mods = append(*mods, qm.Offset(offset))
+	}
+
+	return nil
+}
 
+// listLimitOffset translates the paging part of a ListRequest to SQL limit and offset
+func listLimitOffset(r ListRequest) (limit int, offset int, err error) {
 	if r.StartIndex == 0 {
 		// pagination style
 		if r.PageSize == 0 {
@@ -4198,18 +4247,13 @@ func appendListMods(mods *[]qm.QueryMod, r ListRequest) error {
 		if r.StopIndex == 0 {
 			limit = MAX_PAGE_SIZE
 		} else if r.StopIndex < r.StartIndex {
-			return errors.Errorf("Invalid range [%d-%d]", r.StartIndex, r.StopIndex)
+			err = errors.Errorf("Invalid range [%d-%d]", r.StartIndex, r.StopIndex)
 		} else {
 			limit = r.StopIndex - r.StartIndex + 1
 		}
 	}
 
-	*mods = append(*mods, qm.Limit(limit))
-	if offset != 0 {
-		*mods = append(*mods, qm.Offset(offset))
-	}
-
-	return nil
+	return
 }
 
 func appendPermissionsMods(cp utils.ContextProvider, mods *[]qm.QueryMod) {
@@ -4359,6 +4403,26 @@ func appendSHA1sFilterMods(mods *[]qm.QueryMod, f SHA1sFilter) error {
 	return nil
 }
 
+func appendSHA256sFilterMods(mods *[]qm.QueryMod, f SHA256sFilter) error {
+	if utils.IsEmpty(f.SHA256s) {
+		return nil
+	}
+
+	hexSHA256s := make([][]byte, 0)
+	for i := range f.SHA256s {
+		s, err := hex.DecodeString(f.SHA256s[i])
+		if err != nil {
+			return errors.Wrapf(err, "hex.DecodeString [%d]: %s", i, f.SHA256s[i])
+		}
+		hexSHA256s = append(hexSHA256s, s)
+	}
+
+	*mods = append(*mods, qm.Where("id IN (SELECT file_id FROM file_hashes WHERE algo = ? AND hash = ANY(?))",
+		HASH_SHA256, pq.ByteaArray(hexSHA256s)))
+
+	return nil
+}
+
 func appendDateRangeFilterMods(mods *[]qm.QueryMod, f DateRangeFilter, field string) error {
 	s, e, err := f.Range()
 	if err != nil {
@@ -0,0 +1,736 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+/* revert
+
+A send operation (or an insert in "new" mode) creates units, collections and files
+and modifies existing files, units and collections along the way.
+
+We keep a snapshot of the prior state of every row it modified, and the ids of every row it created,
+in the operation's properties. Reverting restores that state,
+as long as no later operation depends on the outcome of the original one.
+
+*/
+
+const (
+	REVERT_SNAPSHOT_KEY = "revert_snapshot"
+	REVERTED_AT_KEY     = "reverted_at"
+)
+
+// All files in the trees of the given files and in the trees of related captures (same workflow_id).
+// These are all the files a send might modify.
+const SEND_SNAPSHOT_FILES_SQL = `
+WITH RECURSIVE up AS (
+  SELECT id, parent_id
+  FROM files
+  WHERE id = ANY ($1)
+  UNION
+  SELECT f.id, f.parent_id
+  FROM files f INNER JOIN up ON f.id = up.parent_id
+), roots AS (
+  SELECT id
+  FROM up
+  WHERE parent_id IS NULL
+  UNION
+  SELECT fo.file_id
+  FROM files_operations fo INNER JOIN operations o ON fo.operation_id = o.id AND o.type_id = $2
+  WHERE o.properties ->> 'workflow_id' IN (
+    SELECT o2.properties ->> 'workflow_id'
+    FROM files_operations fo2 INNER JOIN operations o2 ON fo2.operation_id = o2.id AND o2.type_id = $2
+    WHERE fo2.file_id IN (SELECT id FROM up))
+), down AS (
+  SELECT id
+  FROM roots
+  UNION
+  SELECT f.id
+  FROM files f INNER JOIN down ON f.parent_id = down.id
+) SELECT array_agg(DISTINCT x.id)
+  FROM (SELECT id FROM up UNION SELECT id FROM down) AS x
+`
+
+// Operations performed after $2 on the given files or their descendants
+const LATER_OPERATIONS_SQL = `
+WITH RECURSIVE rf AS (
+  SELECT id
+  FROM files
+  WHERE id = ANY ($1)
+  UNION
+  SELECT f.id
+  FROM files f INNER JOIN rf ON f.parent_id = rf.id
+) SELECT array_agg(DISTINCT fo.operation_id)
+  FROM files_operations fo
+  WHERE fo.file_id IN (SELECT id FROM rf) AND fo.operation_id > $2
+`
+
+type FileSnapshot struct {
+	ID            int64       `json:"id"`
+	Name          string      `json:"name"`
+	Language      null.String `json:"language"`
+	ContentUnitID null.Int64  `json:"content_unit_id"`
+	Properties    null.JSON   `json:"properties"`
+	Published     bool        `json:"published"`
+}
+
+type ContentUnitSnapshot struct {
+	ID         int64     `json:"id"`
+	TypeID     int64     `json:"type_id"`
+	Properties null.JSON `json:"properties"`
+	Published  bool      `json:"published"`
+}
+
+type CollectionSnapshot struct {
+	ID         int64     `json:"id"`
+	TypeID     int64     `json:"type_id"`
+	Properties null.JSON `json:"properties"`
+	Published  bool      `json:"published"`
+}
+
+type OperationSnapshot struct {
+	Files              []*FileSnapshot        `json:"files,omitempty"`
+	ContentUnits       []*ContentUnitSnapshot `json:"content_units,omitempty"`
+	Collections        []*CollectionSnapshot  `json:"collections,omitempty"`
+	CreatedFiles       []int64                `json:"created_files,omitempty"`
+	CreatedUnits       []int64                `json:"created_units,omitempty"`
+	CreatedCollections []int64                `json:"created_collections,omitempty"`
+}
+
+func OperationRevertHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_WRITE) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, evnts, err := handleRevertOperation(tx, id)
+	mustConcludeTx(tx, err)
+
+	if err == nil {
+		emitEvents(c, evnts...)
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func handleRevertOperation(exec boil.Executor, id int64) (*models.Operation, []events.Event, *HttpError) {
+	op, err := models.FindOperation(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, NewNotFoundError()
+		}
+		return nil, nil, NewInternalError(err)
+	}
+
+	opType := common.OPERATION_TYPE_REGISTRY.ByID[op.TypeID].Name
+	if opType != common.OP_SEND && opType != common.OP_INSERT {
+		return nil, nil, NewBadRequestError(errors.Errorf("Can't revert %s operations", opType))
+	}
+
+	var props struct {
+		Snapshot   *OperationSnapshot `json:"revert_snapshot"`
+		RevertedAt *time.Time         `json:"reverted_at"`
+	}
+	if op.Properties.Valid {
+		if err := op.Properties.Unmarshal(&props); err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "json.Unmarshal properties"))
+		}
+	}
+	if props.RevertedAt != nil {
+		return nil, nil, NewBadRequestError(errors.Errorf("Operation already reverted at %s", props.RevertedAt))
+	}
+	if props.Snapshot == nil {
+		return nil, nil, NewBadRequestError(errors.New("Operation has no revert snapshot"))
+	}
+
+	// files whose outcome later operations might depend on
+	var roots []int64
+	if opType == common.OP_SEND {
+		err = queries.Raw(exec, "SELECT array_agg(file_id) FROM files_operations WHERE operation_id = $1", op.ID).
+			QueryRow().Scan((*pq.Int64Array)(&roots))
+		if err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "Load operation files"))
+		}
+	}
+	roots = append(roots, props.Snapshot.CreatedFiles...)
+
+	if err := props.Snapshot.checkDependencies(exec, op, roots); err != nil {
+		return nil, nil, err
+	}
+
+	log.Infof("Reverting %s operation %d", opType, op.ID)
+	evnts, err := props.Snapshot.restore(exec, op)
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+
+	err = UpdateOperationProperties(exec, op, map[string]interface{}{
+		REVERTED_AT_KEY: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+
+	return op, evnts, nil
+}
+
+// takeSendSnapshot records the state of everything a send in "new" mode might modify.
+func takeSendSnapshot(exec boil.Executor, metadata CITMetadata, original, proxy *models.File) (*OperationSnapshot, error) {
+	s := new(OperationSnapshot)
+
+	ids := []int64{original.ID}
+	if proxy != nil {
+		ids = append(ids, proxy.ID)
+	}
+	var fileIDs pq.Int64Array
+	err := queries.Raw(exec, SEND_SNAPSHOT_FILES_SQL,
+		pq.Array(ids), common.OPERATION_TYPE_REGISTRY.ByName[common.OP_CAPTURE_STOP].ID).
+		QueryRow().
+		Scan(&fileIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Lookup snapshot files")
+	}
+	if err := s.addFiles(exec, fileIDs...); err != nil {
+		return nil, err
+	}
+
+	// derived units waiting for their main unit
+	if original.ParentID.Valid {
+		derived, err := mainToDerived(exec, metadata, original)
+		if err != nil {
+			return nil, err
+		}
+		cuIDs := make([]int64, 0, len(derived))
+		for k := range derived {
+			cuIDs = append(cuIDs, k)
+		}
+		if err := s.addUnits(exec, cuIDs...); err != nil {
+			return nil, err
+		}
+	}
+
+	// lesson collection which might be updated by a full lesson
+	captureStop, err := FindUpChainOperation(exec, original.ID, common.OP_CAPTURE_STOP)
+	if err != nil {
+		if _, ok := err.(UpChainOperationNotFound); !ok {
+			return nil, err
+		}
+	} else if captureStop.Properties.Valid {
+		var csProps map[string]interface{}
+		if err := captureStop.Properties.Unmarshal(&csProps); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal capture_stop properties")
+		}
+		if captureID, ok := csProps["collection_uid"]; ok {
+			c, err := FindCollectionByCaptureID(exec, captureID)
+			if err != nil {
+				if _, ok := err.(CollectionNotFound); !ok {
+					return nil, err
+				}
+			} else if err := s.addCollections(exec, c.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *OperationSnapshot) addFiles(exec boil.Executor, ids ...int64) error {
+	ids = s.missing(ids, s.fileIDs())
+	if len(ids) == 0 {
+		return nil
+	}
+
+	files, err := models.Files(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load snapshot files")
+	}
+	for i := range files {
+		s.Files = append(s.Files, newFileSnapshot(files[i]))
+	}
+
+	return nil
+}
+
+func (s *OperationSnapshot) addUnits(exec boil.Executor, ids ...int64) error {
+	ids = s.missing(ids, s.unitIDs())
+	if len(ids) == 0 {
+		return nil
+	}
+
+	units, err := models.ContentUnits(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load snapshot content units")
+	}
+	for i := range units {
+		s.ContentUnits = append(s.ContentUnits, newContentUnitSnapshot(units[i]))
+	}
+
+	return nil
+}
+
+func (s *OperationSnapshot) addCollections(exec boil.Executor, ids ...int64) error {
+	ids = s.missing(ids, s.collectionIDs())
+	if len(ids) == 0 {
+		return nil
+	}
+
+	collections, err := models.Collections(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load snapshot collections")
+	}
+	for i := range collections {
+		s.Collections = append(s.Collections, newCollectionSnapshot(collections[i]))
+	}
+
+	return nil
+}
+
+func (s *OperationSnapshot) hasUnit(id int64) bool {
+	for i := range s.ContentUnits {
+		if s.ContentUnits[i].ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// conclude is called after the operation is done.
+// It picks up created collections from the operation's events
+// and drops whatever wasn't modified.
+func (s *OperationSnapshot) conclude(exec boil.Executor, evnts []events.Event) error {
+	for i := range evnts {
+		if evnts[i].Type == events.E_COLLECTION_CREATE {
+			if id, ok := evnts[i].Payload["id"].(int64); ok {
+				s.CreatedCollections = append(s.CreatedCollections, id)
+			}
+		}
+	}
+
+	if len(s.Files) > 0 {
+		files, err := models.Files(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.fileIDs())...)).All()
+		if err != nil {
+			return errors.Wrap(err, "Reload snapshot files")
+		}
+		current := make(map[int64]*FileSnapshot, len(files))
+		for i := range files {
+			current[files[i].ID] = newFileSnapshot(files[i])
+		}
+		changed := make([]*FileSnapshot, 0)
+		for _, x := range s.Files {
+			if y, ok := current[x.ID]; ok && !x.equals(y) {
+				changed = append(changed, x)
+			}
+		}
+		s.Files = changed
+	}
+
+	if len(s.ContentUnits) > 0 {
+		units, err := models.ContentUnits(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.unitIDs())...)).All()
+		if err != nil {
+			return errors.Wrap(err, "Reload snapshot content units")
+		}
+		current := make(map[int64]*ContentUnitSnapshot, len(units))
+		for i := range units {
+			current[units[i].ID] = newContentUnitSnapshot(units[i])
+		}
+		changed := make([]*ContentUnitSnapshot, 0)
+		for _, x := range s.ContentUnits {
+			if y, ok := current[x.ID]; ok && !x.equals(y) {
+				changed = append(changed, x)
+			}
+		}
+		s.ContentUnits = changed
+	}
+
+	if len(s.Collections) > 0 {
+		collections, err := models.Collections(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.collectionIDs())...)).All()
+		if err != nil {
+			return errors.Wrap(err, "Reload snapshot collections")
+		}
+		current := make(map[int64]*CollectionSnapshot, len(collections))
+		for i := range collections {
+			current[collections[i].ID] = newCollectionSnapshot(collections[i])
+		}
+		changed := make([]*CollectionSnapshot, 0)
+		for _, x := range s.Collections {
+			if y, ok := current[x.ID]; ok && !x.equals(y) {
+				changed = append(changed, x)
+			}
+		}
+		s.Collections = changed
+	}
+
+	return nil
+}
+
+// checkDependencies makes sure nothing that came after the operation relies on its outcome.
+func (s *OperationSnapshot) checkDependencies(exec boil.Executor, op *models.Operation, roots []int64) *HttpError {
+	if len(roots) > 0 {
+		var opIDs pq.Int64Array
+		err := queries.Raw(exec, LATER_OPERATIONS_SQL, pq.Array(roots), op.ID).QueryRow().Scan(&opIDs)
+		if err != nil {
+			return NewInternalError(errors.Wrap(err, "Lookup later operations"))
+		}
+		if len(opIDs) > 0 {
+			return NewBadRequestError(errors.Errorf("Later operations depend on this one: %v", opIDs))
+		}
+	}
+
+	if len(s.CreatedUnits) > 0 {
+		known := append(s.fileIDs(), s.CreatedFiles...)
+		var fileIDs pq.Int64Array
+		err := queries.Raw(exec,
+			"SELECT array_agg(id) FROM files WHERE content_unit_id = ANY($1) AND NOT id = ANY($2)",
+			pq.Array(s.CreatedUnits), pq.Array(known)).
+			QueryRow().
+			Scan(&fileIDs)
+		if err != nil {
+			return NewInternalError(errors.Wrap(err, "Lookup created units files"))
+		}
+		if len(fileIDs) > 0 {
+			return NewBadRequestError(errors.Errorf("Files were added to created units since: %v", fileIDs))
+		}
+
+		var cuIDs pq.Int64Array
+		err = queries.Raw(exec,
+			"SELECT array_agg(derived_id) FROM content_unit_derivations WHERE source_id = ANY($1) AND NOT derived_id = ANY($2)",
+			pq.Array(s.CreatedUnits), pq.Array(append(s.unitIDs(), s.CreatedUnits...))).
+			QueryRow().
+			Scan(&cuIDs)
+		if err != nil {
+			return NewInternalError(errors.Wrap(err, "Lookup created units derivations"))
+		}
+		if len(cuIDs) > 0 {
+			return NewBadRequestError(errors.Errorf("Units were derived from created units since: %v", cuIDs))
+		}
+	}
+
+	if len(s.CreatedCollections) > 0 {
+		var cuIDs pq.Int64Array
+		err := queries.Raw(exec,
+			"SELECT array_agg(content_unit_id) FROM collections_content_units WHERE collection_id = ANY($1) AND NOT content_unit_id = ANY($2)",
+			pq.Array(s.CreatedCollections), pq.Array(s.CreatedUnits)).
+			QueryRow().
+			Scan(&cuIDs)
+		if err != nil {
+			return NewInternalError(errors.Wrap(err, "Lookup created collections units"))
+		}
+		if len(cuIDs) > 0 {
+			return NewBadRequestError(errors.Errorf("Units were added to created collections since: %v", cuIDs))
+		}
+	}
+
+	return nil
+}
+
+// restore brings back the snapshot state and removes whatever the operation created.
+func (s *OperationSnapshot) restore(exec boil.Executor, op *models.Operation) ([]events.Event, error) {
+	evnts := make([]events.Event, 0)
+	created := make(map[int64]bool, len(s.CreatedUnits))
+	for _, id := range s.CreatedUnits {
+		created[id] = true
+	}
+
+	// files
+	if len(s.Files) > 0 {
+		files, err := models.Files(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.fileIDs())...)).All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load files")
+		}
+		fm := make(map[int64]*models.File, len(files))
+		for i := range files {
+			fm[files[i].ID] = files[i]
+		}
+
+		for _, x := range s.Files {
+			f, ok := fm[x.ID]
+			if !ok {
+				continue
+			}
+
+			// moved to some other unit by a later operation, leave it there
+			if f.ContentUnitID != x.ContentUnitID && !created[f.ContentUnitID.Int64] {
+				log.Infof("File %d moved to unit %d since, skipping", f.ID, f.ContentUnitID.Int64)
+				continue
+			}
+
+			f.Name = x.Name
+			f.Language = x.Language
+			f.ContentUnitID = x.ContentUnitID
+			f.Properties = x.Properties
+			f.Published = x.Published
+			err = f.Update(exec, "name", "language", "content_unit_id", "properties", "published")
+			if err != nil {
+				return nil, errors.Wrapf(err, "Restore file %d", f.ID)
+			}
+			evnts = append(evnts, events.FileUpdateEvent(f))
+		}
+	}
+
+	if len(s.CreatedFiles) > 0 {
+		files, err := models.Files(exec, qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.CreatedFiles)...)).All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load created files")
+		}
+		for _, f := range files {
+			for _, q := range []string{
+				"DELETE FROM files_operations WHERE file_id = $1",
+				"DELETE FROM files_storages WHERE file_id = $1",
+			} {
+				if _, err := queries.Raw(exec, q, f.ID).Exec(); err != nil {
+					return nil, errors.Wrapf(err, "Delete created file %d associations", f.ID)
+				}
+			}
+			if err := f.Delete(exec); err != nil {
+				return nil, errors.Wrapf(err, "Delete created file %d", f.ID)
+			}
+			evnts = append(evnts, events.FileRemoveEvent(f))
+		}
+	}
+
+	// units
+	changedCollections := make(map[int64]bool)
+	if len(s.CreatedUnits) > 0 {
+		units, err := models.ContentUnits(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(s.CreatedUnits)...),
+			qm.Load("CollectionsContentUnits")).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load created units")
+		}
+
+		_, err = queries.Raw(exec,
+			"DELETE FROM content_unit_derivations WHERE source_id = ANY($1) OR derived_id = ANY($1)",
+			pq.Array(s.CreatedUnits)).
+			Exec()
+		if err != nil {
+			return nil, errors.Wrap(err, "Delete created units derivations")
+		}
+
+		for _, cu := range units {
+			for _, ccu := range cu.R.CollectionsContentUnits {
+				changedCollections[ccu.CollectionID] = true
+			}
+			if err := DeleteContentUnit(exec, cu); err != nil {
+				return nil, errors.Wrapf(err, "Delete created unit %d", cu.ID)
+			}
+			evnts = append(evnts, events.ContentUnitDeleteEvent(cu))
+		}
+	}
+
+	for _, x := range s.ContentUnits {
+		cu, err := models.FindContentUnit(exec, x.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, errors.Wrapf(err, "Load unit %d", x.ID)
+		}
+
+		publishedChange := cu.Published != x.Published
+		cu.TypeID = x.TypeID
+		cu.Properties = x.Properties
+		cu.Published = x.Published
+		if err := cu.Update(exec, "type_id", "properties", "published"); err != nil {
+			return nil, errors.Wrapf(err, "Restore unit %d", cu.ID)
+		}
+		evnts = append(evnts, events.ContentUnitUpdateEvent(cu))
+		if publishedChange {
+			evnts = append(evnts, events.ContentUnitPublishedChangeEvent(cu))
+		}
+	}
+
+	// collections
+	for _, id := range s.CreatedCollections {
+		delete(changedCollections, id)
+		c, err := models.FindCollection(exec, id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, errors.Wrapf(err, "Load created collection %d", id)
+		}
+
+		err = models.CollectionsContentUnits(exec, qm.Where("collection_id = ?", id)).DeleteAll()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Delete created collection %d units", id)
+		}
+		err = models.CollectionI18ns(exec, qm.Where("collection_id = ?", id)).DeleteAll()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Delete created collection %d i18n", id)
+		}
+		if err := c.Delete(exec); err != nil {
+			return nil, errors.Wrapf(err, "Delete created collection %d", id)
+		}
+		evnts = append(evnts, events.CollectionDeleteEvent(c))
+	}
+
+	for _, x := range s.Collections {
+		c, err := models.FindCollection(exec, x.ID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, errors.Wrapf(err, "Load collection %d", x.ID)
+		}
+
+		publishedChange := c.Published != x.Published
+		c.TypeID = x.TypeID
+		c.Properties = x.Properties
+		c.Published = x.Published
+		if err := c.Update(exec, "type_id", "properties", "published"); err != nil {
+			return nil, errors.Wrapf(err, "Restore collection %d", c.ID)
+		}
+		evnts = append(evnts, events.CollectionUpdateEvent(c))
+		if publishedChange {
+			evnts = append(evnts, events.CollectionPublishedChangeEvent(c))
+		}
+	}
+
+	for id := range changedCollections {
+		c, err := models.FindCollection(exec, id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Load collection %d", id)
+		}
+		evnts = append(evnts, events.CollectionContentUnitsChangeEvent(c))
+	}
+
+	return evnts, nil
+}
+
+func (s *OperationSnapshot) fileIDs() []int64 {
+	ids := make([]int64, len(s.Files))
+	for i := range s.Files {
+		ids[i] = s.Files[i].ID
+	}
+	return ids
+}
+
+func (s *OperationSnapshot) unitIDs() []int64 {
+	ids := make([]int64, len(s.ContentUnits))
+	for i := range s.ContentUnits {
+		ids[i] = s.ContentUnits[i].ID
+	}
+	return ids
+}
+
+func (s *OperationSnapshot) collectionIDs() []int64 {
+	ids := make([]int64, len(s.Collections))
+	for i := range s.Collections {
+		ids[i] = s.Collections[i].ID
+	}
+	return ids
+}
+
+// missing returns the ids not in existing
+func (s *OperationSnapshot) missing(ids []int64, existing []int64) []int64 {
+	m := make(map[int64]bool, len(existing))
+	for _, id := range existing {
+		m[id] = true
+	}
+
+	res := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !m[id] {
+			res = append(res, id)
+			m[id] = true
+		}
+	}
+	return res
+}
+
+func newFileSnapshot(f *models.File) *FileSnapshot {
+	return &FileSnapshot{
+		ID:            f.ID,
+		Name:          f.Name,
+		Language:      f.Language,
+		ContentUnitID: f.ContentUnitID,
+		Properties:    f.Properties,
+		Published:     f.Published,
+	}
+}
+
+func (x *FileSnapshot) equals(y *FileSnapshot) bool {
+	return x.ID == y.ID &&
+		x.Name == y.Name &&
+		x.Language == y.Language &&
+		x.ContentUnitID == y.ContentUnitID &&
+		x.Published == y.Published &&
+		sameJSON(x.Properties, y.Properties)
+}
+
+func newContentUnitSnapshot(cu *models.ContentUnit) *ContentUnitSnapshot {
+	return &ContentUnitSnapshot{
+		ID:         cu.ID,
+		TypeID:     cu.TypeID,
+		Properties: cu.Properties,
+		Published:  cu.Published,
+	}
+}
+
+func (x *ContentUnitSnapshot) equals(y *ContentUnitSnapshot) bool {
+	return x.ID == y.ID &&
+		x.TypeID == y.TypeID &&
+		x.Published == y.Published &&
+		sameJSON(x.Properties, y.Properties)
+}
+
+func newCollectionSnapshot(c *models.Collection) *CollectionSnapshot {
+	return &CollectionSnapshot{
+		ID:         c.ID,
+		TypeID:     c.TypeID,
+		Properties: c.Properties,
+		Published:  c.Published,
+	}
+}
+
+func (x *CollectionSnapshot) equals(y *CollectionSnapshot) bool {
+	return x.ID == y.ID &&
+		x.TypeID == y.TypeID &&
+		x.Published == y.Published &&
+		sameJSON(x.Properties, y.Properties)
+}
+
+// sameJSON compares two json values semantically
+func sameJSON(x, y null.JSON) bool {
+	if x.Valid != y.Valid {
+		return false
+	}
+	if !x.Valid || bytes.Equal(x.JSON, y.JSON) {
+		return true
+	}
+
+	var a, b interface{}
+	if json.Unmarshal(x.JSON, &a) != nil || json.Unmarshal(y.JSON, &b) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return bytes.Equal(ja, jb)
+}
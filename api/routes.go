@@ -48,6 +48,8 @@ func SetupRoutes(router *gin.Engine) {
 	rest.PUT("/content_units/:id/derivatives/:duID", ContentUnitDerivativesHandler)
 	rest.DELETE("/content_units/:id/derivatives/:duID", ContentUnitDerivativesHandler)
 	rest.GET("/content_units/:id/origins/", ContentUnitOriginsHandler)
+	rest.GET("/content_units/:id/subtitles", ContentUnitSubtitlesHandler)
+	rest.GET("/content_units/:id/jsonld", ContentUnitJSONLDHandler)
 	rest.GET("/content_units/:id/sources/", ContentUnitSourcesHandler)
 	rest.POST("/content_units/:id/sources/", ContentUnitSourcesHandler)
 	rest.DELETE("/content_units/:id/sources/:sourceID", ContentUnitSourcesHandler)
@@ -60,15 +62,25 @@ func SetupRoutes(router *gin.Engine) {
 	rest.GET("/content_units/:id/publishers/", ContentUnitPublishersHandler)
 	rest.POST("/content_units/:id/publishers/", ContentUnitPublishersHandler)
 	rest.DELETE("/content_units/:id/publishers/:publisherID", ContentUnitPublishersHandler)
+	rest.GET("/content_units/:id/segments/", ContentUnitSegmentsHandler)
+	rest.POST("/content_units/:id/segments/", ContentUnitSegmentsHandler)
+	rest.PUT("/content_units/:id/segments/:segmentID", ContentUnitSegmentsHandler)
+	rest.DELETE("/content_units/:id/segments/:segmentID", ContentUnitSegmentsHandler)
 	rest.POST("/content_units/:id/merge", ContentUnitMergeHandler)
 	rest.GET("/files/", FilesListHandler)
 	rest.GET("/files/:id/", FileHandler)
 	rest.PUT("/files/:id/", FileHandler)
 	rest.GET("/files/:id/storages/", FileStoragesHandler)
 	rest.GET("/files/:id/tree/", FilesWithOperationsTreeHandler)
+	rest.GET("/files/:id/lineage", FileLineageHandler)
+	rest.GET("/files_by_hash/:algo/:hash", FileByHashHandler)
 	rest.GET("/operations/", OperationsListHandler)
 	rest.GET("/operations/:id/", OperationItemHandler)
 	rest.GET("/operations/:id/files/", OperationFilesHandler)
+	rest.POST("/operations/:id/revert", OperationRevertHandler)
+	rest.GET("/workflows/", WorkflowsListHandler)
+	rest.GET("/workflows/:workflow_id/", WorkflowHandler)
+	rest.GET("/captures/active", ActiveCapturesHandler)
 	rest.GET("/authors/", AuthorsHandler)
 	rest.GET("/sources/", SourcesHandler)
 	rest.POST("/sources/", SourcesHandler)
@@ -87,6 +99,43 @@ func SetupRoutes(router *gin.Engine) {
 	rest.DELETE("/persons/:id/", PersonHandler)
 	rest.PUT("/persons/:id/i18n/", PersonI18nHandler)
 	rest.GET("/storages/", StoragesHandler)
+	rest.POST("/storages/", StoragesHandler)
+	rest.GET("/storages/compliance", StoragesComplianceHandler)
+	rest.GET("/storages/offline_impact", StoragesOfflineImpactHandler)
+	rest.POST("/storages/offline", StoragesOfflineHandler)
+	rest.PUT("/storages/:id", StorageHandler)
+	rest.POST("/fixity_reports", FixityReportsHandler)
+	rest.GET("/jobs/", JobsHandler)
+	rest.POST("/jobs/", JobsHandler)
+	rest.GET("/jobs/:id", JobHandler)
+	rest.GET("/jobs/:id/logs", JobLogsHandler)
+	rest.POST("/jobs/:id/resume", JobResumeHandler)
+	rest.GET("/job_types", JobTypesHandler)
+	rest.GET("/scheduler/runs", SchedulerRunsHandler)
+	rest.GET("/naming/validate", NamingValidateHandler)
+	rest.POST("/naming/validate", NamingValidateHandler)
+	rest.POST("/naming/suggest", NamingSuggestHandler)
+	rest.GET("/scheduler/latest", SchedulerLatestRunsHandler)
+	rest.GET("/blog_posts/", BlogPostsListHandler)
+	rest.GET("/blog_posts/:id/", BlogPostHandler)
+	rest.POST("/blog_posts/:id/hide", BlogPostHideHandler)
+	rest.POST("/blog_posts/:id/unhide", BlogPostUnhideHandler)
+	rest.GET("/blog_posts/:id/content_units/", BlogPostContentUnitsHandler)
+	rest.POST("/blog_posts/:id/content_units/", BlogPostContentUnitsHandler)
+	rest.DELETE("/blog_posts/:id/content_units/:cuID", BlogPostContentUnitsHandler)
+	rest.GET("/tweets/", TweetsListHandler)
+	rest.GET("/tweets/:id/", TweetHandler)
+	rest.POST("/tweets/:id/hide", TweetHideHandler)
+	rest.POST("/tweets/:id/unhide", TweetUnhideHandler)
+	rest.GET("/tweets/:id/content_units/", TweetContentUnitsHandler)
+	rest.POST("/tweets/:id/content_units/", TweetContentUnitsHandler)
+	rest.DELETE("/tweets/:id/content_units/:cuID", TweetContentUnitsHandler)
+	rest.GET("/social/accounts", SocialAccountsHandler)
+	rest.GET("/social/posts", SocialPostsHandler)
+	rest.GET("/transcode_queue/", TranscodeQueueHandler)
+	rest.POST("/transcode_queue/", TranscodeQueueHandler)
+	rest.POST("/transcode_queue/lease", TranscodeQueueLeaseHandler)
+	rest.POST("/transcode_queue/requeue", TranscodeQueueRequeueHandler)
 	rest.GET("/publishers/", PublishersHandler)
 	rest.POST("/publishers/", PublishersHandler)
 	rest.GET("/publishers/:id/", PublisherHandler)
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"database/sql"
+
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/scheduler"
+)
+
+func SchedulerRunsHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r SchedulerRunsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleSchedulerRuns(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+// SchedulerLatestRunsHandler returns the last run of each scheduled task
+func SchedulerLatestRunsHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	runs, err := scheduler.LatestRuns(c.MustGet("MDB").(*sql.DB))
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	concludeRequest(c, runs, nil)
+}
+
+func handleSchedulerRuns(exec *sql.DB, r SchedulerRunsRequest) (*SchedulerRunsResponse, *HttpError) {
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	total, data, err := scheduler.FindRuns(exec, r.Task, r.Status, limit, offset)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &SchedulerRunsResponse{
+		ListResponse: ListResponse{Total: total},
+		Runs:         data,
+	}, nil
+}
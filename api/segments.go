@@ -0,0 +1,387 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Time coded segments (chapters) of a content unit.
+// Times are in seconds from the beginning of the unit's media.
+
+type ContentUnitSegment struct {
+	ID            int64                              `boil:"id" json:"id"`
+	ContentUnitID int64                              `boil:"content_unit_id" json:"content_unit_id"`
+	StartTime     float64                            `boil:"start_time" json:"start"`
+	EndTime       float64                            `boil:"end_time" json:"end"`
+	SourceID      null.Int64                         `boil:"source_id" json:"source_id"`
+	TagID         null.Int64                         `boil:"tag_id" json:"tag_id"`
+	CreatedAt     time.Time                          `boil:"created_at" json:"created_at"`
+	I18n          map[string]*ContentUnitSegmentI18n `boil:"-" json:"i18n"`
+}
+
+type ContentUnitSegmentI18n struct {
+	SegmentID int64  `boil:"segment_id" json:"-"`
+	Language  string `boil:"language" json:"language"`
+	Title     string `boil:"title" json:"title"`
+}
+
+func ContentUnitSegmentsHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	var err *HttpError
+	var resp interface{}
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		resp, err = handleGetContentUnitSegments(c, c.MustGet("MDB").(*sql.DB), id)
+	case http.MethodPost, http.MethodPut:
+		var segment ContentUnitSegment
+		if c.BindJSON(&segment) != nil {
+			return
+		}
+
+		if c.Request.Method == http.MethodPut {
+			segmentID, e := strconv.ParseInt(c.Param("segmentID"), 10, 0)
+			if e != nil {
+				NewBadRequestError(errors.Wrap(e, "segmentID expects int64")).Abort(c)
+				return
+			}
+			segment.ID = segmentID
+		} else {
+			segment.ID = 0
+		}
+		segment.ContentUnitID = id
+
+		var cu *models.ContentUnit
+		tx := mustBeginTx(c)
+		resp, cu, err = handleSaveContentUnitSegment(c, tx, &segment)
+		mustConcludeTx(tx, err)
+
+		if err == nil {
+			emitEvents(c, events.ContentUnitSegmentsChangeEvent(cu))
+		}
+	case http.MethodDelete:
+		segmentID, e := strconv.ParseInt(c.Param("segmentID"), 10, 0)
+		if e != nil {
+			NewBadRequestError(errors.Wrap(e, "segmentID expects int64")).Abort(c)
+			return
+		}
+
+		var cu *models.ContentUnit
+		tx := mustBeginTx(c)
+		cu, err = handleDeleteContentUnitSegment(c, tx, id, segmentID)
+		mustConcludeTx(tx, err)
+
+		if err == nil {
+			emitEvents(c, events.ContentUnitSegmentsChangeEvent(cu))
+			resp = gin.H{"status": "ok"}
+		}
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+func handleGetContentUnitSegments(cp utils.ContextProvider, exec boil.Executor, id int64) ([]*ContentUnitSegment, *HttpError) {
+	cu, err := models.FindContentUnit(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(cu.Secure), common.PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	segments, err := FindContentUnitSegments(exec, id)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return segments, nil
+}
+
+func handleSaveContentUnitSegment(cp utils.ContextProvider, exec boil.Executor, s *ContentUnitSegment) (*ContentUnitSegment, *models.ContentUnit, *HttpError) {
+	cu, err := models.FindContentUnit(exec, s.ContentUnitID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, NewNotFoundError()
+		} else {
+			return nil, nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(cu.Secure), common.PERM_METADATA_WRITE) {
+		return nil, nil, NewForbiddenError()
+	}
+
+	if s.StartTime < 0 || s.EndTime <= s.StartTime {
+		return nil, nil, NewBadRequestError(errors.Errorf("Invalid segment times [%f, %f]", s.StartTime, s.EndTime))
+	}
+	if s.SourceID.Valid {
+		if ok, err := models.SourceExists(exec, s.SourceID.Int64); err != nil {
+			return nil, nil, NewInternalError(err)
+		} else if !ok {
+			return nil, nil, NewBadRequestError(errors.Errorf("Unknown source id %d", s.SourceID.Int64))
+		}
+	}
+	if s.TagID.Valid {
+		if ok, err := models.TagExists(exec, s.TagID.Int64); err != nil {
+			return nil, nil, NewInternalError(err)
+		} else if !ok {
+			return nil, nil, NewBadRequestError(errors.Errorf("Unknown tag id %d", s.TagID.Int64))
+		}
+	}
+	for k, v := range s.I18n {
+		if l := common.StdLang(k); l == common.LANG_UNKNOWN {
+			return nil, nil, NewBadRequestError(errors.Errorf("Unknown language %s", k))
+		} else if v == nil || v.Title == "" {
+			return nil, nil, NewBadRequestError(errors.Errorf("Missing title for language %s", k))
+		}
+	}
+
+	if s.ID == 0 {
+		err = queries.Raw(exec,
+			`INSERT INTO content_unit_segments (content_unit_id, start_time, end_time, source_id, tag_id)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			s.ContentUnitID, s.StartTime, s.EndTime, s.SourceID, s.TagID).
+			QueryRow().
+			Scan(&s.ID)
+		if err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "Insert segment"))
+		}
+	} else {
+		res, err := queries.Raw(exec,
+			`UPDATE content_unit_segments SET start_time = $1, end_time = $2, source_id = $3, tag_id = $4
+			 WHERE id = $5 AND content_unit_id = $6`,
+			s.StartTime, s.EndTime, s.SourceID, s.TagID, s.ID, s.ContentUnitID).
+			Exec()
+		if err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "Update segment"))
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, nil, NewNotFoundError()
+		}
+
+		_, err = queries.Raw(exec, `DELETE FROM content_unit_segment_i18n WHERE segment_id = $1`, s.ID).Exec()
+		if err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "Delete segment i18n"))
+		}
+	}
+
+	for k, v := range s.I18n {
+		_, err = queries.Raw(exec,
+			`INSERT INTO content_unit_segment_i18n (segment_id, language, title) VALUES ($1, $2, $3)`,
+			s.ID, common.StdLang(k), v.Title).
+			Exec()
+		if err != nil {
+			return nil, nil, NewInternalError(errors.Wrap(err, "Insert segment i18n"))
+		}
+	}
+
+	segment, err := FindContentUnitSegment(exec, s.ID)
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+
+	return segment, cu, nil
+}
+
+func handleDeleteContentUnitSegment(cp utils.ContextProvider, exec boil.Executor, id int64, segmentID int64) (*models.ContentUnit, *HttpError) {
+	cu, err := models.FindContentUnit(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(cu.Secure), common.PERM_METADATA_WRITE) {
+		return nil, NewForbiddenError()
+	}
+
+	res, err := queries.Raw(exec,
+		`DELETE FROM content_unit_segments WHERE id = $1 AND content_unit_id = $2`,
+		segmentID, id).
+		Exec()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, NewNotFoundError()
+	}
+
+	return cu, nil
+}
+
+// FindContentUnitSegments returns the segments of a unit, with their i18n, ordered by time.
+func FindContentUnitSegments(exec boil.Executor, cuID int64) ([]*ContentUnitSegment, error) {
+	var segments []*ContentUnitSegment
+	err := queries.Raw(exec,
+		`SELECT * FROM content_unit_segments WHERE content_unit_id = $1 ORDER BY start_time, id`,
+		cuID).
+		Bind(&segments)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load segments")
+	}
+
+	if err := loadSegmentsI18n(exec, segments); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+func FindContentUnitSegment(exec boil.Executor, id int64) (*ContentUnitSegment, error) {
+	var segment ContentUnitSegment
+	err := queries.Raw(exec, `SELECT * FROM content_unit_segments WHERE id = $1`, id).Bind(&segment)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load segment")
+	}
+
+	if err := loadSegmentsI18n(exec, []*ContentUnitSegment{&segment}); err != nil {
+		return nil, err
+	}
+
+	return &segment, nil
+}
+
+func loadSegmentsI18n(exec boil.Executor, segments []*ContentUnitSegment) error {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(segments))
+	sm := make(map[int64]*ContentUnitSegment, len(segments))
+	for i, s := range segments {
+		ids[i] = s.ID
+		s.I18n = make(map[string]*ContentUnitSegmentI18n)
+		sm[s.ID] = s
+	}
+
+	var i18ns []*ContentUnitSegmentI18n
+	err := queries.Raw(exec,
+		`SELECT * FROM content_unit_segment_i18n WHERE segment_id = ANY($1)`,
+		pq.Array(ids)).
+		Bind(&i18ns)
+	if err != nil {
+		return errors.Wrap(err, "Load segments i18n")
+	}
+
+	for _, i18n := range i18ns {
+		sm[i18n.SegmentID].I18n[i18n.Language] = i18n
+	}
+
+	return nil
+}
+
+// SeedContentUnitSegments creates segments from the cuts of the trim operation that made the unit's media.
+// Trim operation keeps in and out points on the source timeline. Kept pieces are joined one after the other.
+// We seed only for units without segments and for trims of more than a single piece.
+func SeedContentUnitSegments(exec boil.Executor, cu *models.ContentUnit, trim *models.Operation) (bool, error) {
+	if !trim.Properties.Valid {
+		return false, nil
+	}
+
+	var props struct {
+		In  []float64 `json:"in"`
+		Out []float64 `json:"out"`
+	}
+	if err := trim.Properties.Unmarshal(&props); err != nil {
+		return false, errors.Wrap(err, "json.Unmarshal trim properties")
+	}
+
+	pieces := TrimPieces(props.In, props.Out)
+	if len(pieces) < 2 {
+		return false, nil
+	}
+
+	var count int64
+	err := queries.Raw(exec, `SELECT count(*) FROM content_unit_segments WHERE content_unit_id = $1`, cu.ID).
+		QueryRow().
+		Scan(&count)
+	if err != nil {
+		return false, errors.Wrap(err, "Count existing segments")
+	}
+	if count > 0 {
+		log.Infof("Unit %d already has %d segments, not seeding", cu.ID, count)
+		return false, nil
+	}
+
+	for _, p := range pieces {
+		_, err := queries.Raw(exec,
+			`INSERT INTO content_unit_segments (content_unit_id, start_time, end_time) VALUES ($1, $2, $3)`,
+			cu.ID, p[0], p[1]).
+			Exec()
+		if err != nil {
+			return false, errors.Wrap(err, "Insert segment")
+		}
+	}
+
+	return true, nil
+}
+
+// TrimPieces translates trim in and out points to [start, end] pairs on the trimmed media timeline.
+// Invalid pairs (mismatched lengths, empty pieces) yield no pieces.
+func TrimPieces(in, out []float64) [][2]float64 {
+	if len(in) == 0 || len(in) != len(out) {
+		return nil
+	}
+
+	pieces := make([][2]float64, 0, len(in))
+	var offset float64
+	for i := range in {
+		d := out[i] - in[i]
+		if d <= 0 {
+			return nil
+		}
+		pieces = append(pieces, [2]float64{offset, offset + d})
+		offset += d
+	}
+
+	return pieces
+}
+
+// FindTrimOperation returns the trim operation which created the given file, if any.
+func FindTrimOperation(exec boil.Executor, fileID int64) (*models.Operation, error) {
+	op, err := models.Operations(exec,
+		qm.InnerJoin("files_operations fo ON fo.operation_id = operations.id"),
+		qm.Where("fo.file_id = ? AND operations.type_id = ?",
+			fileID, common.OPERATION_TYPE_REGISTRY.ByName[common.OP_TRIM].ID),
+		qm.OrderBy("operations.id")).
+		One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Lookup trim operation")
+	}
+
+	return op, nil
+}
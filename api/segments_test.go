@@ -0,0 +1,16 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimPieces(t *testing.T) {
+	pieces := TrimPieces([]float64{10, 100, 300}, []float64{40, 160, 310})
+	assert.Equal(t, [][2]float64{{0, 30}, {30, 90}, {90, 100}}, pieces)
+
+	assert.Nil(t, TrimPieces(nil, nil), "empty")
+	assert.Nil(t, TrimPieces([]float64{1, 2}, []float64{3}), "length mismatch")
+	assert.Nil(t, TrimPieces([]float64{5}, []float64{5}), "empty piece")
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"database/sql"
+
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/social"
+)
+
+func SocialAccountsHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	accounts, err := social.FindAccounts(c.MustGet("MDB").(*sql.DB), c.Query("platform"))
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	concludeRequest(c, accounts, nil)
+}
+
+func SocialPostsHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r SocialPostsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleSocialPosts(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func handleSocialPosts(exec *sql.DB, r SocialPostsRequest) (*SocialPostsResponse, *HttpError) {
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	s, e, err := r.Range()
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	total, data, err := social.FindPosts(exec, social.PostsFilter{
+		Platform:   r.Platform,
+		AccountIDs: r.Accounts,
+		Language:   r.Language,
+		StartDate:  s,
+		EndDate:    e,
+		Query:      r.Query,
+		WithRaw:    r.WithRaw,
+	}, limit, offset)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &SocialPostsResponse{
+		ListResponse: ListResponse{Total: total},
+		Posts:        data,
+	}, nil
+}
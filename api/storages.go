@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/storage/policy"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const STORAGE_STATUS_OFFLINE = "offline"
+
+func StoragesComplianceHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r StoragesComplianceRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleStoragesCompliance(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+// handleStoragesCompliance serves the latest compliance report saved by the policy check (mdb storage policy-check)
+func handleStoragesCompliance(exec boil.Executor, r StoragesComplianceRequest) (*StoragesComplianceResponse, *HttpError) {
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	report, err := policy.LatestReport(exec)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if report == nil {
+		return nil, NewNotFoundError()
+	}
+
+	total, violations, err := policy.FindViolations(exec, report.ID, r.Kind, r.Policy, limit, offset)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &StoragesComplianceResponse{
+		ListResponse: ListResponse{Total: total},
+		CheckedAt:    report.CreatedAt,
+		Policies:     report.Policies,
+		Unmatched:    report.Unmatched,
+		Violations:   violations,
+	}, nil
+}
+
+// Note that the storage status import syncs storages from the catalog provider.
+// Storages created here are managed by MDB and left alone by the import.
+// Changes made here to other storages are overridden on its next run, except for marking them offline.
+
+func StorageHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var s PartialStorage
+	if c.BindJSON(&s) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, err := handleUpdateStorage(tx, id, &s)
+	mustConcludeTx(tx, err)
+
+	if err == nil {
+		emitEvents(c, events.StorageUpdateEvent(resp))
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+// Mark storages offline in bulk
+func StoragesOfflineHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r StoragesOfflineRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	tx := mustBeginTx(c)
+	resp, changed, err := handleStoragesOffline(tx, r.IDs)
+	mustConcludeTx(tx, err)
+
+	if err == nil {
+		evnts := make([]events.Event, len(changed))
+		for i, s := range changed {
+			evnts[i] = events.StorageUpdateEvent(s)
+		}
+		emitEvents(c, evnts...)
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+// Files which would have no online copy if the given storages go offline
+func StoragesOfflineImpactHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r StoragesOfflineImpactRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleStoragesOfflineImpact(c, c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func handleCreateStorage(exec boil.Executor, s *NewStorage) (*models.Storage, *HttpError) {
+	exists, err := models.Storages(exec, qm.Where("name = ?", s.Name)).Exists()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if exists {
+		return nil, NewBadRequestError(errors.Errorf("Storage %s already exists", s.Name))
+	}
+
+	storage := &models.Storage{
+		Name:     s.Name,
+		Country:  strings.ToLower(s.Country),
+		Location: s.Location,
+		Status:   s.Status,
+		Access:   s.Access,
+		Managed:  true,
+	}
+	if s.Status == STORAGE_STATUS_OFFLINE {
+		storage.OfflineAt = null.TimeFrom(time.Now().UTC())
+	}
+	if err := storage.Insert(exec); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return storage, nil
+}
+
+func handleUpdateStorage(exec boil.Executor, id int64, s *PartialStorage) (*models.Storage, *HttpError) {
+	storage, err := models.FindStorage(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	cols := make([]string, 0)
+	if s.Country != "" {
+		storage.Country = strings.ToLower(s.Country)
+		cols = append(cols, "country")
+	}
+	if s.Location != "" {
+		storage.Location = s.Location
+		cols = append(cols, "location")
+	}
+	if s.Status != "" && s.Status != storage.Status {
+		storage.Status = s.Status
+		storage.OfflineAt = null.NewTime(time.Now().UTC(), s.Status == STORAGE_STATUS_OFFLINE)
+		cols = append(cols, "status", "offline_at")
+	}
+	if s.Access != "" {
+		storage.Access = s.Access
+		cols = append(cols, "access")
+	}
+	if len(cols) == 0 {
+		return storage, nil
+	}
+
+	if err := storage.Update(exec, cols...); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return storage, nil
+}
+
+// handleStoragesOffline returns the requested storages and the ones among them which were not offline already
+func handleStoragesOffline(exec boil.Executor, ids []int64) ([]*models.Storage, []*models.Storage, *HttpError) {
+	ids = utils.UniqueInt64(ids)
+	storages, err := models.Storages(exec,
+		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
+		qm.OrderBy("id")).
+		All()
+	if err != nil {
+		return nil, nil, NewInternalError(err)
+	}
+	if len(storages) != len(ids) {
+		return nil, nil, NewBadRequestError(errors.New("Unknown storage ids"))
+	}
+
+	changed := make([]*models.Storage, 0)
+	for _, s := range storages {
+		if s.Status == STORAGE_STATUS_OFFLINE {
+			continue
+		}
+		s.Status = STORAGE_STATUS_OFFLINE
+		s.OfflineAt = null.TimeFrom(time.Now().UTC())
+		if err := s.Update(exec, "status", "offline_at"); err != nil {
+			return nil, nil, NewInternalError(err)
+		}
+		changed = append(changed, s)
+	}
+
+	return storages, changed, nil
+}
+
+const OFFLINE_IMPACT_WHERE = `files.removed_at IS NULL
+AND EXISTS (SELECT 1 FROM files_storages fs INNER JOIN storages s ON fs.storage_id = s.id
+  WHERE fs.file_id = files.id AND s.status = 'online' AND s.id = ANY(?))
+AND NOT EXISTS (SELECT 1 FROM files_storages fs INNER JOIN storages s ON fs.storage_id = s.id
+  WHERE fs.file_id = files.id AND s.status = 'online' AND NOT (s.id = ANY(?)))`
+
+func handleStoragesOfflineImpact(cp utils.ContextProvider, exec boil.Executor, r StoragesOfflineImpactRequest) (*FilesResponse, *HttpError) {
+	if len(r.IDs) == 0 {
+		return nil, NewBadRequestError(errors.New("Missing storage ids"))
+	}
+
+	mods := make([]qm.QueryMod, 0)
+	appendPermissionsMods(cp, &mods)
+	mods = append(mods, qm.Where(OFFLINE_IMPACT_WHERE, pq.Array(r.IDs), pq.Array(r.IDs)))
+
+	// count query
+	var total int64
+	countMods := append([]qm.QueryMod{qm.Select("count(DISTINCT id)")}, mods...)
+	err := models.Files(exec, countMods...).QueryRow().Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	if total == 0 {
+		return NewFilesResponse(), nil
+	}
+
+	// order, limit, offset
+	if r.OrderBy == "" {
+		r.OrderBy = "id"
+	}
+	if err = appendListMods(&mods, r.ListRequest); err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	files, err := models.Files(exec, mods...).All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	data := make([]*MFile, len(files))
+	for i, f := range files {
+		data[i] = NewMFile(f)
+	}
+
+	return &FilesResponse{
+		ListResponse: ListResponse{Total: total},
+		Files:        data,
+	}, nil
+}
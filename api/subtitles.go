@@ -0,0 +1,185 @@
+package api
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/subtitles"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// Insert types (and file sub types) of captions and transcripts
+var SUBTITLES_INSERT_TYPES = []string{"subtitles", "transcript"}
+
+// SubtitlesRoot is the locally mounted storage inserted subtitles local paths must be under
+var SubtitlesRoot string
+
+// InitSubtitles sets up validation of inserted subtitles if a local root is configured
+func InitSubtitles() {
+	SubtitlesRoot = viper.GetString("subtitles.root")
+	if SubtitlesRoot == "" {
+		log.Info("No subtitles.root, validation of inserted subtitles is disabled")
+	}
+}
+
+func ContentUnitSubtitlesHandler(c *gin.Context) {
+	id, e := strconv.ParseInt(c.Param("id"), 10, 0)
+	if e != nil {
+		NewBadRequestError(errors.Wrap(e, "id expects int64")).Abort(c)
+		return
+	}
+
+	resp, err := handleContentUnitSubtitles(c, c.MustGet("MDB").(*sql.DB), id)
+	concludeRequest(c, resp, err)
+}
+
+func handleContentUnitSubtitles(cp utils.ContextProvider, exec boil.Executor, id int64) (*ContentUnitSubtitles, *HttpError) {
+	unit, err := models.FindContentUnit(exec, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, NewNotFoundError()
+		} else {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	// check object level permissions
+	if !can(cp, secureToPermission(unit.Secure), common.PERM_READ) {
+		return nil, NewForbiddenError()
+	}
+
+	files, err := models.Files(exec,
+		qm.Where("secure <= ?", allowedRead(cp)),
+		qm.Where("content_unit_id = ?", id),
+		qm.Where("removed_at IS NULL"),
+		qm.WhereIn("sub_type in ?", utils.ConvertArgsString(SUBTITLES_INSERT_TYPES)...),
+		qm.OrderBy("language, id")).
+		All()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	resp := &ContentUnitSubtitles{
+		Languages: make([]string, 0),
+		Files:     make([]*MFile, len(files)),
+	}
+	langs := make(map[string]bool)
+	for i, f := range files {
+		resp.Files[i] = NewMFile(f)
+		if f.Language.Valid && !langs[f.Language.String] {
+			langs[f.Language.String] = true
+			resp.Languages = append(resp.Languages, f.Language.String)
+		}
+	}
+	sort.Strings(resp.Languages)
+
+	return resp, nil
+}
+
+// validateSubtitlesInsert parses and validates subtitles inserted from a local path under SubtitlesRoot.
+// Returns a nil report if there is nothing to validate.
+func validateSubtitlesInsert(r InsertRequest, cu *models.ContentUnit) (*subtitles.Report, error) {
+	if r.LocalPath == "" || SubtitlesRoot == "" {
+		return nil, nil
+	}
+
+	if subtitles.FormatByName(r.LocalPath) == "" {
+		log.Infof("%s is not srt or vtt, skipping validation", r.LocalPath)
+		return nil, nil
+	}
+
+	path, err := subtitlesPath(r.LocalPath)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	// don't tell clients why, it would reveal what exists on our disks
+	sha1, err := fileSha1(path)
+	if err != nil {
+		log.Warnf("Read local file %s: %s", path, err.Error())
+		return nil, NewBadRequestError(errors.Errorf("Local file %s is not readable", r.LocalPath))
+	}
+	if sha1 != strings.ToLower(r.File.Sha1) {
+		return nil, NewBadRequestError(errors.Errorf("Local file sha1 mismatch: %s != %s", sha1, r.File.Sha1))
+	}
+
+	// media duration of the unit
+	duration := r.AVFile.Duration
+	if duration <= 0 && cu != nil && cu.Properties.Valid {
+		var props map[string]interface{}
+		if err := cu.Properties.Unmarshal(&props); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal unit properties")
+		}
+		if d, ok := props["duration"].(float64); ok {
+			duration = d
+		}
+	}
+
+	report, err := subtitles.ValidateFile(path, r.File.Language, duration)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+	if !report.Valid() {
+		return nil, NewBadRequestError(errors.Errorf("Invalid %s: %s", r.InsertType, strings.Join(report.Errors, "; ")))
+	}
+	for _, w := range report.Warnings {
+		log.Warnf("%s [%s]: %s", r.InsertType, r.File.FileName, w)
+	}
+
+	return report, nil
+}
+
+// subtitlesPath resolves a local path under SubtitlesRoot.
+// Symlinks are followed so they can't point outside of it.
+func subtitlesPath(path string) (string, error) {
+	path, err := utils.PathUnder(SubtitlesRoot, path)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.EvalSymlinks(SubtitlesRoot)
+	if err != nil {
+		return "", errors.Wrap(err, "Resolve subtitles root")
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		// missing files are reported like unreadable ones
+		return path, nil
+	}
+	if _, err := utils.PathUnder(root, resolved); err != nil {
+		return "", errors.Errorf("Path %s is not under %s", path, SubtitlesRoot)
+	}
+
+	return resolved, nil
+}
+
+func fileSha1(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubtitlesPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subtitles")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// resolve the temp dir itself, it may be a symlink (macOS)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.Nil(t, err)
+
+	root := filepath.Join(dir, "root")
+	require.Nil(t, os.Mkdir(root, 0755))
+	inside := filepath.Join(root, "heb.srt")
+	require.Nil(t, ioutil.WriteFile(inside, []byte("1\n"), 0644))
+	outside := filepath.Join(dir, "secret.srt")
+	require.Nil(t, ioutil.WriteFile(outside, []byte("1\n"), 0644))
+	require.Nil(t, os.Symlink(outside, filepath.Join(root, "link.srt")))
+
+	defer func(r string) { SubtitlesRoot = r }(SubtitlesRoot)
+	SubtitlesRoot = root
+
+	path, err := subtitlesPath("heb.srt")
+	if assert.Nil(t, err, "relative") {
+		assert.Equal(t, inside, path)
+	}
+	path, err = subtitlesPath(inside)
+	if assert.Nil(t, err, "absolute") {
+		assert.Equal(t, inside, path)
+	}
+	path, err = subtitlesPath("missing.srt")
+	if assert.Nil(t, err, "missing") {
+		assert.Equal(t, filepath.Join(root, "missing.srt"), path)
+	}
+
+	_, err = subtitlesPath("../secret.srt")
+	assert.NotNil(t, err, "relative escape")
+	_, err = subtitlesPath(outside)
+	assert.NotNil(t, err, "absolute escape")
+	_, err = subtitlesPath("link.srt")
+	assert.NotNil(t, err, "symlink escape")
+}
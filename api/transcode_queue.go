@@ -0,0 +1,450 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const (
+	TQ_STATUS_QUEUED = "queued"
+	TQ_STATUS_LEASED = "leased"
+	TQ_STATUS_DONE   = "done"
+	TQ_STATUS_FAILED = "failed"
+)
+
+const (
+	DEFAULT_TRANSCODE_FORMAT      = "mp4"
+	DEFAULT_TRANSCODE_LEASE       = time.Hour
+	DEFAULT_TRANSCODE_BACKOFF     = 5 * time.Minute
+	DEFAULT_TRANSCODE_MAX_BACKOFF = 24 * time.Hour
+)
+
+// TranscodeQueueItem is a file waiting to be transcoded, see transcode_queue table.
+// Higher priority items are leased first. A leased item which is not reported back
+// by /operations/transcode before its lease expires is leased again.
+type TranscodeQueueItem struct {
+	ID             int64       `boil:"id" json:"id"`
+	FileID         int64       `boil:"file_id" json:"file_id"`
+	Sha1           string      `boil:"sha1" json:"sha1"`
+	Format         string      `boil:"format" json:"format"`
+	Priority       int         `boil:"priority" json:"priority"`
+	Status         string      `boil:"status" json:"status"`
+	Attempts       int         `boil:"attempts" json:"attempts"`
+	MaxAttempts    int         `boil:"max_attempts" json:"max_attempts"`
+	NextAttemptAt  time.Time   `boil:"next_attempt_at" json:"next_attempt_at"`
+	LeaseOwner     null.String `boil:"lease_owner" json:"lease_owner"`
+	LeaseExpiresAt null.Time   `boil:"lease_expires_at" json:"lease_expires_at"`
+	OperationID    null.Int64  `boil:"operation_id" json:"operation_id"`
+	LastError      null.String `boil:"last_error" json:"last_error"`
+	CreatedAt      time.Time   `boil:"created_at" json:"created_at"`
+	UpdatedAt      time.Time   `boil:"updated_at" json:"updated_at"`
+}
+
+func TranscodeQueueHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var err *HttpError
+	var resp interface{}
+
+	switch c.Request.Method {
+	case http.MethodGet, "":
+		var r TranscodeQueueRequest
+		if c.Bind(&r) != nil {
+			return
+		}
+		resp, err = handleTranscodeQueueList(c.MustGet("MDB").(*sql.DB), r)
+	case http.MethodPost:
+		var r TranscodeEnqueueRequest
+		if c.BindJSON(&r) != nil {
+			return
+		}
+
+		tx := mustBeginTx(c)
+		resp, err = handleTranscodeEnqueue(tx, r)
+		mustConcludeTx(tx, err)
+	}
+
+	concludeRequest(c, resp, err)
+}
+
+// Lease the next items for a transcoder
+func TranscodeQueueLeaseHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r TranscodeLeaseRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	lease := DEFAULT_TRANSCODE_LEASE
+	if r.LeaseSeconds > 0 {
+		lease = time.Duration(r.LeaseSeconds) * time.Second
+	}
+
+	items, err := LeaseTranscodeItems(c.MustGet("MDB").(*sql.DB), r.Owner, r.Limit, lease)
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	concludeRequest(c, items, nil)
+}
+
+// Reset items so they are transcoded again from scratch
+func TranscodeQueueRequeueHandler(c *gin.Context) {
+	if !isAdmin(c) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r TranscodeRequeueRequest
+	if c.BindJSON(&r) != nil {
+		return
+	}
+
+	n, err := RequeueTranscodeItems(c.MustGet("MDB").(*sql.DB), r.IDs)
+	if err != nil {
+		NewInternalError(err).Abort(c)
+		return
+	}
+
+	concludeRequest(c, gin.H{"requeued": n}, nil)
+}
+
+func handleTranscodeQueueList(exec boil.Executor, r TranscodeQueueRequest) (*TranscodeQueueResponse, *HttpError) {
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	where := `($1 = '' OR q.status = $1) AND ($2 = 0 OR q.file_id = $2)`
+
+	var total int64
+	err = queries.Raw(exec, `SELECT count(*) FROM transcode_queue q WHERE `+where, r.Status, r.FileID).
+		QueryRow().
+		Scan(&total)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	stats, err := transcodeQueueStats(exec)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	items := make([]*TranscodeQueueItem, 0)
+	if total > 0 {
+		err = queries.Raw(exec,
+			`SELECT q.*, encode(f.sha1, 'hex') AS sha1 FROM transcode_queue q INNER JOIN files f ON q.file_id = f.id
+			 WHERE `+where+` ORDER BY q.priority DESC, q.id LIMIT $3 OFFSET $4`,
+			r.Status, r.FileID, limit, offset).
+			Bind(&items)
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+	}
+
+	return &TranscodeQueueResponse{
+		ListResponse: ListResponse{Total: total},
+		Stats:        stats,
+		Items:        items,
+	}, nil
+}
+
+func transcodeQueueStats(exec boil.Executor) (map[string]int64, error) {
+	rows, err := queries.Raw(exec, `SELECT status, count(*) FROM transcode_queue GROUP BY status`).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load queue stats")
+	}
+	defer rows.Close()
+
+	stats := map[string]int64{
+		TQ_STATUS_QUEUED: 0,
+		TQ_STATUS_LEASED: 0,
+		TQ_STATUS_DONE:   0,
+		TQ_STATUS_FAILED: 0,
+	}
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		stats[status] = count
+	}
+
+	return stats, errors.Wrap(rows.Err(), "Iterate rows")
+}
+
+func handleTranscodeEnqueue(exec boil.Executor, r TranscodeEnqueueRequest) (*TranscodeEnqueueResponse, *HttpError) {
+	unitIDs := r.ContentUnitIDs
+	if len(r.CollectionIDs) > 0 {
+		ccus, err := models.CollectionsContentUnits(exec,
+			qm.WhereIn("collection_id in ?", utils.ConvertArgsInt64(r.CollectionIDs)...)).
+			All()
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+		for _, ccu := range ccus {
+			unitIDs = append(unitIDs, ccu.ContentUnitID)
+		}
+	}
+
+	fileIDs := r.FileIDs
+	if len(unitIDs) > 0 {
+		files, err := models.Files(exec,
+			qm.WhereIn("content_unit_id in ?", utils.ConvertArgsInt64(unitIDs)...),
+			qm.Where("removed_at IS NULL")).
+			All()
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+		for _, f := range TranscodeCandidates(files) {
+			fileIDs = append(fileIDs, f.ID)
+		}
+	}
+
+	if len(fileIDs) == 0 {
+		return &TranscodeEnqueueResponse{}, nil
+	}
+
+	format := r.Format
+	if format == "" {
+		format = DEFAULT_TRANSCODE_FORMAT
+	}
+	n, err := EnqueueTranscode(exec, fileIDs, r.Priority, format)
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	return &TranscodeEnqueueResponse{
+		Candidates: len(fileIDs),
+		Enqueued:   n,
+	}, nil
+}
+
+// TranscodeCandidates selects the flv and wmv files of content units which should be transcoded to mp4.
+// A file is skipped if it already has derived files or if its unit has an mp4 of the same name.
+// If a unit has an flv and a wmv of the same name, only the flv is selected.
+// Returns candidates sorted by id.
+func TranscodeCandidates(files []*models.File) []*models.File {
+	mtMP4 := common.MEDIA_TYPE_REGISTRY.ByExtension["mp4"].MimeType
+	mtWMV := common.MEDIA_TYPE_REGISTRY.ByExtension["wmv"].MimeType
+	mtFLV := common.MEDIA_TYPE_REGISTRY.ByExtension["flv"].MimeType
+
+	// unit id => mime type => base name => file
+	byUnit := make(map[int64]map[string]map[string]*models.File)
+	withChildren := make(map[int64]bool)
+	for _, f := range files {
+		switch f.MimeType.String {
+		case mtMP4, mtWMV, mtFLV:
+		default:
+			continue
+		}
+		if !f.Sha1.Valid {
+			continue
+		}
+
+		if f.ParentID.Valid {
+			withChildren[f.ParentID.Int64] = true
+		}
+		if !f.ContentUnitID.Valid {
+			continue
+		}
+
+		byMime, ok := byUnit[f.ContentUnitID.Int64]
+		if !ok {
+			byMime = make(map[string]map[string]*models.File)
+			byUnit[f.ContentUnitID.Int64] = byMime
+		}
+		if _, ok := byMime[f.MimeType.String]; !ok {
+			byMime[f.MimeType.String] = make(map[string]*models.File)
+		}
+		byMime[f.MimeType.String][baseName(f.Name)] = f
+	}
+
+	candidates := make([]*models.File, 0)
+	for _, byMime := range byUnit {
+		mp4s, flvs := byMime[mtMP4], byMime[mtFLV]
+		for k, f := range flvs {
+			if _, ok := mp4s[k]; !ok && !withChildren[f.ID] {
+				candidates = append(candidates, f)
+			}
+		}
+		for k, f := range byMime[mtWMV] {
+			_, hasMP4 := mp4s[k]
+			_, hasFLV := flvs[k]
+			if !hasMP4 && !hasFLV && !withChildren[f.ID] {
+				candidates = append(candidates, f)
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates
+}
+
+func baseName(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// EnqueueTranscode adds files to the queue.
+// Files already queued get the higher of the two priorities, files in any other status are left as is.
+// Returns the number of items added or updated.
+func EnqueueTranscode(exec boil.Executor, fileIDs []int64, priority int, format string) (int64, error) {
+	res, err := queries.Raw(exec,
+		`INSERT INTO transcode_queue (file_id, format, priority, max_attempts)
+		 SELECT DISTINCT unnest($1::BIGINT[]), $2, $3, $4
+		 ON CONFLICT (file_id) DO UPDATE
+		 SET priority = GREATEST(transcode_queue.priority, EXCLUDED.priority), updated_at = now_utc()
+		 WHERE transcode_queue.status = 'queued'`,
+		pq.Array(fileIDs), format, priority, TranscodeMaxAttempts()).
+		Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "Insert queue items")
+	}
+
+	n, err := res.RowsAffected()
+	return n, errors.Wrap(err, "RowsAffected")
+}
+
+// LeaseTranscodeItems leases up to limit queue items, highest priority first, to the given owner.
+// Items whose lease expired are leased again, unless they ran out of attempts in which case they fail.
+// Concurrent transcoders never get the same item.
+func LeaseTranscodeItems(db *sql.DB, owner string, limit int, lease time.Duration) ([]*TranscodeQueueItem, error) {
+	_, err := queries.Raw(db,
+		`UPDATE transcode_queue SET status = 'failed', lease_owner = NULL, lease_expires_at = NULL,
+		 last_error = COALESCE(last_error, 'lease expired'), updated_at = now_utc()
+		 WHERE status = 'leased' AND lease_expires_at < now_utc() AND attempts >= max_attempts`).
+		Exec()
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail expired leases")
+	}
+
+	items := make([]*TranscodeQueueItem, 0)
+	err = queries.Raw(db,
+		`WITH leased AS (
+		   UPDATE transcode_queue SET status = 'leased', lease_owner = $1,
+		   lease_expires_at = now_utc() + $2 * INTERVAL '1 second', attempts = attempts + 1, updated_at = now_utc()
+		   WHERE id IN (
+		     SELECT id FROM transcode_queue
+		     WHERE (status = 'queued' AND next_attempt_at <= now_utc())
+		        OR (status = 'leased' AND lease_expires_at < now_utc())
+		     ORDER BY priority DESC, id
+		     LIMIT $3
+		     FOR UPDATE SKIP LOCKED)
+		   RETURNING *)
+		 SELECT l.*, encode(f.sha1, 'hex') AS sha1 FROM leased l INNER JOIN files f ON l.file_id = f.id
+		 ORDER BY l.priority DESC, l.id`,
+		owner, int64(lease.Seconds()), limit).
+		Bind(&items)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Lease queue items")
+	}
+
+	return items, nil
+}
+
+// CompleteTranscodeItem marks a file's leased queue item as done, if there is one.
+// Items in any other status are left alone, e.g. a duplicate report of a done item.
+func CompleteTranscodeItem(exec boil.Executor, fileID, operationID int64) error {
+	_, err := queries.Raw(exec,
+		`UPDATE transcode_queue SET status = 'done', operation_id = $1, lease_owner = NULL, lease_expires_at = NULL,
+		 last_error = NULL, updated_at = now_utc() WHERE file_id = $2 AND status = 'leased'`,
+		operationID, fileID).
+		Exec()
+	return errors.Wrap(err, "Complete queue item")
+}
+
+// FailTranscodeItem records a transcode error of a file's leased queue item, if there is one.
+// Late or duplicate reports of items no longer leased (e.g. done) are ignored.
+// The item is retried with exponential backoff until it runs out of attempts.
+// Errors matching any of transcode.permanent-errors fail the item immediately.
+func FailTranscodeItem(exec boil.Executor, fileID int64, operationID null.Int64, message string) error {
+	permanent := IsPermanentTranscodeError(message)
+	base, max := TranscodeBackoff()
+
+	_, err := queries.Raw(exec,
+		`UPDATE transcode_queue SET
+		 status = CASE WHEN $1 OR attempts >= max_attempts THEN 'failed' ELSE 'queued' END,
+		 next_attempt_at = now_utc() + LEAST($2, $3 * power(2, GREATEST(attempts - 1, 0))) * INTERVAL '1 second',
+		 operation_id = COALESCE($4, operation_id), last_error = $5,
+		 lease_owner = NULL, lease_expires_at = NULL, updated_at = now_utc()
+		 WHERE file_id = $6 AND status = 'leased'`,
+		permanent, int64(max.Seconds()), int64(base.Seconds()), operationID, message, fileID).
+		Exec()
+	return errors.Wrap(err, "Fail queue item")
+}
+
+// RequeueTranscodeItems resets items to be leased right away with a fresh set of attempts
+func RequeueTranscodeItems(exec boil.Executor, ids []int64) (int64, error) {
+	res, err := queries.Raw(exec,
+		`UPDATE transcode_queue SET status = 'queued', attempts = 0, next_attempt_at = now_utc(),
+		 lease_owner = NULL, lease_expires_at = NULL, last_error = NULL, updated_at = now_utc()
+		 WHERE id = ANY($1)`,
+		pq.Array(ids)).
+		Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "Requeue items")
+	}
+
+	n, err := res.RowsAffected()
+	return n, errors.Wrap(err, "RowsAffected")
+}
+
+// TranscodeBackoff returns the configured delay before the first retry and the max delay between retries.
+func TranscodeBackoff() (base, max time.Duration) {
+	base, max = DEFAULT_TRANSCODE_BACKOFF, DEFAULT_TRANSCODE_MAX_BACKOFF
+	if d := viper.GetDuration("transcode.retry-backoff"); d > 0 {
+		base = d
+	}
+	if d := viper.GetDuration("transcode.max-backoff"); d > 0 {
+		max = d
+	}
+	return
+}
+
+func TranscodeMaxAttempts() int {
+	if n := viper.GetInt("transcode.max-attempts"); n > 0 {
+		return n
+	}
+	return 5
+}
+
+// IsPermanentTranscodeError tells if retrying a transcode with this error message is pointless
+func IsPermanentTranscodeError(message string) bool {
+	message = strings.ToLower(message)
+	for _, s := range viper.GetStringSlice("transcode.permanent-errors") {
+		if s != "" && strings.Contains(message, strings.ToLower(s)) {
+			return true
+		}
+	}
+	return false
+}
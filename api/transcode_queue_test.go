@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func TestTranscodeCandidates(t *testing.T) {
+	assert.Nil(t, common.MEDIA_TYPE_REGISTRY.Init(nil))
+
+	sha1 := null.BytesFrom([]byte{1})
+	file := func(id, cuID int64, name, ext string) *models.File {
+		return &models.File{
+			ID:            id,
+			Name:          name + "." + ext,
+			Sha1:          sha1,
+			MimeType:      null.StringFrom(common.MEDIA_TYPE_REGISTRY.ByExtension[ext].MimeType),
+			ContentUnitID: null.NewInt64(cuID, cuID > 0),
+		}
+	}
+
+	child := file(9, 2, "child", "mp4")
+	child.ParentID = null.Int64From(8)
+	noSha1 := file(10, 2, "no_sha1", "wmv")
+	noSha1.Sha1 = null.Bytes{}
+
+	files := []*models.File{
+		file(1, 1, "a", "flv"),
+		file(2, 1, "a", "wmv"), // flv of same name
+		file(3, 1, "b", "wmv"),
+		file(4, 1, "c", "wmv"),
+		file(5, 1, "c", "mp4"), // has mp4
+		file(6, 2, "d", "flv"),
+		file(7, 0, "e", "wmv"), // no unit
+		file(8, 2, "f", "wmv"), // has children
+		child,
+		noSha1,
+		file(11, 2, "g", "mp3"),
+	}
+
+	candidates := TranscodeCandidates(files)
+	ids := make([]int64, len(candidates))
+	for i := range candidates {
+		ids[i] = candidates[i].ID
+	}
+	assert.Equal(t, []int64{1, 3, 6}, ids)
+}
+
+func TestIsPermanentTranscodeError(t *testing.T) {
+	viper.Set("transcode.permanent-errors", []string{"Invalid data found", ""})
+	defer viper.Set("transcode.permanent-errors", nil)
+
+	assert.True(t, IsPermanentTranscodeError("ffmpeg: invalid data found when processing input"))
+	assert.False(t, IsPermanentTranscodeError("Cannot start transcoding"))
+}
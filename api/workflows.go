@@ -0,0 +1,560 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/gin-gonic/gin.v1"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// A studio workflow is the chain of operations sharing the same workflow_id.
+// The expected chain is:
+// 	capture_start -> capture_stop -> demux -> trim -> send -> convert / upload
+//
+// Downstream operations (convert, upload) carry no workflow_id.
+// We reach them through the descendants of the workflow's files.
+
+// Expected upstream operation types for each step in the chain.
+// A file entering a step should have been through one of these before.
+var WORKFLOW_CHAIN = map[string][]string{
+	common.OP_DEMUX:   {common.OP_CAPTURE_STOP},
+	common.OP_TRIM:    {common.OP_DEMUX},
+	common.OP_SEND:    {common.OP_TRIM},
+	common.OP_CONVERT: {common.OP_SEND},
+	common.OP_UPLOAD:  {common.OP_SEND, common.OP_CONVERT},
+}
+
+// Workflow warning codes
+const (
+	WF_WARN_MISSING_UPSTREAM    = "MISSING_UPSTREAM"
+	WF_WARN_OUT_OF_ORDER        = "OUT_OF_ORDER"
+	WF_WARN_CAPTURE_NOT_STOPPED = "CAPTURE_NOT_STOPPED"
+	WF_WARN_CAPTURE_NOT_STARTED = "CAPTURE_NOT_STARTED"
+)
+
+// files associated with given operations and all their descendants
+const WORKFLOW_FILES_SQL = `
+WITH RECURSIVE rf AS (
+  SELECT f.id
+  FROM files f INNER JOIN files_operations fo ON f.id = fo.file_id AND fo.operation_id = ANY ($1)
+  UNION
+  SELECT f.id
+  FROM files f INNER JOIN rf ON f.parent_id = rf.id
+) SELECT array_agg(DISTINCT id)
+  FROM rf
+`
+
+type WorkflowOperation struct {
+	models.Operation
+	Type    string  `json:"type"`
+	FileIDs []int64 `json:"files"`
+}
+
+type WorkflowWarning struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	OperationID int64  `json:"operation_id,omitempty"`
+	FileID      int64  `json:"file_id,omitempty"`
+}
+
+type WorkflowTimeline struct {
+	WorkflowID   string               `json:"workflow_id"`
+	Operations   []*WorkflowOperation `json:"operations"`
+	Files        []*MFile             `json:"files"`
+	ContentUnits []*ContentUnit       `json:"content_units"`
+	Warnings     []*WorkflowWarning   `json:"warnings"`
+}
+
+type WorkflowSummary struct {
+	WorkflowID string             `json:"workflow_id"`
+	StartedAt  time.Time          `json:"started_at"`
+	Operations []string           `json:"operations"`
+	Warnings   []*WorkflowWarning `json:"warnings"`
+}
+
+func WorkflowsListHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	var r WorkflowsRequest
+	if c.Bind(&r) != nil {
+		return
+	}
+
+	resp, err := handleWorkflowsList(c.MustGet("MDB").(*sql.DB), r)
+	concludeRequest(c, resp, err)
+}
+
+func WorkflowHandler(c *gin.Context) {
+	if !can(c, secureToPermission(common.SEC_PUBLIC), common.PERM_READ) {
+		NewForbiddenError().Abort(c)
+		return
+	}
+
+	resp, err := handleWorkflow(c.MustGet("MDB").(*sql.DB), c.Param("workflow_id"))
+	concludeRequest(c, resp, err)
+}
+
+func handleWorkflow(exec boil.Executor, workflowID string) (*WorkflowTimeline, *HttpError) {
+	timeline, err := FindWorkflowTimeline(exec, workflowID)
+	if err != nil {
+		if _, ok := err.(WorkflowNotFound); ok {
+			return nil, NewNotFoundError()
+		}
+		return nil, NewInternalError(err)
+	}
+
+	return timeline, nil
+}
+
+// handleWorkflowsList pages through workflows in SQL and validates only the workflows on the page.
+// with_warnings has to validate every workflow in range before paging,
+// so it requires both start_date and end_date to keep that bounded.
+func handleWorkflowsList(exec boil.Executor, r WorkflowsRequest) (*WorkflowsResponse, *HttpError) {
+	if r.WithWarnings && (r.StartDate == "" || r.EndDate == "") {
+		return nil, NewBadRequestError(errors.New("with_warnings requires both start_date and end_date"))
+	}
+
+	s, e, err := r.Range()
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+	if r.StartDate != "" && r.EndDate != "" && e.Before(s) {
+		return nil, NewBadRequestError(errors.New("Invalid date range"))
+	}
+
+	limit, offset, err := listLimitOffset(r.ListRequest)
+	if err != nil {
+		return nil, NewBadRequestError(err)
+	}
+
+	where := []string{"properties ? 'workflow_id'", "properties->>'workflow_id' <> ''"}
+	args := make([]interface{}, 0)
+	if r.StartDate != "" {
+		args = append(args, s)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if r.EndDate != "" {
+		args = append(args, e)
+		where = append(where, fmt.Sprintf("created_at <= $%d", len(args)))
+	}
+	q := fmt.Sprintf(`SELECT properties->>'workflow_id', min(created_at)
+FROM operations
+WHERE %s
+GROUP BY 1
+ORDER BY 2 DESC`, strings.Join(where, " AND "))
+
+	var total int64
+	if !r.WithWarnings {
+		err = queries.Raw(exec, fmt.Sprintf("SELECT count(*) FROM (%s) AS x", q), args...).
+			QueryRow().Scan(&total)
+		if err != nil {
+			return nil, NewInternalError(err)
+		}
+		if total == 0 {
+			return NewWorkflowsResponse(), nil
+		}
+
+		q = fmt.Sprintf("%s LIMIT %d OFFSET %d", q, limit, offset)
+	}
+
+	rows, err := queries.Raw(exec, q, args...).Query()
+	if err != nil {
+		return nil, NewInternalError(err)
+	}
+	defer rows.Close()
+
+	data := make([]*WorkflowSummary, 0)
+	for rows.Next() {
+		x := new(WorkflowSummary)
+		if err := rows.Scan(&x.WorkflowID, &x.StartedAt); err != nil {
+			return nil, NewInternalError(err)
+		}
+		data = append(data, x)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, NewInternalError(err)
+	}
+
+	summaries := make([]*WorkflowSummary, 0, len(data))
+	for i := range data {
+		timeline, _, err := findWorkflowChain(exec, data[i].WorkflowID)
+		if err != nil {
+			return nil, NewInternalError(errors.Wrapf(err, "Workflow %s", data[i].WorkflowID))
+		}
+		if r.WithWarnings && len(timeline.Warnings) == 0 {
+			continue
+		}
+
+		data[i].Operations = make([]string, len(timeline.Operations))
+		for j := range timeline.Operations {
+			data[i].Operations[j] = timeline.Operations[j].Type
+		}
+		data[i].Warnings = timeline.Warnings
+		summaries = append(summaries, data[i])
+	}
+
+	if r.WithWarnings {
+		total = int64(len(summaries))
+		if offset < len(summaries) {
+			summaries = summaries[offset:utils.Min(offset+limit, len(summaries))]
+		} else {
+			summaries = summaries[:0]
+		}
+	}
+
+	return &WorkflowsResponse{
+		ListResponse: ListResponse{Total: total},
+		Workflows:    summaries,
+	}, nil
+}
+
+// FindWorkflowTimeline loads all operations, files and resulting units of a workflow
+// ordered by time and validates the chain of operations.
+func FindWorkflowTimeline(exec boil.Executor, workflowID string) (*WorkflowTimeline, error) {
+	timeline, files, err := findWorkflowChain(exec, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	cuIDs := make(map[int64]bool)
+	for _, f := range files {
+		if f.ContentUnitID.Valid {
+			cuIDs[f.ContentUnitID.Int64] = true
+		}
+	}
+	if len(cuIDs) > 0 {
+		ids := make([]int64, 0, len(cuIDs))
+		for k := range cuIDs {
+			ids = append(ids, k)
+		}
+		units, err := models.ContentUnits(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
+			qm.Load("ContentUnitI18ns"),
+			qm.OrderBy("id")).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load content units")
+		}
+
+		for _, cu := range units {
+			x := &ContentUnit{ContentUnit: *cu}
+			x.I18n = make(map[string]*models.ContentUnitI18n, len(cu.R.ContentUnitI18ns))
+			for _, i18n := range cu.R.ContentUnitI18ns {
+				x.I18n[i18n.Language] = i18n
+			}
+			timeline.ContentUnits = append(timeline.ContentUnits, x)
+		}
+	}
+
+	return timeline, nil
+}
+
+// findWorkflowChain loads the operations and files of a workflow and validates the chain of operations.
+// Returns the timeline without content units and the workflow's files by id.
+func findWorkflowChain(exec boil.Executor, workflowID string) (*WorkflowTimeline, map[int64]*models.File, error) {
+	wfOps, err := models.Operations(exec,
+		qm.Where("properties->>'workflow_id' = ?", workflowID)).
+		All()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load workflow operations")
+	}
+	if len(wfOps) == 0 {
+		return nil, nil, WorkflowNotFound{WorkflowID: workflowID}
+	}
+
+	wfFileIDs := make(map[int64]bool)
+	opsMap := make(map[int64]*models.Operation, len(wfOps))
+	opIDs := make([]int64, len(wfOps))
+	for i := range wfOps {
+		opsMap[wfOps[i].ID] = wfOps[i]
+		opIDs[i] = wfOps[i].ID
+	}
+
+	// files of workflow operations and their descendants
+	var fileIDs pq.Int64Array
+	err = queries.Raw(exec, WORKFLOW_FILES_SQL, pq.Array(opIDs)).QueryRow().Scan(&fileIDs)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Load workflow files")
+	}
+
+	files := make(map[int64]*models.File)
+	opFiles := make(map[int64][]int64)
+	if len(fileIDs) > 0 {
+		fs, err := models.Files(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(fileIDs)...)).
+			All()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Load files")
+		}
+		for i := range fs {
+			files[fs[i].ID] = fs[i]
+		}
+
+		rows, err := queries.Raw(exec,
+			"SELECT file_id, operation_id FROM files_operations WHERE file_id = ANY($1)",
+			pq.Array(fileIDs)).
+			Query()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Load files operations")
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var fID, oID int64
+			if err := rows.Scan(&fID, &oID); err != nil {
+				return nil, nil, errors.Wrap(err, "rows.Scan")
+			}
+			opFiles[oID] = append(opFiles[oID], fID)
+			if _, ok := opsMap[oID]; ok {
+				wfFileIDs[fID] = true
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, nil, errors.Wrap(err, "rows.Err")
+		}
+	}
+
+	// fetch downstream operations we don't have yet
+	missing := make([]int64, 0)
+	for oID := range opFiles {
+		if _, ok := opsMap[oID]; !ok {
+			missing = append(missing, oID)
+		}
+	}
+	if len(missing) > 0 {
+		ops, err := models.Operations(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(missing)...)).
+			All()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Load downstream operations")
+		}
+		for i := range ops {
+			opsMap[ops[i].ID] = ops[i]
+		}
+	}
+
+	timeline := &WorkflowTimeline{
+		WorkflowID:   workflowID,
+		Operations:   make([]*WorkflowOperation, 0),
+		Files:        make([]*MFile, 0),
+		ContentUnits: make([]*ContentUnit, 0),
+	}
+
+	// Descendants might reach into other workflows (e.g. other trims of the same capture).
+	// We keep only files reachable from the workflow's files through operations
+	// that are not part of some other workflow.
+	foreign := make(map[int64]bool)
+	for oID, op := range opsMap {
+		if wfID := operationWorkflowID(op); wfID != "" && wfID != workflowID {
+			foreign[oID] = true
+		}
+	}
+	kept := make(map[int64]bool, len(files))
+	for k := range wfFileIDs {
+		kept[k] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for oID, fIDs := range opFiles {
+			if foreign[oID] {
+				continue
+			}
+			for _, fID := range fIDs {
+				f, ok := files[fID]
+				if kept[fID] || !ok || !f.ParentID.Valid || !kept[f.ParentID.Int64] {
+					continue
+				}
+				kept[fID] = true
+				changed = true
+			}
+		}
+	}
+
+	for oID, fIDs := range opFiles {
+		if foreign[oID] {
+			continue
+		}
+		x := make([]int64, 0, len(fIDs))
+		for _, fID := range fIDs {
+			if kept[fID] {
+				x = append(x, fID)
+			}
+		}
+		if len(x) == 0 {
+			continue
+		}
+		sort.Slice(x, func(i, j int) bool { return x[i] < x[j] })
+		timeline.Operations = append(timeline.Operations, newWorkflowOperation(opsMap[oID], x))
+		delete(opsMap, oID)
+	}
+
+	// workflow operations without files (should not happen, but still part of the workflow)
+	for _, op := range opsMap {
+		if !foreign[op.ID] {
+			timeline.Operations = append(timeline.Operations, newWorkflowOperation(op, make([]int64, 0)))
+		}
+	}
+
+	sort.Slice(timeline.Operations, func(i, j int) bool {
+		a, b := timeline.Operations[i], timeline.Operations[j]
+		if a.CreatedAt.Equal(b.CreatedAt) {
+			return a.ID < b.ID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	// files
+	keptFiles := make(map[int64]*models.File, len(kept))
+	for fID := range kept {
+		f, ok := files[fID]
+		if !ok {
+			continue
+		}
+		keptFiles[fID] = f
+		timeline.Files = append(timeline.Files, NewMFile(f))
+	}
+	sort.Slice(timeline.Files, func(i, j int) bool { return timeline.Files[i].ID < timeline.Files[j].ID })
+
+	timeline.Warnings = ValidateWorkflowChain(timeline.Operations, keptFiles)
+
+	return timeline, keptFiles, nil
+}
+
+// ValidateWorkflowChain flags broken or out of order chains of operations.
+// ops are expected to be sorted by time.
+func ValidateWorkflowChain(ops []*WorkflowOperation, files map[int64]*models.File) []*WorkflowWarning {
+	warnings := make([]*WorkflowWarning, 0)
+
+	fileOps := make(map[int64][]*WorkflowOperation)
+	byType := make(map[string][]*WorkflowOperation)
+	for _, op := range ops {
+		byType[op.Type] = append(byType[op.Type], op)
+		for _, fID := range op.FileIDs {
+			fileOps[fID] = append(fileOps[fID], op)
+		}
+	}
+
+	// capture start and stop come in pairs
+	if len(byType[common.OP_CAPTURE_START]) > 0 && len(byType[common.OP_CAPTURE_STOP]) == 0 {
+		op := byType[common.OP_CAPTURE_START][0]
+		warnings = append(warnings, &WorkflowWarning{
+			Code:        WF_WARN_CAPTURE_NOT_STOPPED,
+			Message:     "capture_start without capture_stop",
+			OperationID: op.ID,
+		})
+	}
+	if len(byType[common.OP_CAPTURE_STOP]) > 0 && len(byType[common.OP_CAPTURE_START]) == 0 {
+		op := byType[common.OP_CAPTURE_STOP][0]
+		warnings = append(warnings, &WorkflowWarning{
+			Code:        WF_WARN_CAPTURE_NOT_STARTED,
+			Message:     "capture_stop without capture_start",
+			OperationID: op.ID,
+		})
+	}
+
+	// every file entering a step should have been through its upstream step before
+	for _, op := range ops {
+		upstream, ok := WORKFLOW_CHAIN[op.Type]
+		if !ok {
+			continue
+		}
+
+		for _, fID := range workflowOperationInputs(op, files) {
+			found, late := false, false
+			for _, x := range fileOps[fID] {
+				if x.ID == op.ID || !isOneOf(x.Type, upstream) {
+					continue
+				}
+				if x.CreatedAt.After(op.CreatedAt) || (x.CreatedAt.Equal(op.CreatedAt) && x.ID > op.ID) {
+					late = true
+				} else {
+					found = true
+					break
+				}
+			}
+
+			if found {
+				continue
+			}
+
+			w := &WorkflowWarning{OperationID: op.ID, FileID: fID}
+			if late {
+				w.Code = WF_WARN_OUT_OF_ORDER
+				w.Message = fmt.Sprintf("%s on file %d before %s", op.Type, fID, strings.Join(upstream, "/"))
+			} else {
+				w.Code = WF_WARN_MISSING_UPSTREAM
+				w.Message = fmt.Sprintf("%s on file %d without %s", op.Type, fID, strings.Join(upstream, "/"))
+			}
+			warnings = append(warnings, w)
+		}
+	}
+
+	return warnings
+}
+
+// workflowOperationInputs returns the IDs of files an operation was applied on.
+// Files created by the operation are children of other files in that same operation.
+func workflowOperationInputs(op *WorkflowOperation, files map[int64]*models.File) []int64 {
+	inOp := make(map[int64]bool, len(op.FileIDs))
+	for _, fID := range op.FileIDs {
+		inOp[fID] = true
+	}
+
+	inputs := make([]int64, 0)
+	for _, fID := range op.FileIDs {
+		if f, ok := files[fID]; ok && f.ParentID.Valid && inOp[f.ParentID.Int64] {
+			continue
+		}
+		inputs = append(inputs, fID)
+	}
+
+	return inputs
+}
+
+func newWorkflowOperation(op *models.Operation, fileIDs []int64) *WorkflowOperation {
+	x := &WorkflowOperation{Operation: *op, FileIDs: fileIDs}
+	if t, ok := common.OPERATION_TYPE_REGISTRY.ByID[op.TypeID]; ok {
+		x.Type = t.Name
+	}
+	return x
+}
+
+func operationWorkflowID(op *models.Operation) string {
+	if !op.Properties.Valid {
+		return ""
+	}
+
+	var props map[string]interface{}
+	if err := op.Properties.Unmarshal(&props); err != nil {
+		return ""
+	}
+
+	if wfID, ok := props["workflow_id"].(string); ok {
+		return wfID
+	}
+	return ""
+}
+
+func isOneOf(s string, options []string) bool {
+	for i := range options {
+		if options[i] == s {
+			return true
+		}
+	}
+	return false
+}
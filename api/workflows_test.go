@@ -0,0 +1,106 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func TestValidateWorkflowChain(t *testing.T) {
+	now := time.Now()
+	op := func(id int64, typ string, offset int, fileIDs ...int64) *WorkflowOperation {
+		x := &WorkflowOperation{Type: typ, FileIDs: fileIDs}
+		x.ID = id
+		x.CreatedAt = now.Add(time.Duration(offset) * time.Minute)
+		return x
+	}
+	files := map[int64]*models.File{
+		1: {ID: 1},
+		2: {ID: 2, ParentID: null.Int64From(1)},
+		3: {ID: 3, ParentID: null.Int64From(2)},
+	}
+
+	// happy path
+	ops := []*WorkflowOperation{
+		op(1, common.OP_CAPTURE_START, 0, 1),
+		op(2, common.OP_CAPTURE_STOP, 1, 1),
+		op(3, common.OP_DEMUX, 2, 1, 2),
+		op(4, common.OP_TRIM, 3, 2, 3),
+		op(5, common.OP_SEND, 4, 3),
+	}
+	warnings := ValidateWorkflowChain(ops, files)
+	assert.Empty(t, warnings, "happy path")
+
+	// originals are uploaded straight after send, proxies after convert
+	files[4] = &models.File{ID: 4, ParentID: null.Int64From(3)}
+	ops = append(ops,
+		op(6, common.OP_UPLOAD, 5, 3),
+		op(7, common.OP_CONVERT, 6, 3, 4),
+		op(8, common.OP_UPLOAD, 7, 4),
+	)
+	warnings = ValidateWorkflowChain(ops, files)
+	assert.Empty(t, warnings, "upload after send and after convert")
+
+	// upload without send or convert
+	ops = []*WorkflowOperation{
+		op(1, common.OP_CAPTURE_START, 0, 1),
+		op(2, common.OP_CAPTURE_STOP, 1, 1),
+		op(6, common.OP_UPLOAD, 2, 1),
+	}
+	warnings = ValidateWorkflowChain(ops, files)
+	if assert.Len(t, warnings, 1, "upload without upstream") {
+		assert.Equal(t, WF_WARN_MISSING_UPSTREAM, warnings[0].Code, "Code")
+		assert.Equal(t, int64(6), warnings[0].OperationID, "OperationID")
+	}
+
+	// trim without demux
+	ops = []*WorkflowOperation{
+		op(1, common.OP_CAPTURE_START, 0, 1),
+		op(2, common.OP_CAPTURE_STOP, 1, 1),
+		op(4, common.OP_TRIM, 3, 2, 3),
+	}
+	warnings = ValidateWorkflowChain(ops, files)
+	if assert.Len(t, warnings, 1, "missing upstream") {
+		assert.Equal(t, WF_WARN_MISSING_UPSTREAM, warnings[0].Code, "Code")
+		assert.Equal(t, int64(4), warnings[0].OperationID, "OperationID")
+		assert.Equal(t, int64(2), warnings[0].FileID, "FileID")
+	}
+
+	// send before trim
+	ops = []*WorkflowOperation{
+		op(1, common.OP_CAPTURE_START, 0, 1),
+		op(2, common.OP_CAPTURE_STOP, 1, 1),
+		op(3, common.OP_DEMUX, 2, 1, 2),
+		op(5, common.OP_SEND, 3, 3),
+		op(4, common.OP_TRIM, 4, 2, 3),
+	}
+	warnings = ValidateWorkflowChain(ops, files)
+	if assert.Len(t, warnings, 1, "out of order") {
+		assert.Equal(t, WF_WARN_OUT_OF_ORDER, warnings[0].Code, "Code")
+		assert.Equal(t, int64(5), warnings[0].OperationID, "OperationID")
+	}
+
+	// capture start without stop
+	ops = []*WorkflowOperation{
+		op(1, common.OP_CAPTURE_START, 0, 1),
+	}
+	warnings = ValidateWorkflowChain(ops, files)
+	if assert.Len(t, warnings, 1, "capture not stopped") {
+		assert.Equal(t, WF_WARN_CAPTURE_NOT_STOPPED, warnings[0].Code, "Code")
+	}
+
+	// capture stop without start
+	ops = []*WorkflowOperation{
+		op(2, common.OP_CAPTURE_STOP, 1, 1),
+		op(3, common.OP_DEMUX, 2, 1, 2),
+	}
+	warnings = ValidateWorkflowChain(ops, files)
+	if assert.Len(t, warnings, 1, "capture not started") {
+		assert.Equal(t, WF_WARN_CAPTURE_NOT_STARTED, warnings[0].Code, "Code")
+	}
+}
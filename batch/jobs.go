@@ -0,0 +1,39 @@
+package batch
+
+import (
+	"github.com/Bnei-Baruch/mdb/jobs"
+)
+
+// Job types of batch commands
+const (
+	JOB_RENAME_UNITS              = "rename_units"
+	JOB_APPLY_UNIT_NAMES          = "apply_unit_names"
+	JOB_EVENTS_SUBCOLLECTIONS     = "events_subcollections"
+	JOB_PREPARE_FILES_FOR_CONVERT = "prepare_files_for_convert"
+)
+
+func init() {
+	jobs.Register(&jobs.Definition{
+		Type:        JOB_RENAME_UNITS,
+		Description: "Dry run: report recomputed content unit names which differ from the current ones (csv or xlsx)",
+		Params:      func() interface{} { return new(RenameUnitsParams) },
+		Run:         renameUnits,
+	})
+	jobs.Register(&jobs.Definition{
+		Type:        JOB_APPLY_UNIT_NAMES,
+		Description: "Write the approved rows of a reviewed rename_units report",
+		Params:      func() interface{} { return new(ApplyUnitNamesParams) },
+		Run:         applyUnitNames,
+	})
+	jobs.Register(&jobs.Definition{
+		Type:        JOB_EVENTS_SUBCOLLECTIONS,
+		Description: "Organize events lesson parts in subcollections by capture",
+		Params:      func() interface{} { return new(EventsSubcollectionsParams) },
+		Run:         eventsSubcollections,
+	})
+	jobs.Register(&jobs.Definition{
+		Type:        JOB_PREPARE_FILES_FOR_CONVERT,
+		Description: "Enqueue video files to convert to mp4 in the transcode queue",
+		Run:         prepareFilesForConvert,
+	})
+}
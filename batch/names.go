@@ -2,96 +2,168 @@ package batch
 
 import (
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"runtime/debug"
+	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
-	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/api"
 	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/jobs"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
 var mdb *sql.DB
 
-type UnitNames struct {
-	UnitID int64
-	Names  map[string]string
+const (
+	NAMES_FORMAT_CSV  = "csv"
+	NAMES_FORMAT_XLSX = "xlsx"
+	NAMES_XLSX_SHEET  = "Sheet1"
+)
+
+// Columns of the rename units diff report.
+// Reviewers mark rows to apply in the approve column (see isApproved).
+var NAMES_REPORT_COLUMNS = []string{"unit_id", "uid", "content_type", "language", "old_name", "new_name", "approve"}
+
+type RenameUnitsParams struct {
+	ContentTypes  []string `json:"content_types"`
+	CollectionIDs []int64  `json:"collection_ids"`
+	Format        string   `json:"format"` // csv (default) or xlsx
+	Output        string   `json:"output"` // report path under batch.reports-dir, defaults to a new file there
 }
 
-func RenameUnits() {
-	var err error
-	clock := time.Now()
+func (p *RenameUnitsParams) Validate() error {
+	for _, ct := range p.ContentTypes {
+		if _, ok := common.CONTENT_TYPE_REGISTRY.ByName[ct]; !ok {
+			return errors.Errorf("Unknown content type %s", ct)
+		}
+	}
+	switch p.Format {
+	case "", NAMES_FORMAT_CSV, NAMES_FORMAT_XLSX:
+	default:
+		return errors.Errorf("Unknown format %s, expecting csv or xlsx", p.Format)
+	}
+	if p.Output != "" {
+		if _, err := namesReportPath(p.Output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// namesReportPath resolves a report path under batch.reports-dir (the temp directory if not configured).
+// Jobs are started by API clients too, so reports may not be read or written anywhere else.
+func namesReportPath(path string) (string, error) {
+	dir := viper.GetString("batch.reports-dir")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return utils.PathUnder(dir, path)
+}
 
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
-	//log.SetLevel(log.WarnLevel)
+type UnitNames struct {
+	Unit  *models.ContentUnit
+	Names map[string]string
+}
 
-	log.Info("Starting unit renaming")
+// NameDiff is a single (unit, language) row of the rename units report
+type NameDiff struct {
+	UnitID      int64
+	UID         string
+	ContentType string
+	Language    string
+	OldName     string
+	NewName     string
+	Approve     string
+}
 
-	log.Info("Setting up connection to MDB")
-	mdb, err = sql.Open("postgres", viper.GetString("mdb.url"))
-	utils.Must(err)
-	utils.Must(mdb.Ping())
-	defer mdb.Close()
-	boil.SetDB(mdb)
-	//boil.DebugMode = true
+func (d *NameDiff) row() []string {
+	return []string{strconv.FormatInt(d.UnitID, 10), d.UID, d.ContentType, d.Language, d.OldName, d.NewName, d.Approve}
+}
 
-	log.Info("Initializing static data from MDB")
-	utils.Must(common.InitTypeRegistries(mdb))
+// renameUnits is a dry run: it recomputes unit names and reports those which differ from the current ones.
+// Nothing is written to the DB, the reviewed report is applied with applyUnitNames.
+func renameUnits(ctx *jobs.Context) error {
+	mdb = ctx.DB
+	params, _ := ctx.Params().(*RenameUnitsParams)
+	if params == nil {
+		params = new(RenameUnitsParams)
+	}
 
-	log.Info("Loading all units")
-	units, err := models.ContentUnits(mdb,
-		qm.Load("CollectionsContentUnits", "CollectionsContentUnits.Collection")).
-		All()
-	utils.Must(err)
-	log.Infof("Got %d units", len(units))
+	mods := []qm.QueryMod{
+		qm.Load("ContentUnitI18ns", "CollectionsContentUnits", "CollectionsContentUnits.Collection"),
+	}
+	if len(params.ContentTypes) > 0 {
+		typeIDs := make([]int64, len(params.ContentTypes))
+		for i, ct := range params.ContentTypes {
+			typeIDs[i] = common.CONTENT_TYPE_REGISTRY.ByName[ct].ID
+		}
+		mods = append(mods, qm.Where("type_id = ANY(?)", pq.Array(typeIDs)))
+	}
+	if len(params.CollectionIDs) > 0 {
+		mods = append(mods, qm.Where(
+			"id IN (SELECT content_unit_id FROM collections_content_units WHERE collection_id = ANY(?))",
+			pq.Array(params.CollectionIDs)))
+	}
 
-	log.Info("Setting up workers")
-	jobs := make(chan *models.ContentUnit, 100)
+	ctx.Infof("Loading units")
+	units, err := models.ContentUnits(mdb, mods...).All()
+	if err != nil {
+		return errors.Wrap(err, "Load units")
+	}
+	ctx.Infof("Got %d units", len(units))
+	if err := ctx.SetTotal(int64(len(units))); err != nil {
+		return err
+	}
+
+	unitsCh := make(chan *models.ContentUnit, 100)
 	results := make(chan UnitNames, 100)
-	done := make(chan bool)
+	done := make(chan error)
+	errs := make(chan error, 5)
 
 	var workersWG sync.WaitGroup
 	for w := 1; w <= 5; w++ {
 		workersWG.Add(1)
-		go namesUnitWorker(jobs, results, &workersWG)
+		go namesUnitWorker(ctx, unitsCh, results, errs, &workersWG)
 	}
-	go namesWriter(results, done)
+	go namesWriter(ctx, params, results, errs, done)
 
-	log.Info("Queueing work")
 	for _, u := range units {
-		jobs <- u
+		unitsCh <- u
 	}
+	close(unitsCh)
 
-	log.Info("Closing jobs channel")
-	close(jobs)
-
-	log.Info("Waiting for workers to finish")
 	workersWG.Wait()
-
-	log.Info("Closing results channel")
+	close(errs)
 	close(results)
 
-	log.Info("Waiting for writer to finish")
-	<-done
-
-	log.Info("Success")
-	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+	return <-done
 }
 
-func namesUnitWorker(jobs <-chan *models.ContentUnit, results chan UnitNames, wg *sync.WaitGroup) {
-	for cu := range jobs {
+// namesUnitWorker stops when saving progress fails and reports the error to errs.
+// It keeps draining units so the feeder doesn't block.
+func namesUnitWorker(ctx *jobs.Context, units <-chan *models.ContentUnit, results chan UnitNames, errs chan<- error,
+	wg *sync.WaitGroup) {
+	var failed error
+	for cu := range units {
+		if failed != nil {
+			continue
+		}
+
 		metadata := api.CITMetadata{}
 
 		for i := range cu.R.CollectionsContentUnits {
@@ -110,8 +182,7 @@ func namesUnitWorker(jobs <-chan *models.ContentUnit, results chan UnitNames, wg
 					var props map[string]interface{}
 					err := json.Unmarshal(c.Properties.JSON, &props)
 					if err != nil {
-						log.Errorf("json.Unmarshal collection properties [%d]: %s", c.ID, err.Error())
-						debug.PrintStack()
+						ctx.Errorf("json.Unmarshal collection properties [%d]: %s", c.ID, err.Error())
 						continue
 					}
 
@@ -124,15 +195,15 @@ func namesUnitWorker(jobs <-chan *models.ContentUnit, results chan UnitNames, wg
 
 		describer, err := api.GetCUDescriber(mdb, cu, metadata)
 		if err != nil {
-			log.Errorf("Error getting describer for unit [%d]: %s", cu.ID, err.Error())
-			debug.PrintStack()
+			ctx.Errorf("Error getting describer for unit [%d]: %s", cu.ID, err.Error())
+			failed = ctx.Progress(0, 1)
 			continue
 		}
 
 		i18ns, err := describer.DescribeContentUnit(mdb, cu, metadata)
 		if err != nil {
-			log.Errorf("Error naming unit [%d]: %s", cu.ID, err.Error())
-			debug.PrintStack()
+			ctx.Errorf("Error naming unit [%d]: %s", cu.ID, err.Error())
+			failed = ctx.Progress(0, 1)
 			continue
 		}
 
@@ -143,41 +214,209 @@ func namesUnitWorker(jobs <-chan *models.ContentUnit, results chan UnitNames, wg
 			}
 		}
 
-		results <- UnitNames{UnitID: cu.ID, Names: names}
+		results <- UnitNames{Unit: cu, Names: names}
+		failed = ctx.Progress(1, 0)
+	}
+
+	if failed != nil {
+		errs <- failed
 	}
 	wg.Done()
 }
 
-func namesWriter(results <-chan UnitNames, done chan bool) {
-	f, err := ioutil.TempFile("/tmp", "unit_names_")
-	if err != nil {
-		utils.Must(err)
+// diffUnitNames returns a row for each language in which the new name differs from the current one
+func diffUnitNames(un UnitNames) []*NameDiff {
+	current := make(map[string]string)
+	if un.Unit.R != nil {
+		for _, i18n := range un.Unit.R.ContentUnitI18ns {
+			current[i18n.Language] = i18n.Name.String
+		}
 	}
-	defer f.Close()
-	log.Infof("Report file: %s", f.Name())
 
-	_, err = fmt.Fprintf(f, "ID\t%s\n", strings.Join(common.ALL_LANGS, "\t"))
-	utils.Must(err)
+	var ct string
+	if x, ok := common.CONTENT_TYPE_REGISTRY.ByID[un.Unit.TypeID]; ok {
+		ct = x.Name
+	}
 
+	diffs := make([]*NameDiff, 0)
+	for _, language := range common.ALL_LANGS {
+		name, ok := un.Names[language]
+		if !ok || name == current[language] {
+			continue
+		}
+		diffs = append(diffs, &NameDiff{
+			UnitID:      un.Unit.ID,
+			UID:         un.Unit.UID,
+			ContentType: ct,
+			Language:    language,
+			OldName:     current[language],
+			NewName:     name,
+		})
+	}
+
+	return diffs
+}
+
+// namesWriter writes the diff of all results to a report and sends its error, if any, on done.
+// Results are always drained so workers never block.
+// No report is written if a worker stopped (errs is closed before results), it would be partial.
+func namesWriter(ctx *jobs.Context, params *RenameUnitsParams, results <-chan UnitNames, errs <-chan error,
+	done chan error) {
+	var err error
+	defer func() {
+		for range results {
+		}
+		done <- err
+	}()
+
+	diffs := make([]*NameDiff, 0)
 	for un := range results {
 		if len(un.Names) == 0 {
-			log.Infof("No name [%d]", un.UnitID)
+			ctx.Warnf("No name [%d]", un.Unit.ID)
 			continue
 		}
+		diffs = append(diffs, diffUnitNames(un)...)
+	}
+
+	if werr, ok := <-errs; ok {
+		err = errors.Wrap(werr, "Worker stopped, report not written")
+		return
+	}
 
-		values := make([]string, len(common.ALL_LANGS)+1)
-		values[0] = strconv.FormatInt(un.UnitID, 10)
-		for i, language := range common.ALL_LANGS {
-			if name, ok := un.Names[language]; ok {
-				values[i+1] = name
-			} else {
-				values[i+1] = ""
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].UnitID == diffs[j].UnitID {
+			return diffs[i].Language < diffs[j].Language
+		}
+		return diffs[i].UnitID < diffs[j].UnitID
+	})
+
+	format := params.Format
+	if format == "" {
+		format = NAMES_FORMAT_CSV
+	}
+
+	path := params.Output
+	if path == "" {
+		path = fmt.Sprintf("unit_names_%s.%s", time.Now().Format("20060102_150405"), format)
+	}
+	path, err = namesReportPath(path)
+	if err != nil {
+		return
+	}
+
+	err = WriteNamesReport(path, format, diffs)
+	if err != nil {
+		return
+	}
+
+	ctx.Infof("%d changed names in report file: %s", len(diffs), path)
+}
+
+// WriteNamesReport writes a rename units report to path in the given format
+func WriteNamesReport(path, format string, diffs []*NameDiff) error {
+	if format == NAMES_FORMAT_XLSX {
+		out := excelize.NewFile()
+		for i, h := range NAMES_REPORT_COLUMNS {
+			out.SetCellStr(NAMES_XLSX_SHEET, xlsxCell(i, 1), h)
+		}
+		for i, d := range diffs {
+			for j, v := range d.row() {
+				out.SetCellStr(NAMES_XLSX_SHEET, xlsxCell(j, i+2), v)
 			}
 		}
+		return errors.Wrap(out.SaveAs(path), "Save xlsx report")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Create report file")
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(NAMES_REPORT_COLUMNS); err != nil {
+		return errors.Wrap(err, "Write report header")
+	}
+	for _, d := range diffs {
+		if err := w.Write(d.row()); err != nil {
+			return errors.Wrapf(err, "Write report line [%d]", d.UnitID)
+		}
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "Flush report")
+}
+
+// ReadNamesReport reads a (reviewed) rename units report, csv or xlsx by extension
+func ReadNamesReport(path string) ([]*NameDiff, error) {
+	var rows [][]string
+	if strings.ToLower(filepath.Ext(path)) == "."+NAMES_FORMAT_XLSX {
+		xlFile, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "excelize.OpenFile: %s", path)
+		}
+		rows = xlFile.GetRows(xlFile.GetSheetName(1))
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "Open report file")
+		}
+		defer f.Close()
 
-		_, err = fmt.Fprintln(f, strings.Join(values, "\t"))
-		utils.Must(err)
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		rows, err = r.ReadAll()
+		if err != nil {
+			return nil, errors.Wrap(err, "Read csv report")
+		}
 	}
 
-	done <- true
+	return parseNamesReport(rows)
+}
+
+func parseNamesReport(rows [][]string) ([]*NameDiff, error) {
+	if len(rows) == 0 {
+		return nil, errors.New("Empty report")
+	}
+
+	header := rows[0]
+	if len(header) < len(NAMES_REPORT_COLUMNS) {
+		return nil, errors.Errorf("Bad report header, expecting %s", strings.Join(NAMES_REPORT_COLUMNS, ","))
+	}
+	for i, h := range NAMES_REPORT_COLUMNS {
+		if strings.TrimSpace(strings.ToLower(header[i])) != h {
+			return nil, errors.Errorf("Bad report header, expecting %s", strings.Join(NAMES_REPORT_COLUMNS, ","))
+		}
+	}
+
+	diffs := make([]*NameDiff, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		if len(row) == 0 || (len(row) == 1 && row[0] == "") {
+			continue
+		}
+
+		// trailing empty cells are dropped by spreadsheets
+		for len(row) < len(NAMES_REPORT_COLUMNS) {
+			row = append(row, "")
+		}
+
+		id, err := strconv.ParseInt(strings.TrimSpace(row[0]), 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("Row %d: bad unit_id %s", i+2, row[0])
+		}
+		diffs = append(diffs, &NameDiff{
+			UnitID:      id,
+			UID:         row[1],
+			ContentType: row[2],
+			Language:    strings.TrimSpace(row[3]),
+			OldName:     row[4],
+			NewName:     row[5],
+			Approve:     row[6],
+		})
+	}
+
+	return diffs, nil
+}
+
+func xlsxCell(col, row int) string {
+	return fmt.Sprintf("%c%d", 'A'+col, row)
 }
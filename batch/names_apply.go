@@ -0,0 +1,146 @@
+package batch
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/jobs"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+type ApplyUnitNamesParams struct {
+	File string `json:"file"` // reviewed rename_units report (csv or xlsx) under batch.reports-dir
+}
+
+func (p *ApplyUnitNamesParams) Validate() error {
+	if p.File == "" {
+		return errors.New("file is required")
+	}
+	_, err := namesReportPath(p.File)
+	return err
+}
+
+type applyUnitNamesCheckpoint struct {
+	Next int `json:"next"` // index in approved rows to continue from
+}
+
+// isApproved tells if a reviewer marked a report row to be applied
+func isApproved(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "y", "yes", "v", "x", "1", "true", "ok":
+		return true
+	default:
+		return false
+	}
+}
+
+// applyUnitNames writes the approved rows of a reviewed rename_units report.
+// Rows whose unit name changed since the report was made are skipped.
+// Renamed units are announced with a unit update event on every checkpoint.
+func applyUnitNames(ctx *jobs.Context) error {
+	params := ctx.Params().(*ApplyUnitNamesParams)
+
+	path, err := namesReportPath(params.File)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := ReadNamesReport(path)
+	if err != nil {
+		return err
+	}
+
+	approved := make([]*NameDiff, 0)
+	for _, d := range diffs {
+		if isApproved(d.Approve) {
+			approved = append(approved, d)
+		}
+	}
+	ctx.Infof("%d of %d rows are approved", len(approved), len(diffs))
+
+	var cp applyUnitNamesCheckpoint
+	if _, err := ctx.LoadCheckpoint(&cp); err != nil {
+		return err
+	}
+	if cp.Next == 0 {
+		if err := ctx.SetTotal(int64(len(approved))); err != nil {
+			return err
+		}
+	}
+
+	renamed := make([]int64, 0)
+	for i := cp.Next; i < len(approved); i++ {
+		d := approved[i]
+		if err := applyUnitName(ctx.DB, d); err != nil {
+			ctx.Warnf("Unit %d [%s]: %s", d.UnitID, d.Language, err.Error())
+			if err := ctx.Progress(0, 1); err != nil {
+				return err
+			}
+		} else {
+			renamed = append(renamed, d.UnitID)
+			if err := ctx.Progress(1, 0); err != nil {
+				return err
+			}
+		}
+
+		if (i+1)%100 == 0 {
+			if err := emitUnitsRenamed(ctx, renamed); err != nil {
+				return err
+			}
+			renamed = renamed[:0]
+			if err := ctx.Checkpoint(applyUnitNamesCheckpoint{Next: i + 1}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return emitUnitsRenamed(ctx, renamed)
+}
+
+func emitUnitsRenamed(ctx *jobs.Context, ids []int64) error {
+	ids = utils.UniqueInt64(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	units, err := models.ContentUnits(ctx.DB, qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...)).All()
+	if err != nil {
+		return errors.Wrap(err, "Load renamed units")
+	}
+
+	evnts := make([]events.Event, len(units))
+	for i := range units {
+		evnts[i] = events.ContentUnitUpdateEvent(units[i])
+	}
+	ctx.Emitter.Emit(evnts...)
+
+	return nil
+}
+
+func applyUnitName(db *sql.DB, d *NameDiff) error {
+	if d.NewName == "" {
+		return errors.New("empty new_name")
+	}
+
+	i18n, err := models.FindContentUnitI18n(db, d.UnitID, d.Language)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return errors.Wrap(err, "Load i18n")
+		}
+		i18n = &models.ContentUnitI18n{ContentUnitID: d.UnitID, Language: d.Language}
+	}
+
+	if i18n.Name.String != d.OldName {
+		return errors.Errorf("Name changed since report: %s", i18n.Name.String)
+	}
+
+	i18n.Name = null.StringFrom(d.NewName)
+	err = i18n.Upsert(db, true, []string{"content_unit_id", "language"}, []string{"name"})
+	return errors.Wrap(err, "Upsert i18n")
+}
@@ -0,0 +1,329 @@
+package bundle
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VERSION of the bundle format, bump on incompatible changes
+const VERSION = 1
+
+// Bundle is a self contained copy of a collection and everything it references.
+// Entities reference each other by UID only, DB ids are meaningless across MDB instances.
+// Types (content types, source types, roles) are referenced by name.
+type Bundle struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Collection *Collection  `json:"collection"`
+	Units      []*Unit      `json:"units"`
+	Files      []*File      `json:"files"`
+	Sources    []*Source    `json:"sources"`
+	Tags       []*Tag       `json:"tags"`
+	Persons    []*Person    `json:"persons"`
+	Publishers []*Publisher `json:"publishers"`
+}
+
+type I18n struct {
+	Language         string `json:"language"`
+	OriginalLanguage string `json:"original_language,omitempty"`
+	Name             string `json:"name,omitempty"`
+	Description      string `json:"description,omitempty"`
+}
+
+type Collection struct {
+	UID        string          `json:"uid"`
+	Type       string          `json:"type"`
+	Properties json.RawMessage `json:"properties,omitempty"`
+	Secure     int16           `json:"secure"`
+	Published  bool            `json:"published"`
+	CreatedAt  time.Time       `json:"created_at"`
+	I18n       []*I18n         `json:"i18n,omitempty"`
+	Units      []*UnitRef      `json:"units"`
+}
+
+// UnitRef is the membership of a unit in the collection
+type UnitRef struct {
+	UID      string `json:"uid"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+type Unit struct {
+	UID         string          `json:"uid"`
+	Type        string          `json:"type"`
+	Properties  json.RawMessage `json:"properties,omitempty"`
+	Secure      int16           `json:"secure"`
+	Published   bool            `json:"published"`
+	CreatedAt   time.Time       `json:"created_at"`
+	I18n        []*I18n         `json:"i18n,omitempty"`
+	Sources     []string        `json:"sources,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	Persons     []*PersonRef    `json:"persons,omitempty"`
+	Publishers  []string        `json:"publishers,omitempty"`
+	Derivatives []*Derivation   `json:"derivatives,omitempty"` // units derived from this one
+}
+
+type PersonRef struct {
+	UID  string `json:"uid"`
+	Role string `json:"role"`
+}
+
+type Derivation struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+type File struct {
+	UID           string          `json:"uid"`
+	Name          string          `json:"name"`
+	Sha1          string          `json:"sha1,omitempty"`
+	Size          int64           `json:"size"`
+	Type          string          `json:"type"`
+	SubType       string          `json:"sub_type"`
+	MimeType      string          `json:"mime_type,omitempty"`
+	Language      string          `json:"language,omitempty"`
+	Properties    json.RawMessage `json:"properties,omitempty"`
+	Secure        int16           `json:"secure"`
+	Published     bool            `json:"published"`
+	CreatedAt     time.Time       `json:"created_at"`
+	FileCreatedAt *time.Time      `json:"file_created_at,omitempty"`
+	Unit          string          `json:"unit,omitempty"`
+	Parent        string          `json:"parent,omitempty"`
+}
+
+type Source struct {
+	UID         string          `json:"uid"`
+	Parent      string          `json:"parent,omitempty"`
+	Pattern     string          `json:"pattern,omitempty"`
+	Type        string          `json:"type"`
+	Position    *int            `json:"position,omitempty"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Properties  json.RawMessage `json:"properties,omitempty"`
+	I18n        []*I18n         `json:"i18n,omitempty"`
+}
+
+type Tag struct {
+	UID         string  `json:"uid"`
+	Parent      string  `json:"parent,omitempty"`
+	Pattern     string  `json:"pattern,omitempty"`
+	Description string  `json:"description,omitempty"`
+	I18n        []*I18n `json:"i18n,omitempty"` // Name is the label
+}
+
+type Person struct {
+	UID     string  `json:"uid"`
+	Pattern string  `json:"pattern,omitempty"`
+	I18n    []*I18n `json:"i18n,omitempty"`
+}
+
+type Publisher struct {
+	UID     string  `json:"uid"`
+	Pattern string  `json:"pattern,omitempty"`
+	I18n    []*I18n `json:"i18n,omitempty"`
+}
+
+// Validate checks the bundle is self contained, i.e. every UID referenced is in the bundle
+func (b *Bundle) Validate() error {
+	if b.Version != VERSION {
+		return errors.Errorf("Unsupported bundle version %d, expected %d", b.Version, VERSION)
+	}
+	if b.Collection == nil {
+		return errors.New("No collection in bundle")
+	}
+
+	units := make(map[string]bool, len(b.Units))
+	for _, x := range b.Units {
+		units[x.UID] = true
+	}
+	files := make(map[string]bool, len(b.Files))
+	for _, x := range b.Files {
+		files[x.UID] = true
+	}
+	sources := make(map[string]bool, len(b.Sources))
+	for _, x := range b.Sources {
+		sources[x.UID] = true
+	}
+	tags := make(map[string]bool, len(b.Tags))
+	for _, x := range b.Tags {
+		tags[x.UID] = true
+	}
+	persons := make(map[string]bool, len(b.Persons))
+	for _, x := range b.Persons {
+		persons[x.UID] = true
+	}
+	publishers := make(map[string]bool, len(b.Publishers))
+	for _, x := range b.Publishers {
+		publishers[x.UID] = true
+	}
+
+	missing := func(kind, uid, by string) error {
+		return errors.Errorf("%s %s referenced by %s is not in bundle", kind, uid, by)
+	}
+
+	for _, x := range b.Collection.Units {
+		if !units[x.UID] {
+			return missing("unit", x.UID, "collection")
+		}
+	}
+	for _, u := range b.Units {
+		for _, x := range u.Sources {
+			if !sources[x] {
+				return missing("source", x, "unit "+u.UID)
+			}
+		}
+		for _, x := range u.Tags {
+			if !tags[x] {
+				return missing("tag", x, "unit "+u.UID)
+			}
+		}
+		for _, x := range u.Persons {
+			if !persons[x.UID] {
+				return missing("person", x.UID, "unit "+u.UID)
+			}
+		}
+		for _, x := range u.Publishers {
+			if !publishers[x] {
+				return missing("publisher", x, "unit "+u.UID)
+			}
+		}
+		for _, x := range u.Derivatives {
+			if !units[x.UID] {
+				return missing("unit", x.UID, "unit "+u.UID)
+			}
+		}
+	}
+	for _, f := range b.Files {
+		if f.Unit != "" && !units[f.Unit] {
+			return missing("unit", f.Unit, "file "+f.UID)
+		}
+		if f.Parent != "" && !files[f.Parent] {
+			return missing("file", f.Parent, "file "+f.UID)
+		}
+	}
+	for _, s := range b.Sources {
+		if s.Parent != "" && !sources[s.Parent] {
+			return missing("source", s.Parent, "source "+s.UID)
+		}
+	}
+	for _, t := range b.Tags {
+		if t.Parent != "" && !tags[t.Parent] {
+			return missing("tag", t.Parent, "tag "+t.UID)
+		}
+	}
+
+	return nil
+}
+
+// Write saves a bundle as gzipped JSON
+func Write(path string, b *Bundle) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "Create %s", path)
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(b); err != nil {
+		return errors.Wrap(err, "Encode bundle")
+	}
+	return errors.Wrap(zw.Close(), "Close gzip writer")
+}
+
+// Read loads and validates a bundle written by Write
+func Read(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open %s", path)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read %s", path)
+	}
+	defer zr.Close()
+
+	var b Bundle
+	if err := json.NewDecoder(zr).Decode(&b); err != nil {
+		return nil, errors.Wrap(err, "Decode bundle")
+	}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// parentsFirst returns an order of n items in which parents come before their children
+func parentsFirst(uids, parents []string) []int {
+	idx := make(map[string]int, len(uids))
+	for i, uid := range uids {
+		idx[uid] = i
+	}
+
+	order := make([]int, 0, len(uids))
+	visited := make([]bool, len(uids))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		if p, ok := idx[parents[i]]; ok {
+			visit(p)
+		}
+		order = append(order, i)
+	}
+	for i := range uids {
+		visit(i)
+	}
+
+	return order
+}
+
+func sortSources(sources []*Source) []*Source {
+	uids := make([]string, len(sources))
+	parents := make([]string, len(sources))
+	for i, s := range sources {
+		uids[i], parents[i] = s.UID, s.Parent
+	}
+
+	sorted := make([]*Source, len(sources))
+	for i, j := range parentsFirst(uids, parents) {
+		sorted[i] = sources[j]
+	}
+	return sorted
+}
+
+func sortTags(tags []*Tag) []*Tag {
+	uids := make([]string, len(tags))
+	parents := make([]string, len(tags))
+	for i, t := range tags {
+		uids[i], parents[i] = t.UID, t.Parent
+	}
+
+	sorted := make([]*Tag, len(tags))
+	for i, j := range parentsFirst(uids, parents) {
+		sorted[i] = tags[j]
+	}
+	return sorted
+}
+
+func sortFiles(files []*File) []*File {
+	uids := make([]string, len(files))
+	parents := make([]string, len(files))
+	for i, f := range files {
+		uids[i], parents[i] = f.UID, f.Parent
+	}
+
+	sorted := make([]*File, len(files))
+	for i, j := range parentsFirst(uids, parents) {
+		sorted[i] = files[j]
+	}
+	return sorted
+}
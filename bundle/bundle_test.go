@@ -0,0 +1,123 @@
+package bundle
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBundle() *Bundle {
+	pos := 1
+	return &Bundle{
+		Version:    VERSION,
+		ExportedAt: time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC),
+		Collection: &Collection{
+			UID:  "cccccccc",
+			Type: "CONGRESS",
+			I18n: []*I18n{{Language: "en", Name: "Congress"}},
+			Units: []*UnitRef{
+				{UID: "uuuuuuu1", Name: "1", Position: 1},
+			},
+		},
+		Units: []*Unit{
+			{
+				UID:         "uuuuuuu1",
+				Type:        "LESSON_PART",
+				Properties:  json.RawMessage(`{"duration":3600}`),
+				Sources:     []string{"ssssssc1"},
+				Tags:        []string{"ttttttt2"},
+				Persons:     []*PersonRef{{UID: "pppppppp", Role: "LECTURER"}},
+				Publishers:  []string{"bbbbbbbb"},
+				Derivatives: []*Derivation{{UID: "uuuuuuu2", Name: "clip"}},
+			},
+			{UID: "uuuuuuu2", Type: "CLIP"},
+		},
+		Files: []*File{
+			{UID: "fffffff2", Name: "heb.mp3", Sha1: "0987654321fedcba0987654321fedcba09876543", Unit: "uuuuuuu1", Parent: "fffffff1"},
+			{UID: "fffffff1", Name: "heb.mp4", Sha1: "1234567890abcdef1234567890abcdef12345678", Unit: "uuuuuuu1"},
+		},
+		Sources: []*Source{
+			{UID: "ssssssc1", Parent: "ssssssb1", Type: "CHAPTER", Name: "1", Position: &pos},
+			{UID: "ssssssb1", Type: "BOOK", Name: "Shamati", Pattern: "shamati"},
+		},
+		Tags: []*Tag{
+			{UID: "ttttttt2", Parent: "ttttttt1", I18n: []*I18n{{Language: "en", Name: "Child"}}},
+			{UID: "ttttttt1", Pattern: "root"},
+		},
+		Persons:    []*Person{{UID: "pppppppp", Pattern: "rav"}},
+		Publishers: []*Publisher{{UID: "bbbbbbbb"}},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bundle")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bundle.json.gz")
+
+	b := testBundle()
+	assert.Nil(t, Write(path, b))
+
+	r, err := Read(path)
+	assert.Nil(t, err)
+	assert.Equal(t, b, r)
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, testBundle().Validate())
+
+	b := testBundle()
+	b.Version = VERSION + 1
+	assert.NotNil(t, b.Validate())
+
+	b = testBundle()
+	b.Collection = nil
+	assert.NotNil(t, b.Validate())
+
+	b = testBundle()
+	b.Units[0].Tags = append(b.Units[0].Tags, "missing1")
+	assert.EqualError(t, b.Validate(), "tag missing1 referenced by unit uuuuuuu1 is not in bundle")
+
+	b = testBundle()
+	b.Units = b.Units[:1]
+	assert.EqualError(t, b.Validate(), "unit uuuuuuu2 referenced by unit uuuuuuu1 is not in bundle")
+
+	b = testBundle()
+	b.Sources = b.Sources[:1]
+	assert.EqualError(t, b.Validate(), "source ssssssb1 referenced by source ssssssc1 is not in bundle")
+
+	b = testBundle()
+	b.Files = b.Files[:1]
+	assert.EqualError(t, b.Validate(), "file fffffff1 referenced by file fffffff2 is not in bundle")
+}
+
+func TestParentsFirst(t *testing.T) {
+	b := testBundle()
+
+	sources := sortSources(b.Sources)
+	assert.Equal(t, "ssssssb1", sources[0].UID)
+	assert.Equal(t, "ssssssc1", sources[1].UID)
+
+	tags := sortTags(b.Tags)
+	assert.Equal(t, "ttttttt1", tags[0].UID)
+	assert.Equal(t, "ttttttt2", tags[1].UID)
+
+	files := sortFiles(b.Files)
+	assert.Equal(t, "fffffff1", files[0].UID)
+	assert.Equal(t, "fffffff2", files[1].UID)
+
+	// grandchild listed before its ancestors, unknown parents are ignored
+	order := parentsFirst([]string{"c", "b", "a", "x"}, []string{"b", "a", "", "unknown"})
+	assert.Equal(t, []int{2, 1, 0, 3}, order)
+}
+
+func TestImportOptions(t *testing.T) {
+	assert.Nil(t, ImportOptions{Collisions: COLLISIONS_REUSE}.Validate())
+	assert.Nil(t, ImportOptions{Collisions: COLLISIONS_NEW}.Validate())
+	assert.NotNil(t, ImportOptions{Collisions: "overwrite"}.Validate())
+}
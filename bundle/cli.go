@@ -0,0 +1,99 @@
+package bundle
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func openDB() *sql.DB {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	utils.Must(common.InitTypeRegistries(db))
+	return db
+}
+
+// ExportCommand writes a bundle of the collection with the given UID to path
+func ExportCommand(uid, path string) {
+	clock := time.Now()
+
+	db := openDB()
+	defer db.Close()
+
+	b, err := Export(db, uid)
+	utils.Must(err)
+	utils.Must(Write(path, b))
+
+	log.Infof("Exported collection %s to %s: %d units, %d files, %d sources, %d tags, %d persons, %d publishers",
+		uid, path, len(b.Units), len(b.Files), len(b.Sources), len(b.Tags), len(b.Persons), len(b.Publishers))
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// ImportCommand loads the bundle at path. Changes are rolled back unless apply is set.
+func ImportCommand(path, collisions string, apply bool) {
+	clock := time.Now()
+
+	b, err := Read(path)
+	utils.Must(err)
+
+	db := openDB()
+	defer db.Close()
+
+	opts := ImportOptions{Collisions: collisions, DryRun: !apply}
+	if !apply {
+		summary, _, err := Import(db, b, opts)
+		utils.Must(err)
+		PrintSummary(summary)
+		log.Info("Preview only, run again with --apply to write changes")
+		return
+	}
+
+	emitter, err := events.InitEmitter()
+	utils.Must(err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		events.CloseEmitter(ctx)
+	}()
+
+	summary, evnts, err := Import(db, b, opts)
+	utils.Must(err)
+	emitter.Emit(evnts...)
+	PrintSummary(summary)
+
+	log.Infof("Imported bundle as collection %s", summary.Collection)
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// PrintSummary writes the import counts and renamed UIDs to stdout
+func PrintSummary(s *Summary) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tCREATED\tREUSED")
+	for _, k := range KINDS {
+		fmt.Fprintf(w, "%s\t%d\t%d\n", k, s.Counts[k].Created, s.Counts[k].Reused)
+	}
+	w.Flush()
+
+	if len(s.Renamed) == 0 {
+		return
+	}
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nBUNDLE UID\tNEW UID")
+	for k, v := range s.Renamed {
+		fmt.Fprintf(w, "%s\t%s\n", k, v)
+	}
+	w.Flush()
+}
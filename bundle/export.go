@@ -0,0 +1,421 @@
+package bundle
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var UNIT_RELATIONS = []string{
+	"ContentUnitI18ns",
+	"ContentUnitsPersons",
+	"Publishers",
+	"Sources",
+	"Tags",
+	"Files",
+	"SourceContentUnitDerivations",
+}
+
+// Export collects a collection and everything it references into a bundle.
+// Units derived from the collection's units are included as well, one hop out.
+func Export(exec boil.Executor, uid string) (*Bundle, error) {
+	c, err := models.Collections(exec,
+		qm.Where("uid = ?", uid),
+		qm.Load("CollectionI18ns", "CollectionsContentUnits")).
+		One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.Errorf("Unknown collection %s", uid)
+		}
+		return nil, errors.Wrapf(err, "Load collection %s", uid)
+	}
+
+	b := &Bundle{
+		Version:    VERSION,
+		ExportedAt: time.Now().UTC(),
+		Collection: &Collection{
+			UID:        c.UID,
+			Type:       common.CONTENT_TYPE_REGISTRY.ByID[c.TypeID].Name,
+			Properties: jsonValue(c.Properties),
+			Secure:     c.Secure,
+			Published:  c.Published,
+			CreatedAt:  c.CreatedAt,
+		},
+	}
+	for _, x := range c.R.CollectionI18ns {
+		b.Collection.I18n = append(b.Collection.I18n, &I18n{
+			Language:         x.Language,
+			OriginalLanguage: x.OriginalLanguage.String,
+			Name:             x.Name.String,
+			Description:      x.Description.String,
+		})
+	}
+
+	// collection units, then the units derived from them
+	ids := make([]int64, len(c.R.CollectionsContentUnits))
+	for i, ccu := range c.R.CollectionsContentUnits {
+		ids[i] = ccu.ContentUnitID
+	}
+	units, err := loadUnits(exec, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]*models.ContentUnit, len(units))
+	for _, cu := range units {
+		byID[cu.ID] = cu
+	}
+
+	var derivedIDs []int64
+	for _, cu := range units {
+		for _, d := range cu.R.SourceContentUnitDerivations {
+			if _, ok := byID[d.DerivedID]; !ok {
+				derivedIDs = append(derivedIDs, d.DerivedID)
+			}
+		}
+	}
+	derived, err := loadUnits(exec, derivedIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, cu := range derived {
+		if _, ok := byID[cu.ID]; !ok {
+			byID[cu.ID] = cu
+			units = append(units, cu)
+		}
+	}
+
+	for _, ccu := range c.R.CollectionsContentUnits {
+		b.Collection.Units = append(b.Collection.Units, &UnitRef{
+			UID:      byID[ccu.ContentUnitID].UID,
+			Name:     ccu.Name,
+			Position: ccu.Position,
+		})
+	}
+
+	roles := make(map[int64]string, len(common.CONTENT_ROLE_TYPE_REGISTRY.ByName))
+	for k, v := range common.CONTENT_ROLE_TYPE_REGISTRY.ByName {
+		roles[v.ID] = k
+	}
+
+	sourceIDs := make(map[int64]bool)
+	tagIDs := make(map[int64]bool)
+	personIDs := make(map[int64]bool)
+	publisherIDs := make(map[int64]bool)
+	var files []*models.File
+
+	for _, cu := range units {
+		u := &Unit{
+			UID:        cu.UID,
+			Type:       common.CONTENT_TYPE_REGISTRY.ByID[cu.TypeID].Name,
+			Properties: jsonValue(cu.Properties),
+			Secure:     cu.Secure,
+			Published:  cu.Published,
+			CreatedAt:  cu.CreatedAt,
+		}
+		for _, x := range cu.R.ContentUnitI18ns {
+			u.I18n = append(u.I18n, &I18n{
+				Language:         x.Language,
+				OriginalLanguage: x.OriginalLanguage.String,
+				Name:             x.Name.String,
+				Description:      x.Description.String,
+			})
+		}
+		for _, x := range cu.R.Sources {
+			u.Sources = append(u.Sources, x.UID)
+			sourceIDs[x.ID] = true
+		}
+		for _, x := range cu.R.Tags {
+			u.Tags = append(u.Tags, x.UID)
+			tagIDs[x.ID] = true
+		}
+		for _, x := range cu.R.Publishers {
+			u.Publishers = append(u.Publishers, x.UID)
+			publisherIDs[x.ID] = true
+		}
+		for _, x := range cu.R.ContentUnitsPersons {
+			personIDs[x.PersonID] = true
+		}
+		for _, x := range cu.R.SourceContentUnitDerivations {
+			if d, ok := byID[x.DerivedID]; ok {
+				u.Derivatives = append(u.Derivatives, &Derivation{UID: d.UID, Name: x.Name})
+			}
+		}
+		for _, f := range cu.R.Files {
+			if !f.RemovedAt.Valid {
+				files = append(files, f)
+			}
+		}
+		b.Units = append(b.Units, u)
+	}
+
+	persons, err := exportPersons(exec, personIDs)
+	if err != nil {
+		return nil, err
+	}
+	personUIDs := make(map[int64]string, len(persons))
+	for _, p := range persons {
+		personUIDs[p.ID] = p.UID
+		x := &Person{UID: p.UID, Pattern: p.Pattern.String}
+		for _, i18n := range p.R.PersonI18ns {
+			x.I18n = append(x.I18n, &I18n{
+				Language:         i18n.Language,
+				OriginalLanguage: i18n.OriginalLanguage.String,
+				Name:             i18n.Name.String,
+				Description:      i18n.Description.String,
+			})
+		}
+		b.Persons = append(b.Persons, x)
+	}
+	for i, cu := range units {
+		for _, x := range cu.R.ContentUnitsPersons {
+			b.Units[i].Persons = append(b.Units[i].Persons, &PersonRef{
+				UID:  personUIDs[x.PersonID],
+				Role: roles[x.RoleID],
+			})
+		}
+	}
+
+	publishers, err := exportPublishers(exec, publisherIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range publishers {
+		x := &Publisher{UID: p.UID, Pattern: p.Pattern.String}
+		for _, i18n := range p.R.PublisherI18ns {
+			x.I18n = append(x.I18n, &I18n{
+				Language:         i18n.Language,
+				OriginalLanguage: i18n.OriginalLanguage.String,
+				Name:             i18n.Name.String,
+				Description:      i18n.Description.String,
+			})
+		}
+		b.Publishers = append(b.Publishers, x)
+	}
+
+	if b.Sources, err = exportSources(exec, sourceIDs); err != nil {
+		return nil, err
+	}
+	if b.Tags, err = exportTags(exec, tagIDs); err != nil {
+		return nil, err
+	}
+	b.Files = exportFiles(files, byID)
+
+	return b, b.Validate()
+}
+
+func loadUnits(exec boil.Executor, ids []int64) ([]*models.ContentUnit, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	units, err := models.ContentUnits(exec,
+		qm.WhereIn("id in ?", utils.ConvertArgsInt64(ids)...),
+		qm.Load(UNIT_RELATIONS...)).
+		All()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load content units")
+	}
+
+	return units, nil
+}
+
+func exportPersons(exec boil.Executor, ids map[int64]bool) ([]*models.Person, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	persons, err := models.Persons(exec,
+		qm.WhereIn("id in ?", utils.ConvertArgsInt64(keys(ids))...),
+		qm.Load("PersonI18ns")).
+		All()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load persons")
+	}
+
+	return persons, nil
+}
+
+func exportPublishers(exec boil.Executor, ids map[int64]bool) ([]*models.Publisher, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	publishers, err := models.Publishers(exec,
+		qm.WhereIn("id in ?", utils.ConvertArgsInt64(keys(ids))...),
+		qm.Load("PublisherI18ns")).
+		All()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load publishers")
+	}
+
+	return publishers, nil
+}
+
+// exportSources loads the given sources with all their ancestors
+func exportSources(exec boil.Executor, ids map[int64]bool) ([]*Source, error) {
+	all := make(map[int64]*models.Source)
+	for pending := keys(ids); len(pending) > 0; {
+		sources, err := models.Sources(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(pending)...),
+			qm.Load("SourceI18ns")).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load sources")
+		}
+
+		pending = nil
+		for _, s := range sources {
+			all[s.ID] = s
+		}
+		for _, s := range sources {
+			if s.ParentID.Valid {
+				if _, ok := all[s.ParentID.Int64]; !ok {
+					pending = append(pending, s.ParentID.Int64)
+				}
+			}
+		}
+	}
+
+	res := make([]*Source, 0, len(all))
+	for _, s := range all {
+		x := &Source{
+			UID:         s.UID,
+			Pattern:     s.Pattern.String,
+			Type:        common.SOURCE_TYPE_REGISTRY.ByID[s.TypeID].Name,
+			Name:        s.Name,
+			Description: s.Description.String,
+			Properties:  jsonValue(s.Properties),
+		}
+		if s.ParentID.Valid {
+			x.Parent = all[s.ParentID.Int64].UID
+		}
+		if s.Position.Valid {
+			pos := s.Position.Int
+			x.Position = &pos
+		}
+		for _, i18n := range s.R.SourceI18ns {
+			x.I18n = append(x.I18n, &I18n{
+				Language:    i18n.Language,
+				Name:        i18n.Name.String,
+				Description: i18n.Description.String,
+			})
+		}
+		res = append(res, x)
+	}
+
+	return sortSources(res), nil
+}
+
+// exportTags loads the given tags with all their ancestors
+func exportTags(exec boil.Executor, ids map[int64]bool) ([]*Tag, error) {
+	all := make(map[int64]*models.Tag)
+	for pending := keys(ids); len(pending) > 0; {
+		tags, err := models.Tags(exec,
+			qm.WhereIn("id in ?", utils.ConvertArgsInt64(pending)...),
+			qm.Load("TagI18ns")).
+			All()
+		if err != nil {
+			return nil, errors.Wrap(err, "Load tags")
+		}
+
+		pending = nil
+		for _, t := range tags {
+			all[t.ID] = t
+		}
+		for _, t := range tags {
+			if t.ParentID.Valid {
+				if _, ok := all[t.ParentID.Int64]; !ok {
+					pending = append(pending, t.ParentID.Int64)
+				}
+			}
+		}
+	}
+
+	res := make([]*Tag, 0, len(all))
+	for _, t := range all {
+		x := &Tag{
+			UID:         t.UID,
+			Pattern:     t.Pattern.String,
+			Description: t.Description.String,
+		}
+		if t.ParentID.Valid {
+			x.Parent = all[t.ParentID.Int64].UID
+		}
+		for _, i18n := range t.R.TagI18ns {
+			x.I18n = append(x.I18n, &I18n{
+				Language:         i18n.Language,
+				OriginalLanguage: i18n.OriginalLanguage.String,
+				Name:             i18n.Label.String,
+			})
+		}
+		res = append(res, x)
+	}
+
+	return sortTags(res), nil
+}
+
+// exportFiles maps unit files to the bundle. Parent files outside the bundle are dropped.
+func exportFiles(files []*models.File, units map[int64]*models.ContentUnit) []*File {
+	uids := make(map[int64]string, len(files))
+	for _, f := range files {
+		uids[f.ID] = f.UID
+	}
+
+	res := make([]*File, len(files))
+	for i, f := range files {
+		x := &File{
+			UID:        f.UID,
+			Name:       f.Name,
+			Size:       f.Size,
+			Type:       f.Type,
+			SubType:    f.SubType,
+			MimeType:   f.MimeType.String,
+			Language:   f.Language.String,
+			Properties: jsonValue(f.Properties),
+			Secure:     f.Secure,
+			Published:  f.Published,
+			CreatedAt:  f.CreatedAt,
+		}
+		if f.Sha1.Valid {
+			x.Sha1 = hex.EncodeToString(f.Sha1.Bytes)
+		}
+		if f.FileCreatedAt.Valid {
+			t := f.FileCreatedAt.Time
+			x.FileCreatedAt = &t
+		}
+		if f.ContentUnitID.Valid {
+			x.Unit = units[f.ContentUnitID.Int64].UID
+		}
+		if f.ParentID.Valid {
+			x.Parent = uids[f.ParentID.Int64]
+		}
+		res[i] = x
+	}
+
+	return res
+}
+
+func jsonValue(j null.JSON) json.RawMessage {
+	if !j.Valid || len(j.JSON) == 0 {
+		return nil
+	}
+	return json.RawMessage(j.JSON)
+}
+
+func keys(m map[int64]bool) []int64 {
+	res := make([]int64, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
@@ -0,0 +1,632 @@
+package bundle
+
+import (
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// What to do when a collection or unit in the bundle has the UID of an existing one
+const (
+	COLLISIONS_REUSE = "reuse" // assume it is the same entity and link to it
+	COLLISIONS_NEW   = "new"   // create a new entity with a fresh UID
+)
+
+var COLLISION_POLICIES = []string{COLLISIONS_REUSE, COLLISIONS_NEW}
+
+const (
+	KIND_COLLECTION = "collection"
+	KIND_UNIT       = "content_unit"
+	KIND_FILE       = "file"
+	KIND_SOURCE     = "source"
+	KIND_TAG        = "tag"
+	KIND_PERSON     = "person"
+	KIND_PUBLISHER  = "publisher"
+)
+
+var KINDS = []string{KIND_COLLECTION, KIND_UNIT, KIND_FILE, KIND_SOURCE, KIND_TAG, KIND_PERSON, KIND_PUBLISHER}
+
+type ImportOptions struct {
+	Collisions string
+	DryRun     bool // import inside a transaction and roll it back
+}
+
+func (o ImportOptions) Validate() error {
+	for _, x := range COLLISION_POLICIES {
+		if o.Collisions == x {
+			return nil
+		}
+	}
+	return errors.Errorf("Unknown collisions policy %q, expected one of %v", o.Collisions, COLLISION_POLICIES)
+}
+
+type Count struct {
+	Created int
+	Reused  int
+}
+
+type Summary struct {
+	Collection string // UID of the collection in this MDB
+	Counts     map[string]*Count
+	Renamed    map[string]string // bundle UID => new UID, for entities created under a fresh UID
+}
+
+func (s *Summary) created(kind string) {
+	s.Counts[kind].Created++
+}
+
+func (s *Summary) reused(kind string) {
+	s.Counts[kind].Reused++
+}
+
+// Import loads a bundle into MDB in a single transaction.
+// Sources, tags, persons and publishers are matched by UID and then by pattern and created only if missing.
+// Files are matched by sha1. Collections and units colliding on UID are handled by opts.Collisions.
+func Import(db *sql.DB, b *Bundle, opts ImportOptions) (*Summary, []events.Event, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := b.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Begin transaction")
+	}
+
+	imp := newImporter(tx, opts)
+	err = imp.run(b)
+	if err != nil || opts.DryRun {
+		if ex := tx.Rollback(); ex != nil {
+			return nil, nil, errors.Wrap(ex, "Rollback transaction")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return imp.summary, nil, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, errors.Wrap(err, "Commit transaction")
+	}
+
+	return imp.summary, imp.evnts, nil
+}
+
+type importer struct {
+	exec    boil.Executor
+	opts    ImportOptions
+	summary *Summary
+	evnts   []events.Event
+
+	// bundle UID => id in this MDB
+	sources    map[string]int64
+	tags       map[string]int64
+	persons    map[string]int64
+	publishers map[string]int64
+	units      map[string]*models.ContentUnit
+	files      map[string]int64
+
+	createdUnits map[string]bool
+}
+
+func newImporter(exec boil.Executor, opts ImportOptions) *importer {
+	summary := &Summary{
+		Counts:  make(map[string]*Count, len(KINDS)),
+		Renamed: make(map[string]string),
+	}
+	for _, k := range KINDS {
+		summary.Counts[k] = new(Count)
+	}
+
+	return &importer{
+		exec:         exec,
+		opts:         opts,
+		summary:      summary,
+		sources:      make(map[string]int64),
+		tags:         make(map[string]int64),
+		persons:      make(map[string]int64),
+		publishers:   make(map[string]int64),
+		units:        make(map[string]*models.ContentUnit),
+		files:        make(map[string]int64),
+		createdUnits: make(map[string]bool),
+	}
+}
+
+func (imp *importer) run(b *Bundle) error {
+	for _, s := range sortSources(b.Sources) {
+		if err := imp.importSource(s); err != nil {
+			return errors.Wrapf(err, "Source %s", s.UID)
+		}
+	}
+	for _, t := range sortTags(b.Tags) {
+		if err := imp.importTag(t); err != nil {
+			return errors.Wrapf(err, "Tag %s", t.UID)
+		}
+	}
+	for _, p := range b.Persons {
+		if err := imp.importPerson(p); err != nil {
+			return errors.Wrapf(err, "Person %s", p.UID)
+		}
+	}
+	for _, p := range b.Publishers {
+		if err := imp.importPublisher(p); err != nil {
+			return errors.Wrapf(err, "Publisher %s", p.UID)
+		}
+	}
+	for _, u := range b.Units {
+		if err := imp.importUnit(u); err != nil {
+			return errors.Wrapf(err, "Content unit %s", u.UID)
+		}
+	}
+	for _, u := range b.Units {
+		if err := imp.importDerivations(u); err != nil {
+			return errors.Wrapf(err, "Content unit %s derivations", u.UID)
+		}
+	}
+	for _, f := range sortFiles(b.Files) {
+		if err := imp.importFile(f); err != nil {
+			return errors.Wrapf(err, "File %s", f.UID)
+		}
+	}
+
+	return errors.Wrapf(imp.importCollection(b.Collection), "Collection %s", b.Collection.UID)
+}
+
+func (imp *importer) importSource(s *Source) error {
+	existing, err := models.Sources(imp.exec, qm.Where("uid = ?", s.UID)).One()
+	if err == sql.ErrNoRows && s.Pattern != "" {
+		existing, err = models.Sources(imp.exec, qm.Where("pattern = ?", s.Pattern)).One()
+	}
+	if err == nil {
+		imp.sources[s.UID] = existing.ID
+		imp.summary.reused(KIND_SOURCE)
+		return nil
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	st, ok := common.SOURCE_TYPE_REGISTRY.ByName[s.Type]
+	if !ok {
+		return errors.Errorf("Unknown source type %s", s.Type)
+	}
+
+	source := &models.Source{
+		UID:         s.UID,
+		TypeID:      st.ID,
+		Name:        s.Name,
+		Pattern:     null.NewString(s.Pattern, s.Pattern != ""),
+		Description: null.NewString(s.Description, s.Description != ""),
+		Properties:  null.NewJSON(s.Properties, len(s.Properties) > 0),
+	}
+	if s.Parent != "" {
+		source.ParentID = null.Int64From(imp.sources[s.Parent])
+	}
+	if s.Position != nil {
+		source.Position = null.IntFrom(*s.Position)
+	}
+	if err := source.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range s.I18n {
+		i18n := &models.SourceI18n{
+			SourceID:    source.ID,
+			Language:    x.Language,
+			Name:        null.NewString(x.Name, x.Name != ""),
+			Description: null.NewString(x.Description, x.Description != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	imp.sources[s.UID] = source.ID
+	imp.summary.created(KIND_SOURCE)
+	imp.evnts = append(imp.evnts, events.SourceCreateEvent(source))
+	return nil
+}
+
+func (imp *importer) importTag(t *Tag) error {
+	existing, err := models.Tags(imp.exec, qm.Where("uid = ?", t.UID)).One()
+	if err == sql.ErrNoRows && t.Pattern != "" {
+		existing, err = models.Tags(imp.exec, qm.Where("pattern = ?", t.Pattern)).One()
+	}
+	if err == nil {
+		imp.tags[t.UID] = existing.ID
+		imp.summary.reused(KIND_TAG)
+		return nil
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	tag := &models.Tag{
+		UID:         t.UID,
+		Pattern:     null.NewString(t.Pattern, t.Pattern != ""),
+		Description: null.NewString(t.Description, t.Description != ""),
+	}
+	if t.Parent != "" {
+		tag.ParentID = null.Int64From(imp.tags[t.Parent])
+	}
+	if err := tag.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range t.I18n {
+		i18n := &models.TagI18n{
+			TagID:            tag.ID,
+			Language:         x.Language,
+			OriginalLanguage: null.NewString(x.OriginalLanguage, x.OriginalLanguage != ""),
+			Label:            null.NewString(x.Name, x.Name != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	imp.tags[t.UID] = tag.ID
+	imp.summary.created(KIND_TAG)
+	imp.evnts = append(imp.evnts, events.TagCreateEvent(tag))
+	return nil
+}
+
+func (imp *importer) importPerson(p *Person) error {
+	existing, err := models.Persons(imp.exec, qm.Where("uid = ?", p.UID)).One()
+	if err == sql.ErrNoRows && p.Pattern != "" {
+		existing, err = models.Persons(imp.exec, qm.Where("pattern = ?", p.Pattern)).One()
+	}
+	if err == nil {
+		imp.persons[p.UID] = existing.ID
+		imp.summary.reused(KIND_PERSON)
+		return nil
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	person := &models.Person{
+		UID:     p.UID,
+		Pattern: null.NewString(p.Pattern, p.Pattern != ""),
+	}
+	if err := person.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range p.I18n {
+		i18n := &models.PersonI18n{
+			PersonID:         person.ID,
+			Language:         x.Language,
+			OriginalLanguage: null.NewString(x.OriginalLanguage, x.OriginalLanguage != ""),
+			Name:             null.NewString(x.Name, x.Name != ""),
+			Description:      null.NewString(x.Description, x.Description != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	imp.persons[p.UID] = person.ID
+	imp.summary.created(KIND_PERSON)
+	imp.evnts = append(imp.evnts, events.PersonCreateEvent(person))
+	return nil
+}
+
+func (imp *importer) importPublisher(p *Publisher) error {
+	existing, err := models.Publishers(imp.exec, qm.Where("uid = ?", p.UID)).One()
+	if err == sql.ErrNoRows && p.Pattern != "" {
+		existing, err = models.Publishers(imp.exec, qm.Where("pattern = ?", p.Pattern)).One()
+	}
+	if err == nil {
+		imp.publishers[p.UID] = existing.ID
+		imp.summary.reused(KIND_PUBLISHER)
+		return nil
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	publisher := &models.Publisher{
+		UID:     p.UID,
+		Pattern: null.NewString(p.Pattern, p.Pattern != ""),
+	}
+	if err := publisher.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range p.I18n {
+		i18n := &models.PublisherI18n{
+			PublisherID:      publisher.ID,
+			Language:         x.Language,
+			OriginalLanguage: null.NewString(x.OriginalLanguage, x.OriginalLanguage != ""),
+			Name:             null.NewString(x.Name, x.Name != ""),
+			Description:      null.NewString(x.Description, x.Description != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	imp.publishers[p.UID] = publisher.ID
+	imp.summary.created(KIND_PUBLISHER)
+	imp.evnts = append(imp.evnts, events.PublisherCreateEvent(publisher))
+	return nil
+}
+
+func (imp *importer) importUnit(u *Unit) error {
+	uid := u.UID
+	existing, err := models.ContentUnits(imp.exec, qm.Where("uid = ?", u.UID)).One()
+	if err == nil {
+		if imp.opts.Collisions == COLLISIONS_REUSE {
+			imp.units[u.UID] = existing
+			imp.summary.reused(KIND_UNIT)
+			return nil
+		}
+		if uid, err = api.GetFreeUID(imp.exec, new(api.ContentUnitUIDChecker)); err != nil {
+			return err
+		}
+		imp.summary.Renamed[u.UID] = uid
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	ct, ok := common.CONTENT_TYPE_REGISTRY.ByName[u.Type]
+	if !ok {
+		return errors.Errorf("Unknown content type %s", u.Type)
+	}
+
+	cu := &models.ContentUnit{
+		UID:        uid,
+		TypeID:     ct.ID,
+		Properties: null.NewJSON(u.Properties, len(u.Properties) > 0),
+		Secure:     u.Secure,
+		Published:  u.Published,
+		CreatedAt:  u.CreatedAt,
+	}
+	if err := cu.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range u.I18n {
+		i18n := &models.ContentUnitI18n{
+			ContentUnitID:    cu.ID,
+			Language:         x.Language,
+			OriginalLanguage: null.NewString(x.OriginalLanguage, x.OriginalLanguage != ""),
+			Name:             null.NewString(x.Name, x.Name != ""),
+			Description:      null.NewString(x.Description, x.Description != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	if len(u.Sources) > 0 {
+		sources := make([]*models.Source, len(u.Sources))
+		for i, x := range u.Sources {
+			sources[i] = &models.Source{ID: imp.sources[x]}
+		}
+		if err := cu.AddSources(imp.exec, false, sources...); err != nil {
+			return errors.Wrap(err, "Add sources")
+		}
+	}
+
+	if len(u.Tags) > 0 {
+		tags := make([]*models.Tag, len(u.Tags))
+		for i, x := range u.Tags {
+			tags[i] = &models.Tag{ID: imp.tags[x]}
+		}
+		if err := cu.AddTags(imp.exec, false, tags...); err != nil {
+			return errors.Wrap(err, "Add tags")
+		}
+	}
+
+	if len(u.Publishers) > 0 {
+		publishers := make([]*models.Publisher, len(u.Publishers))
+		for i, x := range u.Publishers {
+			publishers[i] = &models.Publisher{ID: imp.publishers[x]}
+		}
+		if err := cu.AddPublishers(imp.exec, false, publishers...); err != nil {
+			return errors.Wrap(err, "Add publishers")
+		}
+	}
+
+	for _, x := range u.Persons {
+		role, ok := common.CONTENT_ROLE_TYPE_REGISTRY.ByName[x.Role]
+		if !ok {
+			return errors.Errorf("Unknown content role type %s", x.Role)
+		}
+		cup := &models.ContentUnitsPerson{
+			ContentUnitID: cu.ID,
+			PersonID:      imp.persons[x.UID],
+			RoleID:        role.ID,
+		}
+		if err := cup.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Add person %s", x.UID)
+		}
+	}
+
+	imp.units[u.UID] = cu
+	imp.createdUnits[u.UID] = true
+	imp.summary.created(KIND_UNIT)
+	imp.evnts = append(imp.evnts, events.ContentUnitCreateEvent(cu))
+	return nil
+}
+
+// importDerivations links units to their derivatives.
+// Links between two reused units are left as they are.
+func (imp *importer) importDerivations(u *Unit) error {
+	for _, x := range u.Derivatives {
+		if !imp.createdUnits[u.UID] && !imp.createdUnits[x.UID] {
+			continue
+		}
+
+		cud := &models.ContentUnitDerivation{
+			SourceID:  imp.units[u.UID].ID,
+			DerivedID: imp.units[x.UID].ID,
+			Name:      x.Name,
+		}
+		if err := cud.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Add derivative %s", x.UID)
+		}
+	}
+
+	return nil
+}
+
+func (imp *importer) importFile(f *File) error {
+	var sha1 []byte
+	if f.Sha1 != "" {
+		var err error
+		if sha1, err = hex.DecodeString(f.Sha1); err != nil {
+			return errors.Wrapf(err, "Invalid sha1 %s", f.Sha1)
+		}
+
+		existing, err := models.Files(imp.exec, qm.Where("sha1 = ?", sha1)).One()
+		if err == nil {
+			imp.files[f.UID] = existing.ID
+			imp.summary.reused(KIND_FILE)
+			return nil
+		} else if err != sql.ErrNoRows {
+			return errors.Wrap(err, "Lookup existing")
+		}
+	}
+
+	// a different file with the same UID
+	uid := f.UID
+	exists, err := new(api.FileUIDChecker).Check(imp.exec, uid)
+	if err != nil {
+		return errors.Wrap(err, "Check UID exists")
+	}
+	if exists {
+		if uid, err = api.GetFreeUID(imp.exec, new(api.FileUIDChecker)); err != nil {
+			return err
+		}
+		imp.summary.Renamed[f.UID] = uid
+	}
+
+	file := &models.File{
+		UID:        uid,
+		Name:       f.Name,
+		Size:       f.Size,
+		Type:       f.Type,
+		SubType:    f.SubType,
+		MimeType:   null.NewString(f.MimeType, f.MimeType != ""),
+		Sha1:       null.NewBytes(sha1, sha1 != nil),
+		Language:   null.NewString(f.Language, f.Language != ""),
+		Properties: null.NewJSON(f.Properties, len(f.Properties) > 0),
+		Secure:     f.Secure,
+		Published:  f.Published,
+		CreatedAt:  f.CreatedAt,
+	}
+	if f.FileCreatedAt != nil {
+		file.FileCreatedAt = null.TimeFrom(*f.FileCreatedAt)
+	}
+	if f.Unit != "" {
+		file.ContentUnitID = null.Int64From(imp.units[f.Unit].ID)
+	}
+	if f.Parent != "" {
+		file.ParentID = null.Int64From(imp.files[f.Parent])
+	}
+	if err := file.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	imp.files[f.UID] = file.ID
+	imp.summary.created(KIND_FILE)
+	return nil
+}
+
+// importCollection creates the collection, or adds missing units to an existing one if reused
+func (imp *importer) importCollection(c *Collection) error {
+	uid := c.UID
+	existing, err := models.Collections(imp.exec, qm.Where("uid = ?", c.UID)).One()
+	if err == nil {
+		if imp.opts.Collisions == COLLISIONS_REUSE {
+			imp.summary.Collection = existing.UID
+			imp.summary.reused(KIND_COLLECTION)
+			return imp.addCollectionUnits(existing, c.Units, true)
+		}
+		if uid, err = api.GetFreeUID(imp.exec, new(api.CollectionUIDChecker)); err != nil {
+			return err
+		}
+		imp.summary.Renamed[c.UID] = uid
+	} else if err != sql.ErrNoRows {
+		return errors.Wrap(err, "Lookup existing")
+	}
+
+	ct, ok := common.CONTENT_TYPE_REGISTRY.ByName[c.Type]
+	if !ok {
+		return errors.Errorf("Unknown content type %s", c.Type)
+	}
+
+	collection := &models.Collection{
+		UID:        uid,
+		TypeID:     ct.ID,
+		Properties: null.NewJSON(c.Properties, len(c.Properties) > 0),
+		Secure:     c.Secure,
+		Published:  c.Published,
+		CreatedAt:  c.CreatedAt,
+	}
+	if err := collection.Insert(imp.exec); err != nil {
+		return errors.Wrap(err, "Insert")
+	}
+
+	for _, x := range c.I18n {
+		i18n := &models.CollectionI18n{
+			CollectionID:     collection.ID,
+			Language:         x.Language,
+			OriginalLanguage: null.NewString(x.OriginalLanguage, x.OriginalLanguage != ""),
+			Name:             null.NewString(x.Name, x.Name != ""),
+			Description:      null.NewString(x.Description, x.Description != ""),
+		}
+		if err := i18n.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Insert i18n %s", x.Language)
+		}
+	}
+
+	imp.summary.Collection = collection.UID
+	imp.summary.created(KIND_COLLECTION)
+	imp.evnts = append(imp.evnts, events.CollectionCreateEvent(collection))
+	return imp.addCollectionUnits(collection, c.Units, false)
+}
+
+func (imp *importer) addCollectionUnits(collection *models.Collection, refs []*UnitRef, existing bool) error {
+	added := 0
+	for _, x := range refs {
+		cu := imp.units[x.UID]
+		if existing {
+			linked, err := models.CollectionsContentUnits(imp.exec,
+				qm.Where("collection_id = ? AND content_unit_id = ?", collection.ID, cu.ID)).
+				Exists()
+			if err != nil {
+				return errors.Wrapf(err, "Check unit %s in collection", x.UID)
+			}
+			if linked {
+				continue
+			}
+		}
+
+		ccu := &models.CollectionsContentUnit{
+			CollectionID:  collection.ID,
+			ContentUnitID: cu.ID,
+			Name:          x.Name,
+			Position:      x.Position,
+		}
+		if err := ccu.Insert(imp.exec); err != nil {
+			return errors.Wrapf(err, "Add unit %s", x.UID)
+		}
+		added++
+	}
+
+	if existing && added > 0 {
+		imp.evnts = append(imp.evnts, events.CollectionContentUnitsChangeEvent(collection))
+	}
+	return nil
+}
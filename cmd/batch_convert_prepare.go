@@ -4,6 +4,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/Bnei-Baruch/mdb/batch"
+	"github.com/Bnei-Baruch/mdb/jobs"
 )
 
 var convertPrepareCmd = &cobra.Command{
@@ -17,5 +18,5 @@ func init() {
 }
 
 func convertPrepareFn(cmd *cobra.Command, args []string) {
-	batch.PrepareFilesForConvert()
+	jobs.RunCommand(batch.JOB_PREPARE_FILES_FOR_CONVERT, "")
 }
@@ -1,11 +1,17 @@
 package cmd
 
 import (
+	"encoding/json"
+
 	"github.com/spf13/cobra"
 
 	"github.com/Bnei-Baruch/mdb/batch"
+	"github.com/Bnei-Baruch/mdb/jobs"
+	"github.com/Bnei-Baruch/mdb/utils"
 )
 
+var eventsSubcollectionsIDs []int
+
 var eventsSubcollectionsCmd = &cobra.Command{
 	Use:   "events_subcollections",
 	Short: "Organize events lesson parts in subcollections",
@@ -13,9 +19,17 @@ var eventsSubcollectionsCmd = &cobra.Command{
 }
 
 func init() {
+	eventsSubcollectionsCmd.Flags().IntSliceVar(&eventsSubcollectionsIDs, "collections", nil, "ids of events collections to organize")
 	batchCmd.AddCommand(eventsSubcollectionsCmd)
 }
 
 func eventsSubcollectionsFn(cmd *cobra.Command, args []string) {
-	batch.EventsSubcollections()
+	ids := make([]int64, len(eventsSubcollectionsIDs))
+	for i, id := range eventsSubcollectionsIDs {
+		ids[i] = int64(id)
+	}
+	params, err := json.Marshal(batch.EventsSubcollectionsParams{CollectionIDs: ids})
+	utils.Must(err)
+
+	jobs.RunCommand(batch.JOB_EVENTS_SUBCOLLECTIONS, string(params))
 }
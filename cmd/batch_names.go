@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/batch"
+	"github.com/Bnei-Baruch/mdb/jobs"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+var (
+	renameUnitsContentTypes  []string
+	renameUnitsCollectionIDs []int
+	renameUnitsFormat        string
+	renameUnitsOutput        string
+)
+
+var renameUnitsCmd = &cobra.Command{
+	Use:   "rename_units",
+	Short: "Report recomputed unit names which differ from the current ones (dry run)",
+	Run:   renameUnitsFn,
+}
+
+var applyUnitNamesCmd = &cobra.Command{
+	Use:   "apply_unit_names <report under batch.reports-dir>",
+	Short: "Write the approved rows of a reviewed rename_units report",
+	Run:   applyUnitNamesFn,
+}
+
+func init() {
+	renameUnitsCmd.Flags().StringSliceVar(&renameUnitsContentTypes, "content-types", nil, "rename only units of these content types")
+	renameUnitsCmd.Flags().IntSliceVar(&renameUnitsCollectionIDs, "collections", nil, "rename only units in these collections")
+	renameUnitsCmd.Flags().StringVar(&renameUnitsFormat, "format", batch.NAMES_FORMAT_CSV, "report format: csv or xlsx")
+	renameUnitsCmd.Flags().StringVarP(&renameUnitsOutput, "output", "o", "", "report path under batch.reports-dir (default a new file there)")
+	batchCmd.AddCommand(renameUnitsCmd, applyUnitNamesCmd)
+}
+
+func renameUnitsFn(cmd *cobra.Command, args []string) {
+	ids := make([]int64, len(renameUnitsCollectionIDs))
+	for i, id := range renameUnitsCollectionIDs {
+		ids[i] = int64(id)
+	}
+	params, err := json.Marshal(batch.RenameUnitsParams{
+		ContentTypes:  renameUnitsContentTypes,
+		CollectionIDs: ids,
+		Format:        renameUnitsFormat,
+		Output:        renameUnitsOutput,
+	})
+	utils.Must(err)
+
+	jobs.RunCommand(batch.JOB_RENAME_UNITS, string(params))
+}
+
+func applyUnitNamesFn(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Usage()
+		return
+	}
+
+	params, err := json.Marshal(batch.ApplyUnitNamesParams{File: args[0]})
+	utils.Must(err)
+
+	jobs.RunCommand(batch.JOB_APPLY_UNIT_NAMES, string(params))
+}
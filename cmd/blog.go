@@ -6,6 +6,8 @@ import (
 	"github.com/Bnei-Baruch/mdb/importer/blog"
 )
 
+var blogIngestFormat string
+
 func init() {
 	command := &cobra.Command{
 		Use:   "blog-download",
@@ -42,4 +44,18 @@ func init() {
 		},
 	}
 	RootCmd.AddCommand(command)
+
+	command = &cobra.Command{
+		Use:   "blog-ingest <blog> <source>",
+		Short: "Import blog posts from a WordPress export (WXR) or RSS/Atom feed file or url",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 2 {
+				cmd.Usage()
+				return
+			}
+			blog.IngestFeed(args[0], args[1], blogIngestFormat)
+		},
+	}
+	command.Flags().StringVar(&blogIngestFormat, "format", blog.FORMAT_AUTO, "source format: auto, wxr, rss or atom")
+	RootCmd.AddCommand(command)
 }
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/bundle"
+)
+
+var (
+	bundleCollection string
+	bundleOutput     string
+	bundleApply      bool
+	bundleCollisions string
+)
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Move collections between MDB instances as self contained bundles",
+}
+
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a collection with its units, files and metadata to a bundle file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if bundleCollection == "" || bundleOutput == "" {
+			cmd.Usage()
+			return
+		}
+		bundle.ExportCommand(bundleCollection, bundleOutput)
+	},
+}
+
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Preview (and apply) importing a bundle file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		bundle.ImportCommand(args[0], bundleCollisions, bundleApply)
+	},
+}
+
+func init() {
+	bundleExportCmd.Flags().StringVar(&bundleCollection, "collection", "", "UID of collection to export")
+	bundleExportCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "bundle file")
+	bundleImportCmd.Flags().BoolVar(&bundleApply, "apply", false, "apply changes after preview")
+	bundleImportCmd.Flags().StringVar(&bundleCollisions, "collisions", bundle.COLLISIONS_REUSE,
+		"collection or unit with an existing UID: reuse to link to the existing one, new to create a copy with a fresh UID")
+	bundleCmd.AddCommand(bundleExportCmd, bundleImportCmd)
+	RootCmd.AddCommand(bundleCmd)
+}
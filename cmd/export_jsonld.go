@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/exporter/jsonld"
+)
+
+var exportJSONLDCmd = &cobra.Command{
+	Use:   "jsonld <file>",
+	Short: "Export published content units as schema.org JSON-LD (one document per line)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		jsonld.ExportCommand(args[0])
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportJSONLDCmd)
+}
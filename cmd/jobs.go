@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/jobs"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Run and inspect persistent batch jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs.ListCommand(jobsStatus, jobsType, jobsLimit)
+	},
+}
+
+var (
+	jobsStatus string
+	jobsType   string
+	jobsLimit  int
+	jobsParams string
+	jobsForce  bool
+)
+
+var jobsTypesCmd = &cobra.Command{
+	Use:   "types",
+	Short: "List job types and their params",
+	Run: func(cmd *cobra.Command, args []string) {
+		jobs.TypesCommand()
+	},
+}
+
+var jobsRunCmd = &cobra.Command{
+	Use:   "run <type>",
+	Short: "Create a job and run it in the foreground",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		jobs.RunCommand(args[0], jobsParams)
+	},
+}
+
+var jobsResumeCmd = &cobra.Command{
+	Use:   "resume <id>",
+	Short: "Resume a failed job from its last checkpoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		jobs.ResumeCommand(mustParseJobID(args[0]), jobsForce)
+	},
+}
+
+var jobsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a job and its log",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		jobs.ShowCommand(mustParseJobID(args[0]))
+	},
+}
+
+func init() {
+	jobsCmd.Flags().StringVar(&jobsStatus, "status", "", "list only jobs in this status")
+	jobsCmd.Flags().StringVar(&jobsType, "type", "", "list only jobs of this type")
+	jobsCmd.Flags().IntVar(&jobsLimit, "limit", 20, "max jobs to list")
+	jobsRunCmd.Flags().StringVarP(&jobsParams, "params", "p", "", "job params as json")
+	jobsResumeCmd.Flags().BoolVar(&jobsForce, "force", false, "take over a job left running by a crashed process")
+	jobsCmd.AddCommand(jobsTypesCmd, jobsRunCmd, jobsResumeCmd, jobsShowCmd)
+	RootCmd.AddCommand(jobsCmd)
+}
+
+func mustParseJobID(s string) int64 {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		panic("job id expects int64")
+	}
+	return id
+}
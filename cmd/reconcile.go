@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/reconcile"
+)
+
+var reconcileParams reconcile.Params
+
+var reconcileCmd = &cobra.Command{
+	Use:   "reconcile <adapter> <source>",
+	Short: "Reconcile an external catalog with MDB files",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Usage()
+			return
+		}
+		reconcileParams.Adapter = args[0]
+		reconcileParams.Source = args[1]
+		reconcile.Command(reconcileParams)
+	},
+}
+
+var reconcileAdaptersCmd = &cobra.Command{
+	Use:   "adapters",
+	Short: "List available catalog adapters",
+	Run: func(cmd *cobra.Command, args []string) {
+		reconcile.AdaptersCommand()
+	},
+}
+
+func init() {
+	f := reconcileCmd.Flags()
+	f.StringVar(&reconcileParams.Options.Match, "match", reconcile.MATCH_SHA1, "match key: sha1, name or external_id")
+	f.StringSliceVar(&reconcileParams.Options.Compare, "compare", reconcile.DEFAULT_COMPARE, "fields to compare on match: sha1, name, size")
+	f.StringVar(&reconcileParams.Scope.ExternalIDKey, "external-id-key", "", "files.properties key holding the external id (e.g. kmedia_id)")
+	f.BoolVar(&reconcileParams.Scope.Published, "published", false, "only published MDB files")
+	f.StringSliceVar(&reconcileParams.Scope.ContentTypes, "content-types", nil, "only MDB files of units of these content types")
+	f.BoolVar(&reconcileParams.Adapters.Hash, "hash", false, "compute sha1 of local files (dir adapter)")
+	f.StringVar(&reconcileParams.Format, "format", reconcile.FORMAT_CSV, "report format: csv or xlsx")
+	f.StringVarP(&reconcileParams.Output, "output", "o", "", "report file (default in /tmp)")
+	f.StringVar(&reconcileParams.Plan, "plan", "", "write a JSON fix-up plan to this file")
+	reconcileCmd.AddCommand(reconcileAdaptersCmd)
+	RootCmd.AddCommand(reconcileCmd)
+}
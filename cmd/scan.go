@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/reconcile"
+	"github.com/Bnei-Baruch/mdb/scan"
+)
+
+var scanParams scan.Params
+
+var scanCmd = &cobra.Command{
+	Use:   "scan <dir>",
+	Short: "Match files in a local directory tree to MDB files by sha1",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		scanParams.Root = args[0]
+		scan.Command(scanParams)
+	},
+}
+
+func init() {
+	f := scanCmd.Flags()
+	f.StringVar(&scanParams.Cache, "cache", "", "hash cache file, reused across (interrupted) scans of the same dir (default in the temp dir)")
+	f.IntVar(&scanParams.Workers, "workers", 0, "parallel hashing workers (default number of CPUs)")
+	f.BoolVar(&scanParams.Scope.Published, "published", false, "only compare with published MDB files")
+	f.StringSliceVar(&scanParams.Scope.ContentTypes, "content-types", nil, "only compare with MDB files of units of these content types")
+	f.StringVar(&scanParams.Format, "format", reconcile.FORMAT_CSV, "report format: csv or xlsx")
+	f.StringVarP(&scanParams.Output, "output", "o", "", "report file (default in /tmp)")
+	f.StringVar(&scanParams.Storage, "storage", "", "register found copies against this storage")
+	RootCmd.AddCommand(scanCmd)
+}
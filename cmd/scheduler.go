@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/importer/blog"
+	"github.com/Bnei-Baruch/mdb/importer/twitter"
+	"github.com/Bnei-Baruch/mdb/scheduler"
+	"github.com/Bnei-Baruch/mdb/storage"
+)
+
+var schedulerCmd = &cobra.Command{
+	Use:   "scheduler",
+	Short: "Run periodic tasks according to [[scheduler.tasks]] in config",
+	Run: func(cmd *cobra.Command, args []string) {
+		scheduler.ServeCommand()
+	},
+}
+
+var (
+	schedulerTask   string
+	schedulerStatus string
+	schedulerLimit  int
+)
+
+var schedulerTasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "List tasks available to schedules",
+	Run: func(cmd *cobra.Command, args []string) {
+		scheduler.TasksCommand()
+	},
+}
+
+var schedulerRunCmd = &cobra.Command{
+	Use:   "run <task>",
+	Short: "Run a task now",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Usage()
+			return
+		}
+		scheduler.RunCommand(args[0])
+	},
+}
+
+var schedulerRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List recent task runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		scheduler.RunsCommand(schedulerTask, schedulerStatus, schedulerLimit)
+	},
+}
+
+func init() {
+	scheduler.Register(&scheduler.Task{
+		Name:        "import_storage",
+		Description: "Import storage status (incremental)",
+		Run:         func() error { return storage.RunImport(false) },
+	})
+	scheduler.Register(&scheduler.Task{
+		Name:        "import_storage_full",
+		Description: "Import storage status (full)",
+		Run:         func() error { return storage.RunImport(true) },
+	})
+	scheduler.Register(&scheduler.Task{
+		Name:        "policy_check",
+		Description: "Check storage replication policies and save the compliance report",
+		Run: func() error {
+			_, err := storage.RunPolicyCheck()
+			return err
+		},
+	})
+	scheduler.Register(&scheduler.Task{
+		Name:        "import_twitter",
+		Description: "Import latest tweets for registered accounts",
+		Run:         twitter.LatestTweets,
+	})
+	scheduler.Register(&scheduler.Task{
+		Name:        "import_blogs",
+		Description: "Import latest blog posts",
+		Run:         blog.Latest,
+	})
+	scheduler.Register(&scheduler.Task{
+		Name:        "email_warnings",
+		Description: "Mail yesterday's warnings from the mdb log",
+		Run:         scheduler.EmailWarnings,
+	})
+
+	schedulerRunsCmd.Flags().StringVar(&schedulerTask, "task", "", "list only runs of this task")
+	schedulerRunsCmd.Flags().StringVar(&schedulerStatus, "status", "", "list only runs in this status")
+	schedulerRunsCmd.Flags().IntVar(&schedulerLimit, "limit", 20, "max runs to list")
+	schedulerCmd.AddCommand(schedulerTasksCmd, schedulerRunCmd, schedulerRunsCmd)
+	RootCmd.AddCommand(schedulerCmd)
+}
@@ -92,6 +92,8 @@ func serverFn(cmd *cobra.Command, args []string) {
 		cors.New(corsConfig),
 		utils.RecoveryMiddleware())
 
+	api.InitMediaProber()
+	api.InitSubtitles()
 	api.SetupRoutes(router)
 
 	srv := &http.Server{
@@ -107,12 +109,17 @@ func serverFn(cmd *cobra.Command, args []string) {
 		}
 	}()
 
+	// background check for stale captures
+	stopCapturesChecker := make(chan struct{})
+	go api.RunStaleCapturesChecker(db, emitter, viper.GetDuration("captures.check-interval"), stopCapturesChecker)
+
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
 	quit := make(chan os.Signal)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	log.Infof("Shutdown server ...")
+	close(stopCapturesChecker)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
+)
+
+var (
+	sheetImportApply bool
+	sheetImportForce bool
+	sheetImportUser  string
+	sheetImportName  string
+	sheetImportLimit int
+)
+
+var sheetImportCmd = &cobra.Command{
+	Use:   "sheet-import <importer> <file>",
+	Short: "Preview (and apply) a CSV or XLSX sheet import",
+	Run:   sheetImportFn,
+}
+
+var sheetImportersCmd = &cobra.Command{
+	Use:   "importers",
+	Short: "List available sheet importers",
+	Run: func(cmd *cobra.Command, args []string) {
+		sheet.ImportersCommand()
+	},
+}
+
+var sheetHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List applied sheet imports",
+	Run: func(cmd *cobra.Command, args []string) {
+		sheet.HistoryCommand(sheetImportName, sheetImportLimit)
+	},
+}
+
+func init() {
+	sheetImportCmd.Flags().BoolVar(&sheetImportApply, "apply", false, "apply changes after preview")
+	sheetImportCmd.Flags().BoolVar(&sheetImportForce, "force", false, "apply even if some rows have errors (these rows are skipped)")
+	sheetImportCmd.Flags().StringVar(&sheetImportUser, "user", "", "user to record in the audit trail")
+	sheetHistoryCmd.Flags().StringVar(&sheetImportName, "importer", "", "show only imports of this importer")
+	sheetHistoryCmd.Flags().IntVar(&sheetImportLimit, "limit", 20, "max number of imports to show")
+	sheetImportCmd.AddCommand(sheetImportersCmd, sheetHistoryCmd)
+	RootCmd.AddCommand(sheetImportCmd)
+}
+
+func sheetImportFn(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Usage()
+		return
+	}
+	sheet.ImportCommand(args[0], args[1], sheetImportApply, sheetImportForce, sheetImportUser)
+}
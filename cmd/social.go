@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/Bnei-Baruch/mdb/social"
+)
+
+var (
+	socialImportUsername string
+	socialImportLanguage string
+)
+
+var socialCmd = &cobra.Command{
+	Use:   "social",
+	Short: "Social media posts archive",
+}
+
+var socialImportCmd = &cobra.Command{
+	Use:   "import <twitter|telegram> <path>",
+	Short: "Import a twitter archive directory or a telegram channel export (result.json)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 2 {
+			cmd.Usage()
+			return
+		}
+		social.ImportCommand(args[0], args[1], socialImportUsername, socialImportLanguage)
+	},
+}
+
+var socialAccountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "List social media accounts",
+	Run: func(cmd *cobra.Command, args []string) {
+		social.AccountsCommand()
+	},
+}
+
+func init() {
+	socialImportCmd.Flags().StringVar(&socialImportUsername, "username", "", "account username, required for archives without account details")
+	socialImportCmd.Flags().StringVar(&socialImportLanguage, "language", "", "default language of the account's posts")
+	socialCmd.AddCommand(socialImportCmd, socialAccountsCmd)
+	RootCmd.AddCommand(socialCmd)
+}
@@ -6,13 +6,40 @@ import (
 	"github.com/Bnei-Baruch/mdb/storage"
 )
 
+var storageIncremental bool
+
+var storageCmd = &cobra.Command{
+	Use:   "storage",
+	Short: "Import storage locations status of files in MDB",
+	Run: func(cmd *cobra.Command, args []string) {
+		storage.ImportStorageStatus(!storageIncremental)
+	},
+}
+
+var policyCheckOutput string
+
+var policyCheckCmd = &cobra.Command{
+	Use:   "policy-check",
+	Short: "Report files under or over replicated according to storage policies",
+	Run: func(cmd *cobra.Command, args []string) {
+		storage.PolicyCheck(policyCheckOutput)
+	},
+}
+
+var storageRunsLimit int
+
+var storageRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "List recent storage status import runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		storage.RunsCommand(storageRunsLimit)
+	},
+}
+
 func init() {
-	command := &cobra.Command{
-		Use:   "storage",
-		Short: "Import storage locations status of files in MDB",
-		Run: func(cmd *cobra.Command, args []string) {
-			storage.ImportStorageStatus()
-		},
-	}
-	RootCmd.AddCommand(command)
+	storageCmd.Flags().BoolVar(&storageIncremental, "incremental", false, "import only changes since last successful run instead of a full import")
+	policyCheckCmd.Flags().StringVarP(&policyCheckOutput, "output", "o", "", "write json report to this file instead of stdout")
+	storageRunsCmd.Flags().IntVar(&storageRunsLimit, "limit", 20, "max runs to list")
+	storageCmd.AddCommand(policyCheckCmd, storageRunsCmd)
+	RootCmd.AddCommand(storageCmd)
 }
@@ -133,6 +133,8 @@ var (
 		{Extension: "rtf", Type: "text", SubType: "", MimeType: "text/rtf"},
 		{Extension: "txt", Type: "text", SubType: "", MimeType: "text/plain"},
 		{Extension: "fb2", Type: "text", SubType: "", MimeType: "text/xml"},
+		{Extension: "srt", Type: "text", SubType: "subtitles", MimeType: "application/x-subrip"},
+		{Extension: "vtt", Type: "text", SubType: "subtitles", MimeType: "text/vtt"},
 		{Extension: "rb", Type: "text", SubType: "", MimeType: "application/x-rocketbook"},
 		{Extension: "xls", Type: "sheet", SubType: "", MimeType: "application/vnd.ms-excel"},
 		{Extension: "swf", Type: "banner", SubType: "", MimeType: "application/x-shockwave-flash"},
@@ -196,6 +198,7 @@ func (r *ContentTypeRegistry) Init(exec boil.Executor) error {
 
 type OperationTypeRegistry struct {
 	ByName map[string]*models.OperationType
+	ByID   map[int64]*models.OperationType
 }
 
 func (r *OperationTypeRegistry) Init(exec boil.Executor) error {
@@ -205,8 +208,10 @@ func (r *OperationTypeRegistry) Init(exec boil.Executor) error {
 	}
 
 	r.ByName = make(map[string]*models.OperationType)
+	r.ByID = make(map[int64]*models.OperationType)
 	for _, t := range types {
 		r.ByName[t.Name] = t
+		r.ByID[t.ID] = t
 	}
 
 	return nil
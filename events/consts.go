@@ -16,6 +16,7 @@ const (
 	E_CONTENT_UNIT_TAGS_CHANGE        = "CONTENT_UNIT_TAGS_CHANGE"
 	E_CONTENT_UNIT_PERSONS_CHANGE     = "CONTENT_UNIT_PERSONS_CHANGE"
 	E_CONTENT_UNIT_PUBLISHERS_CHANGE  = "CONTENT_UNIT_PUBLISHERS_CHANGE"
+	E_CONTENT_UNIT_SEGMENTS_CHANGE    = "CONTENT_UNIT_SEGMENTS_CHANGE"
 
 	E_FILE_UPDATE    = "FILE_UPDATE"
 	E_FILE_PUBLISHED = "FILE_PUBLISHED"
@@ -23,6 +24,8 @@ const (
 	E_FILE_REPLACE   = "FILE_REPLACE"
 	E_FILE_REMOVE    = "FILE_REMOVE"
 
+	E_FILE_FIXITY_MISMATCH = "FILE_FIXITY_MISMATCH"
+
 	E_SOURCE_CREATE = "SOURCE_CREATE"
 	E_SOURCE_UPDATE = "SOURCE_UPDATE"
 
@@ -36,6 +39,9 @@ const (
 	E_PUBLISHER_CREATE = "PUBLISHER_CREATE"
 	E_PUBLISHER_UPDATE = "PUBLISHER_UPDATE"
 
+	E_STORAGE_CREATE = "STORAGE_CREATE"
+	E_STORAGE_UPDATE = "STORAGE_UPDATE"
+
 	E_BLOG_POST_CREATE = "BLOG_POST_CREATE"
 	E_BLOG_POST_UPDATE = "BLOG_POST_UPDATE"
 	E_BLOG_POST_DELETE = "BLOG_POST_DELETE"
@@ -43,4 +49,7 @@ const (
 	E_TWEET_CREATE = "TWEET_CREATE"
 	E_TWEET_UPDATE = "TWEET_UPDATE"
 	E_TWEET_DELETE = "TWEET_DELETE"
+
+	E_CAPTURE_STALE              = "CAPTURE_STALE"
+	E_CAPTURE_STOP_WITHOUT_START = "CAPTURE_STOP_WITHOUT_START"
 )
@@ -1,6 +1,9 @@
 package events
 
 import (
+	"encoding/hex"
+	"time"
+
 	"github.com/Bnei-Baruch/mdb/models"
 )
 
@@ -117,6 +120,13 @@ func ContentUnitPublishersChangeEvent(cu *models.ContentUnit) Event {
 	})
 }
 
+func ContentUnitSegmentsChangeEvent(cu *models.ContentUnit) Event {
+	return makeEvent(E_CONTENT_UNIT_SEGMENTS_CHANGE, map[string]interface{}{
+		"id":  cu.ID,
+		"uid": cu.UID,
+	})
+}
+
 func FileUpdateEvent(f *models.File) Event {
 	return makeEvent(E_FILE_UPDATE, map[string]interface{}{
 		"id":  f.ID,
@@ -178,6 +188,16 @@ func FileRemoveEvent(f *models.File) Event {
 	})
 }
 
+func FileFixityMismatchEvent(f *models.File, s *models.Storage, verifiedSha1 string) Event {
+	return makeEvent(E_FILE_FIXITY_MISMATCH, map[string]interface{}{
+		"id":            f.ID,
+		"uid":           f.UID,
+		"sha1":          hex.EncodeToString(f.Sha1.Bytes),
+		"storage":       s.Name,
+		"verified_sha1": verifiedSha1,
+	})
+}
+
 func SourceCreateEvent(s *models.Source) Event {
 	return makeEvent(E_SOURCE_CREATE, map[string]interface{}{
 		"id":  s.ID,
@@ -241,6 +261,22 @@ func PublisherUpdateEvent(p *models.Publisher) Event {
 	})
 }
 
+func StorageCreateEvent(s *models.Storage) Event {
+	return makeEvent(E_STORAGE_CREATE, map[string]interface{}{
+		"id":     s.ID,
+		"name":   s.Name,
+		"status": s.Status,
+	})
+}
+
+func StorageUpdateEvent(s *models.Storage) Event {
+	return makeEvent(E_STORAGE_UPDATE, map[string]interface{}{
+		"id":     s.ID,
+		"name":   s.Name,
+		"status": s.Status,
+	})
+}
+
 func BlogPostCreateEvent(p *models.BlogPost) Event {
 	return makeEvent(E_BLOG_POST_CREATE, map[string]interface{}{
 		"blogId": p.BlogID,
@@ -279,3 +315,21 @@ func TweetDeleteEvent(t *models.TwitterTweet) Event {
 		"tid": t.TwitterID,
 	})
 }
+
+func CaptureStaleEvent(workflowID, captureSource, collectionUID string, startedAt time.Time) Event {
+	return makeEvent(E_CAPTURE_STALE, map[string]interface{}{
+		"workflow_id":    workflowID,
+		"capture_source": captureSource,
+		"collection_uid": collectionUID,
+		"started_at":     startedAt,
+	})
+}
+
+func CaptureStopWithoutStartEvent(op *models.Operation, captureSource, collectionUID string) Event {
+	return makeEvent(E_CAPTURE_STOP_WITHOUT_START, map[string]interface{}{
+		"id":             op.ID,
+		"uid":            op.UID,
+		"capture_source": captureSource,
+		"collection_uid": collectionUID,
+	})
+}
@@ -0,0 +1,85 @@
+package jsonld
+
+import (
+	"bufio"
+	"database/sql"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const PAGE_SIZE = 500
+
+// ExportCommand writes all published public content units to path as JSON lines, one JSON-LD document per unit
+func ExportCommand(path string) {
+	clock := time.Now()
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	defer db.Close()
+	utils.Must(common.InitTypeRegistries(db))
+
+	count, err := Export(db, path, Options{BaseURL: viper.GetString("jsonld.base-url")})
+	utils.Must(err)
+
+	log.Infof("Exported %d units to %s", count, path)
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+func Export(exec boil.Executor, path string, opts Options) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Create %s", path)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	sources := NewSourcesCache(exec)
+	count := 0
+	var lastID int64
+	for {
+		mods := append([]qm.QueryMod{
+			qm.Where("published IS TRUE AND secure = ? AND id > ?", common.SEC_PUBLIC, lastID),
+			qm.OrderBy("id"),
+			qm.Limit(PAGE_SIZE),
+		}, UnitMods()...)
+		units, err := models.ContentUnits(exec, mods...).All()
+		if err != nil {
+			return count, errors.Wrapf(err, "Load units after %d", lastID)
+		}
+		if len(units) == 0 {
+			break
+		}
+
+		for _, cu := range units {
+			u, err := NewUnit(cu, sources)
+			if err != nil {
+				return count, errors.Wrapf(err, "Unit [%d]", cu.ID)
+			}
+			b, err := Marshal(UnitNode(u, opts))
+			if err != nil {
+				return count, errors.Wrapf(err, "Marshal unit [%d]", cu.ID)
+			}
+			if _, err := w.Write(append(b, '\n')); err != nil {
+				return count, errors.Wrap(err, "Write")
+			}
+			count++
+		}
+
+		lastID = units[len(units)-1].ID
+		log.Infof("%d units", count)
+	}
+
+	return count, errors.Wrap(w.Flush(), "Flush")
+}
@@ -0,0 +1,417 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+const (
+	CONTEXT    = "https://schema.org"
+	MIME_TYPE  = "application/ld+json"
+	URN_PREFIX = "urn:mdb"
+)
+
+// schema.org types
+const (
+	TYPE_VIDEO_OBJECT         = "VideoObject"
+	TYPE_AUDIO_OBJECT         = "AudioObject"
+	TYPE_ARTICLE              = "Article"
+	TYPE_CREATIVE_WORK_SERIES = "CreativeWorkSeries"
+	TYPE_EVENT                = "Event"
+	TYPE_PERSON               = "Person"
+	TYPE_BOOK                 = "Book"
+	TYPE_CHAPTER              = "Chapter"
+)
+
+// Units of these content types are texts, others are media by their files
+var ARTICLE_CONTENT_TYPES = map[string]bool{
+	common.CT_ARTICLE:           true,
+	common.CT_PUBLICATION:       true,
+	common.CT_BLOG_POST:         true,
+	common.CT_KITEI_MAKOR:       true,
+	common.CT_RESEARCH_MATERIAL: true,
+	common.CT_LIKUTIM:           true,
+	common.CT_SOURCE:            true,
+	common.CT_BOOK:              true,
+}
+
+// Collections of these content types happened at a time (and place), others are series
+var EVENT_CONTENT_TYPES = map[string]bool{
+	common.CT_DAILY_LESSON:   true,
+	common.CT_SPECIAL_LESSON: true,
+	common.CT_CONGRESS:       true,
+	common.CT_HOLIDAY:        true,
+	common.CT_PICNIC:         true,
+	common.CT_UNITY_DAY:      true,
+}
+
+// Sources of these types are books, others are chapters of their parent
+var BOOK_SOURCE_TYPES = map[string]bool{
+	common.SRC_COLLECTION: true,
+	common.SRC_BOOK:       true,
+	common.SRC_VOLUME:     true,
+}
+
+// Node is a JSON-LD object
+type Node map[string]interface{}
+
+// LangValue is a language tagged string
+type LangValue struct {
+	Value    string `json:"@value"`
+	Language string `json:"@language"`
+}
+
+// Options of the mapping
+type Options struct {
+	// BaseURL for node ids, e.g. https://mdb.example.com/rest.
+	// Nodes are identified by urn:mdb:[kind]:[uid] if empty.
+	BaseURL string
+}
+
+// Unit is a content unit with everything mapped to JSON-LD
+type Unit struct {
+	ContentUnit *models.ContentUnit
+	I18n        []*models.ContentUnitI18n
+	Collections []*Collection
+	Persons     []*Person
+	Sources     []*Source
+	Files       []*models.File
+}
+
+type Collection struct {
+	Collection *models.Collection
+	I18n       []*models.CollectionI18n
+}
+
+type Person struct {
+	Person *models.Person
+	I18n   []*models.PersonI18n
+	Role   string // content role type name, e.g. LECTURER
+}
+
+type Source struct {
+	Source *models.Source
+	I18n   []*models.SourceI18n
+	Parent *Source
+}
+
+func (o Options) id(kind, uid string) string {
+	if o.BaseURL == "" {
+		return fmt.Sprintf("%s:%s:%s", URN_PREFIX, kind, uid)
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimRight(o.BaseURL, "/"), kind, uid)
+}
+
+// UnitNode maps a content unit to a VideoObject, AudioObject or Article
+func UnitNode(u *Unit, opts Options) Node {
+	cu := u.ContentUnit
+	props := unmarshalProps(cu.Properties)
+
+	names := make(map[string]string)
+	descriptions := make(map[string]string)
+	for _, x := range u.I18n {
+		if x.Name.Valid {
+			names[x.Language] = x.Name.String
+		}
+		if x.Description.Valid {
+			descriptions[x.Language] = x.Description.String
+		}
+	}
+
+	node := Node{
+		"@context":   CONTEXT,
+		"@type":      unitType(u),
+		"@id":        opts.id("content_units", cu.UID),
+		"identifier": cu.UID,
+	}
+	if ct, ok := common.CONTENT_TYPE_REGISTRY.ByID[cu.TypeID]; ok {
+		node["genre"] = ct.Name
+	}
+	setLangValues(node, "name", names)
+	setLangValues(node, "description", descriptions)
+
+	if v, ok := props["original_language"].(string); ok && v != "" {
+		node["inLanguage"] = v
+	}
+	if v := date(props["film_date"]); v != "" {
+		node["dateCreated"] = v
+	}
+	if v, ok := props["duration"].(float64); ok && v > 0 {
+		node["duration"] = isoDuration(v)
+	}
+
+	encodings := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range u.Files {
+		if f.MimeType.Valid && !seen[f.MimeType.String] {
+			seen[f.MimeType.String] = true
+			encodings = append(encodings, f.MimeType.String)
+		}
+	}
+	if len(encodings) > 0 {
+		sort.Strings(encodings)
+		node["encodingFormat"] = encodings
+	}
+
+	if len(u.Collections) > 0 {
+		parts := make([]Node, len(u.Collections))
+		for i, c := range u.Collections {
+			parts[i] = CollectionNode(c, opts)
+			delete(parts[i], "@context")
+		}
+		node["isPartOf"] = parts
+	}
+
+	authors := make([]Node, 0)
+	contributors := make([]Node, 0)
+	for _, p := range u.Persons {
+		n := PersonNode(p, opts)
+		delete(n, "@context")
+		if p.Role == common.CR_LECTURER {
+			authors = append(authors, n)
+		} else {
+			contributors = append(contributors, n)
+		}
+	}
+	if len(authors) > 0 {
+		node["author"] = authors
+	}
+	if len(contributors) > 0 {
+		node["contributor"] = contributors
+	}
+
+	if len(u.Sources) > 0 {
+		citations := make([]Node, len(u.Sources))
+		for i, s := range u.Sources {
+			citations[i] = SourceNode(s, opts)
+			delete(citations[i], "@context")
+		}
+		node["citation"] = citations
+	}
+
+	return node
+}
+
+// CollectionNode maps a collection to an Event or a CreativeWorkSeries
+func CollectionNode(c *Collection, opts Options) Node {
+	props := unmarshalProps(c.Collection.Properties)
+
+	typ := TYPE_CREATIVE_WORK_SERIES
+	ctName := ""
+	if ct, ok := common.CONTENT_TYPE_REGISTRY.ByID[c.Collection.TypeID]; ok {
+		ctName = ct.Name
+		if EVENT_CONTENT_TYPES[ct.Name] {
+			typ = TYPE_EVENT
+		}
+	}
+
+	node := Node{
+		"@context":   CONTEXT,
+		"@type":      typ,
+		"@id":        opts.id("collections", c.Collection.UID),
+		"identifier": c.Collection.UID,
+	}
+	if ctName != "" {
+		node["genre"] = ctName
+	}
+
+	names := make(map[string]string)
+	descriptions := make(map[string]string)
+	for _, x := range c.I18n {
+		if x.Name.Valid {
+			names[x.Language] = x.Name.String
+		}
+		if x.Description.Valid {
+			descriptions[x.Language] = x.Description.String
+		}
+	}
+	setLangValues(node, "name", names)
+	setLangValues(node, "description", descriptions)
+
+	start := date(props["start_date"])
+	if start == "" {
+		start = date(props["film_date"])
+	}
+	if start != "" {
+		node["startDate"] = start
+	}
+	if v := date(props["end_date"]); v != "" {
+		node["endDate"] = v
+	}
+
+	if typ == TYPE_EVENT {
+		address := make(Node)
+		if v, ok := props["city"].(string); ok && v != "" {
+			address["addressLocality"] = v
+		}
+		if v, ok := props["country"].(string); ok && v != "" {
+			address["addressCountry"] = v
+		}
+		if v, ok := props["full_address"].(string); ok && v != "" {
+			address["streetAddress"] = v
+		}
+		if len(address) > 0 {
+			address["@type"] = "PostalAddress"
+			node["location"] = Node{"@type": "Place", "address": address}
+		}
+	}
+
+	return node
+}
+
+// PersonNode maps a person to a Person
+func PersonNode(p *Person, opts Options) Node {
+	node := Node{
+		"@context":   CONTEXT,
+		"@type":      TYPE_PERSON,
+		"@id":        opts.id("persons", p.Person.UID),
+		"identifier": p.Person.UID,
+	}
+
+	names := make(map[string]string)
+	descriptions := make(map[string]string)
+	for _, x := range p.I18n {
+		if x.Name.Valid {
+			names[x.Language] = x.Name.String
+		}
+		if x.Description.Valid {
+			descriptions[x.Language] = x.Description.String
+		}
+	}
+	setLangValues(node, "name", names)
+	setLangValues(node, "description", descriptions)
+
+	return node
+}
+
+// SourceNode maps a source to a Book or a Chapter of its parent
+func SourceNode(s *Source, opts Options) Node {
+	typ := TYPE_CHAPTER
+	if st, ok := common.SOURCE_TYPE_REGISTRY.ByID[s.Source.TypeID]; ok && BOOK_SOURCE_TYPES[st.Name] {
+		typ = TYPE_BOOK
+	}
+
+	node := Node{
+		"@context":   CONTEXT,
+		"@type":      typ,
+		"@id":        opts.id("sources", s.Source.UID),
+		"identifier": s.Source.UID,
+	}
+
+	names := map[string]string{}
+	descriptions := map[string]string{}
+	for _, x := range s.I18n {
+		if x.Name.Valid {
+			names[x.Language] = x.Name.String
+		}
+		if x.Description.Valid {
+			descriptions[x.Language] = x.Description.String
+		}
+	}
+	if len(names) == 0 {
+		node["name"] = s.Source.Name
+	} else {
+		setLangValues(node, "name", names)
+	}
+	setLangValues(node, "description", descriptions)
+
+	if s.Source.Position.Valid {
+		node["position"] = s.Source.Position.Int
+	}
+	if s.Parent != nil {
+		parent := SourceNode(s.Parent, opts)
+		delete(parent, "@context")
+		node["isPartOf"] = parent
+	}
+
+	return node
+}
+
+func unitType(u *Unit) string {
+	if ct, ok := common.CONTENT_TYPE_REGISTRY.ByID[u.ContentUnit.TypeID]; ok && ARTICLE_CONTENT_TYPES[ct.Name] {
+		return TYPE_ARTICLE
+	}
+
+	hasAudio := false
+	for _, f := range u.Files {
+		switch f.Type {
+		case "video":
+			return TYPE_VIDEO_OBJECT
+		case "audio":
+			hasAudio = true
+		}
+	}
+	if hasAudio {
+		return TYPE_AUDIO_OBJECT
+	}
+
+	if ct, ok := common.CONTENT_TYPE_REGISTRY.ByID[u.ContentUnit.TypeID]; ok && ct.Name == common.CT_SONG {
+		return TYPE_AUDIO_OBJECT
+	}
+	return TYPE_VIDEO_OBJECT
+}
+
+// setLangValues sets a language tagged value, or a list of them sorted by language, if any
+func setLangValues(node Node, key string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	langs := make([]string, 0, len(values))
+	for k := range values {
+		langs = append(langs, k)
+	}
+	sort.Strings(langs)
+
+	lvs := make([]LangValue, len(langs))
+	for i, l := range langs {
+		lvs[i] = LangValue{Value: values[l], Language: l}
+	}
+	if len(lvs) == 1 {
+		node[key] = lvs[0]
+	} else {
+		node[key] = lvs
+	}
+}
+
+func unmarshalProps(p null.JSON) map[string]interface{} {
+	props := make(map[string]interface{})
+	if p.Valid {
+		p.Unmarshal(&props)
+	}
+	return props
+}
+
+// date returns YYYY-MM-DD of a date or timestamp property, empty if invalid
+func date(v interface{}) string {
+	s, ok := v.(string)
+	if !ok || len(s) < 10 {
+		return ""
+	}
+	if _, err := time.Parse("2006-01-02", s[:10]); err != nil {
+		return ""
+	}
+	return s[:10]
+}
+
+// isoDuration formats seconds as an ISO 8601 duration
+func isoDuration(seconds float64) string {
+	d := time.Duration(seconds) * time.Second
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	return fmt.Sprintf("PT%dH%dM%dS", h, m, s)
+}
+
+// Marshal encodes a node
+func Marshal(node Node) ([]byte, error) {
+	return json.Marshal(node)
+}
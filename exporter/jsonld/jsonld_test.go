@@ -0,0 +1,143 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+func initRegistries() {
+	common.CONTENT_TYPE_REGISTRY.ByID = map[int64]*models.ContentType{
+		1: {ID: 1, Name: common.CT_LESSON_PART},
+		2: {ID: 2, Name: common.CT_ARTICLE},
+		3: {ID: 3, Name: common.CT_CONGRESS},
+		4: {ID: 4, Name: common.CT_VIDEO_PROGRAM},
+		5: {ID: 5, Name: common.CT_SONG},
+	}
+	common.SOURCE_TYPE_REGISTRY.ByID = map[int64]*models.SourceType{
+		1: {ID: 1, Name: common.SRC_BOOK},
+		2: {ID: 2, Name: common.SRC_CHAPTER},
+	}
+}
+
+func TestUnitNode(t *testing.T) {
+	initRegistries()
+
+	book := &Source{
+		Source: &models.Source{UID: "bbbbbbbb", TypeID: 1, Name: "Shamati"},
+		I18n: []*models.SourceI18n{
+			{Language: common.LANG_HEBREW, Name: null.StringFrom("שמעתי")},
+			{Language: common.LANG_ENGLISH, Name: null.StringFrom("Shamati")},
+		},
+	}
+	chapter := &Source{
+		Source: &models.Source{UID: "cccccccc", TypeID: 2, Name: "1", Position: null.IntFrom(1)},
+		Parent: book,
+	}
+
+	u := &Unit{
+		ContentUnit: &models.ContentUnit{
+			UID:        "uuuuuuuu",
+			TypeID:     1,
+			Properties: null.JSONFrom([]byte(`{"duration": 3725, "film_date": "2018-10-18", "original_language": "he"}`)),
+		},
+		I18n: []*models.ContentUnitI18n{
+			{Language: common.LANG_HEBREW, Name: null.StringFrom("שיעור")},
+			{Language: common.LANG_ENGLISH, Name: null.StringFrom("Lesson"), Description: null.StringFrom("Morning lesson")},
+		},
+		Collections: []*Collection{{
+			Collection: &models.Collection{
+				UID:        "kkkkkkkk",
+				TypeID:     3,
+				Properties: null.JSONFrom([]byte(`{"start_date": "2018-10-18T00:00:00Z", "end_date": "2018-10-20T00:00:00Z", "city": "Tel Aviv", "country": "Israel"}`)),
+			},
+			I18n: []*models.CollectionI18n{{Language: common.LANG_ENGLISH, Name: null.StringFrom("Congress")}},
+		}},
+		Persons: []*Person{
+			{
+				Person: &models.Person{UID: "pppppppp"},
+				I18n:   []*models.PersonI18n{{Language: common.LANG_ENGLISH, Name: null.StringFrom("Michael Laitman")}},
+				Role:   common.CR_LECTURER,
+			},
+		},
+		Sources: []*Source{chapter},
+		Files: []*models.File{
+			{Type: "audio", MimeType: null.StringFrom("audio/mpeg")},
+			{Type: "video", MimeType: null.StringFrom("video/mp4")},
+		},
+	}
+
+	node := UnitNode(u, Options{})
+	assert.Equal(t, CONTEXT, node["@context"])
+	assert.Equal(t, TYPE_VIDEO_OBJECT, node["@type"])
+	assert.Equal(t, "urn:mdb:content_units:uuuuuuuu", node["@id"])
+	assert.Equal(t, common.CT_LESSON_PART, node["genre"])
+	assert.Equal(t, []LangValue{{Value: "Lesson", Language: "en"}, {Value: "שיעור", Language: "he"}}, node["name"])
+	assert.Equal(t, LangValue{Value: "Morning lesson", Language: "en"}, node["description"])
+	assert.Equal(t, "he", node["inLanguage"])
+	assert.Equal(t, "2018-10-18", node["dateCreated"])
+	assert.Equal(t, "PT1H2M5S", node["duration"])
+	assert.Equal(t, []string{"audio/mpeg", "video/mp4"}, node["encodingFormat"])
+
+	parts := node["isPartOf"].([]Node)
+	if assert.Len(t, parts, 1) {
+		assert.Equal(t, TYPE_EVENT, parts[0]["@type"])
+		assert.Equal(t, "2018-10-18", parts[0]["startDate"])
+		assert.Equal(t, "2018-10-20", parts[0]["endDate"])
+		assert.NotNil(t, parts[0]["location"])
+		assert.NotContains(t, parts[0], "@context")
+	}
+
+	authors := node["author"].([]Node)
+	if assert.Len(t, authors, 1) {
+		assert.Equal(t, TYPE_PERSON, authors[0]["@type"])
+		assert.Equal(t, LangValue{Value: "Michael Laitman", Language: "en"}, authors[0]["name"])
+	}
+	assert.NotContains(t, node, "contributor")
+
+	citations := node["citation"].([]Node)
+	if assert.Len(t, citations, 1) {
+		assert.Equal(t, TYPE_CHAPTER, citations[0]["@type"])
+		assert.Equal(t, "1", citations[0]["name"])
+		assert.Equal(t, 1, citations[0]["position"])
+		parent := citations[0]["isPartOf"].(Node)
+		assert.Equal(t, TYPE_BOOK, parent["@type"])
+		assert.Len(t, parent["name"], 2)
+	}
+
+	// valid json
+	b, err := Marshal(node)
+	assert.Nil(t, err)
+	var x map[string]interface{}
+	assert.Nil(t, json.Unmarshal(b, &x))
+}
+
+func TestUnitType(t *testing.T) {
+	initRegistries()
+
+	node := UnitNode(&Unit{ContentUnit: &models.ContentUnit{UID: "a", TypeID: 2}}, Options{BaseURL: "https://mdb.example.com/rest/"})
+	assert.Equal(t, TYPE_ARTICLE, node["@type"])
+	assert.Equal(t, "https://mdb.example.com/rest/content_units/a", node["@id"])
+
+	node = UnitNode(&Unit{
+		ContentUnit: &models.ContentUnit{UID: "a", TypeID: 1},
+		Files:       []*models.File{{Type: "audio"}, {Type: "text"}},
+	}, Options{})
+	assert.Equal(t, TYPE_AUDIO_OBJECT, node["@type"])
+
+	node = UnitNode(&Unit{ContentUnit: &models.ContentUnit{UID: "a", TypeID: 5}}, Options{})
+	assert.Equal(t, TYPE_AUDIO_OBJECT, node["@type"])
+
+	node = UnitNode(&Unit{ContentUnit: &models.ContentUnit{UID: "a", TypeID: 1}}, Options{})
+	assert.Equal(t, TYPE_VIDEO_OBJECT, node["@type"])
+	assert.NotContains(t, node, "name")
+
+	node = CollectionNode(&Collection{Collection: &models.Collection{UID: "c", TypeID: 4}}, Options{})
+	assert.Equal(t, TYPE_CREATIVE_WORK_SERIES, node["@type"])
+	assert.NotContains(t, node, "location")
+}
@@ -0,0 +1,132 @@
+package jsonld
+
+import (
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+// UNIT_RELATIONS are eager loaded for mapping units
+var UNIT_RELATIONS = []string{
+	"ContentUnitI18ns",
+	"CollectionsContentUnits",
+	"CollectionsContentUnits.Collection",
+	"CollectionsContentUnits.Collection.CollectionI18ns",
+	"ContentUnitsPersons",
+	"ContentUnitsPersons.Person",
+	"ContentUnitsPersons.Person.PersonI18ns",
+	"Sources",
+	"Sources.SourceI18ns",
+	"Files",
+}
+
+// UnitMods eager loads everything needed by NewUnit
+func UnitMods() []qm.QueryMod {
+	mods := make([]qm.QueryMod, len(UNIT_RELATIONS))
+	for i, r := range UNIT_RELATIONS {
+		mods[i] = qm.Load(r)
+	}
+	return mods
+}
+
+// SourcesCache resolves sources with their i18n and ancestors, loading each source once
+type SourcesCache struct {
+	exec    boil.Executor
+	sources map[int64]*Source
+}
+
+func NewSourcesCache(exec boil.Executor) *SourcesCache {
+	return &SourcesCache{exec: exec, sources: make(map[int64]*Source)}
+}
+
+func (c *SourcesCache) Get(s *models.Source) (*Source, error) {
+	if x, ok := c.sources[s.ID]; ok {
+		return x, nil
+	}
+
+	x := &Source{Source: s}
+	if s.R != nil && s.R.SourceI18ns != nil {
+		x.I18n = s.R.SourceI18ns
+	} else {
+		i18ns, err := models.SourceI18ns(c.exec, qm.Where("source_id = ?", s.ID)).All()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Load source i18n [%d]", s.ID)
+		}
+		x.I18n = i18ns
+	}
+
+	if s.ParentID.Valid {
+		parent, err := models.FindSource(c.exec, s.ParentID.Int64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Load parent source [%d]", s.ParentID.Int64)
+		}
+		x.Parent, err = c.Get(parent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.sources[s.ID] = x
+	return x, nil
+}
+
+// NewUnit builds a Unit of a content unit loaded with UnitMods.
+// Only published, not secure and not removed related entities are included.
+func NewUnit(cu *models.ContentUnit, sources *SourcesCache) (*Unit, error) {
+	u := &Unit{ContentUnit: cu}
+	if cu.R == nil {
+		return u, nil
+	}
+
+	u.I18n = cu.R.ContentUnitI18ns
+
+	for _, ccu := range cu.R.CollectionsContentUnits {
+		if ccu.R == nil {
+			continue
+		}
+		c := ccu.R.Collection
+		if c == nil || !c.Published || c.Secure != common.SEC_PUBLIC {
+			continue
+		}
+		x := &Collection{Collection: c}
+		if c.R != nil {
+			x.I18n = c.R.CollectionI18ns
+		}
+		u.Collections = append(u.Collections, x)
+	}
+
+	roles := make(map[int64]string, len(common.CONTENT_ROLE_TYPE_REGISTRY.ByName))
+	for k, v := range common.CONTENT_ROLE_TYPE_REGISTRY.ByName {
+		roles[v.ID] = k
+	}
+	for _, cup := range cu.R.ContentUnitsPersons {
+		if cup.R == nil || cup.R.Person == nil {
+			continue
+		}
+		p := cup.R.Person
+		x := &Person{Person: p, Role: roles[cup.RoleID]}
+		if p.R != nil {
+			x.I18n = p.R.PersonI18ns
+		}
+		u.Persons = append(u.Persons, x)
+	}
+
+	for _, s := range cu.R.Sources {
+		x, err := sources.Get(s)
+		if err != nil {
+			return nil, err
+		}
+		u.Sources = append(u.Sources, x)
+	}
+
+	for _, f := range cu.R.Files {
+		if f.Published && f.Secure == common.SEC_PUBLIC && !f.RemovedAt.Valid {
+			u.Files = append(u.Files, f)
+		}
+	}
+
+	return u, nil
+}
@@ -0,0 +1,346 @@
+package blog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robbiet480/go-wordpress"
+
+	"github.com/Bnei-Baruch/mdb/version"
+)
+
+// Offline sources formats
+const (
+	FORMAT_AUTO = "auto"
+	FORMAT_WXR  = "wxr"  // WordPress eXtended RSS export (Tools > Export)
+	FORMAT_RSS  = "rss"  // RSS 2.0 feed
+	FORMAT_ATOM = "atom" // Atom 1.0 feed
+)
+
+var BLOCK_TAG_RE = regexp.MustCompile(`(?i)^<(p|div|h[1-6]|ul|ol|li|blockquote|table|pre|figure|hr|iframe|script|!--)[\s>/]`)
+
+// Feed is the posts of an offline source translated to the wordpress REST API model.
+// Posts are identified by their wordpress id, taken from the source (wxr, wordpress feeds)
+// or from the post link (?p=123, /some/path/123.html). Items without an id are skipped.
+type Feed struct {
+	Format  string
+	Link    string // site url
+	Posts   []*wordpress.Post
+	Skipped []string // links of items without a post id
+}
+
+type wxrItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	PubDate     string `xml:"pubDate"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"encoded"` // content:encoded
+	PostID      string `xml:"post_id"` // wp:post_id
+	PostIDFeed  string `xml:"post-id"` // wordpress feed additions
+	PostDateGMT string `xml:"post_date_gmt"`
+	PostType    string `xml:"post_type"`
+	Status      string `xml:"status"`
+}
+
+type rssDoc struct {
+	XMLName xml.Name `xml:"rss"`
+	Channel struct {
+		Link  string    `xml:"link"`
+		Items []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   string     `xml:"content"`
+	Summary   string     `xml:"summary"`
+}
+
+type atomDoc struct {
+	XMLName xml.Name    `xml:"feed"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// OpenSource reads an offline source from a local file or an http(s) url
+func OpenSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		b, err := ioutil.ReadFile(source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Read %s", source)
+		}
+		return b, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("BB Archive (MDB %s)", version.Version))
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %s", source)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s: bad status %d", source, resp.StatusCode)
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read %s", source)
+	}
+	return b, nil
+}
+
+// DetectFormat tells a wxr export, an rss feed and an atom feed apart by their root element
+func DetectFormat(b []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return "", errors.New("Empty document")
+			}
+			return "", errors.Wrap(err, "Read root element")
+		}
+
+		if se, ok := t.(xml.StartElement); ok {
+			switch se.Name.Local {
+			case "rss":
+				if bytes.Contains(b, []byte("<wp:wxr_version>")) {
+					return FORMAT_WXR, nil
+				}
+				return FORMAT_RSS, nil
+			case "feed":
+				return FORMAT_ATOM, nil
+			default:
+				return "", errors.Errorf("Unknown root element %s", se.Name.Local)
+			}
+		}
+	}
+}
+
+// ParseFeed parses a wxr export, an rss feed or an atom feed
+func ParseFeed(b []byte, format string) (*Feed, error) {
+	if format == "" || format == FORMAT_AUTO {
+		var err error
+		format, err = DetectFormat(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case FORMAT_WXR, FORMAT_RSS:
+		return parseRSS(b, format)
+	case FORMAT_ATOM:
+		return parseAtom(b)
+	default:
+		return nil, errors.Errorf("Unknown format %s", format)
+	}
+}
+
+func parseRSS(b []byte, format string) (*Feed, error) {
+	var doc rssDoc
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrapf(err, "xml.Unmarshal %s", format)
+	}
+
+	feed := &Feed{
+		Format: format,
+		Link:   strings.TrimSpace(doc.Channel.Link),
+		Posts:  make([]*wordpress.Post, 0, len(doc.Channel.Items)),
+	}
+
+	for _, item := range doc.Channel.Items {
+		// wxr exports have pages, attachments, menus, drafts...
+		if format == FORMAT_WXR &&
+			(item.PostType != "post" || item.Status != "publish") {
+			continue
+		}
+
+		link := strings.TrimSpace(item.Link)
+		id := postID(item.PostID, item.PostIDFeed, item.GUID, link)
+		if id == 0 {
+			feed.Skipped = append(feed.Skipped, link)
+			continue
+		}
+
+		content := item.Encoded
+		if content == "" {
+			content = item.Description
+		}
+		if format == FORMAT_WXR {
+			content = autop(content)
+		}
+
+		postedAt, err := parseTime(item.PostDateGMT, item.PubDate)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Post %d date", id)
+		}
+
+		feed.Posts = append(feed.Posts, &wordpress.Post{
+			ID:      id,
+			Link:    link,
+			Title:   wordpress.RenderedString{Rendered: strings.TrimSpace(item.Title)},
+			Content: wordpress.RenderedString{Rendered: content},
+			DateGMT: wordpress.Time{Time: postedAt},
+		})
+	}
+
+	return feed, nil
+}
+
+func parseAtom(b []byte) (*Feed, error) {
+	var doc atomDoc
+	if err := xml.Unmarshal(b, &doc); err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal atom")
+	}
+
+	feed := &Feed{
+		Format: FORMAT_ATOM,
+		Link:   alternateLink(doc.Links),
+		Posts:  make([]*wordpress.Post, 0, len(doc.Entries)),
+	}
+
+	for _, entry := range doc.Entries {
+		link := alternateLink(entry.Links)
+		id := postID(entry.ID, link)
+		if id == 0 {
+			feed.Skipped = append(feed.Skipped, link)
+			continue
+		}
+
+		content := entry.Content
+		if content == "" {
+			content = entry.Summary
+		}
+
+		postedAt, err := parseTime(entry.Published, entry.Updated)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Post %d date", id)
+		}
+
+		feed.Posts = append(feed.Posts, &wordpress.Post{
+			ID:      id,
+			Link:    link,
+			Title:   wordpress.RenderedString{Rendered: strings.TrimSpace(entry.Title)},
+			Content: wordpress.RenderedString{Rendered: content},
+			DateGMT: wordpress.Time{Time: postedAt},
+		})
+	}
+
+	return feed, nil
+}
+
+func alternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+// postID returns the first wordpress post id found in the candidates,
+// either a number or a url with one (?p=123, /some/path/123.html)
+func postID(candidates ...string) int {
+	for _, c := range candidates {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+
+		if id, err := strconv.Atoi(c); err == nil && id > 0 {
+			return id
+		}
+
+		pUrl, err := url.Parse(c)
+		if err != nil {
+			continue
+		}
+		if id, err := strconv.Atoi(pUrl.Query().Get("p")); err == nil && id > 0 {
+			return id
+		}
+		if m := POST_ID_HTML_RE.FindStringSubmatch(pUrl.Path); len(m) > 0 {
+			if id, err := strconv.Atoi(m[len(m)-1]); err == nil && id > 0 {
+				return id
+			}
+		}
+	}
+
+	return 0
+}
+
+// parseTime returns the first valid timestamp in any of the formats found in wxr and feeds
+func parseTime(values ...string) (time.Time, error) {
+	layouts := []string{
+		"2006-01-02 15:04:05", // wp:post_date_gmt
+		time.RFC1123Z,
+		time.RFC1123,
+		time.RFC3339,
+	}
+
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || strings.HasPrefix(v, "0000-00-00") {
+			continue
+		}
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t.UTC(), nil
+			}
+		}
+	}
+
+	return time.Time{}, errors.Errorf("No valid timestamp in %v", values)
+}
+
+// autop wraps double line break separated blocks in paragraphs, like wordpress does on render.
+// Export files have the raw post content, not the rendered one we get from the API and feeds.
+func autop(content string) string {
+	content = strings.Replace(content, "\r\n", "\n", -1)
+	if strings.TrimSpace(content) == "" {
+		return content
+	}
+
+	var sb strings.Builder
+	for _, block := range strings.Split(content, "\n\n") {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		if BLOCK_TAG_RE.MatchString(block) {
+			sb.WriteString(block)
+		} else {
+			sb.WriteString("<p>")
+			sb.WriteString(strings.Replace(block, "\n", "<br />\n", -1))
+			sb.WriteString("</p>")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
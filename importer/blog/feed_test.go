@@ -0,0 +1,148 @@
+package blog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const wxrFixture = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>Blog</title>
+	<link>https://www.laitman.com</link>
+	<wp:wxr_version>1.2</wp:wxr_version>
+	<item>
+		<title>First post</title>
+		<link>https://www.laitman.com/2019/01/first-post/</link>
+		<pubDate>Tue, 01 Jan 2019 10:00:00 +0000</pubDate>
+		<content:encoded><![CDATA[Line one
+line two
+
+<h2>Header</h2>
+
+Last <a href="https://www.laitman.com/?p=2">paragraph</a>]]></content:encoded>
+		<wp:post_id>101</wp:post_id>
+		<wp:post_date_gmt>2019-01-01 10:00:00</wp:post_date_gmt>
+		<wp:status>publish</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>Draft</title>
+		<wp:post_id>102</wp:post_id>
+		<wp:post_date_gmt>0000-00-00 00:00:00</wp:post_date_gmt>
+		<wp:status>draft</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<wp:post_id>103</wp:post_id>
+		<wp:status>publish</wp:status>
+		<wp:post_type>page</wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+const rssFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+	<link>https://www.laitman.ru</link>
+	<item>
+		<title>Post &amp; more</title>
+		<link>https://www.laitman.ru/kabbalah-religion/144454.html</link>
+		<pubDate>Wed, 02 Jan 2019 08:30:00 +0200</pubDate>
+		<description>summary</description>
+		<content:encoded><![CDATA[<p>full</p>]]></content:encoded>
+	</item>
+	<item>
+		<title>By guid</title>
+		<link>https://www.laitman.ru/some-post/</link>
+		<guid isPermaLink="false">https://www.laitman.ru/?p=144455</guid>
+		<pubDate>Thu, 03 Jan 2019 08:30:00 +0000</pubDate>
+		<description>only summary</description>
+	</item>
+	<item>
+		<title>No id</title>
+		<link>https://www.laitman.ru/no-id/</link>
+		<pubDate>Thu, 03 Jan 2019 08:30:00 +0000</pubDate>
+	</item>
+</channel>
+</rss>`
+
+const atomFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<link rel="self" href="https://www.laitman.es/feed/atom/"/>
+	<link rel="alternate" href="https://www.laitman.es"/>
+	<entry>
+		<id>https://www.laitman.es/?p=77</id>
+		<title type="html">Entrada</title>
+		<link rel="alternate" href="https://www.laitman.es/2019/01/entrada/"/>
+		<published>2019-01-04T12:00:00Z</published>
+		<updated>2019-01-05T12:00:00Z</updated>
+		<content type="html">&lt;p&gt;contenido&lt;/p&gt;</content>
+	</entry>
+</feed>`
+
+func TestParseFeedWXR(t *testing.T) {
+	feed, err := ParseFeed([]byte(wxrFixture), FORMAT_AUTO)
+	assert.Nil(t, err)
+	assert.Equal(t, FORMAT_WXR, feed.Format)
+	assert.Equal(t, "https://www.laitman.com", feed.Link)
+	if assert.Len(t, feed.Posts, 1, "drafts and pages are skipped") {
+		post := feed.Posts[0]
+		assert.Equal(t, 101, post.ID)
+		assert.Equal(t, "First post", post.Title.Rendered)
+		assert.Equal(t, time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC), post.DateGMT.Time)
+		assert.Equal(t, "<p>Line one<br />\nline two</p>\n<h2>Header</h2>\n"+
+			"<p>Last <a href=\"https://www.laitman.com/?p=2\">paragraph</a></p>\n", post.Content.Rendered)
+	}
+}
+
+func TestParseFeedRSS(t *testing.T) {
+	feed, err := ParseFeed([]byte(rssFixture), FORMAT_AUTO)
+	assert.Nil(t, err)
+	assert.Equal(t, FORMAT_RSS, feed.Format)
+	assert.Equal(t, []string{"https://www.laitman.ru/no-id/"}, feed.Skipped)
+	if assert.Len(t, feed.Posts, 2) {
+		assert.Equal(t, 144454, feed.Posts[0].ID)
+		assert.Equal(t, "Post & more", feed.Posts[0].Title.Rendered)
+		assert.Equal(t, "<p>full</p>", feed.Posts[0].Content.Rendered)
+		assert.Equal(t, time.Date(2019, 1, 2, 6, 30, 0, 0, time.UTC), feed.Posts[0].DateGMT.Time)
+
+		assert.Equal(t, 144455, feed.Posts[1].ID)
+		assert.Equal(t, "only summary", feed.Posts[1].Content.Rendered)
+	}
+}
+
+func TestParseFeedAtom(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write([]byte(atomFixture))
+	}))
+	defer srv.Close()
+
+	b, err := OpenSource(srv.URL + "/feed/atom/")
+	assert.Nil(t, err)
+
+	feed, err := ParseFeed(b, FORMAT_AUTO)
+	assert.Nil(t, err)
+	assert.Equal(t, FORMAT_ATOM, feed.Format)
+	assert.Equal(t, "https://www.laitman.es", feed.Link)
+	if assert.Len(t, feed.Posts, 1) {
+		post := feed.Posts[0]
+		assert.Equal(t, 77, post.ID)
+		assert.Equal(t, "https://www.laitman.es/2019/01/entrada/", post.Link)
+		assert.Equal(t, "<p>contenido</p>", post.Content.Rendered)
+		assert.Equal(t, time.Date(2019, 1, 4, 12, 0, 0, 0, time.UTC), post.DateGMT.Time)
+	}
+}
+
+func TestParseFeedUnknown(t *testing.T) {
+	_, err := ParseFeed([]byte(`<html></html>`), FORMAT_AUTO)
+	assert.Error(t, err)
+}
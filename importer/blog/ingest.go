@@ -0,0 +1,107 @@
+package blog
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/robbiet480/go-wordpress"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// IngestFeed imports posts of a WXR export or an RSS / Atom feed into a blog.
+// Source is a local file or an http(s) url. A missing blog is created with the site url of the source.
+func IngestFeed(blogName, source, format string) {
+	clock := time.Now()
+
+	utils.Must(Ingest(blogName, source, format))
+
+	log.Info("Success")
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// Ingest does the work of IngestFeed
+func Ingest(blogName, source, format string) error {
+	_, emitter := Init()
+	defer Shutdown()
+
+	feed, err := loadFeed(source, format)
+	if err != nil {
+		return err
+	}
+
+	b, err := ensureBlog(blogName, feed.Link)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Ingesting %d posts from %s [%s] into %s", len(feed.Posts), source, feed.Format, b.Name)
+	newPosts, skipCount := insertNewPosts(b, feed.Posts, emitter)
+	log.Infof("%d new posts, %d existing", len(newPosts), skipCount)
+
+	return relinkPosts(b, newPosts)
+}
+
+func importLastFromFeed(b *models.Blog, feedUrl string, after time.Time, emitter *events.BufferedEmitter) error {
+	feed, err := loadFeed(feedUrl, FORMAT_AUTO)
+	if err != nil {
+		return err
+	}
+
+	posts := make([]*wordpress.Post, 0, len(feed.Posts))
+	for _, post := range feed.Posts {
+		if post.DateGMT.After(after) {
+			posts = append(posts, post)
+		}
+	}
+
+	newPosts, skipCount := insertNewPosts(b, posts, emitter)
+	log.Infof("%s feed: %d new posts, %d existing", b.Name, len(newPosts), skipCount)
+
+	return relinkPosts(b, newPosts)
+}
+
+func loadFeed(source, format string) (*Feed, error) {
+	b, err := OpenSource(source)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenSource")
+	}
+
+	feed, err := ParseFeed(b, format)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ParseFeed %s", source)
+	}
+
+	for _, link := range feed.Skipped {
+		log.Warnf("No post id in item, skipping %s", link)
+	}
+
+	return feed, nil
+}
+
+func ensureBlog(name, siteUrl string) (*models.Blog, error) {
+	for _, b := range allBlogs {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+
+	if siteUrl == "" {
+		return nil, errors.Errorf("Unknown blog %s and no site url in source", name)
+	}
+
+	b := &models.Blog{
+		Name: name,
+		URL:  siteUrl,
+	}
+	if err := b.Insert(mdb); err != nil {
+		return nil, errors.Wrapf(err, "Insert blog %s", name)
+	}
+	allBlogs[b.ID] = b
+	log.Infof("Created blog %s [%d] %s", b.Name, b.ID, b.URL)
+
+	return b, nil
+}
@@ -18,15 +18,22 @@ import (
 )
 
 func ImportLatest() {
-	clock, emitter := Init()
+	clock := time.Now()
 
-	utils.Must(importLatest(emitter))
+	utils.Must(Latest())
 
-	Shutdown()
 	log.Info("Success")
 	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
 }
 
+// Latest imports new posts of all configured blogs, it runs as the import_blogs scheduler task
+func Latest() error {
+	_, emitter := Init()
+	defer Shutdown()
+
+	return importLatest(emitter)
+}
+
 func importLatest(emitter *events.BufferedEmitter) error {
 	// load blogs
 	blogs, err := models.Blogs(mdb).All()
@@ -65,14 +72,18 @@ func importLastFromBlog(b *models.Blog, lastTS time.Time, emitter *events.Buffer
 	log.Infof("Importing latest posts from %s [%s]", b.Name, lastTS.Format(time.RFC3339))
 
 	wpConfig := viper.GetStringMapString(fmt.Sprintf("wordpress.%s", b.Name))
+	after := lastTS.AddDate(0, 0, -3)
+
+	// blogs without API access are followed through their feed
+	if feedUrl := wpConfig["feed"]; feedUrl != "" {
+		return importLastFromFeed(b, feedUrl, after, emitter)
+	}
+
 	client, err := NewWordpressClient(wpConfig["url"], wpConfig["username"], wpConfig["password"])
 	if err != nil {
 		return errors.Wrap(err, "NewWordpressClient")
 	}
 
-	after := lastTS.AddDate(0, 0, -3)
-	postFilter := getBlogPostFilter(b.ID)
-
 	page := 1
 	perPage := 100
 	skipCount := 0
@@ -90,39 +101,9 @@ func importLastFromBlog(b *models.Blog, lastTS time.Time, emitter *events.Buffer
 			return errors.Wrapf(err, "Posts.List %d", page)
 		}
 
-		for _, post := range posts {
-
-			exist, err := models.BlogPosts(mdb,
-				qm.Where("blog_id = ? and wp_id = ?", b.ID, post.ID)).
-				Exists()
-			if err != nil {
-				log.Errorf("Check exists %d %d: %s", b.ID, post.ID, err.Error())
-				continue
-			}
-			if exist {
-				log.Infof("Post exists %d %d. Skipping", b.ID, post.ID)
-				skipCount++
-				continue
-			}
-
-			blogPost, err := prepare(post)
-			if err != nil {
-				log.Errorf("Prepare post %d %d: %s", b.ID, post.ID, err.Error())
-				continue
-			}
-
-			log.Infof("Insert new post %s [%d]", post.Title.Rendered, post.ID)
-			blogPost.BlogID = b.ID
-			blogPost.Filtered = !postFilter.IsPass(post)
-			err = blogPost.Insert(mdb)
-			if err != nil {
-				log.Errorf("Insert post to DB %d %d: %s", b.ID, post.ID, err.Error())
-				continue
-			}
-
-			newPosts = append(newPosts, blogPost)
-			emitter.Emit(events.BlogPostCreateEvent(blogPost))
-		}
+		inserted, skipped := insertNewPosts(b, posts, emitter)
+		newPosts = append(newPosts, inserted...)
+		skipCount += skipped
 
 		page = resp.NextPage
 		if page < 1 {
@@ -130,8 +111,55 @@ func importLastFromBlog(b *models.Blog, lastTS time.Time, emitter *events.Buffer
 		}
 	}
 
-	// make relative links of new posts
-	err = loadLinkMap()
+	return relinkPosts(b, newPosts)
+}
+
+// insertNewPosts prepares and inserts posts not already in the blog.
+// Failures are logged and skipped. Returns the inserted posts and the number of existing ones.
+func insertNewPosts(b *models.Blog, posts []*wordpress.Post, emitter *events.BufferedEmitter) ([]*models.BlogPost, int) {
+	postFilter := getBlogPostFilter(b.ID)
+
+	skipCount := 0
+	newPosts := make([]*models.BlogPost, 0)
+	for _, post := range posts {
+		exist, err := models.BlogPosts(mdb,
+			qm.Where("blog_id = ? and wp_id = ?", b.ID, post.ID)).
+			Exists()
+		if err != nil {
+			log.Errorf("Check exists %d %d: %s", b.ID, post.ID, err.Error())
+			continue
+		}
+		if exist {
+			log.Infof("Post exists %d %d. Skipping", b.ID, post.ID)
+			skipCount++
+			continue
+		}
+
+		blogPost, err := prepare(post)
+		if err != nil {
+			log.Errorf("Prepare post %d %d: %s", b.ID, post.ID, err.Error())
+			continue
+		}
+
+		log.Infof("Insert new post %s [%d]", post.Title.Rendered, post.ID)
+		blogPost.BlogID = b.ID
+		blogPost.Filtered = !postFilter.IsPass(post)
+		err = blogPost.Insert(mdb)
+		if err != nil {
+			log.Errorf("Insert post to DB %d %d: %s", b.ID, post.ID, err.Error())
+			continue
+		}
+
+		newPosts = append(newPosts, blogPost)
+		emitter.Emit(events.BlogPostCreateEvent(blogPost))
+	}
+
+	return newPosts, skipCount
+}
+
+// relinkPosts makes the links of new posts relative
+func relinkPosts(b *models.Blog, newPosts []*models.BlogPost) error {
+	err := loadLinkMap()
 	if err != nil {
 		return errors.Wrap(err, "loadLinkMap")
 	}
@@ -1,172 +1,179 @@
 package conventions
 
 import (
-	"database/sql"
 	"encoding/json"
+	"fmt"
+	"sort"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/boil"
-	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
 const (
-	CONVENTIONS_FILE = "importer/convetions/data/Conventions - 2017.csv"
+	IMPORTER         = "conventions"
+	CONVENTIONS_FILE = "importer/conventions/data/Conventions - 2017.csv"
 )
 
-var (
-	LANGS = [4]string{
-		common.LANG_ENGLISH,
-		common.LANG_HEBREW,
-		common.LANG_RUSSIAN,
-		common.LANG_SPANISH,
-	}
-)
-
-func ImportConvetions() {
-	var err error
-	clock := time.Now()
+var MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "pattern", Required: true},
+		{Name: "start_date", Type: sheet.TYPE_DATE, Required: true},
+		{Name: "end_date", Type: sheet.TYPE_DATE, Required: true},
+		{Name: "country"},
+		{Name: "city"},
+		{Name: "full_address"},
+	},
+	I18n: []string{"name"},
+}
 
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
-	//log.SetLevel(log.WarnLevel)
+// properties set from the sheet, in diff order
+var PROPS = []string{"pattern", "active", "country", "city", "full_address", "start_date", "end_date"}
 
-	log.Info("Starting convetions insert")
+func init() {
+	sheet.Register(&sheet.Definition{
+		Name:        IMPORTER,
+		Description: "Conventions by pattern (pattern, start_date, end_date, country, city, full_address, [lang].name)",
+		New:         func() sheet.Importer { return new(ConventionsImporter) },
+	})
+}
 
-	log.Info("Setting up connection to MDB")
-	mdb, err := sql.Open("postgres", viper.GetString("mdb.url"))
-	utils.Must(err)
-	utils.Must(mdb.Ping())
-	defer mdb.Close()
-	boil.SetDB(mdb)
-	//boil.DebugMode = true
+func ImportConvetions() {
+	sheet.ImportCommand(IMPORTER, CONVENTIONS_FILE, true, false, "")
+}
 
-	utils.Must(common.InitTypeRegistries(mdb))
+type conventionChange struct {
+	convention *models.Collection
+	props      map[string]interface{}
+	names      map[string]string
+}
 
-	utils.Must(handleConventions(mdb))
+type ConventionsImporter struct{}
 
-	log.Info("Success")
-	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+func (i *ConventionsImporter) Mapping() *sheet.Mapping {
+	return MAPPING
 }
 
-func handleConventions(db *sql.DB) error {
-	records, err := utils.ReadCSV(CONVENTIONS_FILE)
-	if err != nil {
-		return errors.Wrap(err, "Read conventions")
-	}
+func (i *ConventionsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	pattern := row.Get("pattern")
+	change := &sheet.Change{Key: pattern}
 
-	h, err := utils.ParseCSVHeader(records[0])
+	ctID := common.CONTENT_TYPE_REGISTRY.ByName[common.CT_CONGRESS].ID
+	conventions, err := models.Collections(exec,
+		qm.Where("type_id = ? AND properties->>'pattern' = ?", ctID, pattern),
+		qm.Load("CollectionI18ns")).
+		All()
 	if err != nil {
-		return errors.Wrap(err, "Bad header")
+		return nil, errors.Wrapf(err, "Lookup convention in db [%s]", pattern)
 	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "Start transaction")
+	if len(conventions) > 1 {
+		return change.Conflict("%d conventions with this pattern", len(conventions)), nil
 	}
 
-	for _, x := range records[1:] {
-		if err = doConvention(tx, h, x); err != nil {
-			break
-		}
+	data := &conventionChange{
+		props: make(map[string]interface{}),
+		names: row.I18n("name"),
 	}
-
-	if err == nil {
-		err = tx.Commit()
-		if err != nil {
-			return errors.Wrap(err, "Commit transaction")
+	change.Data = data
+
+	current := make(map[string]string)
+	if len(conventions) == 1 {
+		data.convention = conventions[0]
+		if data.convention.Properties.Valid {
+			if err := json.Unmarshal(data.convention.Properties.JSON, &data.props); err != nil {
+				return change.Conflict("bad properties in convention %d: %s", data.convention.ID, err.Error()), nil
+			}
 		}
-	} else {
-		if ex := tx.Rollback(); ex != nil {
-			return errors.Wrap(ex, "Rollback transaction")
+		for k, v := range data.props {
+			current[k] = fmt.Sprintf("%v", v)
 		}
-		return err
+		for _, i18n := range data.convention.R.CollectionI18ns {
+			current[i18n.Language+".name"] = i18n.Name.String
+		}
+	} else {
+		change.Action = sheet.ACTION_CREATE
 	}
 
-	return nil
-}
+	data.props["pattern"] = pattern
+	data.props["active"] = true
+	data.props["country"] = row.Get("country")
+	data.props["city"] = row.Get("city")
+	data.props["full_address"] = row.Get("full_address")
+	data.props["start_date"] = row.Date("start_date")
+	data.props["end_date"] = row.Date("end_date")
 
-func doConvention(exec boil.Executor, header map[string]int, record []string) error {
-	// Get or create convention
-	ctID := common.CONTENT_TYPE_REGISTRY.ByName[common.CT_CONGRESS].ID
-	var convention models.Collection
-	err := queries.Raw(exec,
-		`select * from collections where type_id=$1 and properties -> 'pattern' ? $2 limit 1`,
-		ctID, record[header["pattern"]],
-	).Bind(&convention)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Create
-			convention = models.Collection{
-				UID:    utils.GenerateUID(8),
-				TypeID: ctID,
-			}
-			err = convention.Insert(exec)
-			if err != nil {
-				return errors.Wrapf(err, "Insert convention [%s]", record)
-			}
-		} else {
-			return errors.Wrapf(err, "Lookup convention in db [%s]", record)
-		}
+	for _, k := range PROPS {
+		change.Set(k, current[k], propString(data.props[k]))
 	}
 
-	// Properties
-	var props = make(map[string]interface{})
-	if convention.Properties.Valid {
-		convention.Properties.Unmarshal(&props)
+	langs := make([]string, 0, len(data.names))
+	for l := range data.names {
+		langs = append(langs, l)
 	}
-	props["pattern"] = record[header["pattern"]]
-	props["active"] = true
-	props["country"] = record[header["country"]]
-	props["city"] = record[header["city"]]
-	props["full_address"] = record[header["full_address"]]
-	sd, err := time.Parse("2006-01-02", record[header["start_date"]])
-	if err != nil {
-		return errors.Wrapf(err, "Bad start_date format, expected `2006-01-02` got %s", record[header["start_date"]])
+	sort.Strings(langs)
+	for _, l := range langs {
+		change.Set(l+".name", current[l+".name"], data.names[l])
 	}
-	props["start_date"] = sd
-	ed, err := time.Parse("2006-01-02", record[header["end_date"]])
-	if err != nil {
-		return errors.Wrapf(err, "Bad end_date format, expected `2006-01-02` got %s", record[header["end_date"]])
-	}
-	props["end_date"] = ed
 
-	p, err := json.Marshal(props)
-	if err != nil {
-		return errors.Wrap(err, "Marshal convention properties")
-	}
-	convention.Properties = null.JSONFrom(p)
+	return change, nil
+}
+
+func (i *ConventionsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*conventionChange)
 
-	err = convention.Update(exec)
+	p, err := json.Marshal(data.props)
 	if err != nil {
-		return errors.Wrap(err, "Update convention properties")
+		return nil, errors.Wrap(err, "Marshal convention properties")
 	}
 
-	// i18n
-	for _, l := range LANGS {
-		n := record[header[l+".name"]]
-		if n == "" {
-			continue
+	var evnt events.Event
+	if change.Action == sheet.ACTION_CREATE {
+		data.convention = &models.Collection{
+			UID:        utils.GenerateUID(8),
+			TypeID:     common.CONTENT_TYPE_REGISTRY.ByName[common.CT_CONGRESS].ID,
+			Properties: null.JSONFrom(p),
+		}
+		if err := data.convention.Insert(exec); err != nil {
+			return nil, errors.Wrapf(err, "Insert convention [%s]", change.Key)
+		}
+		evnt = events.CollectionCreateEvent(data.convention)
+	} else {
+		data.convention.Properties = null.JSONFrom(p)
+		if err := data.convention.Update(exec, "properties"); err != nil {
+			return nil, errors.Wrap(err, "Update convention properties")
 		}
+		evnt = events.CollectionUpdateEvent(data.convention)
+	}
 
+	for l, n := range data.names {
 		ci18n := models.CollectionI18n{
-			CollectionID: convention.ID,
+			CollectionID: data.convention.ID,
 			Language:     l,
-			Name:         null.NewString(n, n != ""),
+			Name:         null.StringFrom(n),
 		}
 		err = ci18n.Upsert(exec, true,
 			[]string{"collection_id", "language"},
 			[]string{"name"})
 		if err != nil {
-			return errors.Wrapf(err, "Upsert convention i18n")
+			return nil, errors.Wrapf(err, "Upsert convention i18n")
 		}
 	}
 
-	return nil
+	return []events.Event{evnt}, nil
+}
+
+// propString formats a property as it reads back from its json, dates are marshaled as RFC3339
+func propString(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", v)
 }
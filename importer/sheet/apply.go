@@ -0,0 +1,148 @@
+package sheet
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+)
+
+// Import is the audit record of an applied sheet
+type Import struct {
+	ID        int64       `boil:"id" json:"id"`
+	Importer  string      `boil:"importer" json:"importer"`
+	File      string      `boil:"file" json:"file"`
+	Sha1      []byte      `boil:"sha1" json:"-"`
+	User      null.String `boil:"user" json:"user"`
+	Created   int         `boil:"created" json:"created"`
+	Updated   int         `boil:"updated" json:"updated"`
+	Unchanged int         `boil:"unchanged" json:"unchanged"`
+	Conflicts int         `boil:"conflicts" json:"conflicts"`
+	Errors    int         `boil:"errors" json:"errors"`
+	Changes   null.JSON   `boil:"changes" json:"changes"`
+	CreatedAt time.Time   `boil:"created_at" json:"created_at"`
+}
+
+// Apply writes the create and update changes of a previewed plan in a single transaction.
+// The sheet is diffed again inside the transaction and the import is aborted if the result
+// differs from the preview, i.e. the DB changed in the meantime.
+// Plans with row errors are refused unless force is given, conflicts are never applied.
+// Events are returned for the caller to emit after the transaction is committed.
+func Apply(db *sql.DB, p *Plan, user string, force bool) (*Import, []events.Event, error) {
+	if len(p.Errors) > 0 && !force {
+		return nil, nil, errors.Errorf("%d row errors, fix the sheet or force to skip these rows", len(p.Errors))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Start transaction")
+	}
+
+	record, evnts, err := apply(tx, p, user)
+	if err != nil {
+		if ex := tx.Rollback(); ex != nil {
+			return nil, nil, errors.Wrap(ex, "Rollback transaction")
+		}
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, errors.Wrap(err, "Commit transaction")
+	}
+
+	return record, evnts, nil
+}
+
+func apply(tx *sql.Tx, p *Plan, user string) (*Import, []events.Event, error) {
+	def, ok := Lookup(p.Importer)
+	if !ok {
+		return nil, nil, errors.Errorf("Unknown importer %s", p.Importer)
+	}
+
+	// changes are applied by the importer instance (and state) which made them
+	imp := def.New()
+	plan, err := preview(tx, imp, p.Importer, p.File, p.content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	before, err := p.fingerprint()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Fingerprint preview")
+	}
+	after, err := plan.fingerprint()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Fingerprint plan")
+	}
+	if !bytes.Equal(before, after) {
+		return nil, nil, errors.New("DB changed since preview, please preview again")
+	}
+
+	evnts := make([]events.Event, 0)
+	applied := make([]*Change, 0)
+	for _, c := range plan.Changes {
+		if c.Action != ACTION_CREATE && c.Action != ACTION_UPDATE {
+			continue
+		}
+		ev, err := imp.Apply(tx, c)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Apply row %d", c.Row)
+		}
+		evnts = append(evnts, ev...)
+		applied = append(applied, c)
+	}
+
+	record, err := insertImport(tx, plan, user, applied)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return record, evnts, nil
+}
+
+func insertImport(exec boil.Executor, plan *Plan, user string, applied []*Change) (*Import, error) {
+	counts := plan.Counts()
+
+	changes, err := json.Marshal(applied)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal changes")
+	}
+	sha1, err := hex.DecodeString(plan.Sha1)
+	if err != nil {
+		return nil, errors.Wrap(err, "Decode sha1")
+	}
+
+	record := new(Import)
+	err = queries.Raw(exec,
+		`INSERT INTO sheet_imports (importer, file, sha1, "user", created, updated, unchanged, conflicts, errors, changes)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *`,
+		plan.Importer, plan.File, sha1, null.NewString(user, user != ""),
+		counts[ACTION_CREATE], counts[ACTION_UPDATE], counts[ACTION_UNCHANGED], counts[ACTION_CONFLICT],
+		len(plan.Errors), null.JSONFrom(changes)).
+		Bind(record)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert sheet import")
+	}
+
+	return record, nil
+}
+
+// FindImports returns the audit records of applied imports, most recent first
+func FindImports(exec boil.Executor, importer string, limit int) ([]*Import, error) {
+	imports := make([]*Import, 0)
+	err := queries.Raw(exec,
+		`SELECT * FROM sheet_imports WHERE $1 = '' OR importer = $1 ORDER BY created_at DESC, id DESC LIMIT $2`,
+		importer, limit).Bind(&imports)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Load sheet imports")
+	}
+	return imports, nil
+}
@@ -0,0 +1,117 @@
+package sheet
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func openDB() *sql.DB {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	utils.Must(common.InitTypeRegistries(db))
+	return db
+}
+
+// ImportCommand previews importing a sheet and, if asked to, applies it
+func ImportCommand(importer, path string, apply, force bool, user string) {
+	clock := time.Now()
+
+	db := openDB()
+	defer db.Close()
+
+	plan, err := Preview(db, importer, path)
+	utils.Must(err)
+	PrintPlan(plan, apply)
+
+	if !apply {
+		log.Info("Preview only, run again with --apply to write changes")
+		return
+	}
+
+	emitter, err := events.InitEmitter()
+	utils.Must(err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		events.CloseEmitter(ctx)
+	}()
+
+	record, evnts, err := Apply(db, plan, user, force)
+	utils.Must(err)
+	emitter.Emit(evnts...)
+
+	log.Infof("Applied as sheet import %d: %d created, %d updated, %d conflicts skipped",
+		record.ID, record.Created, record.Updated, record.Conflicts)
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// PrintPlan writes a plan to stdout. Unchanged rows are listed only if verbose.
+func PrintPlan(plan *Plan, verbose bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ROW\tACTION\tKEY\tDETAILS")
+	for _, c := range plan.Changes {
+		if c.Action == ACTION_UNCHANGED && !verbose {
+			continue
+		}
+
+		details := c.Message
+		if details == "" {
+			fields := make([]string, len(c.Fields))
+			for i, f := range c.Fields {
+				fields[i] = fmt.Sprintf("%s: %q => %q", f.Field, f.Old, f.New)
+			}
+			details = strings.Join(fields, ", ")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", c.Row, c.Action, c.Key, details)
+	}
+	for _, e := range plan.Errors {
+		fmt.Fprintf(w, "%d\terror\t%s\t%s\n", e.Row, e.Column, e.Message)
+	}
+	utils.Must(w.Flush())
+
+	counts := plan.Counts()
+	fmt.Printf("\n%s [%s]: %d create, %d update, %d unchanged, %d conflict, %d errors\n",
+		plan.File, plan.Importer, counts[ACTION_CREATE], counts[ACTION_UPDATE],
+		counts[ACTION_UNCHANGED], counts[ACTION_CONFLICT], len(plan.Errors))
+}
+
+func HistoryCommand(importer string, limit int) {
+	db := openDB()
+	defer db.Close()
+
+	imports, err := FindImports(db, importer, limit)
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIMPORTER\tFILE\tUSER\tCREATED\tUPDATED\tUNCHANGED\tCONFLICTS\tERRORS\tAT")
+	for _, x := range imports {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			x.ID, x.Importer, x.File, x.User.String, x.Created, x.Updated, x.Unchanged, x.Conflicts, x.Errors,
+			x.CreatedAt.Format(time.RFC3339))
+	}
+	utils.Must(w.Flush())
+}
+
+func ImportersCommand() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMPORTER\tDESCRIPTION")
+	for _, d := range Definitions() {
+		fmt.Fprintf(w, "%s\t%s\n", d.Name, d.Description)
+	}
+	utils.Must(w.Flush())
+}
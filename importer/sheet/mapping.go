@@ -0,0 +1,258 @@
+package sheet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+// Column value types
+const (
+	TYPE_STRING = "string"
+	TYPE_INT    = "int"
+	TYPE_BOOL   = "bool"
+	TYPE_DATE   = "date" // YYYY-MM-DD
+	TYPE_LANG   = "lang" // language code (he) or file name language (HEB)
+)
+
+// Column declares a single sheet column
+type Column struct {
+	Name     string               // header, case insensitive
+	Type     string               // one of TYPE_*, default TYPE_STRING
+	Required bool                 // header must exist and values must not be empty
+	OneOf    []string             // allowed values, if given
+	Validate func(v string) error // additional validation of non empty values
+}
+
+// Mapping declares the columns of a sheet.
+// I18n fields are families of per language columns named [language].[field], e.g. en.label, he.label.
+type Mapping struct {
+	Columns []Column
+	I18n    []string
+}
+
+// RowError is a validation error of a single cell (or row if Column is empty)
+type RowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d, %s: %s", e.Row, e.Column, e.Message)
+}
+
+// Row is a validated sheet row
+type Row struct {
+	Number int // line number in the sheet, header is 1
+	values map[string]string
+	i18n   map[string]map[string]string // field => language => value
+}
+
+func (r *Row) Get(column string) string {
+	return r.values[strings.ToLower(column)]
+}
+
+// Int returns the value of an int column, 0 if empty
+func (r *Row) Int(column string) int64 {
+	v, _ := strconv.ParseInt(r.Get(column), 10, 64)
+	return v
+}
+
+func (r *Row) Bool(column string) bool {
+	v, _ := parseBool(r.Get(column))
+	return v
+}
+
+// Date returns the value of a date column, zero time if empty
+func (r *Row) Date(column string) time.Time {
+	v, _ := time.Parse("2006-01-02", r.Get(column))
+	return v
+}
+
+// Lang returns the language code of a lang column, empty if empty
+func (r *Row) Lang(column string) string {
+	v, _ := parseLang(r.Get(column))
+	return v
+}
+
+// I18n returns the non empty values of an i18n field by language
+func (r *Row) I18n(field string) map[string]string {
+	return r.i18n[strings.ToLower(field)]
+}
+
+// Parse validates records (header first) against the mapping.
+// The returned error is for problems with the header, rows with problems are left out and reported as RowErrors.
+func (m *Mapping) Parse(records [][]string) ([]*Row, []RowError, error) {
+	if len(records) == 0 {
+		return nil, nil, errors.New("Empty sheet")
+	}
+
+	header := make(map[string]int, len(records[0]))
+	for i, x := range records[0] {
+		header[strings.ToLower(strings.TrimSpace(x))] = i
+	}
+
+	missing := make([]string, 0)
+	for _, c := range m.Columns {
+		if _, ok := header[strings.ToLower(c.Name)]; !ok && c.Required {
+			missing = append(missing, c.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, errors.Errorf("Missing required columns: %s", strings.Join(missing, ", "))
+	}
+
+	// i18n columns present in the header
+	i18nCols := make(map[string]map[string]int)
+	for _, field := range m.I18n {
+		field = strings.ToLower(field)
+		i18nCols[field] = make(map[string]int)
+		for _, language := range common.ALL_LANGS {
+			if idx, ok := header[language+"."+field]; ok {
+				i18nCols[field][language] = idx
+			}
+		}
+	}
+
+	rows := make([]*Row, 0, len(records)-1)
+	rowErrs := make([]RowError, 0)
+	for i, record := range records[1:] {
+		if isEmpty(record) {
+			continue
+		}
+
+		row := &Row{
+			Number: i + 2,
+			values: make(map[string]string, len(m.Columns)),
+			i18n:   make(map[string]map[string]string, len(i18nCols)),
+		}
+
+		var errs []RowError
+		for _, c := range m.Columns {
+			name := strings.ToLower(c.Name)
+			v := cell(record, header, name)
+			if err := c.check(v); err != nil {
+				errs = append(errs, RowError{Row: row.Number, Column: c.Name, Message: err.Error()})
+				continue
+			}
+			row.values[name] = v
+		}
+
+		for field, langs := range i18nCols {
+			row.i18n[field] = make(map[string]string)
+			for language, idx := range langs {
+				if idx < len(record) {
+					if v := strings.TrimSpace(record[idx]); v != "" {
+						row.i18n[field][language] = v
+					}
+				}
+			}
+		}
+
+		if len(errs) > 0 {
+			rowErrs = append(rowErrs, errs...)
+		} else {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, rowErrs, nil
+}
+
+func (c *Column) check(v string) error {
+	if v == "" {
+		if c.Required {
+			return errors.New("required")
+		}
+		return nil
+	}
+
+	switch c.Type {
+	case TYPE_INT:
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return errors.Errorf("expected integer, got %q", v)
+		}
+	case TYPE_BOOL:
+		if _, err := parseBool(v); err != nil {
+			return err
+		}
+	case TYPE_DATE:
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			return errors.Errorf("expected YYYY-MM-DD, got %q", v)
+		}
+	case TYPE_LANG:
+		if _, err := parseLang(v); err != nil {
+			return err
+		}
+	}
+
+	if len(c.OneOf) > 0 {
+		ok := false
+		for _, x := range c.OneOf {
+			if strings.EqualFold(x, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.Errorf("expected one of %s, got %q", strings.Join(c.OneOf, ", "), v)
+		}
+	}
+
+	if c.Validate != nil {
+		return c.Validate(v)
+	}
+
+	return nil
+}
+
+func cell(record []string, header map[string]int, name string) string {
+	if idx, ok := header[name]; ok && idx < len(record) {
+		return strings.TrimSpace(record[idx])
+	}
+	return ""
+}
+
+func isEmpty(record []string) bool {
+	for _, x := range record {
+		if strings.TrimSpace(x) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func parseBool(v string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "v", "x", "y", "yes", "true", "1":
+		return true, nil
+	case "", "n", "no", "false", "0":
+		return false, nil
+	default:
+		return false, errors.Errorf("expected boolean (v / empty), got %q", v)
+	}
+}
+
+func parseLang(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	if l, ok := common.LANG_MAP[strings.ToUpper(v)]; ok {
+		return l, nil
+	}
+	for _, l := range common.ALL_LANGS {
+		if l == strings.ToLower(v) {
+			return l, nil
+		}
+	}
+	return "", errors.Errorf("unknown language %q", v)
+}
@@ -0,0 +1,48 @@
+package sheet
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMappingParse(t *testing.T) {
+	m := &Mapping{
+		Columns: []Column{
+			{Name: "id", Type: TYPE_INT, Required: true},
+			{Name: "active", Type: TYPE_BOOL},
+			{Name: "language", Type: TYPE_LANG},
+			{Name: "kind", OneOf: []string{"a", "b"}},
+		},
+		I18n: []string{"name"},
+	}
+
+	_, _, err := m.Parse([][]string{{"active"}})
+	assert.Error(t, err, "missing required column")
+
+	rows, rowErrs, err := m.Parse([][]string{
+		{"ID", " Active ", "language", "kind", "he.name", "en.name"},
+		{"1", "v", "HEB", "a", "שם", "name"},
+		{"", "", "", "", "", ""},
+		{"x", "maybe", "klingon", "c", "", ""},
+		{"3", "", "ru", "B", "", "other"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, rows, 2)
+	assert.Len(t, rowErrs, 4)
+
+	assert.Equal(t, 2, rows[0].Number)
+	assert.Equal(t, int64(1), rows[0].Int("id"))
+	assert.True(t, rows[0].Bool("active"))
+	assert.Equal(t, "he", rows[0].Lang("language"))
+	assert.Equal(t, map[string]string{"he": "שם", "en": "name"}, rows[0].I18n("name"))
+
+	assert.Equal(t, 5, rows[1].Number)
+	assert.False(t, rows[1].Bool("active"))
+	assert.Equal(t, "ru", rows[1].Lang("language"))
+	assert.Equal(t, map[string]string{"en": "other"}, rows[1].I18n("name"))
+
+	for _, e := range rowErrs {
+		assert.Equal(t, 4, e.Row)
+	}
+}
@@ -0,0 +1,250 @@
+// Package sheet is a framework for importing spreadsheets (CSV or XLSX) into MDB.
+//
+// An Importer declares its columns with a Mapping and knows how to diff a row against the DB
+// and apply the resulting change. Imports are previewed as a Plan of per row changes
+// (create, update, unchanged or conflict) before anything is written.
+// Applied imports emit events and are recorded in the sheet_imports table.
+package sheet
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+
+	"github.com/Bnei-Baruch/mdb/events"
+)
+
+const (
+	ACTION_CREATE    = "create"
+	ACTION_UPDATE    = "update"
+	ACTION_UNCHANGED = "unchanged"
+	ACTION_CONFLICT  = "conflict"
+)
+
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Change is what applying a single row would do
+type Change struct {
+	Row     int         `json:"row"`
+	Key     string      `json:"key"`
+	Action  string      `json:"action"`
+	Fields  []FieldDiff `json:"fields,omitempty"`
+	Message string      `json:"message,omitempty"` // reason of conflict
+	Data    interface{} `json:"-"`                 // importer's state for Apply
+}
+
+// Set records a field change if new differs from old
+func (c *Change) Set(field, old, new string) {
+	if old != new {
+		c.Fields = append(c.Fields, FieldDiff{Field: field, Old: old, New: new})
+	}
+}
+
+// Conflict marks the change as a conflict which will not be applied
+func (c *Change) Conflict(format string, args ...interface{}) *Change {
+	c.Action = ACTION_CONFLICT
+	c.Message = fmt.Sprintf(format, args...)
+	return c
+}
+
+// Importer imports rows of a specific sheet.
+// A new importer is made for every run so it may keep state between rows (e.g. a hierarchy).
+type Importer interface {
+	Mapping() *Mapping
+
+	// Diff tells what applying the row would do. Rows are diffed in order.
+	// The returned change Key identifies the entity, duplicate keys in a sheet are conflicts.
+	// A change with no Action is a create if Data is nil, otherwise an update (or unchanged if no Fields).
+	Diff(exec boil.Executor, row *Row) (*Change, error)
+
+	// Apply writes a create or update change, in the order of rows.
+	Apply(exec boil.Executor, change *Change) ([]events.Event, error)
+}
+
+// FileImporter is an Importer whose rows depend on the sheet they come from,
+// e.g. the parent of all rows is named by the file.
+type FileImporter interface {
+	Importer
+
+	// Open is called with the path of the sheet before any row is diffed
+	Open(exec boil.Executor, path string) error
+}
+
+type Definition struct {
+	Name        string
+	Description string
+	New         func() Importer
+}
+
+var (
+	registry   = make(map[string]*Definition)
+	registryMu sync.RWMutex
+)
+
+// Register makes an importer available by name. Panics on duplicates.
+func Register(def *Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.New == nil {
+		panic("sheet: importer " + def.Name + " has no New function")
+	}
+	if _, ok := registry[def.Name]; ok {
+		panic("sheet: importer " + def.Name + " registered twice")
+	}
+	registry[def.Name] = def
+}
+
+func Lookup(name string) (*Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+// Definitions returns all registered importers sorted by name
+func Definitions() []*Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]*Definition, 0, len(registry))
+	for _, d := range registry {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Plan is the preview of importing a sheet
+type Plan struct {
+	Importer string     `json:"importer"`
+	File     string     `json:"file"`
+	Sha1     string     `json:"sha1"`
+	Changes  []*Change  `json:"changes"`
+	Errors   []RowError `json:"errors"`
+
+	content []byte
+}
+
+// Counts returns the number of changes by action
+func (p *Plan) Counts() map[string]int {
+	counts := map[string]int{ACTION_CREATE: 0, ACTION_UPDATE: 0, ACTION_UNCHANGED: 0, ACTION_CONFLICT: 0}
+	for _, c := range p.Changes {
+		counts[c.Action]++
+	}
+	return counts
+}
+
+// Preview reads a sheet and diffs it against the DB. Nothing is written.
+func Preview(exec boil.Executor, importer, path string) (*Plan, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Read sheet")
+	}
+
+	def, ok := Lookup(importer)
+	if !ok {
+		return nil, errors.Errorf("Unknown importer %s", importer)
+	}
+
+	return preview(exec, def.New(), importer, path, content)
+}
+
+// preview diffs content using the given importer instance
+func preview(exec boil.Executor, imp Importer, importer, path string, content []byte) (*Plan, error) {
+	records, err := ReadRecords(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, rowErrs, err := imp.Mapping().Parse(records)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi, ok := imp.(FileImporter); ok {
+		if err := fi.Open(exec, path); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &Plan{
+		Importer: importer,
+		File:     path,
+		Sha1:     fmt.Sprintf("%x", sha1.Sum(content)),
+		Changes:  make([]*Change, 0, len(rows)),
+		Errors:   rowErrs,
+		content:  content,
+	}
+
+	keys := make(map[string]int)
+	for _, row := range rows {
+		change, err := imp.Diff(exec, row)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Diff row %d", row.Number)
+		}
+		change.Row = row.Number
+
+		if change.Action == "" {
+			switch {
+			case change.Data == nil:
+				change.Action = ACTION_CREATE
+			case len(change.Fields) > 0:
+				change.Action = ACTION_UPDATE
+			default:
+				change.Action = ACTION_UNCHANGED
+			}
+		}
+
+		if change.Key != "" {
+			if prev, ok := keys[change.Key]; ok {
+				change.Conflict("duplicate of row %d", prev)
+			} else {
+				keys[change.Key] = row.Number
+			}
+		}
+
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	return plan, nil
+}
+
+// ReadRecords parses CSV or XLSX (first sheet) content by the file extension
+func ReadRecords(path string, content []byte) ([][]string, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".xlsx" {
+		xlFile, err := excelize.OpenReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Read xlsx %s", path)
+		}
+		return xlFile.GetRows(xlFile.GetSheetName(1)), nil
+	}
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read csv %s", path)
+	}
+	return records, nil
+}
+
+// fingerprint identifies the changes of a plan, ignoring importers' state
+func (p *Plan) fingerprint() ([]byte, error) {
+	return json.Marshal(p.Changes)
+}
@@ -0,0 +1,141 @@
+package sources
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+const AUTHORS_IMPORTER = "source_authors"
+
+var AUTHORS_MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "code", Required: true},
+		{Name: "name", Required: true},
+		{Name: "full name"},
+	},
+	I18n: []string{"name", "full_name"},
+}
+
+type authorChange struct {
+	author    *models.Author
+	code      string
+	name      string
+	fullName  string
+	names     map[string]string
+	fullNames map[string]string
+}
+
+type AuthorsImporter struct{}
+
+func (i *AuthorsImporter) Mapping() *sheet.Mapping {
+	return AUTHORS_MAPPING
+}
+
+func (i *AuthorsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	code := row.Get("code")
+	change := &sheet.Change{Key: code}
+
+	author, err := models.Authors(exec,
+		qm.Where("code = ?", code),
+		qm.Load("AuthorI18ns")).
+		One()
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "Lookup author in db [%s]", code)
+	}
+
+	data := &authorChange{
+		code:      code,
+		name:      row.Get("name"),
+		fullName:  row.Get("full name"),
+		names:     row.I18n("name"),
+		fullNames: row.I18n("full_name"),
+	}
+	change.Data = data
+
+	current := make(map[string]string)
+	if author != nil {
+		data.author = author
+		current["name"] = author.Name
+		current["full_name"] = author.FullName.String
+		for _, i18n := range author.R.AuthorI18ns {
+			current[i18n.Language+".name"] = i18n.Name.String
+			current[i18n.Language+".full_name"] = i18n.FullName.String
+		}
+	} else {
+		change.Action = sheet.ACTION_CREATE
+	}
+
+	change.Set("name", current["name"], data.name)
+	change.Set("full_name", current["full_name"], data.fullName)
+
+	// empty i18n cells keep current values
+	for _, l := range sortedKeys(data.names) {
+		change.Set(l+".name", current[l+".name"], data.names[l])
+	}
+	for _, l := range sortedKeys(data.fullNames) {
+		change.Set(l+".full_name", current[l+".full_name"], data.fullNames[l])
+	}
+
+	return change, nil
+}
+
+// Apply writes the author, there are no author events
+func (i *AuthorsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*authorChange)
+
+	if change.Action == sheet.ACTION_CREATE {
+		data.author = &models.Author{
+			Code:     data.code,
+			Name:     data.name,
+			FullName: null.NewString(data.fullName, data.fullName != ""),
+		}
+		if err := data.author.Insert(exec); err != nil {
+			return nil, errors.Wrapf(err, "Insert author [%s]", data.code)
+		}
+	} else {
+		data.author.Name = data.name
+		data.author.FullName = null.NewString(data.fullName, data.fullName != "")
+		if err := data.author.Update(exec, "name", "full_name"); err != nil {
+			return nil, errors.Wrapf(err, "Update author [%d]", data.author.ID)
+		}
+	}
+
+	langs := make(map[string]string)
+	for l := range data.names {
+		langs[l] = l
+	}
+	for l := range data.fullNames {
+		langs[l] = l
+	}
+
+	for _, l := range sortedKeys(langs) {
+		n, fn := data.names[l], data.fullNames[l]
+		cols := make([]string, 0, 2)
+		if n != "" {
+			cols = append(cols, "name")
+		}
+		if fn != "" {
+			cols = append(cols, "full_name")
+		}
+
+		ai18n := models.AuthorI18n{
+			AuthorID: data.author.ID,
+			Language: l,
+			Name:     null.NewString(n, n != ""),
+			FullName: null.NewString(fn, fn != ""),
+		}
+		if err := ai18n.Upsert(exec, true, []string{"author_id", "language"}, cols); err != nil {
+			return nil, errors.Wrapf(err, "Upsert author [%d] i18n %s", data.author.ID, l)
+		}
+	}
+
+	return nil, nil
+}
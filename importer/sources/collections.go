@@ -0,0 +1,118 @@
+package sources
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const COLLECTIONS_IMPORTER = "source_collections"
+
+var COLLECTIONS_MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "author", Required: true},
+		{Name: "name", Required: true},
+		{Name: "pattern"},
+	},
+	I18n: []string{"name", "description"},
+}
+
+type collectionChange struct {
+	author       *models.Author
+	collection   *models.Source
+	name         string
+	pattern      string
+	names        map[string]string
+	descriptions map[string]string
+}
+
+type CollectionsImporter struct{}
+
+func (i *CollectionsImporter) Mapping() *sheet.Mapping {
+	return COLLECTIONS_MAPPING
+}
+
+func (i *CollectionsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	authorCode := row.Get("author")
+	name := row.Get("name")
+	change := &sheet.Change{Key: authorCode + "/" + name}
+
+	author, err := models.Authors(exec, qm.Where("code = ?", authorCode)).One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return change.Conflict("unknown author %s", authorCode), nil
+		}
+		return nil, errors.Wrapf(err, "Fetch author [%s]", authorCode)
+	}
+
+	collection, err := models.Sources(exec,
+		qm.InnerJoin("authors_sources x on x.source_id = sources.id and author_id = ?", author.ID),
+		qm.Where("name = ? and parent_id is null", name),
+		qm.Load("SourceI18ns")).
+		One()
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "Lookup collection in db [%s, %s]", authorCode, name)
+	}
+
+	data := &collectionChange{
+		author:       author,
+		name:         name,
+		pattern:      row.Get("pattern"),
+		names:        row.I18n("name"),
+		descriptions: row.I18n("description"),
+	}
+	change.Data = data
+
+	current := make(map[string]string)
+	if collection != nil {
+		data.collection = collection
+		current["pattern"] = collection.Pattern.String
+		setSourceI18ns(current, collection.R.SourceI18ns)
+	} else {
+		change.Action = sheet.ACTION_CREATE
+	}
+
+	change.Set("pattern", current["pattern"], data.pattern)
+	diffSourceI18ns(change, current, data.names, data.descriptions)
+
+	return change, nil
+}
+
+func (i *CollectionsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*collectionChange)
+	var evnt events.Event
+
+	if change.Action == sheet.ACTION_CREATE {
+		data.collection = &models.Source{
+			UID:     utils.GenerateUID(8),
+			Name:    data.name,
+			Pattern: null.NewString(data.pattern, data.pattern != ""),
+			TypeID:  common.SOURCE_TYPE_REGISTRY.ByName[common.SRC_COLLECTION].ID,
+		}
+		if err := data.author.AddSources(exec, true, data.collection); err != nil {
+			return nil, errors.Wrapf(err, "Create collection [%s]", change.Key)
+		}
+		evnt = events.SourceCreateEvent(data.collection)
+	} else {
+		data.collection.Pattern = null.NewString(data.pattern, data.pattern != "")
+		if err := data.collection.Update(exec, "pattern"); err != nil {
+			return nil, errors.Wrapf(err, "Update collection [%d]", data.collection.ID)
+		}
+		evnt = events.SourceUpdateEvent(data.collection)
+	}
+
+	if err := upsertSourceI18ns(exec, data.collection.ID, data.names, data.descriptions); err != nil {
+		return nil, err
+	}
+
+	return []events.Event{evnt}, nil
+}
@@ -0,0 +1,255 @@
+package sources
+
+import (
+	"database/sql"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const CONTENTS_IMPORTER = "sources"
+
+var CONTENTS_MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "level", Type: sheet.TYPE_INT, Required: true},
+		{Name: "position", Type: sheet.TYPE_INT},
+		{Name: "type", Required: true, Validate: validateSourceType},
+		{Name: "name", Required: true},
+		{Name: "description"},
+		{Name: "pattern"},
+	},
+	I18n: []string{"name", "description"},
+}
+
+func validateSourceType(v string) error {
+	if _, ok := common.SOURCE_TYPE_REGISTRY.ByName[v]; !ok {
+		return errors.Errorf("unknown source type %q", v)
+	}
+	return nil
+}
+
+// sourceRef is a source in the sheet's hierarchy which might not be created yet
+type sourceRef struct {
+	source   *models.Source
+	path     string
+	conflict bool
+}
+
+type contentChange struct {
+	ref          *sourceRef
+	parent       *sourceRef
+	typeID       int64
+	name         string
+	description  string
+	pattern      string
+	position     null.Int
+	names        map[string]string
+	descriptions map[string]string
+}
+
+// ContentsImporter keeps the chain of parents of the current row,
+// the collection named by the sheet is at level 0.
+type ContentsImporter struct {
+	parents []*sourceRef
+}
+
+func (i *ContentsImporter) Mapping() *sheet.Mapping {
+	return CONTENTS_MAPPING
+}
+
+// Open finds the collection of the sheet by its author code and collection name
+func (i *ContentsImporter) Open(exec boil.Executor, path string) error {
+	authorCode, slug, err := parseContentsFile(path)
+	if err != nil {
+		return err
+	}
+
+	collection, err := models.Sources(exec,
+		qm.InnerJoin("authors_sources x on x.source_id = sources.id"),
+		qm.InnerJoin("authors a on a.id = x.author_id and a.code = ?", authorCode),
+		qm.Where("sources.parent_id is null and replace(lower(sources.name), ' ', '-') = ?", slug)).
+		One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.Errorf("No collection %s of author %s, import %s first", slug, authorCode, COLLECTIONS_IMPORTER)
+		}
+		return errors.Wrapf(err, "Lookup collection in db [%s, %s]", authorCode, slug)
+	}
+
+	i.parents = []*sourceRef{{source: collection, path: authorCode + "/" + collection.Name}}
+	return nil
+}
+
+func (i *ContentsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	level := int(row.Int("level"))
+	name := row.Get("name")
+	change := new(sheet.Change)
+
+	if level < 1 || level > len(i.parents) {
+		return change.Conflict("level %d without a parent at level %d", level, level-1), nil
+	}
+
+	parent := i.parents[level-1]
+	change.Key = parent.path + "/" + name
+
+	ref := &sourceRef{path: change.Key}
+	i.parents = append(i.parents[:level], ref)
+
+	if parent.conflict {
+		ref.conflict = true
+		return change.Conflict("parent %s is in conflict", parent.path), nil
+	}
+
+	sType := common.SOURCE_TYPE_REGISTRY.ByName[row.Get("type")]
+
+	// Lookup existing source, parents to be created have no children yet
+	var source *models.Source
+	var err error
+	if parent.source != nil {
+		source, err = models.Sources(exec,
+			qm.Where("type_id = ? and parent_id = ? and name = ?", sType.ID, parent.source.ID, name),
+			qm.Load("SourceI18ns")).
+			One()
+	} else {
+		err = sql.ErrNoRows
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "Fetch source %s", change.Key)
+	}
+
+	data := &contentChange{
+		ref:          ref,
+		parent:       parent,
+		typeID:       sType.ID,
+		name:         name,
+		description:  row.Get("description"),
+		pattern:      row.Get("pattern"),
+		names:        row.I18n("name"),
+		descriptions: row.I18n("description"),
+	}
+	if row.Get("position") != "" {
+		data.position = null.IntFrom(int(row.Int("position")))
+	}
+	change.Data = data
+
+	current := make(map[string]string)
+	if source != nil {
+		ref.source = source
+		current["description"] = source.Description.String
+		current["pattern"] = source.Pattern.String
+		if source.Position.Valid {
+			current["position"] = strconv.Itoa(source.Position.Int)
+		}
+		setSourceI18ns(current, source.R.SourceI18ns)
+	} else {
+		change.Action = sheet.ACTION_CREATE
+		change.Set("type", "", sType.Name)
+	}
+
+	change.Set("description", current["description"], data.description)
+	change.Set("pattern", current["pattern"], data.pattern)
+	if data.position.Valid {
+		change.Set("position", current["position"], strconv.Itoa(data.position.Int))
+	} else {
+		change.Set("position", current["position"], "")
+	}
+	diffSourceI18ns(change, current, data.names, data.descriptions)
+
+	return change, nil
+}
+
+func (i *ContentsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*contentChange)
+	var evnt events.Event
+
+	if change.Action == sheet.ACTION_CREATE {
+		source := &models.Source{
+			UID:         utils.GenerateUID(8),
+			TypeID:      data.typeID,
+			Name:        data.name,
+			Description: null.NewString(data.description, data.description != ""),
+			Pattern:     null.NewString(data.pattern, data.pattern != ""),
+			ParentID:    null.Int64From(data.parent.source.ID),
+			Position:    data.position,
+		}
+		if err := source.Insert(exec); err != nil {
+			return nil, errors.Wrapf(err, "Insert source %s", data.ref.path)
+		}
+		data.ref.source = source
+		evnt = events.SourceCreateEvent(source)
+	} else {
+		source := data.ref.source
+		source.Description = null.NewString(data.description, data.description != "")
+		source.Pattern = null.NewString(data.pattern, data.pattern != "")
+		source.Position = data.position
+		if err := source.Update(exec, "description", "pattern", "position"); err != nil {
+			return nil, errors.Wrapf(err, "Update source %s", data.ref.path)
+		}
+		evnt = events.SourceUpdateEvent(source)
+	}
+
+	if err := upsertSourceI18ns(exec, data.ref.source.ID, data.names, data.descriptions); err != nil {
+		return nil, err
+	}
+
+	return []events.Event{evnt}, nil
+}
+
+func setSourceI18ns(current map[string]string, i18ns models.SourceI18nSlice) {
+	for _, i18n := range i18ns {
+		current[i18n.Language+".name"] = i18n.Name.String
+		current[i18n.Language+".description"] = i18n.Description.String
+	}
+}
+
+// diffSourceI18ns sets the i18n changes, empty cells keep current values
+func diffSourceI18ns(change *sheet.Change, current, names, descriptions map[string]string) {
+	for _, l := range sortedKeys(names) {
+		change.Set(l+".name", current[l+".name"], names[l])
+	}
+	for _, l := range sortedKeys(descriptions) {
+		change.Set(l+".description", current[l+".description"], descriptions[l])
+	}
+}
+
+func upsertSourceI18ns(exec boil.Executor, sourceID int64, names, descriptions map[string]string) error {
+	langs := make(map[string]string)
+	for l := range names {
+		langs[l] = l
+	}
+	for l := range descriptions {
+		langs[l] = l
+	}
+
+	for _, l := range sortedKeys(langs) {
+		n, d := names[l], descriptions[l]
+		cols := make([]string, 0, 2)
+		if n != "" {
+			cols = append(cols, "name")
+		}
+		if d != "" {
+			cols = append(cols, "description")
+		}
+
+		si18n := models.SourceI18n{
+			SourceID:    sourceID,
+			Language:    l,
+			Name:        null.NewString(n, n != ""),
+			Description: null.NewString(d, d != ""),
+		}
+		if err := si18n.Upsert(exec, true, []string{"source_id", "language"}, cols); err != nil {
+			return errors.Wrapf(err, "Upsert source [%d] i18n %s", sourceID, l)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package sources
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentsFile(t *testing.T) {
+	fn := ContentsFile("BS", "Zohar La Am")
+	assert.Equal(t, "importer/sources/data/Sources - bs-zohar-la-am.csv", fn)
+
+	author, slug, err := parseContentsFile(fn)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "bs", author)
+		assert.Equal(t, "zohar-la-am", slug)
+	}
+
+	author, slug, err = parseContentsFile("/tmp/rb-igrot.xlsx")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "rb", author)
+		assert.Equal(t, "igrot", slug)
+	}
+
+	_, _, err = parseContentsFile("Sources - Authors.csv")
+	assert.NotNil(t, err)
+}
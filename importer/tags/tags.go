@@ -2,190 +2,213 @@ package tags
 
 import (
 	"database/sql"
-	"fmt"
-	"strconv"
-	"time"
+	"sort"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"gopkg.in/volatiletech/null.v6"
 
-	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
 const (
+	IMPORTER  = "tags"
 	TAGS_FILE = "importer/tags/data/Tags - All.csv"
 )
 
-var mappings map[int]int64
-var LANGS = [5]string{
-	common.LANG_ENGLISH,
-	common.LANG_HEBREW,
-	common.LANG_RUSSIAN,
-	common.LANG_SPANISH,
-	common.LANG_UKRAINIAN,
+var MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "level", Type: sheet.TYPE_INT, Required: true},
+		{Name: "kmedia_catalog", Type: sheet.TYPE_INT},
+		{Name: "pattern", Required: true},
+		{Name: "description"},
+	},
+	I18n: []string{"label"},
+}
+
+func init() {
+	sheet.Register(&sheet.Definition{
+		Name:        IMPORTER,
+		Description: "Tags tree by level (level, kmedia_catalog, pattern, description, [lang].label)",
+		New:         func() sheet.Importer { return new(TagsImporter) },
+	})
 }
 
 func ImportTags() {
-	var err error
-	clock := time.Now()
-
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
-	//log.SetLevel(log.WarnLevel)
-
-	log.Info("Starting tags import")
-
-	log.Info("Setting up connection to MDB")
-	mdb, err := sql.Open("postgres", viper.GetString("mdb.url"))
-	utils.Must(err)
-	utils.Must(mdb.Ping())
-	defer mdb.Close()
-	boil.SetDB(mdb)
-	//boil.DebugMode = true
-
-	mappings = make(map[int]int64)
-	utils.Must(handleTopics(mdb))
-	log.Infof("Here comes %d catalogs mappings", len(mappings))
-	for k, v := range mappings {
-		fmt.Printf("%d\t%d\n", k, v)
-	}
+	sheet.ImportCommand(IMPORTER, TAGS_FILE, true, false, "")
+}
+
+// tagRef is a tag in the sheet's hierarchy which might not be created yet
+type tagRef struct {
+	tag      *models.Tag
+	path     string
+	conflict bool
+}
 
-	log.Info("Success")
-	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+type tagChange struct {
+	ref         *tagRef
+	parent      *tagRef
+	pattern     string
+	kmdbID      int64
+	description string
+	labels      map[string]string
 }
 
-func handleTopics(db *sql.DB) error {
-	records, err := utils.ReadCSV(TAGS_FILE)
-	if err != nil {
-		return errors.Wrap(err, "Read topics")
+// TagsImporter keeps the chain of parents of the current row
+type TagsImporter struct {
+	parents []*tagRef
+}
+
+func (i *TagsImporter) Mapping() *sheet.Mapping {
+	return MAPPING
+}
+
+func (i *TagsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	level := int(row.Int("level"))
+	pattern := row.Get("pattern")
+	change := new(sheet.Change)
+
+	if level < 1 || level > len(i.parents)+1 {
+		return change.Conflict("level %d without a parent at level %d", level, level-1), nil
 	}
 
-	h, err := utils.ParseCSVHeader(records[0])
-	if err != nil {
-		return errors.Wrap(err, "Bad header")
+	var parent *tagRef
+	path := pattern
+	if level > 1 {
+		parent = i.parents[level-2]
+		path = parent.path + "/" + pattern
 	}
+	change.Key = path
 
-	tx, err := db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "Start transaction")
+	ref := &tagRef{path: path}
+	if level == len(i.parents)+1 {
+		i.parents = append(i.parents, ref)
+	} else {
+		i.parents[level-1] = ref
+		i.parents = i.parents[:level]
 	}
 
-	var parents = []*models.Tag{}
-	for i, x := range records[1:] {
-		if utils.IsEmpty(x) {
-			continue
-		}
+	if parent != nil && parent.conflict {
+		ref.conflict = true
+		return change.Conflict("parent %s is in conflict", parent.path), nil
+	}
 
-		xLevel := x[h["level"]]
-		level, err := strconv.Atoi(xLevel)
-		if err != nil {
-			return errors.Wrapf(err, "Bad level at row %d: %s", i+1, xLevel)
-		}
+	// Lookup existing tag, parents to be created have no children yet
+	var tag *models.Tag
+	var err error
+	if parent == nil {
+		tag, err = models.Tags(exec,
+			qm.Where("parent_id is null and pattern = ?", pattern),
+			qm.Load("TagI18ns")).
+			One()
+	} else if parent.tag != nil {
+		tag, err = models.Tags(exec,
+			qm.Where("parent_id = ? and pattern = ?", parent.tag.ID, pattern),
+			qm.Load("TagI18ns")).
+			One()
+	} else {
+		err = sql.ErrNoRows
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrapf(err, "Fetch tag %s", path)
+	}
 
-		kmdbID := -1
-		xKmdbID := x[h["kmedia_catalog"]]
-		if xKmdbID != "" {
-			kmdbID, err = strconv.Atoi(xKmdbID)
-			if err != nil {
-				return errors.Wrapf(err, "Bad kmedia_catalog at row %d: %s", i+1, xKmdbID)
-			}
-		}
+	data := &tagChange{
+		ref:         ref,
+		parent:      parent,
+		pattern:     pattern,
+		kmdbID:      row.Int("kmedia_catalog"),
+		description: row.Get("description"),
+		labels:      row.I18n("label"),
+	}
 
-		pattern := x[h["pattern"]]
-		description := x[h["description"]]
-
-		// Get or create tag
-		var tag *models.Tag
-		var parent *models.Tag
-		if level == 1 {
-			tag, err = models.Tags(tx,
-				qm.Where("parent_id is null and pattern = ?", pattern)).
-				One()
-		} else {
-			parent = parents[level-2]
-			tag, err = models.Tags(tx,
-				qm.Where("parent_id = ? and pattern = ?", parent.ID, pattern)).
-				One()
+	// on create all fields are new
+	current := make(map[string]string)
+	if tag != nil {
+		ref.tag = tag
+		change.Data = data
+		current["description"] = tag.Description.String
+		for _, i18n := range tag.R.TagI18ns {
+			current[i18n.Language+".label"] = i18n.Label.String
 		}
+	} else {
+		change.Action = sheet.ACTION_CREATE
+		change.Data = data
+		change.Set("pattern", "", pattern)
+	}
 
-		if err == nil {
-			// update
-			if description != "" {
-				tag.Description = null.StringFrom(description)
-				err = tag.Update(tx, "description")
-				if err != nil {
-					return errors.Wrapf(err, "Update tag %s", pattern)
-				}
-			}
-		} else {
-			if err == sql.ErrNoRows {
-				log.Infof("New pattern %s", pattern)
-				// create
-				tag = &models.Tag{
-					UID:         utils.GenerateUID(8),
-					Pattern:     null.StringFrom(pattern),
-					Description: null.NewString(description, description != ""),
-				}
-				if parent != nil {
-					tag.ParentID = null.Int64From(parent.ID)
-				}
-				err = tag.Insert(tx)
-				if err != nil {
-					return errors.Wrapf(err, "Insert tag %s", pattern)
-				}
-			} else {
-				return errors.Wrapf(err, "Fetch tag %s", pattern)
-			}
-		}
+	// empty cells keep current values
+	if data.description != "" {
+		change.Set("description", current["description"], data.description)
+	}
+	for _, l := range sortedKeys(data.labels) {
+		change.Set(l+".label", current[l+".label"], data.labels[l])
+	}
 
-		// i18n
-		for _, l := range LANGS {
-			label := x[h[l+".label"]]
-			if label == "" {
-				continue
-			}
+	return change, nil
+}
 
-			ti18n := models.TagI18n{
-				TagID:    tag.ID,
-				Language: l,
-				Label:    null.StringFrom(label),
-			}
-			err = ti18n.Upsert(tx, true,
-				[]string{"tag_id", "language"},
-				[]string{"label"})
-			if err != nil {
-				return errors.Wrapf(err, "Upsert tag [%d] i18n %s", tag.ID, l)
-			}
-		}
+func (i *TagsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*tagChange)
+	var evnt events.Event
 
-		// kmedia catalogs mappings
-		if kmdbID > 0 {
-			mappings[kmdbID] = tag.ID
+	if change.Action == sheet.ACTION_CREATE {
+		tag := &models.Tag{
+			UID:         utils.GenerateUID(8),
+			Pattern:     null.StringFrom(data.pattern),
+			Description: null.NewString(data.description, data.description != ""),
 		}
-
-		if level == len(parents)+1 {
-			parents = append(parents, tag)
-		} else {
-			parents[level-1] = tag
+		if data.parent != nil {
+			tag.ParentID = null.Int64From(data.parent.tag.ID)
 		}
+		if err := tag.Insert(exec); err != nil {
+			return nil, errors.Wrapf(err, "Insert tag %s", data.ref.path)
+		}
+		data.ref.tag = tag
+		evnt = events.TagCreateEvent(tag)
+	} else {
+		tag := data.ref.tag
+		if data.description != "" && tag.Description.String != data.description {
+			tag.Description = null.StringFrom(data.description)
+			if err := tag.Update(exec, "description"); err != nil {
+				return nil, errors.Wrapf(err, "Update tag %s", data.ref.path)
+			}
+		}
+		evnt = events.TagUpdateEvent(tag)
 	}
 
-	if err == nil {
-		err = tx.Commit()
-		if err != nil {
-			return errors.Wrap(err, "Commit transaction")
+	for l, label := range data.labels {
+		ti18n := models.TagI18n{
+			TagID:    data.ref.tag.ID,
+			Language: l,
+			Label:    null.StringFrom(label),
 		}
-	} else {
-		if ex := tx.Rollback(); ex != nil {
-			return errors.Wrap(ex, "Rollback transaction")
+		err := ti18n.Upsert(exec, true,
+			[]string{"tag_id", "language"},
+			[]string{"label"})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Upsert tag [%d] i18n %s", data.ref.tag.ID, l)
 		}
-		return err
 	}
 
-	return nil
+	// kmedia catalogs mappings
+	if data.kmdbID > 0 {
+		log.Infof("kmedia catalog %d => tag %d", data.kmdbID, data.ref.tag.ID)
+	}
+
+	return []events.Event{evnt}, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
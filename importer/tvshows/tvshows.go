@@ -1,167 +1,167 @@
 package tvshows
 
 import (
-	"database/sql"
 	"encoding/json"
-	"strings"
-	"time"
+	"fmt"
+	"sort"
 
-	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
-	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
 const (
+	IMPORTER      = "tvshows"
 	TV_SHOWS_FILE = "importer/tvshows/data/TV Shows - final.csv"
 )
 
-var (
-	LANGS = [7]string{
-		common.LANG_ENGLISH,
-		common.LANG_HEBREW,
-		common.LANG_RUSSIAN,
-		common.LANG_SPANISH,
-		common.LANG_GERMAN,
-		common.LANG_UKRAINIAN,
-		common.LANG_CHINESE,
-	}
-)
-
-func ImportTVShows() {
-	var err error
-	clock := time.Now()
-
-	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
-	//log.SetLevel(log.WarnLevel)
+var MAPPING = &sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "kmedia_id", Type: sheet.TYPE_INT, Required: true},
+		{Name: "mdb_pattern"},
+		{Name: "active", Type: sheet.TYPE_BOOL},
+		{Name: "language", Type: sheet.TYPE_LANG},
+	},
+	I18n: []string{"name"},
+}
 
-	log.Info("Starting tv shows import")
+func init() {
+	sheet.Register(&sheet.Definition{
+		Name:        IMPORTER,
+		Description: "TV shows by kmedia_id (kmedia_id, mdb_pattern, active, language, [lang].name)",
+		New:         func() sheet.Importer { return new(TVShowsImporter) },
+	})
+}
 
-	log.Info("Setting up connection to MDB")
-	mdb, err := sql.Open("postgres", viper.GetString("mdb.url"))
-	utils.Must(err)
-	utils.Must(mdb.Ping())
-	defer mdb.Close()
-	boil.SetDB(mdb)
-	//boil.DebugMode = true
+func ImportTVShows() {
+	sheet.ImportCommand(IMPORTER, TV_SHOWS_FILE, true, false, "")
+}
 
-	utils.Must(common.InitTypeRegistries(mdb))
+type showChange struct {
+	show  *models.Collection
+	props map[string]interface{}
+	names map[string]string
+}
 
-	utils.Must(handleTVShows(mdb))
+type TVShowsImporter struct{}
 
-	log.Info("Success")
-	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+func (i *TVShowsImporter) Mapping() *sheet.Mapping {
+	return MAPPING
 }
 
-func handleTVShows(db *sql.DB) error {
-	records, err := utils.ReadCSV(TV_SHOWS_FILE)
-	if err != nil {
-		return errors.Wrap(err, "Read tv shows")
-	}
+func (i *TVShowsImporter) Diff(exec boil.Executor, row *sheet.Row) (*sheet.Change, error) {
+	kmediaID := row.Get("kmedia_id")
+	change := &sheet.Change{Key: kmediaID}
 
-	h, err := utils.ParseCSVHeader(records[0])
+	ctID := common.CONTENT_TYPE_REGISTRY.ByName[common.CT_VIDEO_PROGRAM].ID
+	shows, err := models.Collections(exec,
+		qm.Where("type_id = ? AND (properties->>'kmedia_id')::int = ?", ctID, row.Int("kmedia_id")),
+		qm.Load("CollectionI18ns")).
+		All()
 	if err != nil {
-		return errors.Wrap(err, "Bad header")
+		return nil, errors.Wrapf(err, "Lookup show in db [%s]", kmediaID)
 	}
-
-	tx, err := db.Begin()
-	if err != nil {
-		return errors.Wrap(err, "Start transaction")
+	if len(shows) > 1 {
+		return change.Conflict("%d shows with this kmedia_id", len(shows)), nil
 	}
 
-	for _, x := range records[1:] {
-		if err = doTVShow(tx, h, x); err != nil {
-			break
-		}
+	data := &showChange{
+		props: make(map[string]interface{}),
+		names: row.I18n("name"),
 	}
 
-	if err == nil {
-		err = tx.Commit()
-		if err != nil {
-			return errors.Wrap(err, "Commit transaction")
+	current := make(map[string]string)
+	if len(shows) == 1 {
+		data.show = shows[0]
+		change.Data = data
+		if data.show.Properties.Valid {
+			if err := json.Unmarshal(data.show.Properties.JSON, &data.props); err != nil {
+				return change.Conflict("bad properties in show %d: %s", data.show.ID, err.Error()), nil
+			}
 		}
-	} else {
-		if ex := tx.Rollback(); ex != nil {
-			return errors.Wrap(ex, "Rollback transaction")
+		for k, v := range data.props {
+			current[k] = fmt.Sprintf("%v", v)
 		}
-		return err
+		for _, i18n := range data.show.R.CollectionI18ns {
+			current[i18n.Language+".name"] = i18n.Name.String
+		}
+	} else {
+		change.Action = sheet.ACTION_CREATE
+		change.Data = data
 	}
 
-	return nil
-}
+	data.props["kmedia_id"] = kmediaID
+	data.props["pattern"] = row.Get("mdb_pattern")
+	data.props["active"] = row.Bool("active")
+	if l := row.Lang("language"); l != "" {
+		data.props["default_language"] = l
+	}
 
-func doTVShow(exec boil.Executor, header map[string]int, record []string) error {
-	// Get or create TV Show
-	ctID := common.CONTENT_TYPE_REGISTRY.ByName[common.CT_VIDEO_PROGRAM].ID
-	show, err := models.Collections(exec,
-		qm.Where("type_id = ? AND (properties->>'kmedia_id')::int = ?", ctID, record[header["kmedia_id"]])).
-		One()
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Create
-			show = &models.Collection{
-				UID:    utils.GenerateUID(8),
-				TypeID: ctID,
-			}
-			err = show.Insert(exec)
-			if err != nil {
-				return errors.Wrapf(err, "Insert show [%s]", record)
-			}
-		} else {
-			return errors.Wrapf(err, "Lookup show in db [%s]", record)
+	for _, k := range []string{"kmedia_id", "pattern", "active", "default_language"} {
+		if v, ok := data.props[k]; ok {
+			change.Set(k, current[k], fmt.Sprintf("%v", v))
 		}
 	}
 
-	// Properties
-	var props = make(map[string]interface{})
-	if show.Properties.Valid {
-		show.Properties.Unmarshal(&props)
-	}
-	props["kmedia_id"] = record[header["kmedia_id"]]
-	props["pattern"] = record[header["mdb_pattern"]]
-	props["active"] = strings.ToLower(strings.TrimSpace(record[header["active"]])) == "v"
-	dl := record[header["language"]]
-	if dl != "" {
-		if l, ok := common.LANG_MAP[dl]; ok {
-			props["default_language"] = l
-		}
+	langs := make([]string, 0, len(data.names))
+	for l := range data.names {
+		langs = append(langs, l)
 	}
-	p, err := json.Marshal(props)
-	if err != nil {
-		return errors.Wrap(err, "Marshal show properties")
+	sort.Strings(langs)
+	for _, l := range langs {
+		change.Set(l+".name", current[l+".name"], data.names[l])
 	}
-	show.Properties = null.JSONFrom(p)
 
-	err = show.Update(exec)
+	return change, nil
+}
+
+func (i *TVShowsImporter) Apply(exec boil.Executor, change *sheet.Change) ([]events.Event, error) {
+	data := change.Data.(*showChange)
+
+	p, err := json.Marshal(data.props)
 	if err != nil {
-		return errors.Wrap(err, "Update show properties")
+		return nil, errors.Wrap(err, "Marshal show properties")
 	}
 
-	// i18n
-	for _, l := range LANGS {
-		n := record[header[l+".name"]]
-		if n == "" {
-			continue
+	var evnt events.Event
+	if change.Action == sheet.ACTION_CREATE {
+		data.show = &models.Collection{
+			UID:        utils.GenerateUID(8),
+			TypeID:     common.CONTENT_TYPE_REGISTRY.ByName[common.CT_VIDEO_PROGRAM].ID,
+			Properties: null.JSONFrom(p),
 		}
+		if err := data.show.Insert(exec); err != nil {
+			return nil, errors.Wrapf(err, "Insert show [%s]", change.Key)
+		}
+		evnt = events.CollectionCreateEvent(data.show)
+	} else {
+		data.show.Properties = null.JSONFrom(p)
+		if err := data.show.Update(exec, "properties"); err != nil {
+			return nil, errors.Wrap(err, "Update show properties")
+		}
+		evnt = events.CollectionUpdateEvent(data.show)
+	}
 
+	for l, n := range data.names {
 		ci18n := models.CollectionI18n{
-			CollectionID: show.ID,
+			CollectionID: data.show.ID,
 			Language:     l,
-			Name:         null.NewString(n, n != ""),
+			Name:         null.StringFrom(n),
 		}
 		err = ci18n.Upsert(exec, true,
 			[]string{"collection_id", "language"},
 			[]string{"name"})
 		if err != nil {
-			return errors.Wrapf(err, "Upsert show i18n")
+			return nil, errors.Wrapf(err, "Upsert show i18n")
 		}
 	}
 
-	return nil
+	return []events.Event{evnt}, nil
 }
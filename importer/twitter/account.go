@@ -14,10 +14,12 @@ import (
 	"github.com/ChimeraCoder/anaconda"
 	log "github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"gopkg.in/volatiletech/null.v6"
 
 	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/social"
 	"github.com/Bnei-Baruch/mdb/utils"
 )
 
@@ -89,6 +91,9 @@ func saveTweetToDB(t *anaconda.Tweet, user *models.TwitterUser) error {
 	}
 
 	err = mt.Upsert(tx, true, []string{"twitter_id"}, []string{"full_text", "tweet_at", "raw"})
+	if err == nil {
+		err = saveSocialPost(tx, &mt, user, t.Lang)
+	}
 	if err != nil {
 		utils.Must(tx.Rollback())
 		return errors.Wrapf(err, "Upsert to DB")
@@ -99,6 +104,30 @@ func saveTweetToDB(t *anaconda.Tweet, user *models.TwitterUser) error {
 	return nil
 }
 
+// saveSocialPost mirrors a tweet to the platform neutral social posts archive
+func saveSocialPost(exec boil.Executor, mt *models.TwitterTweet, user *models.TwitterUser, lang string) error {
+	account, err := social.EnsureAccount(exec, &social.Account{
+		Platform:    social.PLATFORM_TWITTER,
+		AccountID:   user.AccountID,
+		Username:    null.StringFrom(user.Username),
+		DisplayName: null.StringFrom(user.DisplayName),
+	})
+	if err != nil {
+		return errors.Wrap(err, "social.EnsureAccount")
+	}
+
+	language := social.NormalizeLanguage(lang)
+	return social.UpsertPost(exec, &social.Post{
+		AccountID: account.ID,
+		PostID:    mt.TwitterID,
+		Text:      mt.FullText,
+		Language:  null.NewString(language, language != ""),
+		Link:      null.StringFrom(social.TweetLink(user.Username, mt.TwitterID)),
+		PostedAt:  mt.TweetAt,
+		Raw:       mt.Raw,
+	})
+}
+
 func Analyze() {
 	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
 
@@ -18,15 +18,22 @@ import (
 )
 
 func ImportLatestTweets() {
-	clock, emitter := Init()
+	clock := time.Now()
 
-	utils.Must(importLatestTweets(emitter))
+	utils.Must(LatestTweets())
 
-	Shutdown()
 	log.Info("Success")
 	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
 }
 
+// LatestTweets imports new tweets of registered accounts, it runs as the import_twitter scheduler task
+func LatestTweets() error {
+	_, emitter := Init()
+	defer Shutdown()
+
+	return importLatestTweets(emitter)
+}
+
 func importLatestTweets(emitter *events.BufferedEmitter) error {
 	// initialize twitter api
 	accessToken := viper.GetString("twitter.access-token")
@@ -1,32 +1,22 @@
 package importer
 
 import (
-	"fmt"
-	"regexp"
 	"strings"
 
-	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/naming"
 )
 
-var LANG_RE *regexp.Regexp
-var OT_RE = regexp.MustCompile("(?i)^[ot]$")
-var RAV_NORAV_RE = regexp.MustCompile("(?i)^(rav|norav)$")
-var BITRATE_RE = regexp.MustCompile("(?i)^(24k|96k|128k|hd)$")
-var FILMDATE_RE = regexp.MustCompile("^((19|20)\\d\\d)-(0?[1-9]|1[012])-(0?[1-9]|[12][0-9]|3[01])$") // YYYY-MM-DD
-
-func init() {
-	i := 0
-	keys := make([]string, len(common.LANG_MAP)-1)
-	for k := range common.LANG_MAP {
-		if k == "" {
-			continue
-		}
-		keys[i] = k
-		i++
-	}
-	LANG_RE = regexp.MustCompile(fmt.Sprintf("(?i)^(%s)$", strings.Join(keys, "|")))
-}
+// Token patterns of the file naming convention, see naming package
+var (
+	LANG_RE      = naming.LANG_RE
+	OT_RE        = naming.OT_RE
+	RAV_NORAV_RE = naming.RAV_NORAV_RE
+	BITRATE_RE   = naming.BITRATE_RE
+	FILMDATE_RE  = naming.DATE_RE
+)
 
+// Line is a lenient parse of a (possibly legacy) file name: any token matching a known pattern is taken.
+// Use naming.Parse to validate names against the convention.
 type Line struct {
 	Language string
 	OT string
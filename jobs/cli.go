@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/events"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func openDB() *sql.DB {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	utils.Must(common.InitTypeRegistries(db))
+	return db
+}
+
+// initEmitter sets up the configured event handlers, call the returned func to flush and close them
+func initEmitter() (events.EventEmitter, func()) {
+	emitter, err := events.InitEmitter()
+	utils.Must(err)
+	return emitter, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		events.CloseEmitter(ctx)
+	}
+}
+
+// RunCommand creates a job and executes it in the foreground
+func RunCommand(jobType, params string) {
+	db := openDB()
+	defer db.Close()
+
+	var raw json.RawMessage
+	if params != "" {
+		raw = json.RawMessage(params)
+	}
+	job, err := Create(db, jobType, raw)
+	utils.Must(err)
+
+	emitter, closeEmitter := initEmitter()
+	defer closeEmitter()
+
+	log.Infof("Created job %d [%s]", job.ID, job.Type)
+	utils.Must(Execute(db, emitter, job.ID, false))
+}
+
+// ResumeCommand executes a failed job from its last checkpoint.
+// With force, a job left running by a crashed process is taken over.
+func ResumeCommand(id int64, force bool) {
+	db := openDB()
+	defer db.Close()
+
+	emitter, closeEmitter := initEmitter()
+	defer closeEmitter()
+
+	utils.Must(Execute(db, emitter, id, force))
+}
+
+func ListCommand(status, jobType string, limit int) {
+	db := openDB()
+	defer db.Close()
+
+	_, jobs, err := FindJobs(db, status, jobType, limit, 0)
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tPROGRESS\tCREATED")
+	for _, job := range jobs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d/%d (%d failed)\t%s\n",
+			job.ID, job.Type, job.Status, job.Done, job.Total, job.Failed, job.CreatedAt.Format(time.RFC3339))
+	}
+	utils.Must(w.Flush())
+}
+
+func ShowCommand(id int64) {
+	db := openDB()
+	defer db.Close()
+
+	job, err := FindJob(db, id)
+	utils.Must(err)
+	b, err := json.MarshalIndent(job, "", "  ")
+	utils.Must(err)
+	fmt.Println(string(b))
+
+	var after int64
+	for {
+		logs, err := FindJobLogs(db, id, after, 1000)
+		utils.Must(err)
+		for _, l := range logs {
+			fmt.Printf("%s\t%s\t%s\n", l.CreatedAt.Format(time.RFC3339), l.Level, l.Message)
+			after = l.ID
+		}
+		if len(logs) < 1000 {
+			break
+		}
+	}
+}
+
+func TypesCommand() {
+	b, err := json.MarshalIndent(Definitions(), "", "  ")
+	utils.Must(err)
+	fmt.Println(string(b))
+}
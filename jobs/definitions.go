@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+// Definition is a type of job.
+//
+// Params, if set, returns a pointer to a new params struct of this job type.
+// It's used to validate params on job creation and to describe the job type.
+// Params structs may implement Validate() error for further validation.
+type Definition struct {
+	Type        string
+	Description string
+	Params      func() interface{}
+	Run         func(ctx *Context) error
+}
+
+type ParamsValidator interface {
+	Validate() error
+}
+
+var (
+	registry   = make(map[string]*Definition)
+	registryMu sync.RWMutex
+)
+
+// Register makes a job type available. It panics on duplicate types, like http.Handle.
+func Register(def *Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.Type == "" || def.Run == nil {
+		panic("jobs: definition must have a type and a run function")
+	}
+	if _, ok := registry[def.Type]; ok {
+		panic("jobs: duplicate definition " + def.Type)
+	}
+	registry[def.Type] = def
+}
+
+func Lookup(jobType string) (*Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[jobType]
+	return def, ok
+}
+
+// Definitions returns all registered job types sorted by type
+func Definitions() []*Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]*Definition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Type < defs[j].Type
+	})
+	return defs
+}
+
+// DecodeParams decodes job params into a new params struct of this definition.
+// Unknown fields are an error. Returns nil if the definition takes no params.
+func (d *Definition) DecodeParams(params null.JSON) (interface{}, error) {
+	if d.Params == nil {
+		if params.Valid {
+			return nil, errors.Errorf("Job type %s takes no params", d.Type)
+		}
+		return nil, nil
+	}
+
+	v := d.Params()
+	if params.Valid {
+		dec := json.NewDecoder(bytes.NewReader(params.JSON))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(v); err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s params", d.Type)
+		}
+	}
+
+	if validator, ok := v.(ParamsValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s params", d.Type)
+		}
+	}
+
+	return v, nil
+}
+
+func (d *Definition) ValidateParams(params null.JSON) error {
+	_, err := d.DecodeParams(params)
+	return err
+}
+
+// MarshalJSON describes the definition with a sample of its (zero valued) params
+func (d *Definition) MarshalJSON() ([]byte, error) {
+	var params interface{}
+	if d.Params != nil {
+		params = d.Params()
+	}
+	return json.Marshal(map[string]interface{}{
+		"type":        d.Type,
+		"description": d.Description,
+		"params":      params,
+	})
+}
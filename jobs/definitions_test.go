@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+type testParams struct {
+	IDs []int64 `json:"ids"`
+}
+
+func (p *testParams) Validate() error {
+	if len(p.IDs) == 0 {
+		return errors.New("ids is required")
+	}
+	return nil
+}
+
+func TestDefinitionDecodeParams(t *testing.T) {
+	def := &Definition{
+		Type:   "test_decode",
+		Params: func() interface{} { return new(testParams) },
+		Run:    func(ctx *Context) error { return nil },
+	}
+
+	v, err := def.DecodeParams(null.JSONFrom([]byte(`{"ids": [1, 2]}`)))
+	if assert.Nil(t, err) {
+		assert.Equal(t, []int64{1, 2}, v.(*testParams).IDs)
+	}
+
+	_, err = def.DecodeParams(null.JSONFrom([]byte(`{"ids": [1], "other": true}`)))
+	assert.NotNil(t, err, "unknown field")
+
+	_, err = def.DecodeParams(null.JSON{})
+	assert.NotNil(t, err, "validation")
+
+	noParams := &Definition{Type: "test_no_params", Run: def.Run}
+	v, err = noParams.DecodeParams(null.JSON{})
+	assert.Nil(t, err)
+	assert.Nil(t, v)
+	_, err = noParams.DecodeParams(null.JSONFrom([]byte(`{}`)))
+	assert.NotNil(t, err, "params for no params definition")
+}
+
+func TestRegister(t *testing.T) {
+	def := &Definition{
+		Type:        "test_register",
+		Description: "for tests",
+		Params:      func() interface{} { return new(testParams) },
+		Run:         func(ctx *Context) error { return nil },
+	}
+	Register(def)
+
+	found, ok := Lookup("test_register")
+	assert.True(t, ok)
+	assert.Equal(t, def, found)
+	assert.Contains(t, Definitions(), def)
+
+	assert.Panics(t, func() { Register(def) }, "duplicate")
+	assert.Panics(t, func() { Register(&Definition{Type: "test_no_run"}) }, "no run")
+
+	b, err := json.Marshal(def)
+	if assert.Nil(t, err) {
+		assert.JSONEq(t, `{"type": "test_register", "description": "for tests", "params": {"ids": null}}`, string(b))
+	}
+}
@@ -0,0 +1,213 @@
+// Package jobs runs long batch tasks as persistent jobs.
+//
+// A job is an instance of a registered Definition with its own parameters.
+// While running, a job keeps progress counters, an optional checkpoint
+// to resume from after failure and a log. All of these are persisted in the
+// jobs and job_logs tables so they can be followed from the CLI or the API.
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	STATUS_PENDING   = "pending"
+	STATUS_RUNNING   = "running"
+	STATUS_SUCCEEDED = "succeeded"
+	STATUS_FAILED    = "failed"
+)
+
+var STATUSES = []string{STATUS_PENDING, STATUS_RUNNING, STATUS_SUCCEEDED, STATUS_FAILED}
+
+const (
+	LOG_INFO  = "info"
+	LOG_WARN  = "warn"
+	LOG_ERROR = "error"
+)
+
+type Job struct {
+	ID         int64       `boil:"id" json:"id"`
+	Type       string      `boil:"type" json:"type"`
+	Status     string      `boil:"status" json:"status"`
+	Params     null.JSON   `boil:"params" json:"params"`
+	Total      int64       `boil:"progress_total" json:"progress_total"`
+	Done       int64       `boil:"progress_done" json:"progress_done"`
+	Failed     int64       `boil:"progress_failed" json:"progress_failed"`
+	Checkpoint null.JSON   `boil:"checkpoint" json:"checkpoint"`
+	Error      null.String `boil:"error" json:"error"`
+	CreatedAt  time.Time   `boil:"created_at" json:"created_at"`
+	StartedAt  null.Time   `boil:"started_at" json:"started_at"`
+	FinishedAt null.Time   `boil:"finished_at" json:"finished_at"`
+	UpdatedAt  time.Time   `boil:"updated_at" json:"updated_at"`
+}
+
+type LogEntry struct {
+	ID        int64     `boil:"id" json:"id"`
+	JobID     int64     `boil:"job_id" json:"job_id"`
+	Level     string    `boil:"level" json:"level"`
+	Message   string    `boil:"message" json:"message"`
+	CreatedAt time.Time `boil:"created_at" json:"created_at"`
+}
+
+type JobNotFound struct {
+	ID int64
+}
+
+func (e JobNotFound) Error() string {
+	return fmt.Sprintf("job not found, id = %d", e.ID)
+}
+
+type JobNotClaimable struct {
+	ID     int64
+	Status string
+}
+
+func (e JobNotClaimable) Error() string {
+	return fmt.Sprintf("job %d is %s", e.ID, e.Status)
+}
+
+// Create validates the params against the job type's definition and saves a new pending job.
+func Create(exec boil.Executor, jobType string, params json.RawMessage) (*Job, error) {
+	def, ok := Lookup(jobType)
+	if !ok {
+		return nil, errors.Errorf("Unknown job type %s", jobType)
+	}
+
+	job := &Job{
+		Type:   jobType,
+		Status: STATUS_PENDING,
+	}
+	if len(params) > 0 && string(params) != "null" {
+		job.Params = null.JSONFrom(params)
+	}
+	if err := def.ValidateParams(job.Params); err != nil {
+		return nil, err
+	}
+
+	err := queries.Raw(exec,
+		`INSERT INTO jobs (type, status, params) VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`,
+		job.Type, job.Status, job.Params).
+		QueryRow().
+		Scan(&job.ID, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert job")
+	}
+
+	return job, nil
+}
+
+func FindJob(exec boil.Executor, id int64) (*Job, error) {
+	var job Job
+	err := queries.Raw(exec, `SELECT * FROM jobs WHERE id = $1`, id).Bind(&job)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, JobNotFound{ID: id}
+		}
+		return nil, errors.Wrap(err, "Load job")
+	}
+	return &job, nil
+}
+
+// FindJobs returns jobs by optional status and type, newest first, and their total count.
+func FindJobs(exec boil.Executor, status, jobType string, limit, offset int) (int64, []*Job, error) {
+	where := `($1 = '' OR status = $1) AND ($2 = '' OR type = $2)`
+
+	var total int64
+	err := queries.Raw(exec, `SELECT count(*) FROM jobs WHERE `+where, status, jobType).
+		QueryRow().
+		Scan(&total)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Count jobs")
+	}
+
+	jobs := make([]*Job, 0)
+	if total == 0 {
+		return 0, jobs, nil
+	}
+
+	err = queries.Raw(exec,
+		`SELECT * FROM jobs WHERE `+where+` ORDER BY id DESC LIMIT $3 OFFSET $4`,
+		status, jobType, limit, offset).
+		Bind(&jobs)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Load jobs")
+	}
+
+	return total, jobs, nil
+}
+
+// FindJobLogs returns a job's log entries after the given entry id, oldest first.
+func FindJobLogs(exec boil.Executor, jobID, afterID int64, limit int) ([]*LogEntry, error) {
+	logs := make([]*LogEntry, 0)
+	err := queries.Raw(exec,
+		`SELECT * FROM job_logs WHERE job_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		jobID, afterID, limit).
+		Bind(&logs)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Load job logs")
+	}
+	return logs, nil
+}
+
+func insertLog(exec boil.Executor, jobID int64, level, message string) error {
+	_, err := queries.Raw(exec,
+		`INSERT INTO job_logs (job_id, level, message) VALUES ($1, $2, $3)`,
+		jobID, level, message).
+		Exec()
+	return errors.Wrap(err, "Insert job log")
+}
+
+// claim moves a job to running if it's in one of the given statuses.
+// Returns false if the job is not claimable (e.g. somebody else is running it).
+// Jobs without a checkpoint run from scratch, so their progress counters are reset.
+func claim(exec boil.Executor, job *Job, from []string) (bool, error) {
+	err := queries.Raw(exec,
+		`UPDATE jobs SET status = $1, error = NULL, finished_at = NULL,
+		 progress_done = CASE WHEN checkpoint IS NULL THEN 0 ELSE progress_done END,
+		 progress_failed = CASE WHEN checkpoint IS NULL THEN 0 ELSE progress_failed END,
+		 started_at = COALESCE(started_at, now_utc()), updated_at = now_utc()
+		 WHERE id = $2 AND status = ANY($3) RETURNING *`,
+		STATUS_RUNNING, job.ID, pq.Array(from)).
+		Bind(job)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Claim job")
+	}
+	return true, nil
+}
+
+func saveProgress(exec boil.Executor, job *Job) error {
+	_, err := queries.Raw(exec,
+		`UPDATE jobs SET progress_total = $1, progress_done = $2, progress_failed = $3, checkpoint = $4,
+		 updated_at = now_utc() WHERE id = $5`,
+		job.Total, job.Done, job.Failed, job.Checkpoint, job.ID).
+		Exec()
+	return errors.Wrap(err, "Save job progress")
+}
+
+func finish(exec boil.Executor, job *Job, runErr error) error {
+	job.Status = STATUS_SUCCEEDED
+	job.Error = null.String{}
+	if runErr != nil {
+		job.Status = STATUS_FAILED
+		job.Error = null.StringFrom(runErr.Error())
+	}
+
+	_, err := queries.Raw(exec,
+		`UPDATE jobs SET status = $1, error = $2, progress_total = $3, progress_done = $4, progress_failed = $5,
+		 checkpoint = $6, finished_at = now_utc(), updated_at = now_utc() WHERE id = $7`,
+		job.Status, job.Error, job.Total, job.Done, job.Failed, job.Checkpoint, job.ID).
+		Exec()
+	return errors.Wrap(err, "Finish job")
+}
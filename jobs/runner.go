@@ -0,0 +1,237 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/events"
+)
+
+// Progress counters are saved at most once in this interval, checkpoints are saved immediately.
+const PROGRESS_FLUSH_INTERVAL = 5 * time.Second
+
+// Context is what a running job gets from the framework
+type Context struct {
+	DB      *sql.DB
+	Job     *Job
+	Emitter events.EventEmitter
+
+	params    interface{}
+	mu        sync.Mutex
+	lastFlush time.Time
+}
+
+// Params returns the decoded params struct of the job (as returned by Definition.Params)
+func (ctx *Context) Params() interface{} {
+	return ctx.params
+}
+
+func (ctx *Context) SetTotal(total int64) error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.Job.Total = total
+	return ctx.flush(true)
+}
+
+// Progress adds to the done and failed counters. Safe for concurrent use by workers.
+func (ctx *Context) Progress(done, failed int64) error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.Job.Done += done
+	ctx.Job.Failed += failed
+	return ctx.flush(false)
+}
+
+// Checkpoint saves v (marshalled to json) along with current progress.
+// A resumed job gets it back from LoadCheckpoint.
+func (ctx *Context) Checkpoint(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal checkpoint")
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.Job.Checkpoint = null.JSONFrom(b)
+	return ctx.flush(true)
+}
+
+// LoadCheckpoint unmarshals the last saved checkpoint into v.
+// Returns false if there is none, i.e. the job is not resumed.
+func (ctx *Context) LoadCheckpoint(v interface{}) (bool, error) {
+	if !ctx.Job.Checkpoint.Valid {
+		return false, nil
+	}
+	if err := json.Unmarshal(ctx.Job.Checkpoint.JSON, v); err != nil {
+		return false, errors.Wrap(err, "json.Unmarshal checkpoint")
+	}
+	return true, nil
+}
+
+func (ctx *Context) Infof(format string, args ...interface{}) {
+	ctx.logf(LOG_INFO, format, args...)
+}
+
+func (ctx *Context) Warnf(format string, args ...interface{}) {
+	ctx.logf(LOG_WARN, format, args...)
+}
+
+func (ctx *Context) Errorf(format string, args ...interface{}) {
+	ctx.logf(LOG_ERROR, format, args...)
+}
+
+func (ctx *Context) logf(level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	entry := log.WithFields(log.Fields{"job": ctx.Job.ID, "type": ctx.Job.Type})
+	switch level {
+	case LOG_ERROR:
+		entry.Error(msg)
+	case LOG_WARN:
+		entry.Warn(msg)
+	default:
+		entry.Info(msg)
+	}
+
+	if err := insertLog(ctx.DB, ctx.Job.ID, level, msg); err != nil {
+		entry.Errorf("Save job log: %s", err.Error())
+	}
+}
+
+// flush must be called with ctx.mu held
+func (ctx *Context) flush(force bool) error {
+	if !force && time.Since(ctx.lastFlush) < PROGRESS_FLUSH_INTERVAL {
+		return nil
+	}
+	ctx.lastFlush = time.Now()
+	return saveProgress(ctx.DB, ctx.Job)
+}
+
+// Start creates a new job and runs it in the background
+func Start(db *sql.DB, emitter events.EventEmitter, jobType string, params json.RawMessage) (*Job, error) {
+	job, err := Create(db, jobType, params)
+	if err != nil {
+		return nil, err
+	}
+	return Resume(db, emitter, job.ID, false)
+}
+
+// Resume claims a pending or failed job and runs it in the background.
+// The returned job is already running.
+func Resume(db *sql.DB, emitter events.EventEmitter, id int64, force bool) (*Job, error) {
+	def, ctx, err := prepare(db, emitter, id, force)
+	if err != nil {
+		return nil, err
+	}
+
+	job := *ctx.Job
+	go func() {
+		if err := ctx.execute(def); err != nil {
+			log.Errorf("Job %d [%s]: %s", job.ID, job.Type, err.Error())
+		}
+	}()
+
+	return &job, nil
+}
+
+// Execute runs a pending job, or resumes a failed one, to completion.
+// A job left running by a crashed process may be taken over with force.
+// The returned error is the job's error, if any.
+func Execute(db *sql.DB, emitter events.EventEmitter, id int64, force bool) error {
+	def, ctx, err := prepare(db, emitter, id, force)
+	if err != nil {
+		return err
+	}
+	return ctx.execute(def)
+}
+
+// prepare claims a job for running. A nil emitter drops the job's events.
+func prepare(db *sql.DB, emitter events.EventEmitter, id int64, force bool) (*Definition, *Context, error) {
+	job, err := FindJob(db, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	def, ok := Lookup(job.Type)
+	if !ok {
+		return nil, nil, errors.Errorf("Unknown job type %s", job.Type)
+	}
+
+	params, err := def.DecodeParams(job.Params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	from := []string{STATUS_PENDING, STATUS_FAILED}
+	if force {
+		from = append(from, STATUS_RUNNING)
+	}
+	ok, err = claim(db, job, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, JobNotClaimable{ID: job.ID, Status: job.Status}
+	}
+
+	if emitter == nil {
+		emitter = new(events.NoopEmitter)
+	}
+
+	ctx := &Context{
+		DB:        db,
+		Job:       job,
+		Emitter:   emitter,
+		params:    params,
+		lastFlush: time.Now(),
+	}
+	return def, ctx, nil
+}
+
+func (ctx *Context) execute(def *Definition) error {
+	if ctx.Job.Checkpoint.Valid {
+		ctx.Infof("Resuming from checkpoint %s", string(ctx.Job.Checkpoint.JSON))
+	} else {
+		ctx.Infof("Starting")
+	}
+
+	clock := time.Now()
+	runErr := run(def, ctx)
+	if runErr != nil {
+		ctx.Errorf("Failed after %s: %s", time.Since(clock).String(), runErr.Error())
+	} else {
+		ctx.Infof("Succeeded after %s", time.Since(clock).String())
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if err := finish(ctx.DB, ctx.Job, runErr); err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+// run calls the job's run function turning panics (e.g. utils.Must) into errors
+func run(def *Definition, ctx *Context) (err error) {
+	defer func() {
+		if rval := recover(); rval != nil {
+			log.Errorf("Job %d panic: %v\n%s", ctx.Job.ID, rval, debug.Stack())
+			if e, ok := rval.(error); ok {
+				err = errors.Wrap(e, "panic")
+			} else {
+				err = errors.Errorf("panic: %v", rval)
+			}
+		}
+	}()
+
+	return def.Run(ctx)
+}
@@ -0,0 +1,28 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS capture_sessions;
+CREATE TABLE capture_sessions (
+  id                 BIGSERIAL PRIMARY KEY,
+  workflow_id        VARCHAR(255)                                     NULL,
+  capture_source     VARCHAR(255)                                     NULL,
+  collection_uid     VARCHAR(255)                                     NULL,
+  start_operation_id BIGINT REFERENCES operations ON DELETE CASCADE   NULL,
+  stop_operation_id  BIGINT REFERENCES operations ON DELETE CASCADE   NULL,
+  started_at         TIMESTAMP WITH TIME ZONE                         NULL,
+  stopped_at         TIMESTAMP WITH TIME ZONE                         NULL,
+  alerted_at         TIMESTAMP WITH TIME ZONE                         NULL
+);
+
+CREATE INDEX IF NOT EXISTS capture_sessions_workflow_id_idx
+  ON capture_sessions USING BTREE (workflow_id);
+
+CREATE INDEX IF NOT EXISTS capture_sessions_open_idx
+  ON capture_sessions USING BTREE (capture_source, collection_uid)
+  WHERE stopped_at IS NULL;
+
+-- rambler down
+
+DROP INDEX IF EXISTS capture_sessions_open_idx;
+DROP INDEX IF EXISTS capture_sessions_workflow_id_idx;
+DROP TABLE IF EXISTS capture_sessions;
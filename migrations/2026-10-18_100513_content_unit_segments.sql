@@ -0,0 +1,32 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS content_unit_segments;
+CREATE TABLE content_unit_segments (
+  id              BIGSERIAL PRIMARY KEY,
+  content_unit_id BIGINT REFERENCES content_units               NOT NULL,
+  start_time      DOUBLE PRECISION                              NOT NULL,
+  end_time        DOUBLE PRECISION                              NOT NULL,
+  source_id       BIGINT REFERENCES sources                     NULL,
+  tag_id          BIGINT REFERENCES tags                        NULL,
+  created_at      TIMESTAMP WITH TIME ZONE DEFAULT now_utc()    NOT NULL,
+  CHECK (start_time >= 0 AND end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS content_unit_segments_content_unit_id_idx
+  ON content_unit_segments USING BTREE (content_unit_id);
+
+DROP TABLE IF EXISTS content_unit_segment_i18n;
+CREATE TABLE content_unit_segment_i18n (
+  segment_id BIGINT REFERENCES content_unit_segments ON DELETE CASCADE NOT NULL,
+  language   CHAR(2)                                                   NOT NULL,
+  title      TEXT                                                      NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc()                NOT NULL,
+  PRIMARY KEY (segment_id, language)
+);
+
+-- rambler down
+
+DROP TABLE IF EXISTS content_unit_segment_i18n;
+DROP INDEX IF EXISTS content_unit_segments_content_unit_id_idx;
+DROP TABLE IF EXISTS content_unit_segments;
@@ -0,0 +1,16 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS file_hashes;
+CREATE TABLE file_hashes (
+  file_id    BIGINT REFERENCES files ON DELETE CASCADE NOT NULL,
+  algo       VARCHAR(16)                               NOT NULL,
+  hash       BYTEA                                     NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  PRIMARY KEY (file_id, algo),
+  UNIQUE (algo, hash)
+);
+
+-- rambler down
+
+DROP TABLE IF EXISTS file_hashes;
@@ -0,0 +1,26 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS storage_import_runs;
+CREATE TABLE storage_import_runs (
+  id              BIGSERIAL PRIMARY KEY,
+  provider        VARCHAR(16)                                NOT NULL,
+  mode            VARCHAR(16)                                NOT NULL,
+  status          VARCHAR(16)                                NOT NULL,
+  catalog_path    TEXT                                       NULL,
+  base_run_id     BIGINT REFERENCES storage_import_runs      NULL,
+  lines_total     BIGINT DEFAULT 0                           NOT NULL,
+  files_processed BIGINT DEFAULT 0                           NOT NULL,
+  files_cleared   BIGINT DEFAULT 0                           NOT NULL,
+  error           TEXT                                       NULL,
+  started_at      TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  finished_at     TIMESTAMP WITH TIME ZONE                   NULL
+);
+
+CREATE INDEX IF NOT EXISTS storage_import_runs_started_at_idx
+  ON storage_import_runs USING BTREE (started_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS storage_import_runs_started_at_idx;
+DROP TABLE IF EXISTS storage_import_runs;
@@ -0,0 +1,19 @@
+-- MDB generated migration file
+-- rambler up
+
+ALTER TABLE files_storages
+  ADD COLUMN verified_at   TIMESTAMP WITH TIME ZONE NULL,
+  ADD COLUMN verified_sha1 BYTEA                    NULL,
+  ADD COLUMN fixity_status VARCHAR(16)              NULL;
+
+CREATE INDEX IF NOT EXISTS files_storages_verified_at_idx
+  ON files_storages USING BTREE (verified_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS files_storages_verified_at_idx;
+
+ALTER TABLE files_storages
+  DROP COLUMN IF EXISTS verified_at,
+  DROP COLUMN IF EXISTS verified_sha1,
+  DROP COLUMN IF EXISTS fixity_status;
@@ -0,0 +1,45 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS jobs;
+CREATE TABLE jobs (
+  id              BIGSERIAL PRIMARY KEY,
+  type            VARCHAR(64)                                NOT NULL,
+  status          VARCHAR(16)                                NOT NULL,
+  params          JSONB                                      NULL,
+  progress_total  BIGINT DEFAULT 0                           NOT NULL,
+  progress_done   BIGINT DEFAULT 0                           NOT NULL,
+  progress_failed BIGINT DEFAULT 0                           NOT NULL,
+  checkpoint      JSONB                                      NULL,
+  error           TEXT                                       NULL,
+  created_at      TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  started_at      TIMESTAMP WITH TIME ZONE                   NULL,
+  finished_at     TIMESTAMP WITH TIME ZONE                   NULL,
+  updated_at      TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_type_idx
+  ON jobs USING BTREE (type);
+
+CREATE INDEX IF NOT EXISTS jobs_status_idx
+  ON jobs USING BTREE (status);
+
+DROP TABLE IF EXISTS job_logs;
+CREATE TABLE job_logs (
+  id         BIGSERIAL PRIMARY KEY,
+  job_id     BIGINT REFERENCES jobs ON DELETE CASCADE   NOT NULL,
+  level      VARCHAR(8)                                 NOT NULL,
+  message    TEXT                                       NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS job_logs_job_id_idx
+  ON job_logs USING BTREE (job_id);
+
+-- rambler down
+
+DROP INDEX IF EXISTS job_logs_job_id_idx;
+DROP TABLE IF EXISTS job_logs;
+DROP INDEX IF EXISTS jobs_status_idx;
+DROP INDEX IF EXISTS jobs_type_idx;
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,52 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS transcode_queue;
+CREATE TABLE transcode_queue (
+  id               BIGSERIAL PRIMARY KEY,
+  file_id          BIGINT REFERENCES files ON DELETE CASCADE  NOT NULL UNIQUE,
+  format           VARCHAR(16) DEFAULT 'mp4'                  NOT NULL,
+  priority         INT DEFAULT 0                              NOT NULL,
+  status           VARCHAR(16) DEFAULT 'queued'               NOT NULL,
+  attempts         INT DEFAULT 0                              NOT NULL,
+  max_attempts     INT DEFAULT 5                              NOT NULL,
+  next_attempt_at  TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  lease_owner      VARCHAR(255)                               NULL,
+  lease_expires_at TIMESTAMP WITH TIME ZONE                   NULL,
+  operation_id     BIGINT REFERENCES operations               NULL,
+  last_error       TEXT                                       NULL,
+  created_at       TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  updated_at       TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transcode_queue_next_idx
+  ON transcode_queue USING BTREE (status, priority DESC, next_attempt_at);
+
+-- carry over the ad-hoc batch_convert queue, if any
+DO $$
+BEGIN
+  IF to_regclass('batch_convert') IS NOT NULL
+  THEN
+    INSERT INTO transcode_queue (file_id, status, attempts, lease_owner, lease_expires_at, operation_id, last_error)
+      SELECT DISTINCT ON (file_id)
+        file_id,
+        CASE WHEN operation_id IS NOT NULL AND request_error IS NULL THEN 'done'
+             WHEN request_error IS NOT NULL THEN 'failed'
+             WHEN request_at IS NOT NULL THEN 'leased'
+             ELSE 'queued' END,
+        CASE WHEN request_at IS NULL THEN 0 ELSE 1 END,
+        CASE WHEN request_at IS NOT NULL AND operation_id IS NULL AND request_error IS NULL THEN 'batch_convert' END,
+        CASE WHEN request_at IS NOT NULL AND operation_id IS NULL AND request_error IS NULL THEN now_utc() + INTERVAL '1 day' END,
+        operation_id,
+        request_error
+      FROM batch_convert
+      ORDER BY file_id, request_at DESC NULLS LAST
+    ON CONFLICT (file_id) DO NOTHING;
+  END IF;
+END
+$$;
+
+-- rambler down
+
+DROP INDEX IF EXISTS transcode_queue_next_idx;
+DROP TABLE IF EXISTS transcode_queue;
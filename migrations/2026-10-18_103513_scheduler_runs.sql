@@ -0,0 +1,21 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS scheduler_runs;
+CREATE TABLE scheduler_runs (
+  id          BIGSERIAL PRIMARY KEY,
+  task        VARCHAR(64)                                NOT NULL,
+  status      VARCHAR(16)                                NOT NULL,
+  host        VARCHAR(255)                               NULL,
+  error       TEXT                                       NULL,
+  started_at  TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  finished_at TIMESTAMP WITH TIME ZONE                   NULL
+);
+
+CREATE INDEX IF NOT EXISTS scheduler_runs_task_started_at_idx
+  ON scheduler_runs USING BTREE (task, started_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS scheduler_runs_task_started_at_idx;
+DROP TABLE IF EXISTS scheduler_runs;
@@ -0,0 +1,26 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS sheet_imports;
+CREATE TABLE sheet_imports (
+  id         BIGSERIAL PRIMARY KEY,
+  importer   VARCHAR(64)                                NOT NULL,
+  file       VARCHAR(1024)                              NOT NULL,
+  sha1       BYTEA                                      NOT NULL,
+  "user"     VARCHAR(255)                               NULL,
+  created    INT                                        NOT NULL,
+  updated    INT                                        NOT NULL,
+  unchanged  INT                                        NOT NULL,
+  conflicts  INT                                        NOT NULL,
+  errors     INT                                        NOT NULL,
+  changes    JSONB                                      NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sheet_imports_importer_created_at_idx
+  ON sheet_imports USING BTREE (importer, created_at);
+
+-- rambler down
+
+DROP INDEX IF EXISTS sheet_imports_importer_created_at_idx;
+DROP TABLE IF EXISTS sheet_imports;
@@ -0,0 +1,56 @@
+-- MDB generated migration file
+-- rambler up
+
+CREATE TABLE social_accounts (
+  id           BIGSERIAL PRIMARY KEY,
+  platform     VARCHAR(16)                                NOT NULL,
+  account_id   VARCHAR(64)                                NOT NULL,
+  username     VARCHAR(64)                                NULL,
+  display_name VARCHAR(255)                               NULL,
+  language     CHAR(2)                                    NULL,
+  created_at   TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  UNIQUE (platform, account_id)
+);
+
+CREATE TABLE social_posts (
+  id         BIGSERIAL PRIMARY KEY,
+  account_id BIGINT REFERENCES social_accounts (id)      NOT NULL,
+  post_id    VARCHAR(64)                                NOT NULL,
+  text       TEXT                                       NOT NULL,
+  language   CHAR(2)                                    NULL,
+  link       VARCHAR(255)                               NULL,
+  posted_at  TIMESTAMP WITH TIME ZONE                   NOT NULL,
+  raw        JSONB                                      NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL,
+  UNIQUE (account_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS social_posts_posted_at_idx
+  ON social_posts USING BTREE (posted_at);
+
+CREATE INDEX IF NOT EXISTS social_posts_language_idx
+  ON social_posts USING BTREE (language);
+
+-- carry over existing tweets
+INSERT INTO social_accounts (platform, account_id, username, display_name)
+  SELECT 'twitter', account_id, username, display_name
+  FROM twitter_users;
+
+INSERT INTO social_posts (account_id, post_id, text, language, link, posted_at, raw)
+  SELECT
+    a.id,
+    t.twitter_id,
+    t.full_text,
+    CASE WHEN t.raw ->> 'lang' = 'iw' THEN 'he'
+         WHEN t.raw ->> 'lang' ~ '^[a-z]{2}$' THEN t.raw ->> 'lang' END,
+    'https://twitter.com/' || u.username || '/status/' || t.twitter_id,
+    t.tweet_at,
+    t.raw
+  FROM twitter_tweets t
+    INNER JOIN twitter_users u ON t.user_id = u.id
+    INNER JOIN social_accounts a ON a.platform = 'twitter' AND a.account_id = u.account_id;
+
+-- rambler down
+
+DROP TABLE IF EXISTS social_posts;
+DROP TABLE IF EXISTS social_accounts;
@@ -0,0 +1,47 @@
+-- MDB generated migration file
+-- rambler up
+
+ALTER TABLE blogs
+  ADD COLUMN language CHAR(2) NULL;
+
+UPDATE blogs SET language = 'ru' WHERE name = 'laitman-ru';
+UPDATE blogs SET language = 'en' WHERE name = 'laitman-com';
+UPDATE blogs SET language = 'es' WHERE name = 'laitman-es';
+UPDATE blogs SET language = 'he' WHERE name = 'laitman-co-il';
+
+ALTER TABLE twitter_tweets
+  ADD COLUMN filtered BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS blog_posts_posted_at_idx
+  ON blog_posts USING BTREE (posted_at);
+
+CREATE TABLE content_units_blog_posts (
+  content_unit_id BIGINT REFERENCES content_units (id) NOT NULL,
+  blog_post_id    BIGINT REFERENCES blog_posts (id)    NOT NULL,
+  PRIMARY KEY (content_unit_id, blog_post_id)
+);
+
+CREATE INDEX IF NOT EXISTS content_units_blog_posts_blog_post_id_idx
+  ON content_units_blog_posts USING BTREE (blog_post_id);
+
+CREATE TABLE content_units_tweets (
+  content_unit_id BIGINT REFERENCES content_units (id)  NOT NULL,
+  tweet_id        BIGINT REFERENCES twitter_tweets (id) NOT NULL,
+  PRIMARY KEY (content_unit_id, tweet_id)
+);
+
+CREATE INDEX IF NOT EXISTS content_units_tweets_tweet_id_idx
+  ON content_units_tweets USING BTREE (tweet_id);
+
+-- rambler down
+
+DROP TABLE IF EXISTS content_units_tweets;
+DROP TABLE IF EXISTS content_units_blog_posts;
+
+DROP INDEX IF EXISTS blog_posts_posted_at_idx;
+
+ALTER TABLE twitter_tweets
+  DROP COLUMN IF EXISTS filtered;
+
+ALTER TABLE blogs
+  DROP COLUMN IF EXISTS language;
@@ -0,0 +1,12 @@
+-- MDB generated migration file
+-- rambler up
+
+ALTER TABLE storages
+  ADD COLUMN managed    BOOLEAN                  NOT NULL DEFAULT FALSE,
+  ADD COLUMN offline_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- rambler down
+
+ALTER TABLE storages
+  DROP COLUMN IF EXISTS managed,
+  DROP COLUMN IF EXISTS offline_at;
@@ -0,0 +1,27 @@
+-- MDB generated migration file
+-- rambler up
+
+ALTER TABLE storage_import_runs
+  ADD COLUMN hash_conflicts BIGINT DEFAULT 0 NOT NULL;
+
+DROP TABLE IF EXISTS storage_hash_conflicts;
+CREATE TABLE storage_hash_conflicts (
+  id           BIGSERIAL PRIMARY KEY,
+  run_id       BIGINT REFERENCES storage_import_runs ON DELETE CASCADE NOT NULL,
+  file_id      BIGINT REFERENCES files ON DELETE CASCADE               NOT NULL,
+  algo         VARCHAR(16)                                             NOT NULL,
+  catalog_hash BYTEA                                                   NOT NULL,
+  mdb_hash     BYTEA                                                   NOT NULL,
+  created_at   TIMESTAMP WITH TIME ZONE DEFAULT now_utc()              NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS storage_hash_conflicts_file_id_idx
+  ON storage_hash_conflicts USING BTREE (file_id);
+
+-- rambler down
+
+DROP INDEX IF EXISTS storage_hash_conflicts_file_id_idx;
+DROP TABLE IF EXISTS storage_hash_conflicts;
+
+ALTER TABLE storage_import_runs
+  DROP COLUMN IF EXISTS hash_conflicts;
@@ -0,0 +1,33 @@
+-- MDB generated migration file
+-- rambler up
+
+DROP TABLE IF EXISTS storage_compliance_reports;
+CREATE TABLE storage_compliance_reports (
+  id         BIGSERIAL PRIMARY KEY,
+  policies   JSONB                                  NOT NULL,
+  unmatched  INTEGER DEFAULT 0                      NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT now_utc() NOT NULL
+);
+
+DROP TABLE IF EXISTS storage_compliance_violations;
+CREATE TABLE storage_compliance_violations (
+  id        BIGSERIAL PRIMARY KEY,
+  report_id BIGINT REFERENCES storage_compliance_reports ON DELETE CASCADE NOT NULL,
+  file_id   BIGINT REFERENCES files ON DELETE CASCADE                      NOT NULL,
+  file_uid  CHAR(8)                                                        NOT NULL,
+  file_name VARCHAR(255)                                                   NULL,
+  policy    VARCHAR(255)                                                   NOT NULL,
+  kind      VARCHAR(16)                                                    NOT NULL,
+  copies    INTEGER                                                        NOT NULL,
+  countries INTEGER                                                        NOT NULL,
+  storages  TEXT[]                                                         NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS storage_compliance_violations_report_id_idx
+  ON storage_compliance_violations USING BTREE (report_id, policy, kind);
+
+-- rambler down
+
+DROP INDEX IF EXISTS storage_compliance_violations_report_id_idx;
+DROP TABLE IF EXISTS storage_compliance_violations;
+DROP TABLE IF EXISTS storage_compliance_reports;
@@ -7,14 +7,6 @@ INSERT INTO users (email) VALUES
   ('operator@dev.com');
 
 
-DROP TABLE IF EXISTS batch_convert;
-CREATE TABLE batch_convert (
-  file_id       BIGINT REFERENCES files                          NOT NULL,
-  operation_id  BIGINT REFERENCES operations                     NULL,
-  request_at    TIMESTAMP WITH TIME ZONE                         NULL,
-  request_error TEXT                                             NULL
-);
-
 INSERT INTO sources (id, uid, pattern, type_id, position, name) VALUES
   (1, 'L2jMWyce', 'test-source-pattern-1', 1, 0, 'test-source-name-1'),
   (2, '5sLqsXjD', 'test-source-pattern-2', 1, 0, 'test-source-name-2'),
@@ -17,26 +17,30 @@ import (
 	"github.com/volatiletech/sqlboiler/queries"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"github.com/volatiletech/sqlboiler/strmangle"
+	"gopkg.in/volatiletech/null.v6"
 )
 
 // Blog is an object representing the database table.
 type Blog struct {
-	ID   int64  `boil:"id" json:"id" toml:"id" yaml:"id"`
-	Name string `boil:"name" json:"name" toml:"name" yaml:"name"`
-	URL  string `boil:"url" json:"url" toml:"url" yaml:"url"`
+	ID       int64       `boil:"id" json:"id" toml:"id" yaml:"id"`
+	Name     string      `boil:"name" json:"name" toml:"name" yaml:"name"`
+	URL      string      `boil:"url" json:"url" toml:"url" yaml:"url"`
+	Language null.String `boil:"language" json:"language,omitempty" toml:"language" yaml:"language,omitempty"`
 
 	R *blogR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L blogL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var BlogColumns = struct {
-	ID   string
-	Name string
-	URL  string
+	ID       string
+	Name     string
+	URL      string
+	Language string
 }{
-	ID:   "id",
-	Name: "name",
-	URL:  "url",
+	ID:       "id",
+	Name:     "name",
+	URL:      "url",
+	Language: "language",
 }
 
 // blogR is where relationships are stored.
@@ -48,8 +52,8 @@ type blogR struct {
 type blogL struct{}
 
 var (
-	blogColumns               = []string{"id", "name", "url"}
-	blogColumnsWithoutDefault = []string{"name", "url"}
+	blogColumns               = []string{"id", "name", "url", "language"}
+	blogColumnsWithoutDefault = []string{"name", "url", "language"}
 	blogColumnsWithDefault    = []string{"id"}
 	blogPrimaryKeyColumns     = []string{"id"}
 )
@@ -541,7 +541,7 @@ func testBlogsSelect(t *testing.T) {
 }
 
 var (
-	blogDBTypes = map[string]string{`ID`: `bigint`, `Name`: `character varying`, `URL`: `character varying`}
+	blogDBTypes = map[string]string{`ID`: `bigint`, `Language`: `character`, `Name`: `character varying`, `URL`: `character varying`}
 	_           = bytes.MinRead
 )
 
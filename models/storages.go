@@ -17,35 +17,42 @@ import (
 	"github.com/volatiletech/sqlboiler/queries"
 	"github.com/volatiletech/sqlboiler/queries/qm"
 	"github.com/volatiletech/sqlboiler/strmangle"
+	"gopkg.in/volatiletech/null.v6"
 )
 
 // Storage is an object representing the database table.
 type Storage struct {
-	ID       int64  `boil:"id" json:"id" toml:"id" yaml:"id"`
-	Name     string `boil:"name" json:"name" toml:"name" yaml:"name"`
-	Country  string `boil:"country" json:"country" toml:"country" yaml:"country"`
-	Location string `boil:"location" json:"location" toml:"location" yaml:"location"`
-	Status   string `boil:"status" json:"status" toml:"status" yaml:"status"`
-	Access   string `boil:"access" json:"access" toml:"access" yaml:"access"`
+	ID        int64     `boil:"id" json:"id" toml:"id" yaml:"id"`
+	Name      string    `boil:"name" json:"name" toml:"name" yaml:"name"`
+	Country   string    `boil:"country" json:"country" toml:"country" yaml:"country"`
+	Location  string    `boil:"location" json:"location" toml:"location" yaml:"location"`
+	Status    string    `boil:"status" json:"status" toml:"status" yaml:"status"`
+	Access    string    `boil:"access" json:"access" toml:"access" yaml:"access"`
+	Managed   bool      `boil:"managed" json:"managed" toml:"managed" yaml:"managed"`
+	OfflineAt null.Time `boil:"offline_at" json:"offline_at,omitempty" toml:"offline_at" yaml:"offline_at,omitempty"`
 
 	R *storageR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L storageL  `boil:"-" json:"-" toml:"-" yaml:"-"`
 }
 
 var StorageColumns = struct {
-	ID       string
-	Name     string
-	Country  string
-	Location string
-	Status   string
-	Access   string
+	ID        string
+	Name      string
+	Country   string
+	Location  string
+	Status    string
+	Access    string
+	Managed   string
+	OfflineAt string
 }{
-	ID:       "id",
-	Name:     "name",
-	Country:  "country",
-	Location: "location",
-	Status:   "status",
-	Access:   "access",
+	ID:        "id",
+	Name:      "name",
+	Country:   "country",
+	Location:  "location",
+	Status:    "status",
+	Access:    "access",
+	Managed:   "managed",
+	OfflineAt: "offline_at",
 }
 
 // storageR is where relationships are stored.
@@ -57,9 +64,9 @@ type storageR struct {
 type storageL struct{}
 
 var (
-	storageColumns               = []string{"id", "name", "country", "location", "status", "access"}
-	storageColumnsWithoutDefault = []string{"name", "country", "location", "status", "access"}
-	storageColumnsWithDefault    = []string{"id"}
+	storageColumns               = []string{"id", "name", "country", "location", "status", "access", "managed", "offline_at"}
+	storageColumnsWithoutDefault = []string{"name", "country", "location", "status", "access", "offline_at"}
+	storageColumnsWithDefault    = []string{"id", "managed"}
 	storagePrimaryKeyColumns     = []string{"id"}
 )
 
@@ -698,7 +698,7 @@ func testStoragesSelect(t *testing.T) {
 }
 
 var (
-	storageDBTypes = map[string]string{`Access`: `character varying`, `Country`: `character`, `ID`: `bigint`, `Location`: `character varying`, `Name`: `character varying`, `Status`: `character varying`}
+	storageDBTypes = map[string]string{`Access`: `character varying`, `Country`: `character`, `ID`: `bigint`, `Location`: `character varying`, `Managed`: `boolean`, `Name`: `character varying`, `OfflineAt`: `timestamp with time zone`, `Status`: `character varying`}
 	_              = bytes.MinRead
 )
 
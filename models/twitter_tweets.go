@@ -29,6 +29,7 @@ type TwitterTweet struct {
 	TweetAt   time.Time `boil:"tweet_at" json:"tweet_at" toml:"tweet_at" yaml:"tweet_at"`
 	Raw       null.JSON `boil:"raw" json:"raw,omitempty" toml:"raw" yaml:"raw,omitempty"`
 	CreatedAt time.Time `boil:"created_at" json:"created_at" toml:"created_at" yaml:"created_at"`
+	Filtered  bool      `boil:"filtered" json:"filtered" toml:"filtered" yaml:"filtered"`
 
 	R *twitterTweetR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L twitterTweetL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -42,6 +43,7 @@ var TwitterTweetColumns = struct {
 	TweetAt   string
 	Raw       string
 	CreatedAt string
+	Filtered  string
 }{
 	ID:        "id",
 	UserID:    "user_id",
@@ -50,6 +52,7 @@ var TwitterTweetColumns = struct {
 	TweetAt:   "tweet_at",
 	Raw:       "raw",
 	CreatedAt: "created_at",
+	Filtered:  "filtered",
 }
 
 // twitterTweetR is where relationships are stored.
@@ -61,9 +64,9 @@ type twitterTweetR struct {
 type twitterTweetL struct{}
 
 var (
-	twitterTweetColumns               = []string{"id", "user_id", "twitter_id", "full_text", "tweet_at", "raw", "created_at"}
+	twitterTweetColumns               = []string{"id", "user_id", "twitter_id", "full_text", "tweet_at", "raw", "created_at", "filtered"}
 	twitterTweetColumnsWithoutDefault = []string{"user_id", "twitter_id", "full_text", "tweet_at", "raw"}
-	twitterTweetColumnsWithDefault    = []string{"id", "created_at"}
+	twitterTweetColumnsWithDefault    = []string{"id", "created_at", "filtered"}
 	twitterTweetPrimaryKeyColumns     = []string{"id"}
 )
 
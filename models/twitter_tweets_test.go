@@ -500,7 +500,7 @@ func testTwitterTweetsSelect(t *testing.T) {
 }
 
 var (
-	twitterTweetDBTypes = map[string]string{`CreatedAt`: `timestamp with time zone`, `FullText`: `text`, `ID`: `bigint`, `Raw`: `jsonb`, `TweetAt`: `timestamp with time zone`, `TwitterID`: `character varying`, `UserID`: `bigint`}
+	twitterTweetDBTypes = map[string]string{`CreatedAt`: `timestamp with time zone`, `Filtered`: `boolean`, `FullText`: `text`, `ID`: `bigint`, `Raw`: `jsonb`, `TweetAt`: `timestamp with time zone`, `TwitterID`: `character varying`, `UserID`: `bigint`}
 	_                   = bytes.MinRead
 )
 
@@ -0,0 +1,262 @@
+// Package naming implements the BB file naming convention:
+//
+//	[lang]_[o/t]_[rav/norav]_[part]_[YYYY-MM-DD]_[description]...[.ext]
+//
+// e.g. heb_o_rav_rb-1990-02-kishalon_2016-09-14_lesson.mp4
+// The part is optional. The description has one or more tokens (content type, artifact, bitrate, etc...).
+// All tokens are lower case letters, digits and dashes.
+package naming
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+const (
+	ORIGINAL    = "o"
+	TRANSLATION = "t"
+	RAV         = "rav"
+	NORAV       = "norav"
+	DATE_FORMAT = "2006-01-02"
+)
+
+const FORMAT = "[lang]_[o/t]_[rav/norav]_[part]_[YYYY-MM-DD]_[description].[ext], part is optional"
+
+// Lenient token patterns, used by importers to make sense of legacy names.
+var (
+	LANG_RE      *regexp.Regexp
+	OT_RE        = regexp.MustCompile("(?i)^[ot]$")
+	RAV_NORAV_RE = regexp.MustCompile("(?i)^(rav|norav)$")
+	BITRATE_RE   = regexp.MustCompile("(?i)^(24k|96k|128k|hd)$")
+	DATE_RE      = regexp.MustCompile("^((19|20)\\d\\d)-(0?[1-9]|1[012])-(0?[1-9]|[12][0-9]|3[01])$") // YYYY-MM-DD
+	TOKEN_RE     = regexp.MustCompile("^[a-z0-9][a-z0-9-]*$")
+	EXT_RE       = regexp.MustCompile("^[a-z0-9]+$")
+)
+
+func init() {
+	keys := make([]string, 0, len(common.LANG_MAP))
+	for k := range common.LANG_MAP {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	LANG_RE = regexp.MustCompile(fmt.Sprintf("(?i)^(%s)$", strings.Join(keys, "|")))
+}
+
+// Preferred file extension by file type (as in common.MediaType.Type)
+var EXTENSIONS = map[string]string{
+	"video": "mp4",
+	"audio": "mp3",
+	"image": "jpg",
+	"text":  "doc",
+}
+
+// FileName is a parsed file name
+type FileName struct {
+	Name         string    `json:"name"`
+	LanguageCode string    `json:"language_code"` // as in the file name, e.g. heb
+	Language     string    `json:"language"`      // as in common.LANG_MAP, e.g. he
+	Original     bool      `json:"original"`
+	Rav          bool      `json:"rav"`
+	Part         string    `json:"part,omitempty"`
+	Date         time.Time `json:"-"`
+	DateStr      string    `json:"date"`
+	Description  []string  `json:"description"`
+	Extension    string    `json:"extension"`
+}
+
+// Violation is a single breach of the convention
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (v Violation) Error() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Message)
+}
+
+// Violations is the error returned for names which break the convention
+type Violations []Violation
+
+func (v Violations) Error() string {
+	msgs := make([]string, len(v))
+	for i := range v {
+		msgs[i] = v[i].Error()
+	}
+	return fmt.Sprintf("Bad file name, %s. Expected %s", strings.Join(msgs, "; "), FORMAT)
+}
+
+func (v *Violations) add(field, format string, args ...interface{}) {
+	*v = append(*v, Violation{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// LanguageCode returns the file name language code of a language (e.g. he => heb)
+func LanguageCode(language string) (string, bool) {
+	for k, v := range common.LANG_MAP {
+		if k != "" && v == language {
+			return strings.ToLower(k), true
+		}
+	}
+	return "", false
+}
+
+// Parse parses and validates a file name (a path is fine as well).
+// On failure the error is Violations with all problems found.
+func Parse(name string) (*FileName, error) {
+	fn := &FileName{Name: filepath.Base(name)}
+	var v Violations
+
+	base := fn.Name
+	if idx := strings.LastIndex(base, "."); idx > 0 {
+		fn.Extension = base[idx+1:]
+		base = base[:idx]
+	}
+	if fn.Extension == "" {
+		v.add("extension", "missing")
+	} else if !EXT_RE.MatchString(fn.Extension) {
+		v.add("extension", "%q should be lower case letters and digits", fn.Extension)
+	}
+
+	tokens := strings.Split(base, "_")
+	for _, t := range tokens {
+		if !TOKEN_RE.MatchString(t) {
+			v.add("name", "bad token %q, expecting lower case letters, digits and dashes", t)
+		}
+	}
+	if len(tokens) < 5 {
+		v.add("name", "expected at least 5 parts separated by _, found %d", len(tokens))
+		return nil, v
+	}
+
+	fn.LanguageCode = tokens[0]
+	if language, ok := common.LANG_MAP[strings.ToUpper(tokens[0])]; ok && tokens[0] != "" {
+		fn.Language = language
+	} else {
+		v.add("language", "unknown language code %q", tokens[0])
+	}
+
+	switch tokens[1] {
+	case ORIGINAL:
+		fn.Original = true
+	case TRANSLATION:
+		fn.Original = false
+	default:
+		v.add("original", "expected o or t, got %q", tokens[1])
+	}
+
+	switch tokens[2] {
+	case RAV:
+		fn.Rav = true
+	case NORAV:
+		fn.Rav = false
+	default:
+		v.add("lecturer", "expected rav or norav, got %q", tokens[2])
+	}
+
+	dateIdx := 3
+	if !DATE_RE.MatchString(tokens[3]) {
+		fn.Part = tokens[3]
+		dateIdx = 4
+	}
+	fn.DateStr = tokens[dateIdx]
+	if d, err := time.Parse(DATE_FORMAT, fn.DateStr); err != nil {
+		v.add("date", "expected YYYY-MM-DD after lecturer or part, got %q", fn.DateStr)
+	} else {
+		fn.Date = d
+	}
+
+	fn.Description = tokens[dateIdx+1:]
+	if len(fn.Description) == 0 {
+		v.add("description", "missing after date")
+	}
+
+	if len(v) > 0 {
+		return nil, v
+	}
+	return fn, nil
+}
+
+// Validate is Parse when only the problems matter
+func Validate(name string) Violations {
+	if _, err := Parse(name); err != nil {
+		return err.(Violations)
+	}
+	return nil
+}
+
+// Generate returns the canonical file name of fn, which must have
+// Language (or LanguageCode), Date and Description and either Extension or a file type.
+// Tokens are normalized: lower cased with spaces and underscores replaced by dashes.
+func Generate(fn *FileName, fileType string) (string, error) {
+	var v Violations
+
+	code := fn.LanguageCode
+	if code == "" {
+		var ok bool
+		if code, ok = LanguageCode(fn.Language); !ok {
+			v.add("language", "unknown language %q", fn.Language)
+		}
+	}
+
+	ot := TRANSLATION
+	if fn.Original {
+		ot = ORIGINAL
+	}
+	rav := NORAV
+	if fn.Rav {
+		rav = RAV
+	}
+
+	tokens := []string{strings.ToLower(code), ot, rav}
+	if fn.Part != "" {
+		tokens = append(tokens, normalizeToken(fn.Part))
+	}
+
+	if fn.Date.IsZero() {
+		v.add("date", "missing")
+	}
+	tokens = append(tokens, fn.Date.Format(DATE_FORMAT))
+
+	description := make([]string, 0, len(fn.Description))
+	for _, d := range fn.Description {
+		if t := normalizeToken(d); t != "" {
+			description = append(description, t)
+		}
+	}
+	if len(description) == 0 {
+		v.add("description", "missing")
+	}
+	tokens = append(tokens, description...)
+
+	ext := strings.ToLower(fn.Extension)
+	if ext == "" {
+		var ok bool
+		if ext, ok = EXTENSIONS[fileType]; !ok {
+			v.add("extension", "missing and unknown file type %q", fileType)
+		}
+	}
+
+	if len(v) > 0 {
+		return "", v
+	}
+
+	name := strings.Join(tokens, "_") + "." + ext
+	if _, err := Parse(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+var nonTokenChars = regexp.MustCompile("[^a-z0-9-]+")
+
+func normalizeToken(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = nonTokenChars.ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
@@ -0,0 +1,79 @@
+package naming
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+func TestParse(t *testing.T) {
+	fn, err := Parse("/some/dir/heb_o_rav_rb-1990-02-kishalon_2016-09-14_lesson.mp4")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "heb_o_rav_rb-1990-02-kishalon_2016-09-14_lesson.mp4", fn.Name)
+		assert.Equal(t, "mp4", fn.Extension)
+		assert.Equal(t, "heb", fn.LanguageCode)
+		assert.Equal(t, common.LANG_HEBREW, fn.Language)
+		assert.True(t, fn.Original)
+		assert.True(t, fn.Rav)
+		assert.Equal(t, "rb-1990-02-kishalon", fn.Part)
+		assert.Equal(t, "2016-09-14", fn.DateStr)
+		assert.Equal(t, time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC), fn.Date)
+		assert.Equal(t, []string{"lesson"}, fn.Description)
+	}
+
+	fn, err = Parse("rus_t_norav_1995-12-30_lesson_96k.mp3")
+	if assert.Nil(t, err) {
+		assert.False(t, fn.Original)
+		assert.False(t, fn.Rav)
+		assert.Equal(t, "", fn.Part)
+		assert.Equal(t, []string{"lesson", "96k"}, fn.Description)
+	}
+
+	_, err = Parse("heb_o_rav_rb-1990-02-kishalon_201-09-14_lesson.mp4")
+	if assert.IsType(t, Violations{}, err) {
+		assert.Equal(t, "date", err.(Violations)[0].Field)
+	}
+
+	v := Validate("xyz_x_rav_part_2016-09-14.MP4")
+	fields := make([]string, len(v))
+	for i := range v {
+		fields[i] = v[i].Field
+	}
+	assert.Equal(t, []string{"extension", "language", "original", "description"}, fields)
+
+	assert.NotEmpty(t, Validate("original_renamed.mp4"), "too short")
+	assert.NotEmpty(t, Validate("heb_o_rav_2016-09-14_Lesson.mp4"), "upper case")
+	assert.NotEmpty(t, Validate("heb_o_rav_2016-09-14_lesson"), "no extension")
+	assert.NotEmpty(t, Validate("2017-01-04_02-40-19"))
+	assert.Empty(t, Validate("heb_o_rav_2016-09-14_lesson_akladot.docx"))
+}
+
+func TestGenerate(t *testing.T) {
+	fn := &FileName{
+		Language:    common.LANG_HEBREW,
+		Original:    true,
+		Rav:         true,
+		Part:        "Part 1",
+		Date:        time.Date(2016, 9, 14, 0, 0, 0, 0, time.UTC),
+		Description: []string{"lesson", "kitei_makor", ""},
+	}
+	name, err := Generate(fn, "video")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "heb_o_rav_part-1_2016-09-14_lesson_kitei-makor.mp4", name)
+	}
+
+	fn.Extension = "MP3"
+	fn.Part = ""
+	name, err = Generate(fn, "")
+	if assert.Nil(t, err) {
+		assert.Equal(t, "heb_o_rav_2016-09-14_lesson_kitei-makor.mp3", name)
+	}
+
+	_, err = Generate(&FileName{Language: "xx1"}, "unknown")
+	if assert.IsType(t, Violations{}, err) {
+		assert.Len(t, err.(Violations), 4)
+	}
+}
@@ -0,0 +1,272 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Allowed difference between declared and probed durations
+	DURATION_TOLERANCE = 1.0 // seconds
+
+	DEFAULT_TIMEOUT = 30 * time.Second
+)
+
+// Result is the normalised outcome of probing a media file.
+// Zero values are unknown.
+type Result struct {
+	Format      string  `json:"format,omitempty"`
+	Duration    float64 `json:"duration,omitempty"` // seconds
+	BitRate     int64   `json:"bit_rate,omitempty"` // bits per second
+	Size        int64   `json:"size,omitempty"`     // bytes
+	VideoCodec  string  `json:"video_codec,omitempty"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	AspectRatio string  `json:"aspect_ratio,omitempty"`
+}
+
+func (r *Result) HasVideo() bool {
+	return r.VideoCodec != ""
+}
+
+func (r *Result) Resolution() string {
+	if r.Width == 0 || r.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// VideoSize classifies the video by its height the way stations do, empty for audio
+func (r *Result) VideoSize() string {
+	switch {
+	case !r.HasVideo() || r.Height == 0:
+		return ""
+	case r.Height >= 2160:
+		return "4K"
+	case r.Height >= 1080:
+		return "FHD"
+	case r.Height >= 720:
+		return "HD"
+	case r.Height >= 360:
+		return "nHD"
+	default:
+		return "SD"
+	}
+}
+
+// Properties returns the known values as file properties.
+// Keys are the same as the ones set by stations and the offline ffprobe importer.
+func (r *Result) Properties() map[string]interface{} {
+	props := make(map[string]interface{})
+	if r.Duration > 0 {
+		props["duration"] = r.Duration
+	}
+	if r.BitRate > 0 {
+		props["bit_rate"] = r.BitRate
+	}
+	if v := r.VideoSize(); v != "" {
+		props["video_size"] = v
+	}
+	if v := r.Resolution(); v != "" {
+		props["resolution"] = v
+	}
+	if r.AspectRatio != "" {
+		props["aspect_ratio"] = r.AspectRatio
+	}
+	return props
+}
+
+// Declared are the values a station sent with a file
+type Declared struct {
+	Duration  float64
+	VideoSize string
+	Size      int64
+}
+
+// Inconsistency is a declared value not agreeing with the probed one
+type Inconsistency struct {
+	Field    string `json:"field"`
+	Declared string `json:"declared"`
+	Probed   string `json:"probed"`
+}
+
+func (i Inconsistency) String() string {
+	return fmt.Sprintf("%s: declared %s, probed %s", i.Field, i.Declared, i.Probed)
+}
+
+// Check compares declared values with probed ones. Unknown values on either side are skipped.
+func Check(d Declared, r *Result) []Inconsistency {
+	res := make([]Inconsistency, 0)
+
+	if d.Duration > 0 && r.Duration > 0 && math.Abs(d.Duration-r.Duration) > DURATION_TOLERANCE {
+		res = append(res, Inconsistency{
+			Field:    "duration",
+			Declared: strconv.FormatFloat(d.Duration, 'f', -1, 64),
+			Probed:   strconv.FormatFloat(r.Duration, 'f', -1, 64),
+		})
+	}
+
+	if d.VideoSize != "" {
+		if v := r.VideoSize(); v != "" && !strings.EqualFold(d.VideoSize, v) {
+			res = append(res, Inconsistency{Field: "video_size", Declared: d.VideoSize, Probed: v})
+		} else if v == "" && r.Format != "" {
+			res = append(res, Inconsistency{Field: "video_size", Declared: d.VideoSize, Probed: "no video"})
+		}
+	}
+
+	if d.Size > 0 && r.Size > 0 && d.Size != r.Size {
+		res = append(res, Inconsistency{
+			Field:    "size",
+			Declared: strconv.FormatInt(d.Size, 10),
+			Probed:   strconv.FormatInt(r.Size, 10),
+		})
+	}
+
+	return res
+}
+
+// Prober probes a local media file
+type Prober interface {
+	Probe(path string) (*Result, error)
+}
+
+// FFProbe runs the ffprobe binary
+type FFProbe struct {
+	Binary  string
+	Timeout time.Duration
+}
+
+func NewFFProbe(binary string, timeout time.Duration) *FFProbe {
+	if binary == "" {
+		binary = "ffprobe"
+	}
+	if timeout <= 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+	return &FFProbe{Binary: binary, Timeout: timeout}
+}
+
+func (p *FFProbe) Probe(path string) (*Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, p.Binary,
+		"-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", path).
+		Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "ffprobe %s", path)
+	}
+
+	return ParseFFProbe(out)
+}
+
+// Fake returns predefined results by path, for tests
+type Fake struct {
+	Results map[string]*Result
+}
+
+func (p *Fake) Probe(path string) (*Result, error) {
+	if r, ok := p.Results[path]; ok {
+		return r, nil
+	}
+	return nil, errors.Errorf("No such file %s", path)
+}
+
+// ffprobe -print_format json -show_format -show_streams output.
+// Numbers are quoted strings in ffprobe's JSON.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType          string `json:"codec_type"`
+		CodecName          string `json:"codec_name"`
+		Width              int    `json:"width"`
+		Height             int    `json:"height"`
+		DisplayAspectRatio string `json:"display_aspect_ratio"`
+		Duration           string `json:"duration"`
+		BitRate            string `json:"bit_rate"`
+		Disposition        struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// ParseFFProbe normalises ffprobe JSON output (format and streams)
+func ParseFFProbe(b []byte) (*Result, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal ffprobe output")
+	}
+	if out.Format.FormatName == "" && len(out.Streams) == 0 {
+		return nil, errors.New("No format or streams in ffprobe output")
+	}
+
+	r := &Result{
+		Format:   out.Format.FormatName,
+		Duration: parseFloat(out.Format.Duration),
+		BitRate:  parseInt(out.Format.BitRate),
+		Size:     parseInt(out.Format.Size),
+	}
+
+	for _, s := range out.Streams {
+		switch s.CodecType {
+		case "video":
+			// cover art in audio files
+			if s.Disposition.AttachedPic == 1 || r.VideoCodec != "" {
+				continue
+			}
+			r.VideoCodec = s.CodecName
+			r.Width = s.Width
+			r.Height = s.Height
+			if s.DisplayAspectRatio != "0:1" {
+				r.AspectRatio = s.DisplayAspectRatio
+			}
+		case "audio":
+			if r.AudioCodec != "" {
+				continue
+			}
+			r.AudioCodec = s.CodecName
+		default:
+			continue
+		}
+
+		// raw streams have no format level values
+		if r.Duration == 0 {
+			r.Duration = parseFloat(s.Duration)
+		}
+		if r.BitRate == 0 && len(out.Streams) == 1 {
+			r.BitRate = parseInt(s.BitRate)
+		}
+	}
+
+	return r, nil
+}
+
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || v < 0 {
+		return 0
+	}
+	return v
+}
+
+func parseInt(s string) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const VIDEO_JSON = `{
+  "streams": [
+    {"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1280, "height": 720,
+     "display_aspect_ratio": "16:9", "duration": "1830.120000", "bit_rate": "1500000"},
+    {"index": 1, "codec_name": "aac", "codec_type": "audio", "duration": "1830.100000", "bit_rate": "128000"}
+  ],
+  "format": {"filename": "heb_o_rav_2018-10-18_lesson.mp4", "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+    "duration": "1830.123000", "size": "372153651", "bit_rate": "1626821"}
+}`
+
+const AUDIO_JSON = `{
+  "streams": [
+    {"codec_name": "mp3", "codec_type": "audio", "duration": "600.5", "bit_rate": "96000"},
+    {"codec_name": "mjpeg", "codec_type": "video", "width": 500, "height": 500, "disposition": {"attached_pic": 1}}
+  ],
+  "format": {"format_name": "mp3", "duration": "600.500000", "size": "7206000", "bit_rate": "96000"}
+}`
+
+func TestParseFFProbe(t *testing.T) {
+	r, err := ParseFFProbe([]byte(VIDEO_JSON))
+	assert.Nil(t, err)
+	assert.Equal(t, 1830.123, r.Duration)
+	assert.Equal(t, int64(1626821), r.BitRate)
+	assert.Equal(t, int64(372153651), r.Size)
+	assert.Equal(t, "h264", r.VideoCodec)
+	assert.Equal(t, "aac", r.AudioCodec)
+	assert.Equal(t, map[string]interface{}{
+		"duration":     1830.123,
+		"bit_rate":     int64(1626821),
+		"video_size":   "HD",
+		"resolution":   "1280x720",
+		"aspect_ratio": "16:9",
+	}, r.Properties())
+
+	r, err = ParseFFProbe([]byte(AUDIO_JSON))
+	assert.Nil(t, err)
+	assert.False(t, r.HasVideo())
+	assert.Equal(t, "mp3", r.AudioCodec)
+	assert.Equal(t, map[string]interface{}{
+		"duration": 600.5,
+		"bit_rate": int64(96000),
+	}, r.Properties())
+
+	_, err = ParseFFProbe([]byte(`{}`))
+	assert.NotNil(t, err)
+	_, err = ParseFFProbe([]byte(`not json`))
+	assert.NotNil(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	r, err := ParseFFProbe([]byte(VIDEO_JSON))
+	assert.Nil(t, err)
+
+	assert.Empty(t, Check(Declared{Duration: 1830.5, VideoSize: "hd", Size: 372153651}, r))
+	assert.Empty(t, Check(Declared{}, r))
+
+	res := Check(Declared{Duration: 1800, VideoSize: "FHD", Size: 1}, r)
+	if assert.Len(t, res, 3) {
+		assert.Equal(t, Inconsistency{Field: "duration", Declared: "1800", Probed: "1830.123"}, res[0])
+		assert.Equal(t, Inconsistency{Field: "video_size", Declared: "FHD", Probed: "HD"}, res[1])
+		assert.Equal(t, "size", res[2].Field)
+	}
+
+	r, err = ParseFFProbe([]byte(AUDIO_JSON))
+	assert.Nil(t, err)
+	res = Check(Declared{VideoSize: "HD"}, r)
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, "no video", res[0].Probed)
+	}
+}
+
+func TestFake(t *testing.T) {
+	var p Prober = &Fake{Results: map[string]*Result{"/a.mp3": {Duration: 10}}}
+	r, err := p.Probe("/a.mp3")
+	assert.Nil(t, err)
+	assert.Equal(t, 10.0, r.Duration)
+	_, err = p.Probe("/b.mp3")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,186 @@
+package reconcile
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/importer/sheet"
+)
+
+// Adapter loads the items of an external catalog
+type Adapter interface {
+	Load() ([]*Item, error)
+}
+
+// AdapterFactory creates an adapter for a source (file, folder, url...)
+type AdapterFactory func(source string, opts AdapterOptions) (Adapter, error)
+
+type AdapterOptions struct {
+	Hash bool // compute sha1 of local files
+}
+
+type adapterDef struct {
+	Description string
+	Factory     AdapterFactory
+}
+
+var adapters = make(map[string]*adapterDef)
+
+// RegisterAdapter makes an adapter available by name
+func RegisterAdapter(name, description string, factory AdapterFactory) {
+	if _, ok := adapters[name]; ok {
+		panic("reconcile: adapter already registered " + name)
+	}
+	adapters[name] = &adapterDef{Description: description, Factory: factory}
+}
+
+func NewAdapter(name, source string, opts AdapterOptions) (Adapter, error) {
+	def, ok := adapters[name]
+	if !ok {
+		return nil, errors.Errorf("Unknown adapter %q, expected one of %s", name, strings.Join(AdapterNames(), ", "))
+	}
+	return def.Factory(source, opts)
+}
+
+func AdapterNames() []string {
+	names := make([]string, 0, len(adapters))
+	for k := range adapters {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterAdapter("sheet", "CSV or XLSX catalog with external_id, name, sha1, size and location columns",
+		func(source string, opts AdapterOptions) (Adapter, error) {
+			return &SheetAdapter{Path: source}, nil
+		})
+	RegisterAdapter("dir", "files in a local folder (sha1 with --hash)",
+		func(source string, opts AdapterOptions) (Adapter, error) {
+			return &DirAdapter{Root: source, Hash: opts.Hash}, nil
+		})
+}
+
+var SHA1_RE = regexp.MustCompile("^[0-9a-fA-F]{40}$")
+
+var SHEET_MAPPING = sheet.Mapping{
+	Columns: []sheet.Column{
+		{Name: "external_id"},
+		{Name: "name"},
+		{Name: "sha1", Validate: func(v string) error {
+			if !SHA1_RE.MatchString(v) {
+				return errors.New("expected 40 hex characters")
+			}
+			return nil
+		}},
+		{Name: "size", Type: sheet.TYPE_INT},
+		{Name: "location"},
+	},
+}
+
+// SheetAdapter reads a catalog exported to CSV or XLSX
+type SheetAdapter struct {
+	Path string
+}
+
+func (a *SheetAdapter) Load() ([]*Item, error) {
+	content, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Read %s", a.Path)
+	}
+
+	records, err := sheet.ReadRecords(a.Path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, rowErrs, err := SHEET_MAPPING.Parse(records)
+	if err != nil {
+		return nil, err
+	}
+	if len(rowErrs) > 0 {
+		return nil, errors.Errorf("%d invalid rows, first: %s", len(rowErrs), rowErrs[0].Error())
+	}
+
+	items := make([]*Item, len(rows))
+	for i, row := range rows {
+		items[i] = &Item{
+			ExternalID: row.Get("external_id"),
+			Name:       row.Get("name"),
+			Sha1:       strings.ToLower(row.Get("sha1")),
+			Size:       row.Int("size"),
+			Location:   row.Get("location"),
+		}
+	}
+
+	return items, nil
+}
+
+// DirAdapter walks a local folder. The relative path of each file is its external id.
+type DirAdapter struct {
+	Root string
+	Hash bool
+}
+
+func (a *DirAdapter) Load() ([]*Item, error) {
+	items := make([]*Item, 0)
+	err := filepath.Walk(a.Root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(a.Root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		item := &Item{
+			ExternalID: rel,
+			Name:       info.Name(),
+			Size:       info.Size(),
+			Location:   rel,
+		}
+		if a.Hash {
+			item.Sha1, err = Sha1File(path)
+			if err != nil {
+				return err
+			}
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Walk %s", a.Root)
+	}
+
+	return items, nil
+}
+
+// Sha1File returns the hex encoded sha1 of a file's content
+func Sha1File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Open %s", path)
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "Hash %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
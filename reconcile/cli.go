@@ -0,0 +1,93 @@
+package reconcile
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+type Params struct {
+	Adapter  string
+	Source   string
+	Adapters AdapterOptions
+	Options  Options
+	Scope    MDBScope
+	Format   string // FORMAT_CSV (default) or FORMAT_XLSX
+	Output   string // report path, default in /tmp
+	Plan     string // fix-up plan path, none if empty
+}
+
+// Command reconciles an external catalog with MDB files and writes a report (and optionally a fix-up plan)
+func Command(params Params) {
+	clock := time.Now()
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	switch params.Format {
+	case "":
+		params.Format = FORMAT_CSV
+	case FORMAT_CSV, FORMAT_XLSX:
+	default:
+		utils.Must(errors.Errorf("Unknown report format %s", params.Format))
+	}
+	utils.Must(params.Options.Validate())
+
+	adapter, err := NewAdapter(params.Adapter, params.Source, params.Adapters)
+	utils.Must(err)
+	extItems, err := adapter.Load()
+	utils.Must(err)
+	log.Infof("%s has %d items", params.Source, len(extItems))
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	defer db.Close()
+	utils.Must(common.InitTypeRegistries(db))
+
+	mdbItems, err := LoadMDBFiles(db, params.Scope)
+	utils.Must(err)
+	log.Infof("MDB has %d files in scope", len(mdbItems))
+
+	report, err := Reconcile(mdbItems, extItems, params.Options)
+	utils.Must(err)
+	report.Catalog = params.Source
+
+	path := params.Output
+	if path == "" {
+		path = fmt.Sprintf("/tmp/reconcile_%s_%s.%s", params.Adapter, time.Now().Format("20060102_150405"), params.Format)
+	}
+	utils.Must(WriteReport(path, params.Format, report))
+	log.Infof("Report file: %s", path)
+
+	if params.Plan != "" {
+		utils.Must(WritePlan(params.Plan, report))
+		log.Infof("Fix-up plan file: %s", params.Plan)
+	}
+
+	counts := report.Counts()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, s := range STATUSES {
+		fmt.Fprintf(w, "%s\t%d\n", s, counts[s])
+	}
+	w.Flush()
+
+	log.Info("Success")
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// AdaptersCommand lists the available catalog adapters
+func AdaptersCommand() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range AdapterNames() {
+		fmt.Fprintf(w, "%s\t%s\n", name, adapters[name].Description)
+	}
+	w.Flush()
+}
@@ -0,0 +1,75 @@
+package reconcile
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+// MDBScope limits the MDB files compared with a catalog
+type MDBScope struct {
+	Published     bool     // only published files
+	ContentTypes  []string // only files of units of these content types
+	ExternalIDKey string   // files.properties key holding the external id, e.g. kmedia_id
+}
+
+// LoadMDBFiles loads all files (not removed) in scope
+func LoadMDBFiles(exec boil.Executor, scope MDBScope) ([]*Item, error) {
+	var query bytes.Buffer
+	args := make([]interface{}, 0)
+
+	query.WriteString(`SELECT f.id, f.uid, f.name, coalesce(encode(f.sha1, 'hex'), ''), coalesce(f.size, 0), `)
+	if scope.ExternalIDKey != "" {
+		args = append(args, scope.ExternalIDKey)
+		query.WriteString(fmt.Sprintf("coalesce(f.properties->>$%d, '')", len(args)))
+	} else {
+		query.WriteString("''")
+	}
+	query.WriteString(" FROM files f")
+
+	if len(scope.ContentTypes) > 0 {
+		typeIDs := make([]int64, len(scope.ContentTypes))
+		for i, x := range scope.ContentTypes {
+			ct, ok := common.CONTENT_TYPE_REGISTRY.ByName[strings.ToUpper(x)]
+			if !ok {
+				return nil, errors.Errorf("Unknown content type %s", x)
+			}
+			typeIDs[i] = ct.ID
+		}
+		args = append(args, pq.Array(typeIDs))
+		query.WriteString(fmt.Sprintf(" INNER JOIN content_units cu ON f.content_unit_id = cu.id AND cu.type_id = ANY($%d)", len(args)))
+	}
+
+	query.WriteString(" WHERE f.removed_at IS NULL")
+	if scope.Published {
+		query.WriteString(" AND f.published IS TRUE")
+	}
+	query.WriteString(" ORDER BY f.id")
+
+	rows, err := queries.Raw(exec, query.String(), args...).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load files")
+	}
+	defer rows.Close()
+
+	items := make([]*Item, 0)
+	for rows.Next() {
+		x := new(Item)
+		if err := rows.Scan(&x.ID, &x.UID, &x.Name, &x.Sha1, &x.Size, &x.ExternalID); err != nil {
+			return nil, errors.Wrap(err, "Scan row")
+		}
+		items = append(items, x)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Iterate rows")
+	}
+
+	return items, nil
+}
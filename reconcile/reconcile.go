@@ -0,0 +1,249 @@
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Match keys
+const (
+	MATCH_SHA1        = "sha1"
+	MATCH_NAME        = "name"
+	MATCH_EXTERNAL_ID = "external_id"
+)
+
+// Compared fields
+const (
+	FIELD_SHA1 = "sha1"
+	FIELD_NAME = "name"
+	FIELD_SIZE = "size"
+)
+
+// Result statuses
+const (
+	STATUS_MATCHED            = "matched"
+	STATUS_MISSING_IN_MDB     = "missing_in_mdb"
+	STATUS_MISSING_EXTERNALLY = "missing_externally"
+	STATUS_CONFLICT           = "conflict"
+)
+
+var MATCH_KEYS = []string{MATCH_SHA1, MATCH_NAME, MATCH_EXTERNAL_ID}
+
+var STATUSES = []string{STATUS_MATCHED, STATUS_MISSING_IN_MDB, STATUS_MISSING_EXTERNALLY, STATUS_CONFLICT}
+
+// DEFAULT_COMPARE fields are checked on every match. Names are left out as they often differ between systems.
+var DEFAULT_COMPARE = []string{FIELD_SHA1, FIELD_SIZE}
+
+// Item is a file either in MDB or in an external catalog.
+// Empty (zero) fields are unknown and never compared.
+type Item struct {
+	ID         int64  `json:"id,omitempty"`  // MDB file id
+	UID        string `json:"uid,omitempty"` // MDB file uid
+	ExternalID string `json:"external_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Sha1       string `json:"sha1,omitempty"` // lower case hex
+	Size       int64  `json:"size,omitempty"`
+	Location   string `json:"location,omitempty"` // path or url in the external catalog
+}
+
+type FieldDiff struct {
+	Field    string `json:"field"`
+	MDB      string `json:"mdb"`
+	External string `json:"external"`
+}
+
+// Result is the classification of a single external item, MDB item or both
+type Result struct {
+	Status   string      `json:"status"`
+	Key      string      `json:"key"`
+	MDB      *Item       `json:"mdb,omitempty"`
+	External *Item       `json:"external,omitempty"`
+	Diffs    []FieldDiff `json:"diffs,omitempty"`
+	Message  string      `json:"message,omitempty"`
+}
+
+type Options struct {
+	Match   string   // one of MATCH_*
+	Compare []string // FIELD_* to compare on match, default DEFAULT_COMPARE
+}
+
+func (o *Options) Validate() error {
+	if !contains(MATCH_KEYS, o.Match) {
+		return errors.Errorf("Unknown match key %q, expected one of %s", o.Match, strings.Join(MATCH_KEYS, ", "))
+	}
+	for _, f := range o.Compare {
+		if f != FIELD_SHA1 && f != FIELD_NAME && f != FIELD_SIZE {
+			return errors.Errorf("Unknown compare field %q", f)
+		}
+	}
+	return nil
+}
+
+type Report struct {
+	Catalog string    `json:"catalog"`
+	Match   string    `json:"match"`
+	Results []*Result `json:"results"`
+}
+
+func (r *Report) Counts() map[string]int {
+	counts := make(map[string]int, len(STATUSES))
+	for _, x := range r.Results {
+		counts[x.Status]++
+	}
+	return counts
+}
+
+// Reconcile matches external items with MDB items and classifies each of them.
+// An external item is matched when a single MDB item has its key and compared fields agree,
+// missing_in_mdb when no MDB item has its key and a conflict when compared fields differ
+// or its key is ambiguous or empty. MDB items no external item matched are missing_externally.
+// MDB items without a key can't be matched and are ignored.
+func Reconcile(mdbItems, extItems []*Item, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	compare := opts.Compare
+	if len(compare) == 0 {
+		compare = DEFAULT_COMPARE
+	}
+
+	byKey := make(map[string][]*Item, len(mdbItems))
+	for _, x := range mdbItems {
+		if k := key(x, opts.Match); k != "" {
+			byKey[k] = append(byKey[k], x)
+		}
+	}
+
+	report := &Report{
+		Match:   opts.Match,
+		Results: make([]*Result, 0, len(extItems)),
+	}
+
+	used := make(map[*Item]*Result)
+	for _, ext := range extItems {
+		k := key(ext, opts.Match)
+		r := &Result{Key: k, External: ext}
+		report.Results = append(report.Results, r)
+
+		if k == "" {
+			r.Status = STATUS_CONFLICT
+			r.Message = fmt.Sprintf("no %s in external item", opts.Match)
+			continue
+		}
+
+		candidates := byKey[k]
+		switch len(candidates) {
+		case 0:
+			r.Status = STATUS_MISSING_IN_MDB
+			continue
+		case 1:
+		default:
+			r.Status = STATUS_CONFLICT
+			r.Message = fmt.Sprintf("%d MDB items with this %s", len(candidates), opts.Match)
+			for _, c := range candidates {
+				used[c] = r
+			}
+			continue
+		}
+
+		r.MDB = candidates[0]
+		if prev, ok := used[r.MDB]; ok {
+			r.Status = STATUS_CONFLICT
+			r.Message = fmt.Sprintf("MDB item matched by another external item (%s)", location(prev.External))
+			continue
+		}
+		used[r.MDB] = r
+
+		r.Diffs = diff(r.MDB, ext, compare, opts.Match)
+		if len(r.Diffs) > 0 {
+			r.Status = STATUS_CONFLICT
+		} else {
+			r.Status = STATUS_MATCHED
+		}
+	}
+
+	missing := make([]*Item, 0)
+	for _, x := range mdbItems {
+		if _, ok := used[x]; !ok && key(x, opts.Match) != "" {
+			missing = append(missing, x)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].ID < missing[j].ID })
+	for _, x := range missing {
+		report.Results = append(report.Results, &Result{
+			Status: STATUS_MISSING_EXTERNALLY,
+			Key:    key(x, opts.Match),
+			MDB:    x,
+		})
+	}
+
+	return report, nil
+}
+
+func key(x *Item, match string) string {
+	switch match {
+	case MATCH_SHA1:
+		return strings.ToLower(strings.TrimSpace(x.Sha1))
+	case MATCH_NAME:
+		return strings.ToLower(strings.TrimSpace(x.Name))
+	case MATCH_EXTERNAL_ID:
+		return strings.TrimSpace(x.ExternalID)
+	default:
+		return ""
+	}
+}
+
+func diff(m, e *Item, fields []string, match string) []FieldDiff {
+	diffs := make([]FieldDiff, 0)
+	for _, f := range fields {
+		if f == match {
+			continue
+		}
+
+		switch f {
+		case FIELD_SHA1:
+			if m.Sha1 != "" && e.Sha1 != "" && !strings.EqualFold(m.Sha1, e.Sha1) {
+				diffs = append(diffs, FieldDiff{Field: f, MDB: m.Sha1, External: e.Sha1})
+			}
+		case FIELD_NAME:
+			if m.Name != "" && e.Name != "" && m.Name != e.Name {
+				diffs = append(diffs, FieldDiff{Field: f, MDB: m.Name, External: e.Name})
+			}
+		case FIELD_SIZE:
+			if m.Size > 0 && e.Size > 0 && m.Size != e.Size {
+				diffs = append(diffs, FieldDiff{
+					Field:    f,
+					MDB:      strconv.FormatInt(m.Size, 10),
+					External: strconv.FormatInt(e.Size, 10),
+				})
+			}
+		}
+	}
+	return diffs
+}
+
+func location(x *Item) string {
+	if x == nil {
+		return ""
+	}
+	if x.Location != "" {
+		return x.Location
+	}
+	if x.ExternalID != "" {
+		return x.ExternalID
+	}
+	return x.Name
+}
+
+func contains(a []string, x string) bool {
+	for _, y := range a {
+		if y == x {
+			return true
+		}
+	}
+	return false
+}
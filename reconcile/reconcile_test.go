@@ -0,0 +1,177 @@
+package reconcile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	SHA_A = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	SHA_B = "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+	SHA_C = "cccccccccccccccccccccccccccccccccccccccc"
+	SHA_D = "dddddddddddddddddddddddddddddddddddddddd"
+)
+
+func byStatus(report *Report) map[string][]*Result {
+	m := make(map[string][]*Result)
+	for _, r := range report.Results {
+		m[r.Status] = append(m[r.Status], r)
+	}
+	return m
+}
+
+func TestReconcileSha1(t *testing.T) {
+	mdb := []*Item{
+		{ID: 1, UID: "u1", Name: "a.mp3", Sha1: SHA_A, Size: 10},
+		{ID: 2, UID: "u2", Name: "b.mp3", Sha1: SHA_B, Size: 20},
+		{ID: 3, UID: "u3", Name: "c.mp3", Sha1: SHA_C, Size: 30},
+		{ID: 4, UID: "u4", Name: "nosha.mp3"},
+	}
+	ext := []*Item{
+		{Name: "a.mp3", Sha1: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA", Size: 10},
+		{Name: "b.mp3", Sha1: SHA_B, Size: 21},
+		{Name: "d.mp3", Sha1: SHA_D},
+		{Name: "e.mp3"},
+	}
+
+	report, err := Reconcile(mdb, ext, Options{Match: MATCH_SHA1})
+	assert.Nil(t, err)
+	s := byStatus(report)
+
+	if assert.Len(t, s[STATUS_MATCHED], 1) {
+		assert.Equal(t, int64(1), s[STATUS_MATCHED][0].MDB.ID)
+	}
+	if assert.Len(t, s[STATUS_MISSING_IN_MDB], 1) {
+		assert.Equal(t, "d.mp3", s[STATUS_MISSING_IN_MDB][0].External.Name)
+	}
+	if assert.Len(t, s[STATUS_MISSING_EXTERNALLY], 1) {
+		assert.Equal(t, int64(3), s[STATUS_MISSING_EXTERNALLY][0].MDB.ID)
+	}
+	if assert.Len(t, s[STATUS_CONFLICT], 2) {
+		assert.Equal(t, []FieldDiff{{Field: FIELD_SIZE, MDB: "20", External: "21"}}, s[STATUS_CONFLICT][0].Diffs)
+		assert.Equal(t, "e.mp3", s[STATUS_CONFLICT][1].External.Name)
+		assert.NotEmpty(t, s[STATUS_CONFLICT][1].Message)
+	}
+}
+
+func TestReconcileAmbiguous(t *testing.T) {
+	mdb := []*Item{
+		{ID: 1, Name: "a.mp3", ExternalID: "100"},
+		{ID: 2, Name: "a.mp3", ExternalID: "101"},
+		{ID: 3, Name: "b.mp3", ExternalID: "102"},
+	}
+	ext := []*Item{
+		{Name: "A.mp3", ExternalID: "100"},
+		{Name: "b.mp3", ExternalID: "102"},
+		{Name: "b.mp3", ExternalID: "103"},
+	}
+
+	report, err := Reconcile(mdb, ext, Options{Match: MATCH_NAME})
+	assert.Nil(t, err)
+	s := byStatus(report)
+	assert.Len(t, s[STATUS_MATCHED], 1)
+	assert.Len(t, s[STATUS_CONFLICT], 2)
+	assert.Len(t, s[STATUS_MISSING_EXTERNALLY], 0)
+
+	report, err = Reconcile(mdb, ext, Options{Match: MATCH_EXTERNAL_ID, Compare: []string{FIELD_NAME}})
+	assert.Nil(t, err)
+	s = byStatus(report)
+	assert.Len(t, s[STATUS_MATCHED], 1)
+	assert.Len(t, s[STATUS_CONFLICT], 1)
+	assert.Len(t, s[STATUS_MISSING_IN_MDB], 1)
+	assert.Len(t, s[STATUS_MISSING_EXTERNALLY], 1)
+
+	plan := MakePlan(report)
+	actions := make(map[string]int)
+	for _, a := range plan.Actions {
+		actions[a.Action]++
+	}
+	assert.Equal(t, map[string]int{ACTION_UPDATE: 1, ACTION_IMPORT: 1, ACTION_VERIFY: 1}, actions)
+
+	_, err = Reconcile(mdb, ext, Options{Match: "uid"})
+	assert.NotNil(t, err)
+}
+
+func TestSheetAdapter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "catalog.csv")
+	content := "External_ID,Name,SHA1,Size,Location\n" +
+		"100,a.mp3," + SHA_A + ",10,http://example.com/a.mp3\n" +
+		"101,b.mp3,,,\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	adapter, err := NewAdapter("sheet", path, AdapterOptions{})
+	assert.Nil(t, err)
+	items, err := adapter.Load()
+	assert.Nil(t, err)
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, &Item{ExternalID: "100", Name: "a.mp3", Sha1: SHA_A, Size: 10, Location: "http://example.com/a.mp3"}, items[0])
+		assert.Equal(t, &Item{ExternalID: "101", Name: "b.mp3"}, items[1])
+	}
+
+	if err := ioutil.WriteFile(path, []byte("name,sha1\na.mp3,xyz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = adapter.Load()
+	assert.NotNil(t, err)
+}
+
+func TestDirAdapter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := (&DirAdapter{Root: dir, Hash: true}).Load()
+	assert.Nil(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "sub/a.txt", items[0].ExternalID)
+		assert.Equal(t, "a.txt", items[0].Name)
+		assert.Equal(t, int64(5), items[0].Size)
+		assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d", items[0].Sha1)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	report, err := Reconcile([]*Item{{ID: 1, UID: "u1", Sha1: SHA_A}}, []*Item{{Name: "b", Sha1: SHA_B}}, Options{Match: MATCH_SHA1})
+	assert.Nil(t, err)
+
+	for _, format := range []string{FORMAT_CSV, FORMAT_XLSX} {
+		path := filepath.Join(dir, "report."+format)
+		assert.Nil(t, WriteReport(path, format, report))
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		assert.True(t, info.Size() > 0)
+	}
+
+	path := filepath.Join(dir, "plan.json")
+	assert.Nil(t, WritePlan(path, report))
+}
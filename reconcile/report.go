@@ -0,0 +1,171 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/360EntSecGroup-Skylar/excelize"
+	"github.com/pkg/errors"
+)
+
+const (
+	FORMAT_CSV  = "csv"
+	FORMAT_XLSX = "xlsx"
+	XLSX_SHEET  = "Sheet1"
+)
+
+var REPORT_COLUMNS = []string{"status", "key",
+	"mdb_id", "mdb_uid", "mdb_name", "mdb_sha1", "mdb_size",
+	"external_id", "external_name", "external_sha1", "external_size", "location",
+	"diffs", "message"}
+
+func (r *Result) row() []string {
+	m, e := r.MDB, r.External
+	if m == nil {
+		m = new(Item)
+	}
+	if e == nil {
+		e = new(Item)
+	}
+
+	diffs := make([]string, len(r.Diffs))
+	for i, d := range r.Diffs {
+		diffs[i] = fmt.Sprintf("%s: %s => %s", d.Field, d.MDB, d.External)
+	}
+
+	return []string{r.Status, r.Key,
+		formatInt(m.ID), m.UID, m.Name, m.Sha1, formatInt(m.Size),
+		e.ExternalID, e.Name, e.Sha1, formatInt(e.Size), e.Location,
+		strings.Join(diffs, "; "), r.Message}
+}
+
+// WriteReport writes all results of a reconciliation to path in the given format
+func WriteReport(path, format string, report *Report) error {
+	if format == FORMAT_XLSX {
+		out := excelize.NewFile()
+		for i, h := range REPORT_COLUMNS {
+			out.SetCellStr(XLSX_SHEET, xlsxCell(i, 1), h)
+		}
+		for i, r := range report.Results {
+			for j, v := range r.row() {
+				out.SetCellStr(XLSX_SHEET, xlsxCell(j, i+2), v)
+			}
+		}
+		return errors.Wrap(out.SaveAs(path), "Save xlsx report")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Create report file")
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(REPORT_COLUMNS); err != nil {
+		return errors.Wrap(err, "Write report header")
+	}
+	for i, r := range report.Results {
+		if err := w.Write(r.row()); err != nil {
+			return errors.Wrapf(err, "Write report line %d", i)
+		}
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "Flush report")
+}
+
+// Fix-up actions
+const (
+	ACTION_IMPORT = "import" // bring a missing external file into MDB
+	ACTION_UPDATE = "update" // set an MDB file field to the external value
+	ACTION_REVIEW = "review" // ambiguous, a human should decide
+	ACTION_VERIFY = "verify" // MDB file unknown to the catalog, check whether it should be there
+)
+
+// Action is a suggested fix-up of a single reconciliation result.
+// Actions are never applied automatically, they're meant for review and follow up tooling.
+type Action struct {
+	Action   string `json:"action"`
+	FileID   int64  `json:"file_id,omitempty"`
+	FileUID  string `json:"file_uid,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Value    string `json:"value,omitempty"`
+	External *Item  `json:"external,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type Plan struct {
+	Catalog string    `json:"catalog"`
+	Match   string    `json:"match"`
+	Actions []*Action `json:"actions"`
+}
+
+// MakePlan suggests fix-up actions for everything not matched
+func MakePlan(report *Report) *Plan {
+	plan := &Plan{
+		Catalog: report.Catalog,
+		Match:   report.Match,
+		Actions: make([]*Action, 0),
+	}
+
+	for _, r := range report.Results {
+		switch r.Status {
+		case STATUS_MISSING_IN_MDB:
+			plan.Actions = append(plan.Actions, &Action{
+				Action:   ACTION_IMPORT,
+				External: r.External,
+			})
+		case STATUS_MISSING_EXTERNALLY:
+			plan.Actions = append(plan.Actions, &Action{
+				Action:  ACTION_VERIFY,
+				FileID:  r.MDB.ID,
+				FileUID: r.MDB.UID,
+			})
+		case STATUS_CONFLICT:
+			if r.MDB == nil || len(r.Diffs) == 0 {
+				plan.Actions = append(plan.Actions, &Action{
+					Action:   ACTION_REVIEW,
+					External: r.External,
+					Reason:   r.Message,
+				})
+				continue
+			}
+			for _, d := range r.Diffs {
+				plan.Actions = append(plan.Actions, &Action{
+					Action:   ACTION_UPDATE,
+					FileID:   r.MDB.ID,
+					FileUID:  r.MDB.UID,
+					Field:    d.Field,
+					Value:    d.External,
+					External: r.External,
+				})
+			}
+		}
+	}
+
+	return plan
+}
+
+// WritePlan writes the fix-up plan of a report as JSON
+func WritePlan(path string, report *Report) error {
+	b, err := json.MarshalIndent(MakePlan(report), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, b, 0644), "Write plan file")
+}
+
+func formatInt(v int64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func xlsxCell(col, row int) string {
+	return fmt.Sprintf("%c%d", 'A'+col, row)
+}
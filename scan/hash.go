@@ -0,0 +1,204 @@
+package scan
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/reconcile"
+)
+
+// CacheEntry is the sha1 of a file as of its size and modification time
+type CacheEntry struct {
+	Path    string `json:"path"` // relative to the scanned root
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // unix nano
+	Sha1    string `json:"sha1"`
+}
+
+// HashCache remembers the hashes of previous (possibly interrupted) scans.
+// Entries are appended to a JSON lines file as soon as they're computed, later lines win.
+type HashCache struct {
+	entries map[string]CacheEntry
+	f       *os.File
+	mu      sync.Mutex
+}
+
+// OpenHashCache loads the cache file at path, creating it if missing
+func OpenHashCache(path string) (*HashCache, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Open hash cache %s", path)
+	}
+
+	c := &HashCache{entries: make(map[string]CacheEntry), f: f}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e CacheEntry
+		// an interrupted run might leave a partial last line
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		c.entries[e.Path] = e
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "Read hash cache %s", path)
+	}
+
+	return c, nil
+}
+
+func (c *HashCache) Len() int {
+	return len(c.entries)
+}
+
+// Lookup returns the cached sha1 of a file if it wasn't changed since
+func (c *HashCache) Lookup(path string, size, modTime int64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[path]
+	if !ok || e.Size != size || e.ModTime != modTime {
+		return "", false
+	}
+	return e.Sha1, true
+}
+
+func (c *HashCache) Add(e CacheEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[e.Path] = e
+	if _, err := c.f.Write(append(b, '\n')); err != nil {
+		return errors.Wrap(err, "Write hash cache")
+	}
+	return nil
+}
+
+func (c *HashCache) Close() error {
+	return c.f.Close()
+}
+
+// HashTree walks root and hashes its files with the given number of workers.
+// Files found in cache (same size and modification time) aren't read again.
+// Hidden files and directories are skipped.
+func HashTree(root string, cache *HashCache, workers int) ([]*reconcile.Item, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	entries := make([]*CacheEntry, 0)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(info.Name(), ".") && path != root {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &CacheEntry{
+			Path:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Walk %s", root)
+	}
+	log.Infof("%d files under %s", len(entries), root)
+
+	jobs := make(chan *CacheEntry)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	var done, hashed int
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				var cached bool
+				e.Sha1, cached = cache.Lookup(e.Path, e.Size, e.ModTime)
+				if !cached {
+					var err error
+					e.Sha1, err = reconcile.Sha1File(filepath.Join(root, filepath.FromSlash(e.Path)))
+					if err == nil {
+						err = cache.Add(*e)
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+
+				mu.Lock()
+				done++
+				if !cached {
+					hashed++
+				}
+				if done%1000 == 0 {
+					log.Infof("%d / %d files (%d hashed)", done, len(entries), hashed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var firstErr error
+	for _, e := range entries {
+		select {
+		case err := <-errs:
+			firstErr = err
+		case jobs <- e:
+		}
+		if firstErr != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+	if firstErr == nil {
+		firstErr = <-errs
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	log.Infof("%d files, %d hashed, %d from cache", done, hashed, done-hashed)
+
+	items := make([]*reconcile.Item, len(entries))
+	for i, e := range entries {
+		items[i] = &reconcile.Item{
+			ExternalID: e.Path,
+			Name:       filepath.Base(e.Path),
+			Sha1:       e.Sha1,
+			Size:       e.Size,
+			Location:   e.Path,
+		}
+	}
+
+	return items, nil
+}
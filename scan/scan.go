@@ -0,0 +1,204 @@
+package scan
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/common"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/reconcile"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+type Params struct {
+	Root    string
+	Cache   string // hash cache file, default in the temp dir by root
+	Workers int    // parallel hashing, default number of CPUs
+	Scope   reconcile.MDBScope
+	Format  string // reconcile.FORMAT_CSV (default) or reconcile.FORMAT_XLSX
+	Output  string // report path, default in /tmp
+	Storage string // register found copies against this storage (by name), none if empty
+}
+
+// Summary counts a scan's findings
+type Summary struct {
+	Matched    int // same sha1, name and size
+	Renamed    int // same sha1, different name
+	Unknown    int // no MDB file with this sha1
+	Missing    int // MDB files not found in the tree
+	Conflicts  int // duplicates in the tree or ambiguous sha1 in MDB
+	Registered int // copies registered against storage
+}
+
+// Command scans a directory tree and matches its files to MDB files by sha1
+func Command(params Params) {
+	clock := time.Now()
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	root, err := filepath.Abs(params.Root)
+	utils.Must(err)
+	if params.Cache == "" {
+		params.Cache = DefaultCachePath(root)
+	}
+	if params.Workers < 1 {
+		params.Workers = runtime.NumCPU()
+	}
+	switch params.Format {
+	case "":
+		params.Format = reconcile.FORMAT_CSV
+	case reconcile.FORMAT_CSV, reconcile.FORMAT_XLSX:
+	default:
+		utils.Must(errors.Errorf("Unknown report format %s", params.Format))
+	}
+
+	cache, err := OpenHashCache(params.Cache)
+	utils.Must(err)
+	defer cache.Close()
+	log.Infof("Hash cache %s has %d entries", params.Cache, cache.Len())
+
+	items, err := HashTree(root, cache, params.Workers)
+	utils.Must(err)
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	defer db.Close()
+	utils.Must(common.InitTypeRegistries(db))
+
+	mdbItems, err := reconcile.LoadMDBFiles(db, params.Scope)
+	utils.Must(err)
+	log.Infof("MDB has %d files in scope", len(mdbItems))
+
+	report, err := reconcile.Reconcile(mdbItems, items, reconcile.Options{
+		Match:   reconcile.MATCH_SHA1,
+		Compare: []string{reconcile.FIELD_NAME, reconcile.FIELD_SIZE},
+	})
+	utils.Must(err)
+	report.Catalog = root
+
+	summary := Summarize(report)
+
+	if params.Storage != "" {
+		tx, err := db.Begin()
+		utils.Must(err)
+		summary.Registered, err = RegisterCopies(tx, params.Storage, report)
+		if err != nil {
+			utils.Must(tx.Rollback())
+			utils.Must(err)
+		}
+		utils.Must(tx.Commit())
+	}
+
+	path := params.Output
+	if path == "" {
+		path = fmt.Sprintf("/tmp/scan_%s.%s", time.Now().Format("20060102_150405"), params.Format)
+	}
+	utils.Must(reconcile.WriteReport(path, params.Format, report))
+	log.Infof("Report file: %s", path)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "matched\t%d\n", summary.Matched)
+	fmt.Fprintf(w, "renamed\t%d\n", summary.Renamed)
+	fmt.Fprintf(w, "unknown\t%d\n", summary.Unknown)
+	fmt.Fprintf(w, "missing\t%d\n", summary.Missing)
+	fmt.Fprintf(w, "conflicts\t%d\n", summary.Conflicts)
+	if params.Storage != "" {
+		fmt.Fprintf(w, "registered\t%d\n", summary.Registered)
+	}
+	w.Flush()
+
+	log.Info("Success")
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+// DefaultCachePath is a per root hash cache file in the temp dir
+func DefaultCachePath(root string) string {
+	h := sha1.Sum([]byte(root))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("mdb_scan_%s.jsonl", hex.EncodeToString(h[:6])))
+}
+
+func Summarize(report *reconcile.Report) *Summary {
+	s := new(Summary)
+	for _, r := range report.Results {
+		switch r.Status {
+		case reconcile.STATUS_MATCHED:
+			s.Matched++
+		case reconcile.STATUS_MISSING_IN_MDB:
+			s.Unknown++
+		case reconcile.STATUS_MISSING_EXTERNALLY:
+			s.Missing++
+		case reconcile.STATUS_CONFLICT:
+			if isFoundCopy(r) {
+				s.Renamed++
+			} else {
+				s.Conflicts++
+			}
+		}
+	}
+	return s
+}
+
+// isFoundCopy tells if a result is an MDB file found in the tree, possibly under another name
+func isFoundCopy(r *reconcile.Result) bool {
+	if r.MDB == nil || r.External == nil {
+		return false
+	}
+	if r.Status == reconcile.STATUS_MATCHED {
+		return true
+	}
+	return r.Status == reconcile.STATUS_CONFLICT && len(r.Diffs) > 0
+}
+
+// RegisterCopies maps the MDB files found in the tree to a storage.
+// As files were matched by sha1, their copies are also marked as verified.
+func RegisterCopies(exec boil.Executor, storage string, report *reconcile.Report) (int, error) {
+	s, err := models.Storages(exec, qm.Where("name = ?", storage)).One()
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, errors.Errorf("Unknown storage %s", storage)
+		}
+		return 0, errors.Wrap(err, "Lookup storage")
+	}
+
+	now := time.Now().UTC()
+	count := 0
+	for _, r := range report.Results {
+		if !isFoundCopy(r) {
+			continue
+		}
+
+		sha1, err := hex.DecodeString(r.MDB.Sha1)
+		if err != nil {
+			return count, errors.Wrapf(err, "Decode sha1 [%d]", r.MDB.ID)
+		}
+
+		_, err = queries.Raw(exec,
+			`INSERT INTO files_storages (file_id, storage_id, verified_at, verified_sha1, fixity_status)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (file_id, storage_id) DO UPDATE
+SET verified_at = EXCLUDED.verified_at, verified_sha1 = EXCLUDED.verified_sha1, fixity_status = EXCLUDED.fixity_status`,
+			r.MDB.ID, s.ID, now, sha1, api.FIXITY_STATUS_OK).Exec()
+		if err != nil {
+			return count, errors.Wrapf(err, "Register file %d on storage %s", r.MDB.ID, storage)
+		}
+		count++
+	}
+
+	log.Infof("Registered %d copies on storage %s", count, storage)
+	return count, nil
+}
@@ -0,0 +1,95 @@
+package scan
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Bnei-Baruch/mdb/reconcile"
+)
+
+const (
+	SHA1_HELLO = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+	SHA1_WORLD = "7c211433f02071597741e6ff5a8ea34789abbf43"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "tree")
+	writeFile(t, filepath.Join(root, "a", "hello.txt"), "hello")
+	writeFile(t, filepath.Join(root, "world.txt"), "world")
+	writeFile(t, filepath.Join(root, ".git", "config"), "x")
+	writeFile(t, filepath.Join(root, ".DS_Store"), "x")
+
+	cachePath := filepath.Join(dir, "cache.jsonl")
+	cache, err := OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	items, err := HashTree(root, cache, 4)
+	assert.Nil(t, err)
+	assert.Nil(t, cache.Close())
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Location < items[j].Location })
+	if assert.Len(t, items, 2) {
+		assert.Equal(t, &reconcile.Item{ExternalID: "a/hello.txt", Name: "hello.txt", Sha1: SHA1_HELLO, Size: 5, Location: "a/hello.txt"}, items[0])
+		assert.Equal(t, SHA1_WORLD, items[1].Sha1)
+	}
+
+	// resume with a partial last line, cached hashes are reused
+	f, err := os.OpenFile(cachePath, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(`{"path": "wor`)
+	assert.Nil(t, err)
+	f.Close()
+
+	cache, err = OpenHashCache(cachePath)
+	assert.Nil(t, err)
+	defer cache.Close()
+	assert.Equal(t, 2, cache.Len())
+
+	info, err := os.Stat(filepath.Join(root, "world.txt"))
+	assert.Nil(t, err)
+	sha1, ok := cache.Lookup("world.txt", info.Size(), info.ModTime().UnixNano())
+	assert.True(t, ok)
+	assert.Equal(t, SHA1_WORLD, sha1)
+	_, ok = cache.Lookup("world.txt", info.Size()+1, info.ModTime().UnixNano())
+	assert.False(t, ok)
+}
+
+func TestSummarize(t *testing.T) {
+	mdb := []*reconcile.Item{
+		{ID: 1, Name: "hello.txt", Sha1: SHA1_HELLO, Size: 5},
+		{ID: 2, Name: "world.txt", Sha1: SHA1_WORLD, Size: 5},
+		{ID: 3, Name: "gone.txt", Sha1: "cccccccccccccccccccccccccccccccccccccccc"},
+	}
+	tree := []*reconcile.Item{
+		{Name: "hello.txt", Sha1: SHA1_HELLO, Size: 5},
+		{Name: "world_renamed.txt", Sha1: SHA1_WORLD, Size: 5},
+		{Name: "hello_copy.txt", Sha1: SHA1_HELLO, Size: 5},
+		{Name: "new.txt", Sha1: "dddddddddddddddddddddddddddddddddddddddd", Size: 1},
+	}
+
+	report, err := reconcile.Reconcile(mdb, tree, reconcile.Options{
+		Match:   reconcile.MATCH_SHA1,
+		Compare: []string{reconcile.FIELD_NAME, reconcile.FIELD_SIZE},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, &Summary{Matched: 1, Renamed: 1, Unknown: 1, Missing: 1, Conflicts: 1}, Summarize(report))
+}
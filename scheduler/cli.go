@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func openDB() *sql.DB {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	return db
+}
+
+// ServeCommand runs the configured schedules until interrupted
+func ServeCommand() {
+	configs, err := LoadConfig()
+	utils.Must(err)
+
+	db := openDB()
+	defer db.Close()
+
+	s, err := New(db, configs)
+	utils.Must(err)
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Scheduler: got %s, stopping after the running task (if any)", sig)
+		close(stop)
+	}()
+
+	log.Infof("Scheduler: starting with %d schedules", len(configs))
+	s.Run(stop)
+	log.Info("Scheduler: stopped")
+}
+
+// RunCommand runs a single task now, subject to the same lock as scheduled runs
+func RunCommand(name string) {
+	task, ok := Lookup(name)
+	if !ok {
+		utils.Must(errors.Errorf("Unknown scheduler task %s", name))
+	}
+
+	db := openDB()
+	defer db.Close()
+
+	s, err := New(db, nil)
+	utils.Must(err)
+
+	run, err := s.RunTask(task)
+	utils.Must(err)
+	if run.Error.Valid {
+		utils.Must(errors.New(run.Error.String))
+	}
+	log.Infof("Run %d: %s", run.ID, run.Status)
+}
+
+func RunsCommand(task, status string, limit int) {
+	db := openDB()
+	defer db.Close()
+
+	_, runs, err := FindRuns(db, task, status, limit, 0)
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTASK\tSTATUS\tHOST\tSTARTED\tDURATION\tERROR")
+	for _, run := range runs {
+		var duration string
+		if run.FinishedAt.Valid {
+			duration = run.FinishedAt.Time.Sub(run.StartedAt).String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID, run.Task, run.Status, run.Host.String, run.StartedAt.Format(time.RFC3339), duration, run.Error.String)
+	}
+	utils.Must(w.Flush())
+}
+
+func TasksCommand() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tDESCRIPTION")
+	for _, t := range Tasks() {
+		fmt.Fprintf(w, "%s\t%s\n", t.Name, t.Description)
+	}
+	utils.Must(w.Flush())
+}
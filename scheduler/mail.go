@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+const (
+	DEFAULT_LOG_FILE  = "/sites/mdb/logs/mdb.log"
+	DEFAULT_MAIL_FROM = "mdb@bbdomain.org"
+	DEFAULT_SMTP_ADDR = "localhost:25"
+)
+
+// EmailWarnings mails yesterday's warning and error lines in the mdb log.
+// It replaces the old email_warnings.sh cron script.
+func EmailWarnings() error {
+	to := viper.GetStringSlice("scheduler.mail-to")
+	if len(to) == 0 {
+		return errors.New("scheduler.mail-to is not configured")
+	}
+
+	logFile := viper.GetString("scheduler.log-file")
+	if logFile == "" {
+		logFile = DEFAULT_LOG_FILE
+	}
+
+	date := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	f, err := os.Open(logFile)
+	if err != nil {
+		return errors.Wrap(err, "open log file")
+	}
+	defer f.Close()
+
+	lines, err := GrepWarnings(f, date)
+	if err != nil {
+		return errors.Wrap(err, "scan log file")
+	}
+	if len(lines) == 0 {
+		log.Infof("No warnings on %s", date)
+		return nil
+	}
+
+	subject := fmt.Sprintf("MDB warnings %s [%d]", date, len(lines))
+	return sendMail(to, subject, strings.Join(lines, "\n"))
+}
+
+// GrepWarnings returns the lines logged at warning or error level on date (YYYY-MM-DD)
+func GrepWarnings(r io.Reader, date string) ([]string, error) {
+	re := regexp.MustCompile(regexp.QuoteMeta(date) + `.* level=(warning|error)`)
+
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if re.MatchString(scanner.Text()) {
+			lines = append(lines, scanner.Text())
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// mailFailure notifies scheduler.mail-to of a failed task, if configured
+func mailFailure(task string, runErr error) error {
+	to := viper.GetStringSlice("scheduler.mail-to")
+	if len(to) == 0 || !viper.GetBool("scheduler.mail-failures") {
+		return nil
+	}
+
+	return sendMail(to, fmt.Sprintf("ERROR: MDB scheduler task %s", task), runErr.Error())
+}
+
+func sendMail(to []string, subject, body string) error {
+	addr := viper.GetString("scheduler.smtp-addr")
+	if addr == "" {
+		addr = DEFAULT_SMTP_ADDR
+	}
+	from := viper.GetString("scheduler.mail-from")
+	if from == "" {
+		from = DEFAULT_MAIL_FROM
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body)
+	msg.WriteString("\r\n")
+
+	return errors.Wrap(smtp.SendMail(addr, nil, from, to, msg.Bytes()), "smtp.SendMail")
+}
@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+const (
+	RUN_STATUS_RUNNING   = "running"
+	RUN_STATUS_SUCCEEDED = "succeeded"
+	RUN_STATUS_FAILED    = "failed"
+	RUN_STATUS_SKIPPED   = "skipped"
+)
+
+// Run is a single execution (or skipped execution) of a scheduled task
+type Run struct {
+	ID         int64       `boil:"id" json:"id"`
+	Task       string      `boil:"task" json:"task"`
+	Status     string      `boil:"status" json:"status"`
+	Host       null.String `boil:"host" json:"host"`
+	Error      null.String `boil:"error" json:"error"`
+	StartedAt  time.Time   `boil:"started_at" json:"started_at"`
+	FinishedAt null.Time   `boil:"finished_at" json:"finished_at"`
+}
+
+func insertRun(exec boil.Executor, task, status, host string, runErr error) (*Run, error) {
+	run := new(Run)
+	var errMsg null.String
+	if runErr != nil {
+		errMsg = null.StringFrom(runErr.Error())
+	}
+
+	err := queries.Raw(exec,
+		`INSERT INTO scheduler_runs (task, status, host, error, finished_at)
+VALUES ($1, $2, $3, $4, CASE WHEN $2 = 'running' THEN NULL ELSE now_utc() END) RETURNING *`,
+		task, status, null.NewString(host, host != ""), errMsg).Bind(run)
+	if err != nil {
+		return nil, errors.Wrap(err, "insert scheduler run")
+	}
+
+	return run, nil
+}
+
+func finishRun(exec boil.Executor, run *Run, runErr error) error {
+	run.Status = RUN_STATUS_SUCCEEDED
+	run.Error = null.String{}
+	if runErr != nil {
+		run.Status = RUN_STATUS_FAILED
+		run.Error = null.StringFrom(runErr.Error())
+	}
+
+	err := queries.Raw(exec,
+		`UPDATE scheduler_runs SET status = $2, error = $3, finished_at = now_utc() WHERE id = $1 RETURNING finished_at`,
+		run.ID, run.Status, run.Error).QueryRow().Scan(&run.FinishedAt)
+	return errors.Wrapf(err, "finish scheduler run %d", run.ID)
+}
+
+// FindRuns returns runs, most recent first, optionally filtered by task and status
+func FindRuns(exec boil.Executor, task, status string, limit, offset int) (int64, []*Run, error) {
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+	if task != "" {
+		args = append(args, task)
+		where = append(where, fmt.Sprintf("task = $%d", len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int64
+	err := queries.Raw(exec, "SELECT count(*) FROM scheduler_runs "+whereClause, args...).
+		QueryRow().Scan(&total)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "count scheduler runs")
+	}
+
+	runs := make([]*Run, 0)
+	if total == 0 {
+		return 0, runs, nil
+	}
+
+	args = append(args, limit, offset)
+	err = queries.Raw(exec,
+		fmt.Sprintf("SELECT * FROM scheduler_runs %s ORDER BY started_at DESC, id DESC LIMIT $%d OFFSET $%d",
+			whereClause, len(args)-1, len(args)),
+		args...).Bind(&runs)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, nil, errors.Wrap(err, "load scheduler runs")
+	}
+
+	return total, runs, nil
+}
+
+// LatestRuns returns the most recent run of each task
+func LatestRuns(exec boil.Executor) ([]*Run, error) {
+	runs := make([]*Run, 0)
+	err := queries.Raw(exec,
+		`SELECT DISTINCT ON (task) * FROM scheduler_runs ORDER BY task, started_at DESC, id DESC`).
+		Bind(&runs)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "load latest scheduler runs")
+	}
+	return runs, nil
+}
@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2026, 10, 18, 10, 35, 13, 0, time.UTC)
+
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"0 0 * * *", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC)},
+		{"*/10 * * * *", time.Date(2026, 10, 18, 10, 40, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2026, 10, 18, 11, 5, 0, 0, time.UTC)},
+		{"30-40/5 10 * * *", time.Date(2026, 10, 18, 10, 40, 0, 0, time.UTC)},
+		{"15,45 9 * * *", time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)}, // 2026-10-18 is a sunday
+		{"0 0 1 * 1", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)}, // either dom or dow
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 18, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+
+	for _, tc := range cases {
+		s, err := ParseSchedule(tc.spec)
+		if assert.Nil(t, err, tc.spec) {
+			assert.Equal(t, tc.next, s.Next(base), tc.spec)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *",
+		"*/0 * * * *", "5-1 * * * *", "a * * * *", "@every", "@every 1ms", "@yearly"} {
+		_, err := ParseSchedule(spec)
+		assert.NotNil(t, err, spec)
+	}
+}
+
+func TestGrepWarnings(t *testing.T) {
+	log := `time="2026-10-17T10:00:00Z" level=info msg="fine"
+time="2026-10-17T11:00:00Z" level=warning msg="hmm"
+time="2026-10-17T12:00:00Z" level=error msg="bad"
+time="2026-10-18T00:00:01Z" level=error msg="today"
+`
+	lines, err := GrepWarnings(strings.NewReader(log), "2026-10-17")
+	if assert.Nil(t, err) {
+		assert.Equal(t, []string{
+			`time="2026-10-17T11:00:00Z" level=warning msg="hmm"`,
+			`time="2026-10-17T12:00:00Z" level=error msg="bad"`,
+		}, lines)
+	}
+}
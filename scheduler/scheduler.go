@@ -0,0 +1,240 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Namespace (first key) of the postgres advisory locks taken by the scheduler.
+// The second key is a hash of the task name.
+const LOCK_NAMESPACE = 0x6d6462 // "mdb"
+
+// Task is a unit of periodic work.
+// Tasks run serially within a process since the importers share global state.
+type Task struct {
+	Name        string
+	Description string
+	Run         func() error
+}
+
+// TaskConfig is a [[scheduler.tasks]] entry in the config file
+type TaskConfig struct {
+	Name     string `mapstructure:"name"`
+	Schedule string `mapstructure:"schedule"`
+}
+
+var (
+	registry   = make(map[string]*Task)
+	registryMu sync.RWMutex
+)
+
+// Register makes a task available to schedules. Panics on duplicates.
+func Register(task *Task) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if task.Run == nil {
+		panic("scheduler: task " + task.Name + " has no Run function")
+	}
+	if _, ok := registry[task.Name]; ok {
+		panic("scheduler: task " + task.Name + " registered twice")
+	}
+	registry[task.Name] = task
+}
+
+func Lookup(name string) (*Task, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	task, ok := registry[name]
+	return task, ok
+}
+
+// Tasks returns all registered tasks sorted by name
+func Tasks() []*Task {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	tasks := make([]*Task, 0, len(registry))
+	for _, t := range registry {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks
+}
+
+// LoadConfig reads the [[scheduler.tasks]] entries from the config file
+func LoadConfig() ([]TaskConfig, error) {
+	var configs []TaskConfig
+	if err := viper.UnmarshalKey("scheduler.tasks", &configs); err != nil {
+		return nil, errors.Wrap(err, "scheduler.tasks")
+	}
+	return configs, nil
+}
+
+type entry struct {
+	task     *Task
+	spec     string
+	schedule Schedule
+	next     time.Time
+}
+
+type Scheduler struct {
+	DB      *sql.DB
+	Host    string
+	entries []*entry
+}
+
+// New validates the given schedules against the registered tasks
+func New(db *sql.DB, configs []TaskConfig) (*Scheduler, error) {
+	s := &Scheduler{DB: db}
+	s.Host, _ = os.Hostname()
+
+	for _, c := range configs {
+		task, ok := Lookup(c.Name)
+		if !ok {
+			return nil, errors.Errorf("Unknown scheduler task %s", c.Name)
+		}
+		schedule, err := ParseSchedule(c.Schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "task %s", c.Name)
+		}
+		s.entries = append(s.entries, &entry{task: task, spec: c.Schedule, schedule: schedule})
+	}
+
+	return s, nil
+}
+
+// Run executes due tasks until stop is closed.
+// A task due while another one is running is started as soon as the running one is done.
+func (s *Scheduler) Run(stop <-chan struct{}) {
+	now := time.Now()
+	for _, e := range s.entries {
+		e.next = e.schedule.Next(now)
+		log.Infof("Scheduler: %s [%s] next run at %s", e.task.Name, e.spec, e.next.Format(time.RFC3339))
+	}
+
+	for {
+		var next time.Time
+		for _, e := range s.entries {
+			if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+				next = e.next
+			}
+		}
+		if next.IsZero() {
+			log.Warn("Scheduler: nothing to schedule")
+			<-stop
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		for _, e := range s.entries {
+			if e.next.IsZero() || e.next.After(time.Now()) {
+				continue
+			}
+
+			if _, err := s.RunTask(e.task); err != nil {
+				log.Errorf("Scheduler: %s: %s", e.task.Name, err.Error())
+			}
+			e.next = e.schedule.Next(time.Now())
+
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// RunTask runs a task once, holding its advisory lock.
+// If another process holds the lock the run is recorded as skipped.
+// The returned error is that of the scheduler itself, task failures are in the returned run.
+func (s *Scheduler) RunTask(task *Task) (*Run, error) {
+	ctx := context.Background()
+
+	// advisory locks are per session so we must stick to a single connection
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Conn")
+	}
+	defer conn.Close()
+
+	key := lockKey(task.Name)
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", LOCK_NAMESPACE, key).Scan(&locked)
+	if err != nil {
+		return nil, errors.Wrap(err, "pg_try_advisory_lock")
+	}
+
+	if !locked {
+		log.Infof("Scheduler: %s is already running elsewhere, skipping", task.Name)
+		return insertRun(s.DB, task.Name, RUN_STATUS_SKIPPED, s.Host, nil)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", LOCK_NAMESPACE, key); err != nil {
+			log.Errorf("Scheduler: pg_advisory_unlock %s: %s", task.Name, err.Error())
+		}
+	}()
+
+	run, err := insertRun(s.DB, task.Name, RUN_STATUS_RUNNING, s.Host, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Scheduler: starting %s", task.Name)
+	clock := time.Now()
+	runErr := runTask(task)
+	if runErr != nil {
+		log.Errorf("Scheduler: %s failed after %s: %s", task.Name, time.Since(clock).String(), runErr.Error())
+		if err := mailFailure(task.Name, runErr); err != nil {
+			log.Errorf("Scheduler: mail failure of %s: %s", task.Name, err.Error())
+		}
+	} else {
+		log.Infof("Scheduler: %s succeeded after %s", task.Name, time.Since(clock).String())
+	}
+
+	if err := finishRun(s.DB, run, runErr); err != nil {
+		return run, err
+	}
+
+	return run, nil
+}
+
+// runTask calls the task's run function turning panics into errors
+func runTask(task *Task) (err error) {
+	defer func() {
+		if rval := recover(); rval != nil {
+			log.Errorf("Scheduler: %s panic: %v\n%s", task.Name, rval, debug.Stack())
+			if e, ok := rval.(error); ok {
+				err = errors.Wrap(e, "panic")
+			} else {
+				err = errors.Errorf("panic: %v", rval)
+			}
+		}
+	}()
+
+	return task.Run()
+}
+
+func lockKey(name string) int32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return int32(h.Sum32())
+}
@@ -0,0 +1,116 @@
+package social
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+func openDB() *sql.DB {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	return db
+}
+
+// ImportCommand imports an export file (telegram) or directory (twitter) of a platform.
+// username identifies the account when the export doesn't (old twitter archives)
+// or completes it (telegram channel links). language is the default language of the account's posts.
+func ImportCommand(platform, path, username, language string) {
+	clock := time.Now()
+
+	db := openDB()
+	defer db.Close()
+
+	var account *Account
+	var posts []*Post
+	var err error
+	switch platform {
+	case PLATFORM_TWITTER:
+		account, posts, err = ParseTwitterArchive(path)
+	case PLATFORM_TELEGRAM:
+		account, posts, err = ParseTelegramExport(path, username)
+	default:
+		err = errors.Errorf("Unknown platform %s", platform)
+	}
+	utils.Must(err)
+	log.Infof("%s has %d posts", path, len(posts))
+
+	tx, err := db.Begin()
+	utils.Must(err)
+
+	if err := importPosts(tx, account, posts, username, language); err != nil {
+		utils.Must(tx.Rollback())
+		utils.Must(err)
+	}
+	utils.Must(tx.Commit())
+
+	log.Info("Success")
+	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
+}
+
+func importPosts(tx *sql.Tx, account *Account, posts []*Post, username, language string) error {
+	if account.AccountID == "" {
+		if username == "" {
+			return errors.New("No account in export, username is required")
+		}
+		existing, err := FindAccount(tx, account.Platform, username)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return errors.Errorf("Unknown %s account %s", account.Platform, username)
+		}
+		account = existing
+	}
+	if l := NormalizeLanguage(language); l != "" {
+		account.Language = null.StringFrom(l)
+	} else if language != "" {
+		return errors.Errorf("Unknown language %s", language)
+	}
+
+	account, err := EnsureAccount(tx, account)
+	if err != nil {
+		return err
+	}
+	log.Infof("Importing into %s account %s [%d]", account.Platform, account.Username.String, account.ID)
+
+	for _, post := range posts {
+		post.AccountID = account.ID
+		if !post.Link.Valid && account.Platform == PLATFORM_TWITTER && account.Username.Valid {
+			post.Link = null.StringFrom(TweetLink(account.Username.String, post.PostID))
+		}
+		if err := UpsertPost(tx, post); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func AccountsCommand() {
+	db := openDB()
+	defer db.Close()
+
+	accounts, err := FindAccounts(db, "")
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPLATFORM\tACCOUNT_ID\tUSERNAME\tNAME\tLANGUAGE")
+	for _, a := range accounts {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			a.ID, a.Platform, a.AccountID, a.Username.String, a.DisplayName.String, a.Language.String)
+	}
+	utils.Must(w.Flush())
+}
@@ -0,0 +1,208 @@
+package social
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+const (
+	PLATFORM_TWITTER  = "twitter"
+	PLATFORM_TELEGRAM = "telegram"
+)
+
+var PLATFORMS = []string{PLATFORM_TWITTER, PLATFORM_TELEGRAM}
+
+// Account is a publishing account (twitter user, telegram channel) on some platform
+type Account struct {
+	ID          int64       `boil:"id" json:"id"`
+	Platform    string      `boil:"platform" json:"platform"`
+	AccountID   string      `boil:"account_id" json:"account_id"`
+	Username    null.String `boil:"username" json:"username"`
+	DisplayName null.String `boil:"display_name" json:"display_name"`
+	Language    null.String `boil:"language" json:"language"`
+	CreatedAt   time.Time   `boil:"created_at" json:"created_at"`
+}
+
+// Post is a single published message of an account. PostID is the platform's id of the message.
+type Post struct {
+	ID        int64       `boil:"id" json:"id"`
+	AccountID int64       `boil:"account_id" json:"account_id"`
+	PostID    string      `boil:"post_id" json:"post_id"`
+	Text      string      `boil:"text" json:"text"`
+	Language  null.String `boil:"language" json:"language"`
+	Link      null.String `boil:"link" json:"link"`
+	PostedAt  time.Time   `boil:"posted_at" json:"posted_at"`
+	Raw       null.JSON   `boil:"raw" json:"raw,omitempty"`
+	CreatedAt time.Time   `boil:"created_at" json:"created_at"`
+}
+
+// PostsFilter selects posts in FindPosts. Zero values are ignored.
+type PostsFilter struct {
+	Platform   string
+	AccountIDs []int64
+	Language   string
+	StartDate  time.Time
+	EndDate    time.Time
+	Query      string // case insensitive substring of the text
+	WithRaw    bool
+}
+
+// NormalizeLanguage maps platform language codes to MDB languages, empty if unknown
+func NormalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	switch code {
+	case "iw":
+		return common.LANG_HEBREW
+	case "", "und", common.LANG_UNKNOWN, common.LANG_MULTI:
+		return ""
+	}
+
+	for _, l := range common.ALL_LANGS {
+		if l == code {
+			return l
+		}
+	}
+	return ""
+}
+
+// EnsureAccount creates the account if missing and updates its non empty details otherwise
+func EnsureAccount(exec boil.Executor, a *Account) (*Account, error) {
+	account := new(Account)
+	err := queries.Raw(exec,
+		`INSERT INTO social_accounts (platform, account_id, username, display_name, language)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (platform, account_id) DO UPDATE SET
+  username = COALESCE(EXCLUDED.username, social_accounts.username),
+  display_name = COALESCE(EXCLUDED.display_name, social_accounts.display_name),
+  language = COALESCE(EXCLUDED.language, social_accounts.language)
+RETURNING *`,
+		a.Platform, a.AccountID, a.Username, a.DisplayName, a.Language).
+		Bind(account)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Upsert account %s %s", a.Platform, a.AccountID)
+	}
+	return account, nil
+}
+
+// FindAccount returns an account by its platform username, nil if not found
+func FindAccount(exec boil.Executor, platform, username string) (*Account, error) {
+	account := new(Account)
+	err := queries.Raw(exec,
+		`SELECT * FROM social_accounts WHERE platform = $1 AND lower(username) = lower($2)`,
+		platform, username).
+		Bind(account)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "Lookup account %s %s", platform, username)
+	}
+	return account, nil
+}
+
+// FindAccounts returns all accounts, of a single platform if given
+func FindAccounts(exec boil.Executor, platform string) ([]*Account, error) {
+	accounts := make([]*Account, 0)
+	err := queries.Raw(exec,
+		`SELECT * FROM social_accounts WHERE $1 = '' OR platform = $1 ORDER BY platform, id`,
+		platform).
+		Bind(&accounts)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "Load accounts")
+	}
+	return accounts, nil
+}
+
+// UpsertPost inserts the post of an account or updates it if it already exists.
+// Posts without language inherit the account's.
+func UpsertPost(exec boil.Executor, p *Post) error {
+	err := queries.Raw(exec,
+		`INSERT INTO social_posts (account_id, post_id, text, language, link, posted_at, raw)
+VALUES ($1, $2, $3, COALESCE($4, (SELECT language FROM social_accounts WHERE id = $1)), $5, $6, $7)
+ON CONFLICT (account_id, post_id) DO UPDATE SET
+  text = EXCLUDED.text,
+  language = EXCLUDED.language,
+  link = EXCLUDED.link,
+  posted_at = EXCLUDED.posted_at,
+  raw = EXCLUDED.raw
+RETURNING *`,
+		p.AccountID, p.PostID, p.Text, p.Language, p.Link, p.PostedAt, p.Raw).
+		Bind(p)
+	if err != nil {
+		return errors.Wrapf(err, "Upsert post %d %s", p.AccountID, p.PostID)
+	}
+	return nil
+}
+
+// FindPosts returns the total number of posts matching the filter and a page of them, most recent first
+func FindPosts(exec boil.Executor, f PostsFilter, limit, offset int) (int64, []*Post, error) {
+	where := make([]string, 0)
+	args := make([]interface{}, 0)
+	if f.Platform != "" {
+		args = append(args, f.Platform)
+		where = append(where, fmt.Sprintf("a.platform = $%d", len(args)))
+	}
+	if len(f.AccountIDs) > 0 {
+		ids := make([]string, len(f.AccountIDs))
+		for i, id := range f.AccountIDs {
+			ids[i] = fmt.Sprintf("%d", id)
+		}
+		where = append(where, fmt.Sprintf("p.account_id IN (%s)", strings.Join(ids, ",")))
+	}
+	if f.Language != "" {
+		args = append(args, f.Language)
+		where = append(where, fmt.Sprintf("p.language = $%d", len(args)))
+	}
+	if !f.StartDate.IsZero() {
+		args = append(args, f.StartDate)
+		where = append(where, fmt.Sprintf("p.posted_at >= $%d", len(args)))
+	}
+	if !f.EndDate.IsZero() {
+		args = append(args, f.EndDate)
+		where = append(where, fmt.Sprintf("p.posted_at <= $%d", len(args)))
+	}
+	if f.Query != "" {
+		args = append(args, "%"+f.Query+"%")
+		where = append(where, fmt.Sprintf("p.text ILIKE $%d", len(args)))
+	}
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = "WHERE " + strings.Join(where, " AND ")
+	}
+	from := "FROM social_posts p INNER JOIN social_accounts a ON p.account_id = a.id " + whereClause
+
+	var total int64
+	err := queries.Raw(exec, "SELECT count(*) "+from, args...).QueryRow().Scan(&total)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Count posts")
+	}
+
+	posts := make([]*Post, 0)
+	if total == 0 {
+		return 0, posts, nil
+	}
+
+	cols := "p.id, p.account_id, p.post_id, p.text, p.language, p.link, p.posted_at, p.created_at"
+	if f.WithRaw {
+		cols += ", p.raw"
+	}
+	args = append(args, limit, offset)
+	err = queries.Raw(exec,
+		fmt.Sprintf("SELECT %s %s ORDER BY p.posted_at DESC, p.id DESC LIMIT $%d OFFSET $%d",
+			cols, from, len(args)-1, len(args)),
+		args...).Bind(&posts)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, nil, errors.Wrap(err, "Load posts")
+	}
+
+	return total, posts, nil
+}
@@ -0,0 +1,117 @@
+package social
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	assert.Equal(t, "he", NormalizeLanguage("iw"))
+	assert.Equal(t, "he", NormalizeLanguage("HE"))
+	assert.Equal(t, "ru", NormalizeLanguage("ru"))
+	assert.Equal(t, "", NormalizeLanguage("und"))
+	assert.Equal(t, "", NormalizeLanguage("xx"))
+	assert.Equal(t, "", NormalizeLanguage("klingon"))
+}
+
+func TestParseTwitterArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitter_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "data", "account.js"), `window.YTD.account.part0 = [ {
+  "account" : { "accountId" : "27005015", "username" : "Michael_Laitman", "accountDisplayName" : "Михаэль Лайтман" }
+} ]`)
+	writeFile(t, filepath.Join(dir, "data", "tweet.js"), `window.YTD.tweet.part0 = [ {
+  "tweet" : { "id_str" : "1001", "full_text" : "Привет", "lang" : "ru", "created_at" : "Wed Oct 10 20:19:24 +0000 2018" }
+}, {
+  "tweet" : { "id_str" : "1002", "full_text" : "https://t.co/x", "lang" : "und", "created_at" : "Thu Oct 11 08:00:00 +0000 2018" }
+} ]`)
+
+	account, posts, err := ParseTwitterArchive(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, PLATFORM_TWITTER, account.Platform)
+	assert.Equal(t, "27005015", account.AccountID)
+	assert.Equal(t, "Michael_Laitman", account.Username.String)
+	if assert.Len(t, posts, 2) {
+		assert.Equal(t, "1001", posts[0].PostID)
+		assert.Equal(t, "Привет", posts[0].Text)
+		assert.Equal(t, "ru", posts[0].Language.String)
+		assert.Equal(t, "https://twitter.com/Michael_Laitman/status/1001", posts[0].Link.String)
+		assert.Equal(t, time.Date(2018, 10, 10, 20, 19, 24, 0, time.UTC), posts[0].PostedAt)
+		assert.False(t, posts[1].Language.Valid)
+	}
+}
+
+func TestParseTwitterArchiveOld(t *testing.T) {
+	dir, err := ioutil.TempDir("", "twitter_archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "tweet.js"), `window.YTD.tweet.part0 = [ {
+  "id_str" : "2001", "full_text" : "שלום", "lang" : "iw", "created_at" : "Wed Jul 04 10:00:00 +0000 2018"
+} ]`)
+
+	account, posts, err := ParseTwitterArchive(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "", account.AccountID)
+	if assert.Len(t, posts, 1) {
+		assert.Equal(t, "he", posts[0].Language.String)
+		assert.False(t, posts[0].Link.Valid)
+	}
+}
+
+func TestParseTelegramExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telegram_export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "result.json")
+	writeFile(t, path, `{
+  "name": "Laitman",
+  "type": "public_channel",
+  "id": 1234567890,
+  "messages": [
+    {"id": 1, "type": "service", "date": "2019-01-01T10:00:00", "action": "create_channel", "text": ""},
+    {"id": 2, "type": "message", "date": "2019-01-01T12:00:00", "date_unixtime": "1546344000", "text": "plain"},
+    {"id": 3, "type": "message", "date": "2019-01-02T12:00:00",
+     "text": ["see ", {"type": "link", "text": "https://kab.info"}, " now"]},
+    {"id": 4, "type": "message", "date": "2019-01-03T12:00:00", "photo": "photos/1.jpg", "text": ""}
+  ]
+}`)
+
+	account, posts, err := ParseTelegramExport(path, "laitman")
+	assert.Nil(t, err)
+	assert.Equal(t, PLATFORM_TELEGRAM, account.Platform)
+	assert.Equal(t, "1234567890", account.AccountID)
+	assert.Equal(t, "Laitman", account.DisplayName.String)
+	if assert.Len(t, posts, 2) {
+		assert.Equal(t, "2", posts[0].PostID)
+		assert.Equal(t, "plain", posts[0].Text)
+		assert.Equal(t, time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC), posts[0].PostedAt)
+		assert.Equal(t, "https://t.me/laitman/2", posts[0].Link.String)
+
+		assert.Equal(t, "see https://kab.info now", posts[1].Text)
+		assert.Equal(t, time.Date(2019, 1, 2, 12, 0, 0, 0, time.UTC), posts[1].PostedAt)
+	}
+}
@@ -0,0 +1,144 @@
+package social
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+type telegramExport struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	ID       int64             `json:"id"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+type telegramMessage struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	Date         string          `json:"date"`
+	DateUnixtime string          `json:"date_unixtime"`
+	Text         json.RawMessage `json:"text"`
+}
+
+// ParseTelegramExport reads the messages of a single chat Telegram Desktop JSON export (result.json).
+// Exports do not include the channel's public username, links are made only if it's given.
+func ParseTelegramExport(path, username string) (*Account, []*Post, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Read %s", path)
+	}
+
+	var export telegramExport
+	if err := json.Unmarshal(b, &export); err != nil {
+		return nil, nil, errors.Wrapf(err, "json.Unmarshal %s", path)
+	}
+	if export.ID == 0 {
+		return nil, nil, errors.Errorf("%s is not a single chat export", path)
+	}
+
+	account := &Account{
+		Platform:    PLATFORM_TELEGRAM,
+		AccountID:   strconv.FormatInt(export.ID, 10),
+		Username:    null.NewString(username, username != ""),
+		DisplayName: null.NewString(export.Name, export.Name != ""),
+	}
+
+	posts := make([]*Post, 0, len(export.Messages))
+	for i := range export.Messages {
+		var m telegramMessage
+		if err := json.Unmarshal(export.Messages[i], &m); err != nil {
+			return nil, nil, errors.Wrapf(err, "json.Unmarshal message %d", i)
+		}
+
+		// service messages: pinned, channel created, etc.
+		if m.Type != "message" {
+			continue
+		}
+
+		text, err := telegramText(m.Text)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Message %d text", m.ID)
+		}
+		if strings.TrimSpace(text) == "" {
+			continue // media only
+		}
+
+		ts, err := telegramDate(m)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Message %d date", m.ID)
+		}
+
+		post := &Post{
+			PostID:   strconv.FormatInt(m.ID, 10),
+			Text:     text,
+			PostedAt: ts,
+			Raw:      null.JSONFrom(export.Messages[i]),
+		}
+		if username != "" {
+			post.Link = null.StringFrom(fmt.Sprintf("https://t.me/%s/%d", username, m.ID))
+		}
+		posts = append(posts, post)
+	}
+
+	return account, posts, nil
+}
+
+// telegramText flattens message text, either a string or a list of strings and entities
+func telegramText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.Wrap(err, "json.Unmarshal")
+	}
+
+	var sb strings.Builder
+	for _, part := range parts {
+		if err := json.Unmarshal(part, &s); err == nil {
+			sb.WriteString(s)
+			continue
+		}
+
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &entity); err != nil {
+			return "", errors.Wrap(err, "json.Unmarshal entity")
+		}
+		sb.WriteString(entity.Text)
+	}
+
+	return sb.String(), nil
+}
+
+// telegramDate prefers the unix timestamp of newer exports,
+// older exports have only the local time of the exporting machine which we take as UTC.
+func telegramDate(m telegramMessage) (time.Time, error) {
+	if m.DateUnixtime != "" {
+		sec, err := strconv.ParseInt(m.DateUnixtime, 10, 64)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "date_unixtime")
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+
+	ts, err := time.Parse("2006-01-02T15:04:05", m.Date)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "date")
+	}
+	return ts, nil
+}
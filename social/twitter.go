@@ -0,0 +1,128 @@
+package social
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/volatiletech/null.v6"
+)
+
+type archiveAccount struct {
+	AccountID   string `json:"accountId"`
+	Username    string `json:"username"`
+	DisplayName string `json:"accountDisplayName"`
+}
+
+type archiveTweet struct {
+	IDStr     string `json:"id_str"`
+	FullText  string `json:"full_text"`
+	Text      string `json:"text"`
+	CreatedAt string `json:"created_at"`
+	Lang      string `json:"lang"`
+}
+
+// ParseTwitterArchive reads the tweets of a "Download your data" twitter archive.
+// dir is the extracted archive, either its root or its data directory.
+// Older archives have no account.js, the account is then returned without an id.
+func ParseTwitterArchive(dir string) (*Account, []*Post, error) {
+	if _, err := os.Stat(filepath.Join(dir, "data", "tweet.js")); err == nil {
+		dir = filepath.Join(dir, "data")
+	}
+
+	account := &Account{Platform: PLATFORM_TWITTER}
+	var accounts []json.RawMessage
+	err := readArchiveFile(filepath.Join(dir, "account.js"), &accounts)
+	if err == nil && len(accounts) > 0 {
+		var a archiveAccount
+		if err := json.Unmarshal(unwrapArchiveItem(accounts[0], "account"), &a); err != nil {
+			return nil, nil, errors.Wrap(err, "json.Unmarshal account")
+		}
+		account.AccountID = a.AccountID
+		account.Username = null.NewString(a.Username, a.Username != "")
+		account.DisplayName = null.NewString(a.DisplayName, a.DisplayName != "")
+	} else if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, nil, err
+	}
+
+	var items []json.RawMessage
+	if err := readArchiveFile(filepath.Join(dir, "tweet.js"), &items); err != nil {
+		return nil, nil, err
+	}
+
+	posts := make([]*Post, len(items))
+	for i := range items {
+		raw := unwrapArchiveItem(items[i], "tweet")
+
+		var t archiveTweet
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, nil, errors.Wrapf(err, "json.Unmarshal tweet %d", i)
+		}
+
+		ts, err := time.Parse(time.RubyDate, t.CreatedAt)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Tweet %s created_at", t.IDStr)
+		}
+
+		text := t.FullText
+		if text == "" {
+			text = t.Text
+		}
+
+		posts[i] = &Post{
+			PostID:   t.IDStr,
+			Text:     text,
+			Language: nullLanguage(t.Lang),
+			PostedAt: ts.UTC(),
+			Raw:      null.JSONFrom(raw),
+		}
+		if account.Username.Valid {
+			posts[i].Link = null.StringFrom(TweetLink(account.Username.String, t.IDStr))
+		}
+	}
+
+	return account, posts, nil
+}
+
+// TweetLink is the public url of a tweet
+func TweetLink(username, id string) string {
+	return fmt.Sprintf("https://twitter.com/%s/status/%s", username, id)
+}
+
+// readArchiveFile reads a javascript file of a twitter archive: window.YTD.<name>.part0 = [...]
+func readArchiveFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "Read %s", path)
+	}
+
+	if idx := bytes.IndexByte(b, '='); idx > 0 && bytes.HasPrefix(b, []byte("window.")) {
+		b = b[idx+1:]
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.Wrapf(err, "json.Unmarshal %s", path)
+	}
+	return nil
+}
+
+// unwrapArchiveItem handles newer archives which wrap each item in an object: [{"tweet": {...}}]
+func unwrapArchiveItem(raw json.RawMessage, key string) json.RawMessage {
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &wrapper); err == nil {
+		if inner, ok := wrapper[key]; ok && len(wrapper) == 1 {
+			return inner
+		}
+	}
+	return raw
+}
+
+func nullLanguage(code string) null.String {
+	l := NormalizeLanguage(code)
+	return null.NewString(l, l != "")
+}
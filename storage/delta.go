@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CatalogDelta is what changed between two catalogs
+type CatalogDelta struct {
+	Total   int64    // lines in current catalog
+	Changed []string // current lines which are new or differ from previous catalog
+	Removed []string // sha1s found in previous catalog but not in current one
+}
+
+// DiffCatalogs compares the previous catalog to the current one by sha1.
+// Lines of sha1s for which include returns true are reported as changed even if equal.
+func DiffCatalogs(prev, curr io.Reader, include func(sha1 string) bool) (*CatalogDelta, error) {
+	prevLines := make(map[string]string)
+	err := scanCatalog(prev, func(sha1, line string) {
+		prevLines[sha1] = line
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Scan previous catalog")
+	}
+
+	delta := &CatalogDelta{
+		Changed: make([]string, 0),
+		Removed: make([]string, 0),
+	}
+	err = scanCatalog(curr, func(sha1, line string) {
+		delta.Total++
+		if prevLine, ok := prevLines[sha1]; !ok || prevLine != line || (include != nil && include(sha1)) {
+			delta.Changed = append(delta.Changed, line)
+		}
+		delete(prevLines, sha1)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Scan current catalog")
+	}
+
+	for sha1 := range prevLines {
+		delta.Removed = append(delta.Removed, sha1)
+	}
+
+	return delta, nil
+}
+
+func scanCatalog(r io.Reader, fn func(sha1, line string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 40 {
+			continue
+		}
+		fn(strings.ToLower(line[:40]), line)
+	}
+	return scanner.Err()
+}
@@ -3,10 +3,8 @@ package storage
 import (
 	"bufio"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
@@ -17,15 +15,17 @@ import (
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries"
 	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
 
+	"github.com/Bnei-Baruch/mdb/api"
 	"github.com/Bnei-Baruch/mdb/models"
 	"github.com/Bnei-Baruch/mdb/utils"
-	"github.com/Bnei-Baruch/mdb/version"
 )
 
 const (
@@ -47,29 +47,39 @@ type StorageDevice struct {
 type Statistics struct {
 }
 
-func ImportStorageStatus() {
+func ImportStorageStatus(full bool) {
+	if err := RunImport(full); err != nil {
+		log.WithError(err).Error("Panic")
+	}
+}
+
+// RunImport is ImportStorageStatus for callers who need to know whether it failed
+func RunImport(full bool) (err error) {
 	defer func() {
 		if rval := recover(); rval != nil {
 			debug.PrintStack()
-			err, ok := rval.(error)
+			var ok bool
+			err, ok = rval.(error)
 			if !ok {
 				err = errors.Errorf("panic: %s", rval)
 			}
-
-			log.WithError(err).Error("Panic")
 		}
 	}()
 
-	doStuff()
+	doStuff(full)
+	return nil
 }
 
 // The way we do stuff:
-// We download the data file and locations map from the storage api.
-// Once we have these, we compute the status diff for each file.
+// We fetch the data file (catalog) and storage devices from the configured provider.
+// On full runs, we compute the status diff for each file in the data file.
 // We create new mappings and delete no longer existing ones.
-// We clear storage status for files not found in data file
-// Finally, we drop temp table and clean old local copies of data files
-func doStuff() {
+// We clear storage status for files not found in data file.
+// On incremental runs, we diff the data file against that of the last successful run
+// and do the same only for changed lines and for removed files.
+// Every run is recorded in the storage_import_runs table.
+// Finally, we clean old local copies of data files
+func doStuff(full bool) {
 	var err error
 	clock := time.Now()
 
@@ -78,6 +88,12 @@ func doStuff() {
 
 	log.Info("Starting import of storage status")
 
+	provider, err := NewCatalogProvider()
+	if err != nil {
+		panic(errors.Wrap(err, "Setup catalog provider"))
+	}
+	log.Infof("Using %s catalog provider", provider.Name())
+
 	log.Info("Setting up connection to MDB")
 	mdb, err := sql.Open("postgres", viper.GetString("mdb.url"))
 	utils.Must(err)
@@ -86,15 +102,37 @@ func doStuff() {
 	boil.SetDB(mdb)
 	//boil.DebugMode = true
 
-	err = syncStorages(mdb)
+	run, err := startRun(mdb, provider.Name())
+	if err != nil {
+		panic(errors.Wrap(err, "Start run"))
+	}
+	defer func() {
+		rval := recover()
+		var runErr error
+		if rval != nil {
+			var ok bool
+			if runErr, ok = rval.(error); !ok {
+				runErr = errors.Errorf("panic: %s", rval)
+			}
+		}
+		if err := finishRun(mdb, run, runErr); err != nil {
+			log.Errorf("Finish run %d: %s", run.ID, err.Error())
+		}
+		if rval != nil {
+			panic(rval)
+		}
+	}()
+
+	err = syncStorages(mdb, provider)
 	if err != nil {
 		panic(errors.Wrap(err, "Sync storages"))
 	}
 
-	dataFile, err := downloadDataFile()
+	dataFile, err := downloadDataFile(provider)
 	if err != nil {
 		panic(errors.Wrap(err, "Download data file"))
 	}
+	run.CatalogPath = null.StringFrom(dataFile)
 
 	fileMap, err := loadMDBFiles(mdb)
 	if err != nil {
@@ -106,14 +144,58 @@ func doStuff() {
 		panic(errors.Wrap(err, "Load files storages from MDB"))
 	}
 
-	err = processDataFile(dataFile, mdb, fileMap, fileStorages)
+	sha256Map, err := loadMDBFileHashes(mdb, api.HASH_SHA256)
 	if err != nil {
-		panic(errors.Wrap(err, "Process data file"))
+		panic(errors.Wrap(err, "Load files sha256 from MDB"))
 	}
 
-	err = clearStatusForMissing(mdb, fileMap, fileStorages)
-	if err != nil {
-		panic(errors.Wrap(err, "Clear status for missing"))
+	var base *ImportRun
+	if !full {
+		base, err = incrementalBase(mdb, provider.Name())
+		if err != nil {
+			panic(errors.Wrap(err, "Find incremental base run"))
+		}
+	}
+
+	if base == nil {
+		log.Info("Full import")
+		run.LinesTotal, run.FilesProcessed, err = processDataFile(dataFile, mdb, run, fileMap, fileStorages, sha256Map)
+		if err != nil {
+			panic(errors.Wrap(err, "Process data file"))
+		}
+
+		run.FilesCleared, err = clearStatusForMissing(mdb, fileMap, fileStorages)
+		if err != nil {
+			panic(errors.Wrap(err, "Clear status for missing"))
+		}
+	} else {
+		log.Infof("Incremental import since run %d [%s]", base.ID, base.CatalogPath.String)
+		run.Mode = RUN_MODE_INCREMENTAL
+		run.BaseRunID = null.Int64From(base.ID)
+
+		delta, err := diffDataFiles(mdb, base, dataFile, fileMap)
+		if err != nil {
+			panic(errors.Wrap(err, "Diff data files"))
+		}
+		log.Infof("%d changed lines, %d removed files", len(delta.Changed), len(delta.Removed))
+		run.LinesTotal = delta.Total
+
+		_, run.FilesProcessed, err = processCatalog(strings.NewReader(strings.Join(delta.Changed, "\n")),
+			mdb, run, fileMap, fileStorages, sha256Map)
+		if err != nil {
+			panic(errors.Wrap(err, "Process changed lines"))
+		}
+
+		removed := make(map[string]int64, len(delta.Removed))
+		for _, sha1 := range delta.Removed {
+			if fID, ok := fileMap[sha1]; ok {
+				removed[sha1] = fID
+			}
+		}
+		run.FilesCleared, err = clearStatusForMissing(mdb, removed, fileStorages)
+		if err != nil {
+			panic(errors.Wrap(err, "Clear status for removed"))
+		}
 	}
 
 	err = cleanupDataDir(dataFile)
@@ -125,7 +207,61 @@ func doStuff() {
 	log.Infof("Total run time: %s", time.Now().Sub(clock).String())
 }
 
-func downloadDataFile() (string, error) {
+// incrementalBase returns the last successful run if its data file is still around
+func incrementalBase(db *sql.DB, provider string) (*ImportRun, error) {
+	base, err := lastSuccessfulRun(db, provider)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil || !base.CatalogPath.Valid {
+		log.Info("No previous successful run")
+		return nil, nil
+	}
+	if _, err := os.Stat(base.CatalogPath.String); err != nil {
+		log.Warnf("Data file of run %d is gone: %s", base.ID, err.Error())
+		return nil, nil
+	}
+
+	return base, nil
+}
+
+// diffDataFiles diffs the data file of the base run with the current one.
+// Files created in MDB since the base run are always considered changed
+// as they might have already been in the previous data file.
+func diffDataFiles(db *sql.DB, base *ImportRun, dataFile string, fileMap map[string]int64) (*CatalogDelta, error) {
+	var newIDs pq.Int64Array
+	err := queries.Raw(db,
+		`SELECT coalesce(array_agg(id), '{}') FROM files WHERE created_at >= $1`,
+		base.StartedAt).
+		QueryRow().
+		Scan(&newIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load new files")
+	}
+	newFiles := make(map[int64]bool, len(newIDs))
+	for _, id := range newIDs {
+		newFiles[id] = true
+	}
+
+	prev, err := os.Open(base.CatalogPath.String)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open previous data file")
+	}
+	defer prev.Close()
+
+	curr, err := os.Open(dataFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open data file")
+	}
+	defer curr.Close()
+
+	return DiffCatalogs(prev, curr, func(sha1 string) bool {
+		fID, ok := fileMap[sha1]
+		return ok && newFiles[fID]
+	})
+}
+
+func downloadDataFile(provider CatalogProvider) (string, error) {
 	dir, err := getDataDir()
 	if err != nil {
 		return "", errors.Wrap(err, "Get data directory")
@@ -133,13 +269,11 @@ func downloadDataFile() (string, error) {
 
 	fileName := fmt.Sprintf("index_%s.txt", time.Now().Format("20060102150405"))
 	output := path.Join(dir, fileName)
-	log.Infof("Downloading storage status index to %s", output)
+	log.Infof("Fetching storage status index to %s", output)
 
-	url := fmt.Sprintf("%scatalog", viper.GetString("storage.api-url"))
-
-	err = utils.DownloadUrl(url, output)
+	err = provider.FetchCatalog(output)
 	if err != nil {
-		return "", errors.Wrap(err, "Download file")
+		return "", errors.Wrap(err, "Fetch catalog")
 	}
 
 	return output, nil
@@ -172,40 +306,17 @@ func cleanupDataDir(dataFile string) error {
 	return nil
 }
 
-// get storages from API
+// get storages from provider
 // get storages from MDB
-// Process diff: create new, update existing and remove non existing
-func syncStorages(db *sql.DB) error {
-	// Get storages from API
-	url := fmt.Sprintf("%sstorages", viper.GetString("storage.api-url"))
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	utils.Must(err)
-
-	req.Header.Set("User-Agent", fmt.Sprintf("MDB_%s", version.Version))
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
+// Process diff: create new, update existing and remove non existing.
+// Storages managed by MDB are neither updated nor removed.
+// Storages marked offline in MDB stay offline.
+func syncStorages(db *sql.DB, provider CatalogProvider) error {
+	apiStorages, err := provider.Storages()
 	if err != nil {
-		return errors.Wrap(err, "Do http request")
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return errors.Wrap(err, "Read http response body")
-	}
-
-	var apiStorages []StorageDevice
-	err = json.Unmarshal(body, &apiStorages)
-	if err != nil {
-		return errors.Wrap(err, "json.Unmarshal")
-	}
-	log.Infof("Got %d storages from API", len(apiStorages))
-
-	apiStoragesMap := make(map[string]*StorageDevice, len(apiStorages))
-	for i := range apiStorages {
-		apiStoragesMap[apiStorages[i].ID] = &apiStorages[i]
+		return errors.Wrap(err, "Get storages from provider")
 	}
+	log.Infof("Got %d storages from provider", len(apiStorages))
 
 	// Fetch storages from MDB
 	mdbStoragesMap, err := getMDBStorageMap(db)
@@ -223,18 +334,24 @@ func syncStorages(db *sql.DB) error {
 		s := apiStorages[i]
 		mdbS, ok := mdbStoragesMap[s.ID]
 		if ok {
+			delete(mdbStoragesMap, s.ID)
+			if mdbS.Managed {
+				log.Warnf("Provider storage %s has the name of an MDB managed storage, skipping", s.ID)
+				continue
+			}
+
 			// update
 			mdbS.Country = s.Country
 			mdbS.Location = s.Location
-			mdbS.Status = s.Status
 			mdbS.Access = s.Access
+			if !mdbS.OfflineAt.Valid {
+				mdbS.Status = s.Status
+			}
 			err = mdbS.Update(tx, "country", "location", "status", "access")
 			if err != nil {
 				utils.Must(tx.Rollback())
 				return errors.Wrapf(err, "Update MDB storage %d %s", mdbS.ID, s.ID)
 			}
-
-			delete(mdbStoragesMap, s.ID)
 		} else {
 			// create new
 			mdbS = &models.Storage{
@@ -255,14 +372,13 @@ func syncStorages(db *sql.DB) error {
 	utils.Must(tx.Commit())
 
 	// remove mdb models not found in API anymore
-	if len(mdbStoragesMap) > 0 {
-		ids := make([]int64, len(mdbStoragesMap))
-		i := 0
-		for _, v := range mdbStoragesMap {
-			ids[i] = v.ID
-			i++
+	ids := make([]int64, 0)
+	for _, v := range mdbStoragesMap {
+		if !v.Managed {
+			ids = append(ids, v.ID)
 		}
-
+	}
+	if len(ids) > 0 {
 		log.Infof("Deleting %d storages from MDB", len(ids))
 
 		tx, err = db.Begin()
@@ -321,8 +437,40 @@ func loadMDBFiles(db *sql.DB) (map[string]int64, error) {
 	return fileMap, nil
 }
 
+// loadMDBFileHashes returns a map of file id to hex encoded hash of the given algorithm
+func loadMDBFileHashes(db *sql.DB, algo string) (map[int64]string, error) {
+	rows, err := queries.Raw(db,
+		`SELECT file_id, encode(hash, 'hex') FROM file_hashes WHERE algo = $1`, algo).
+		Query()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Load %s hashes", algo)
+	}
+	defer rows.Close()
+
+	m := make(map[int64]string)
+	for rows.Next() {
+		var fID int64
+		var hash string
+		err = rows.Scan(&fID, &hash)
+		if err != nil {
+			return nil, errors.Wrap(err, "Scan row")
+		}
+
+		m[fID] = hash
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, "Iterate rows")
+	}
+
+	log.Infof("Loaded %d %s hashes from MDB", len(m), algo)
+	return m, nil
+}
+
+// loadMDBFilesMappings loads file locations on storages known to the provider, i.e. not managed by MDB
 func loadMDBFilesMappings(db *sql.DB) (m map[int64][]int64, err error) {
-	rows, err := queries.Raw(db, "SELECT * FROM files_storages").Query()
+	rows, err := queries.Raw(db, `SELECT fs.file_id, fs.storage_id FROM files_storages fs
+INNER JOIN storages s ON fs.storage_id = s.id AND s.managed IS FALSE`).Query()
 	if err != nil {
 		err = errors.Wrap(err, "Load files mappings from MDB")
 		return
@@ -365,19 +513,55 @@ type fileDiffUOW struct {
 	next    map[int64]bool
 }
 
+// parseCatalogLine parses a single line of the storage catalog.
+// Lines are either `sha1,"storage1,storage2"` or `sha1,sha256,"storage1,storage2"`.
+func parseCatalogLine(line string) (sha1 string, sha256 string, names []string, err error) {
+	if len(line) < 43 || line[40] != ',' {
+		err = errors.Errorf("Bad catalog line: %s", line)
+		return
+	}
+	sha1 = strings.ToLower(line[:40])
+
+	rest := line[41:]
+	if !strings.HasPrefix(rest, "\"") {
+		if len(rest) < 67 || rest[64] != ',' {
+			err = errors.Errorf("Bad catalog line: %s", line)
+			return
+		}
+		sha256 = strings.ToLower(rest[:64])
+		rest = rest[65:]
+	}
+
+	if len(rest) < 2 || rest[0] != '"' || rest[len(rest)-1] != '"' {
+		err = errors.Errorf("Bad catalog line: %s", line)
+		return
+	}
+
+	// dedup names since the API doesn't do that for us at the moment
+	names = strings.Split(strings.Replace(rest[1:len(rest)-1], "\"", "", -1), ",")
+	return
+}
+
 // Note: this function modifies the contents of fileMap
-func processDataFile(path string, db *sql.DB, fileMap map[string]int64, fileStorages map[int64][]int64) error {
+func processDataFile(path string, db *sql.DB, run *ImportRun, fileMap map[string]int64, fileStorages map[int64][]int64, sha256Map map[int64]string) (int64, int64, error) {
 	log.Infof("Processing data file: %s", path)
 	f, err := os.Open(path)
 	if err != nil {
-		return errors.Wrap(err, "Open data file")
+		return 0, 0, errors.Wrap(err, "Open data file")
 	}
 	defer f.Close()
 
+	return processCatalog(f, db, run, fileMap, fileStorages, sha256Map)
+}
+
+// processCatalog applies catalog lines to MDB. Returns total lines and number of files processed.
+// Files whose sha256 differs from the one in MDB keep their current locations and are recorded as hash conflicts of the run.
+// Note: this function modifies the contents of fileMap
+func processCatalog(r io.Reader, db *sql.DB, run *ImportRun, fileMap map[string]int64, fileStorages map[int64][]int64, sha256Map map[int64]string) (int64, int64, error) {
 	// Fetch storages from MDB
 	sMap, err := getMDBStorageMap(db)
 	if err != nil {
-		return errors.Wrap(err, "Load storages from MDB")
+		return 0, 0, errors.Wrap(err, "Load storages from MDB")
 	}
 	log.Infof("Got %d storages from MDB", len(sMap))
 
@@ -385,13 +569,13 @@ func processDataFile(path string, db *sql.DB, fileMap map[string]int64, fileStor
 	jobs := make(chan fileDiffUOW, 100)
 	var workersWG sync.WaitGroup
 	for w := 1; w <= 5; w++ {
-		go makeWorker(db, workersWG)(jobs)
+		go makeWorker(db, &workersWG)(jobs)
 	}
 
 	log.Info("Queueing work")
 	i := 0
 	count := int64(0)
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		i++
 		line := strings.TrimSpace(scanner.Text())
@@ -399,24 +583,45 @@ func processDataFile(path string, db *sql.DB, fileMap map[string]int64, fileStor
 			continue
 		}
 
-		sha1 := line[:40]
+		sha1, sha256, names, err := parseCatalogLine(line)
+		if err != nil {
+			log.Warnf("%s line [%d]", err.Error(), i)
+			continue
+		}
+
 		fID, ok := fileMap[sha1]
 		if !ok {
 			continue
 		}
 
+		// cross check sha256 when both sides know it
+		if sha256 != "" {
+			if mdbSha256, ok := sha256Map[fID]; ok {
+				if mdbSha256 != sha256 {
+					log.Warnf("sha256 mismatch for file %d [%s]: %s != %s line [%d]", fID, sha1, sha256, mdbSha256, i)
+					// the file is in the catalog, don't clear its locations as missing
+					delete(fileMap, sha1)
+					if err := recordHashConflict(db, run, fID, api.HASH_SHA256, sha256, mdbSha256); err != nil {
+						log.Errorf("Record sha256 conflict for file %d line [%d]: %s", fID, i, err.Error())
+					}
+					continue
+				}
+			} else if err := api.SaveFileHash(db, fID, api.HASH_SHA256, sha256); err != nil {
+				log.Errorf("Save sha256 for file %d line [%d]: %s", fID, i, err.Error())
+			}
+		}
+
 		count++
 		// we keep only files which have no storage
 		// in next phase we clear their storage value in MDB
 		delete(fileMap, sha1)
 
-		// dedup names since the API doesn't do that for us at the moment
-
-		names := strings.Split(strings.Replace(line[42:len(line)-1], "\"", "", -1), ",")
 		locations := make(map[int64]bool)
 		for j := range names {
 			if s, ok := sMap[names[j]]; ok {
-				locations[s.ID] = true
+				if !s.Managed {
+					locations[s.ID] = true
+				}
 			} else if names[j] != "" {
 				log.Warnf("Unknown storage device %s line [%d]", names[j], i)
 			}
@@ -442,10 +647,14 @@ func processDataFile(path string, db *sql.DB, fileMap map[string]int64, fileStor
 
 	log.Infof("Good files %d, total lines %d", count, i)
 
-	return nil
+	if err := scanner.Err(); err != nil {
+		return int64(i), count, errors.Wrap(err, "scanner.Err")
+	}
+
+	return int64(i), count, nil
 }
 
-func makeWorker(db *sql.DB, wg sync.WaitGroup) func(jobs <-chan fileDiffUOW) {
+func makeWorker(db *sql.DB, wg *sync.WaitGroup) func(jobs <-chan fileDiffUOW) {
 	wg.Add(1)
 	return func(jobs <-chan fileDiffUOW) {
 		for uow := range jobs {
@@ -508,8 +717,8 @@ func doFile(db *sql.DB, fID int64, current []int64, next map[int64]bool) error {
 	// delete old mappings
 	if len(toDelete) > 0 {
 		values := make([]string, 0)
-		for sID := range toDelete {
-			values = append(values, strconv.Itoa(sID))
+		for _, sID := range toDelete {
+			values = append(values, strconv.FormatInt(sID, 10))
 		}
 		res, err := queries.Raw(tx,
 			fmt.Sprintf("DELETE FROM files_storages WHERE file_id=%d AND storage_id IN (%s)",
@@ -535,7 +744,7 @@ func doFile(db *sql.DB, fID int64, current []int64, next map[int64]bool) error {
 	return nil
 }
 
-func clearStatusForMissing(db *sql.DB, missingFiles map[string]int64, fileStorages map[int64][]int64) error {
+func clearStatusForMissing(db *sql.DB, missingFiles map[string]int64, fileStorages map[int64][]int64) (int64, error) {
 	// create a slice of missing files IDs
 	ids := make([]string, 0)
 	for _, id := range missingFiles {
@@ -546,7 +755,7 @@ func clearStatusForMissing(db *sql.DB, missingFiles map[string]int64, fileStorag
 
 	log.Infof("Clearing storage status for %d missing files", len(ids))
 	if len(ids) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	// go over slice by pages
@@ -559,18 +768,19 @@ func clearStatusForMissing(db *sql.DB, missingFiles map[string]int64, fileStorag
 		tx, err := db.Begin()
 		utils.Must(err)
 
-		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM files_storages WHERE file_id IN (%s)`,
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM files_storages WHERE file_id IN (%s)
+AND storage_id IN (SELECT id FROM storages WHERE managed IS FALSE)`,
 			strings.Join(ids[start:end], ",")))
 		if err != nil {
 			utils.Must(tx.Rollback())
-			return errors.Wrapf(err, "Clear storage page %d", i)
+			return int64(start), errors.Wrapf(err, "Clear storage page %d", i)
 		}
 
 		utils.Must(tx.Commit())
 		i++
 	}
 
-	return nil
+	return int64(len(ids)), nil
 }
 
 func getDataDir() (string, error) {
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/volatiletech/sqlboiler/queries/qm"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/api"
+	"github.com/Bnei-Baruch/mdb/models"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+type ImportSuite struct {
+	suite.Suite
+	utils.TestDBManager
+}
+
+func (suite *ImportSuite) SetupSuite() {
+	suite.Require().Nil(suite.InitTestDB())
+}
+
+func (suite *ImportSuite) TearDownSuite() {
+	suite.Require().Nil(suite.DestroyTestDB())
+}
+
+// The import commits its own transactions, so every test cleans up after itself
+func (suite *ImportSuite) TearDownTest() {
+	_, err := suite.DB.Exec(`DELETE FROM files_storages; DELETE FROM storages; DELETE FROM file_hashes; DELETE FROM files;
+DELETE FROM storage_compliance_reports;`)
+	suite.Require().Nil(err)
+}
+
+// In order for 'go test' to run this suite, we need to create
+// a normal test function and pass our suite to suite.Run
+func TestImport(t *testing.T) {
+	suite.Run(t, new(ImportSuite))
+}
+
+type fakeProvider struct {
+	storages []StorageDevice
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Storages() ([]StorageDevice, error) {
+	return p.storages, nil
+}
+
+func (p *fakeProvider) FetchCatalog(output string) error {
+	return nil
+}
+
+func (suite *ImportSuite) TestSyncStoragesManaged() {
+	managed := &models.Storage{Name: "mdb-1", Country: "il", Location: "ptk", Status: "online", Access: "public", Managed: true}
+	suite.Require().Nil(managed.Insert(suite.DB))
+	offline := &models.Storage{Name: "il-1", Country: "il", Location: "ptk", Status: "offline", Access: "public",
+		OfflineAt: null.TimeFrom(time.Now())}
+	suite.Require().Nil(offline.Insert(suite.DB))
+	gone := &models.Storage{Name: "il-2", Country: "il", Location: "ptk", Status: "online", Access: "public"}
+	suite.Require().Nil(gone.Insert(suite.DB))
+
+	provider := &fakeProvider{storages: []StorageDevice{
+		{ID: "mdb-1", Country: "us", Location: "nyc", Status: "nearline", Access: "private"},
+		{ID: "il-1", Country: "il", Location: "tlv", Status: "online", Access: "public"},
+	}}
+	suite.Require().Nil(syncStorages(suite.DB, provider))
+
+	suite.Require().Nil(managed.Reload(suite.DB))
+	suite.Equal("il", managed.Country, "managed: country")
+	suite.Equal("online", managed.Status, "managed: status")
+
+	suite.Require().Nil(offline.Reload(suite.DB))
+	suite.Equal("tlv", offline.Location, "offline: location")
+	suite.Equal("offline", offline.Status, "offline: status")
+
+	exists, err := models.Storages(suite.DB, qm.Where("id = ?", gone.ID)).Exists()
+	suite.Require().Nil(err)
+	suite.False(exists, "removed from provider")
+
+	// provider drops the managed storage name
+	provider.storages = provider.storages[1:]
+	suite.Require().Nil(syncStorages(suite.DB, provider))
+	exists, err = models.Storages(suite.DB, qm.Where("id = ?", managed.ID)).Exists()
+	suite.Require().Nil(err)
+	suite.True(exists, "managed kept")
+}
+
+func (suite *ImportSuite) TestProcessCatalogHashConflict() {
+	il1 := &models.Storage{Name: "il-1", Country: "il", Location: "ptk", Status: "online", Access: "public"}
+	suite.Require().Nil(il1.Insert(suite.DB))
+	il2 := &models.Storage{Name: "il-2", Country: "il", Location: "ptk", Status: "online", Access: "public"}
+	suite.Require().Nil(il2.Insert(suite.DB))
+
+	conflicting := suite.createFile(strings.Repeat("a", 40), il1)
+	suite.Require().Nil(api.SaveFileHash(suite.DB, conflicting.ID, api.HASH_SHA256, strings.Repeat("b", 64)))
+	missing := suite.createFile(strings.Repeat("c", 40), il1)
+
+	run, err := startRun(suite.DB, "fake")
+	suite.Require().Nil(err)
+
+	fileMap, err := loadMDBFiles(suite.DB)
+	suite.Require().Nil(err)
+	fileStorages, err := loadMDBFilesMappings(suite.DB)
+	suite.Require().Nil(err)
+	sha256Map, err := loadMDBFileHashes(suite.DB, api.HASH_SHA256)
+	suite.Require().Nil(err)
+
+	catalog := strings.Repeat("a", 40) + "," + strings.Repeat("d", 64) + `,"il-2"`
+	total, processed, err := processCatalog(strings.NewReader(catalog), suite.DB, run, fileMap, fileStorages, sha256Map)
+	suite.Require().Nil(err)
+	suite.EqualValues(1, total, "total lines")
+	suite.EqualValues(0, processed, "files processed")
+	suite.EqualValues(1, run.HashConflicts, "run hash conflicts")
+	suite.NotContains(fileMap, strings.Repeat("a", 40), "conflicting file is not missing")
+
+	cleared, err := clearStatusForMissing(suite.DB, fileMap, fileStorages)
+	suite.Require().Nil(err)
+	suite.EqualValues(1, cleared, "files cleared")
+
+	suite.Equal([]int64{il1.ID}, suite.fileStorageIDs(conflicting), "conflicting file keeps its locations")
+	suite.Empty(suite.fileStorageIDs(missing), "missing file cleared")
+
+	var algo, catalogHash, mdbHash string
+	err = suite.DB.QueryRow(`SELECT algo, encode(catalog_hash, 'hex'), encode(mdb_hash, 'hex')
+FROM storage_hash_conflicts WHERE run_id = $1 AND file_id = $2`, run.ID, conflicting.ID).
+		Scan(&algo, &catalogHash, &mdbHash)
+	suite.Require().Nil(err)
+	suite.Equal(api.HASH_SHA256, algo)
+	suite.Equal(strings.Repeat("d", 64), catalogHash)
+	suite.Equal(strings.Repeat("b", 64), mdbHash)
+}
+
+func (suite *ImportSuite) createFile(sha1 string, storages ...*models.Storage) *models.File {
+	b, err := hex.DecodeString(sha1)
+	suite.Require().Nil(err)
+	f := &models.File{UID: utils.GenerateUID(8), Name: sha1, Sha1: null.BytesFrom(b)}
+	suite.Require().Nil(f.Insert(suite.DB))
+	if len(storages) > 0 {
+		suite.Require().Nil(f.AddStorages(suite.DB, false, storages...))
+	}
+	return f
+}
+
+func (suite *ImportSuite) fileStorageIDs(f *models.File) []int64 {
+	rows, err := suite.DB.Query("SELECT storage_id FROM files_storages WHERE file_id = $1 ORDER BY storage_id", f.ID)
+	suite.Require().Nil(err)
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		suite.Require().Nil(rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	suite.Require().Nil(rows.Err())
+	return ids
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCatalogLine(t *testing.T) {
+	sha1 := strings.Repeat("a", 40)
+	sha256 := strings.Repeat("b", 64)
+
+	s1, s256, names, err := parseCatalogLine(sha1 + `,"il-1,il-2"`)
+	assert.Nil(t, err)
+	assert.Equal(t, sha1, s1, "sha1")
+	assert.Empty(t, s256, "sha256")
+	assert.Equal(t, []string{"il-1", "il-2"}, names, "names")
+
+	s1, s256, names, err = parseCatalogLine(strings.ToUpper(sha1) + "," + sha256 + `,"il-1"`)
+	assert.Nil(t, err)
+	assert.Equal(t, sha1, s1, "sha1")
+	assert.Equal(t, sha256, s256, "sha256")
+	assert.Equal(t, []string{"il-1"}, names, "names")
+
+	_, _, _, err = parseCatalogLine(sha1 + ",il-1")
+	assert.NotNil(t, err, "unquoted names")
+	_, _, _, err = parseCatalogLine(sha1[:39] + `,"il-1"`)
+	assert.NotNil(t, err, "short sha1")
+	_, _, _, err = parseCatalogLine(sha1 + "," + sha256[:10] + `,"il-1"`)
+	assert.NotNil(t, err, "short sha256")
+}
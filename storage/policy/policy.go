@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"database/sql"
+	"sort"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+const (
+	VIOLATION_UNDER = "under"
+	VIOLATION_OVER  = "over"
+)
+
+// Storage statuses a policy may count copies on. Same as in storage import.
+var STATUSES = []string{"online", "nearline", "offline"}
+
+// Policy says how many copies files matching it should have.
+// Empty match fields match everything. Policies are checked in order, first match wins.
+type Policy struct {
+	Name         string   `mapstructure:"name" json:"name"`
+	FileTypes    []string `mapstructure:"file-types" json:"file_types,omitempty"`
+	ContentTypes []string `mapstructure:"content-types" json:"content_types,omitempty"`
+	Secure       []int16  `mapstructure:"secure" json:"secure,omitempty"`
+	Published    *bool    `mapstructure:"published" json:"published,omitempty"`
+
+	// Only copies on storages with this status are counted, empty for any status
+	Status       string `mapstructure:"status" json:"status,omitempty"`
+	MinCopies    int    `mapstructure:"min-copies" json:"min_copies"`
+	MaxCopies    int    `mapstructure:"max-copies" json:"max_copies,omitempty"` // zero for no limit
+	MinCountries int    `mapstructure:"min-countries" json:"min_countries,omitempty"`
+}
+
+// File is what we need to know about a file to check it against policies
+type File struct {
+	ID          int64
+	UID         string
+	Name        string
+	Type        string
+	ContentType string
+	Secure      int16
+	Published   bool
+	Storages    []*models.Storage
+}
+
+type Violation struct {
+	FileID    int64    `json:"file_id"`
+	FileUID   string   `json:"file_uid"`
+	FileName  string   `json:"file_name"`
+	Policy    string   `json:"policy"`
+	Kind      string   `json:"kind"`
+	Copies    int      `json:"copies"`
+	Countries int      `json:"countries"`
+	Storages  []string `json:"storages"`
+}
+
+type Summary struct {
+	Policy    string `json:"policy"`
+	Files     int    `json:"files"`
+	Compliant int    `json:"compliant"`
+	Under     int    `json:"under"`
+	Over      int    `json:"over"`
+}
+
+type Report struct {
+	Policies   []*Summary   `json:"policies"`
+	Unmatched  int          `json:"unmatched"`
+	Violations []*Violation `json:"violations"`
+}
+
+// LoadPolicies reads replication policies from the storage.policies config key
+func LoadPolicies() ([]*Policy, error) {
+	var policies []*Policy
+	if err := viper.UnmarshalKey("storage.policies", &policies); err != nil {
+		return nil, errors.Wrap(err, "viper.UnmarshalKey")
+	}
+
+	if err := Validate(policies); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+func Validate(policies []*Policy) error {
+	names := make(map[string]bool, len(policies))
+	for i, p := range policies {
+		if p.Name == "" {
+			return errors.Errorf("Policy %d: missing name", i)
+		}
+		if names[p.Name] {
+			return errors.Errorf("Policy %s: duplicate name", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.MinCopies < 0 || p.MaxCopies < 0 || p.MinCountries < 0 {
+			return errors.Errorf("Policy %s: negative limits", p.Name)
+		}
+		if p.MaxCopies > 0 && p.MaxCopies < p.MinCopies {
+			return errors.Errorf("Policy %s: max-copies < min-copies", p.Name)
+		}
+		if p.Status != "" {
+			ok := false
+			for _, s := range STATUSES {
+				ok = ok || s == p.Status
+			}
+			if !ok {
+				return errors.Errorf("Policy %s: unknown status %s", p.Name, p.Status)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Policy) Match(f *File) bool {
+	if len(p.FileTypes) > 0 && !contains(p.FileTypes, f.Type) {
+		return false
+	}
+	if len(p.ContentTypes) > 0 && !contains(p.ContentTypes, f.ContentType) {
+		return false
+	}
+	if len(p.Secure) > 0 {
+		ok := false
+		for _, s := range p.Secure {
+			ok = ok || s == f.Secure
+		}
+		if !ok {
+			return false
+		}
+	}
+	if p.Published != nil && *p.Published != f.Published {
+		return false
+	}
+	return true
+}
+
+// Check returns a violation if the file doesn't comply with the policy, nil otherwise
+func (p *Policy) Check(f *File) *Violation {
+	copies := 0
+	countries := make(map[string]bool)
+	names := make([]string, 0, len(f.Storages))
+	for _, s := range f.Storages {
+		if p.Status != "" && s.Status != p.Status {
+			continue
+		}
+		copies++
+		if s.Country != "" {
+			countries[s.Country] = true
+		}
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	v := &Violation{
+		FileID:    f.ID,
+		FileUID:   f.UID,
+		FileName:  f.Name,
+		Policy:    p.Name,
+		Copies:    copies,
+		Countries: len(countries),
+		Storages:  names,
+	}
+
+	if copies < p.MinCopies || len(countries) < p.MinCountries {
+		v.Kind = VIOLATION_UNDER
+		return v
+	}
+	if p.MaxCopies > 0 && copies > p.MaxCopies {
+		v.Kind = VIOLATION_OVER
+		return v
+	}
+
+	return nil
+}
+
+// Evaluator accumulates policy checks of files into a report
+type Evaluator struct {
+	policies []*Policy
+	report   *Report
+	byName   map[string]*Summary
+}
+
+func NewEvaluator(policies []*Policy) *Evaluator {
+	e := &Evaluator{
+		policies: policies,
+		report: &Report{
+			Policies:   make([]*Summary, len(policies)),
+			Violations: make([]*Violation, 0),
+		},
+		byName: make(map[string]*Summary, len(policies)),
+	}
+	for i, p := range policies {
+		e.report.Policies[i] = &Summary{Policy: p.Name}
+		e.byName[p.Name] = e.report.Policies[i]
+	}
+	return e
+}
+
+func (e *Evaluator) Add(f *File) {
+	for _, p := range e.policies {
+		if !p.Match(f) {
+			continue
+		}
+
+		s := e.byName[p.Name]
+		s.Files++
+		if v := p.Check(f); v == nil {
+			s.Compliant++
+		} else {
+			if v.Kind == VIOLATION_UNDER {
+				s.Under++
+			} else {
+				s.Over++
+			}
+			e.report.Violations = append(e.report.Violations, v)
+		}
+		return
+	}
+
+	e.report.Unmatched++
+}
+
+func (e *Evaluator) Report() *Report {
+	return e.report
+}
+
+const FILES_REPLICAS_SQL = `
+SELECT f.id, f.uid, f.name, f.type, coalesce(ct.name, ''), f.secure, f.published,
+  coalesce(array_agg(fs.storage_id) FILTER (WHERE fs.storage_id IS NOT NULL), '{}')
+FROM files f
+  LEFT JOIN content_units cu ON f.content_unit_id = cu.id
+  LEFT JOIN content_types ct ON cu.type_id = ct.id
+  LEFT JOIN files_storages fs ON f.id = fs.file_id
+WHERE f.removed_at IS NULL AND f.sha1 IS NOT NULL
+GROUP BY f.id, ct.name
+ORDER BY f.id
+`
+
+// CheckCompliance checks all live files in MDB against the given policies
+func CheckCompliance(exec boil.Executor, policies []*Policy) (*Report, error) {
+	storages, err := models.Storages(exec).All()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load storages")
+	}
+	sMap := make(map[int64]*models.Storage, len(storages))
+	for _, s := range storages {
+		sMap[s.ID] = s
+	}
+
+	rows, err := queries.Raw(exec, FILES_REPLICAS_SQL).Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "Load files")
+	}
+	defer rows.Close()
+
+	e := NewEvaluator(policies)
+	for rows.Next() {
+		var f File
+		var sIDs pq.Int64Array
+		var name sql.NullString
+		if err := rows.Scan(&f.ID, &f.UID, &name, &f.Type, &f.ContentType, &f.Secure, &f.Published, &sIDs); err != nil {
+			return nil, errors.Wrap(err, "rows.Scan")
+		}
+		f.Name = name.String
+		f.Storages = make([]*models.Storage, 0, len(sIDs))
+		for _, id := range sIDs {
+			if s, ok := sMap[id]; ok {
+				f.Storages = append(f.Storages, s)
+			}
+		}
+		e.Add(&f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return e.Report(), nil
+}
+
+func contains(s []string, x string) bool {
+	for i := range s {
+		if s[i] == x {
+			return true
+		}
+	}
+	return false
+}
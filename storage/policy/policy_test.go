@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Bnei-Baruch/mdb/models"
+)
+
+var (
+	ilOnline  = &models.Storage{Name: "il-1", Country: "il", Status: "online"}
+	ilOnline2 = &models.Storage{Name: "il-2", Country: "il", Status: "online"}
+	deOnline  = &models.Storage{Name: "de-1", Country: "de", Status: "online"}
+	ilOffline = &models.Storage{Name: "il-tape", Country: "il", Status: "offline"}
+)
+
+func testPolicies() []*Policy {
+	published := true
+	return []*Policy{
+		{
+			Name:         "published originals",
+			FileTypes:    []string{"video"},
+			Published:    &published,
+			Status:       "online",
+			MinCopies:    2,
+			MaxCopies:    3,
+			MinCountries: 2,
+		},
+		{
+			Name:      "default",
+			Secure:    []int16{0, 1},
+			MinCopies: 1,
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.Nil(t, Validate(testPolicies()))
+	assert.NotNil(t, Validate([]*Policy{{MinCopies: 1}}), "missing name")
+	assert.NotNil(t, Validate([]*Policy{{Name: "a"}, {Name: "a"}}), "duplicate name")
+	assert.NotNil(t, Validate([]*Policy{{Name: "a", MinCopies: 3, MaxCopies: 2}}), "max < min")
+	assert.NotNil(t, Validate([]*Policy{{Name: "a", Status: "gone"}}), "bad status")
+}
+
+func TestEvaluator(t *testing.T) {
+	e := NewEvaluator(testPolicies())
+
+	// compliant
+	e.Add(&File{ID: 1, Type: "video", Published: true, Storages: []*models.Storage{ilOnline, deOnline}})
+	// under: single country, offline copy not counted
+	e.Add(&File{ID: 2, Type: "video", Published: true, Storages: []*models.Storage{ilOnline, ilOnline2, ilOffline}})
+	// over
+	e.Add(&File{ID: 3, Type: "video", Published: true,
+		Storages: []*models.Storage{ilOnline, ilOnline2, deOnline, {Name: "de-2", Country: "de", Status: "online"}}})
+	// default policy, under
+	e.Add(&File{ID: 4, Type: "text", Published: true})
+	// default policy, compliant
+	e.Add(&File{ID: 5, Type: "video", Published: false, Storages: []*models.Storage{ilOffline}})
+	// no policy
+	e.Add(&File{ID: 6, Type: "video", Secure: 2})
+
+	r := e.Report()
+	assert.Equal(t, 1, r.Unmatched, "Unmatched")
+	assert.Equal(t, &Summary{Policy: "published originals", Files: 3, Compliant: 1, Under: 1, Over: 1}, r.Policies[0])
+	assert.Equal(t, &Summary{Policy: "default", Files: 2, Compliant: 1, Under: 1}, r.Policies[1])
+
+	if assert.Len(t, r.Violations, 3) {
+		v := r.Violations[0]
+		assert.Equal(t, int64(2), v.FileID)
+		assert.Equal(t, VIOLATION_UNDER, v.Kind)
+		assert.Equal(t, 2, v.Copies, "Copies")
+		assert.Equal(t, 1, v.Countries, "Countries")
+		assert.Equal(t, []string{"il-1", "il-2"}, v.Storages)
+
+		assert.Equal(t, int64(3), r.Violations[1].FileID)
+		assert.Equal(t, VIOLATION_OVER, r.Violations[1].Kind)
+		assert.Equal(t, int64(4), r.Violations[2].FileID)
+		assert.Equal(t, "default", r.Violations[2].Policy)
+	}
+}
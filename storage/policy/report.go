@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// max violations per insert statement
+const SAVE_BATCH_SIZE = 1000
+
+// SavedReport is the latest compliance report saved by SaveReport, without its violations
+type SavedReport struct {
+	ID        int64      `json:"id"`
+	Policies  []*Summary `json:"policies"`
+	Unmatched int        `json:"unmatched"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SaveReport saves a compliance report replacing previous ones
+func SaveReport(exec boil.Executor, report *Report) (int64, error) {
+	policies, err := json.Marshal(report.Policies)
+	if err != nil {
+		return 0, errors.Wrap(err, "json.Marshal policies")
+	}
+
+	var id int64
+	err = queries.Raw(exec,
+		`INSERT INTO storage_compliance_reports (policies, unmatched) VALUES ($1, $2) RETURNING id`,
+		policies, report.Unmatched).
+		QueryRow().
+		Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "Insert report")
+	}
+
+	for i := 0; i < len(report.Violations); i += SAVE_BATCH_SIZE {
+		batch := report.Violations[i:utils.Min(i+SAVE_BATCH_SIZE, len(report.Violations))]
+		values := make([]string, len(batch))
+		args := make([]interface{}, 0, 9*len(batch))
+		for j, v := range batch {
+			n := len(args)
+			values[j] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9)
+			args = append(args, id, v.FileID, v.FileUID, v.FileName, v.Policy, v.Kind, v.Copies, v.Countries,
+				pq.Array(v.Storages))
+		}
+		_, err := queries.Raw(exec,
+			`INSERT INTO storage_compliance_violations
+			 (report_id, file_id, file_uid, file_name, policy, kind, copies, countries, storages)
+			 VALUES `+strings.Join(values, ","),
+			args...).
+			Exec()
+		if err != nil {
+			return 0, errors.Wrap(err, "Insert violations")
+		}
+	}
+
+	if _, err := queries.Raw(exec, `DELETE FROM storage_compliance_reports WHERE id < $1`, id).Exec(); err != nil {
+		return 0, errors.Wrap(err, "Delete previous reports")
+	}
+
+	return id, nil
+}
+
+// LatestReport returns the latest saved compliance report, nil if none
+func LatestReport(exec boil.Executor) (*SavedReport, error) {
+	var report SavedReport
+	var policies []byte
+	err := queries.Raw(exec,
+		`SELECT id, policies, unmatched, created_at FROM storage_compliance_reports ORDER BY id DESC LIMIT 1`).
+		QueryRow().
+		Scan(&report.ID, &policies, &report.Unmatched, &report.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Load report")
+	}
+
+	if err := json.Unmarshal(policies, &report.Policies); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal policies")
+	}
+
+	return &report, nil
+}
+
+// FindViolations returns a page of the violations in a saved report and their total count.
+// Empty kind or policy match all.
+func FindViolations(exec boil.Executor, reportID int64, kind, policy string, limit, offset int) (int64, []*Violation, error) {
+	where := `report_id = $1 AND ($2 = '' OR kind = $2) AND ($3 = '' OR policy = $3)`
+
+	var total int64
+	err := queries.Raw(exec, `SELECT count(*) FROM storage_compliance_violations WHERE `+where,
+		reportID, kind, policy).
+		QueryRow().
+		Scan(&total)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Count violations")
+	}
+
+	rows, err := queries.Raw(exec,
+		`SELECT file_id, file_uid, coalesce(file_name, ''), policy, kind, copies, countries, storages
+		 FROM storage_compliance_violations WHERE `+where+` ORDER BY id LIMIT $4 OFFSET $5`,
+		reportID, kind, policy, limit, offset).
+		Query()
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "Load violations")
+	}
+	defer rows.Close()
+
+	violations := make([]*Violation, 0)
+	for rows.Next() {
+		var v Violation
+		var storages pq.StringArray
+		if err := rows.Scan(&v.FileID, &v.FileUID, &v.FileName, &v.Policy, &v.Kind, &v.Copies, &v.Countries, &storages); err != nil {
+			return 0, nil, errors.Wrap(err, "rows.Scan")
+		}
+		v.Storages = storages
+		violations = append(violations, &v)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, errors.Wrap(err, "rows.Err")
+	}
+
+	return total, violations, nil
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/storage/policy"
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+// PolicyCheck checks all files in MDB against the configured replication policies.
+// Summary is logged, the full report is written as json to output (stdout if empty).
+func PolicyCheck(output string) {
+	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+
+	report, err := RunPolicyCheck()
+	utils.Must(err)
+	if report == nil {
+		return
+	}
+
+	utils.Must(writeReport(report, output))
+}
+
+// RunPolicyCheck checks all files in MDB against the configured replication policies
+// and saves the report served by the API. Returns a nil report if no policies are configured.
+func RunPolicyCheck() (*policy.Report, error) {
+	log.Info("Starting replication policy check")
+
+	policies, err := policy.LoadPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		log.Warn("No replication policies configured, see storage.policies")
+		return nil, nil
+	}
+	log.Infof("Loaded %d policies", len(policies))
+
+	log.Info("Setting up connection to MDB")
+	mdb, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.Open")
+	}
+	defer mdb.Close()
+	if err := mdb.Ping(); err != nil {
+		return nil, errors.Wrap(err, "Ping MDB")
+	}
+
+	report, err := policy.CheckCompliance(mdb, policies)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range report.Policies {
+		log.Infof("%s: %d files, %d compliant, %d under, %d over", s.Policy, s.Files, s.Compliant, s.Under, s.Over)
+	}
+	log.Infof("%d files matched no policy", report.Unmatched)
+
+	log.Info("Saving report")
+	tx, err := mdb.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "Begin transaction")
+	}
+	if _, err := policy.SaveReport(tx, report); err != nil {
+		utils.Must(tx.Rollback())
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "Commit transaction")
+	}
+
+	return report, nil
+}
+
+func writeReport(report *policy.Report, output string) error {
+	w := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return errors.Wrap(err, "os.Create")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/Bnei-Baruch/mdb/storage/policy"
+)
+
+func (suite *ImportSuite) TestSaveComplianceReport() {
+	f1 := suite.createFile(strings.Repeat("a", 40))
+	f2 := suite.createFile(strings.Repeat("b", 40))
+
+	report := &policy.Report{
+		Policies:  []*policy.Summary{{Policy: "default", Files: 2, Under: 1, Over: 1}},
+		Unmatched: 3,
+		Violations: []*policy.Violation{
+			{FileID: f1.ID, FileUID: f1.UID, FileName: f1.Name, Policy: "default", Kind: policy.VIOLATION_UNDER,
+				Copies: 0, Storages: []string{}},
+			{FileID: f2.ID, FileUID: f2.UID, FileName: f2.Name, Policy: "default", Kind: policy.VIOLATION_OVER,
+				Copies: 2, Countries: 1, Storages: []string{"il-1", "il-2"}},
+		},
+	}
+	first, err := policy.SaveReport(suite.DB, report)
+	suite.Require().Nil(err)
+	id, err := policy.SaveReport(suite.DB, report)
+	suite.Require().Nil(err)
+
+	saved, err := policy.LatestReport(suite.DB)
+	suite.Require().Nil(err)
+	suite.Require().NotNil(saved)
+	suite.Equal(id, saved.ID, "latest")
+	suite.Equal(3, saved.Unmatched, "Unmatched")
+	suite.Equal(report.Policies, saved.Policies, "Policies")
+
+	total, violations, err := policy.FindViolations(suite.DB, first, "", "", 10, 0)
+	suite.Require().Nil(err)
+	suite.EqualValues(0, total, "previous report deleted")
+
+	total, violations, err = policy.FindViolations(suite.DB, id, "", "", 1, 1)
+	suite.Require().Nil(err)
+	suite.EqualValues(2, total, "total")
+	suite.Equal([]*policy.Violation{report.Violations[1]}, violations, "page")
+
+	total, violations, err = policy.FindViolations(suite.DB, id, policy.VIOLATION_UNDER, "default", 10, 0)
+	suite.Require().Nil(err)
+	suite.EqualValues(1, total, "filtered total")
+	suite.Equal([]*policy.Violation{report.Violations[0]}, violations, "filtered")
+}
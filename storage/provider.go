@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+	"github.com/Bnei-Baruch/mdb/version"
+)
+
+const (
+	PROVIDER_HTTP  = "http"
+	PROVIDER_LOCAL = "local"
+	PROVIDER_S3    = "s3"
+)
+
+// Files expected in a local provider's directory
+const (
+	LOCAL_STORAGES_FILE = "storages.json"
+	LOCAL_CATALOG_FILE  = "catalog"
+)
+
+// CatalogProvider is a source of storage devices and the catalog of files on them.
+// A catalog has one line per file: `sha1[,sha256],"storage1,storage2"`
+type CatalogProvider interface {
+	Name() string
+	Storages() ([]StorageDevice, error)
+	FetchCatalog(output string) error
+}
+
+// NewCatalogProvider returns the provider configured in storage.provider (http by default)
+func NewCatalogProvider() (CatalogProvider, error) {
+	switch p := viper.GetString("storage.provider"); p {
+	case "", PROVIDER_HTTP:
+		return &HTTPProvider{BaseURL: viper.GetString("storage.api-url")}, nil
+	case PROVIDER_LOCAL:
+		dir := viper.GetString("storage.local-directory")
+		if dir == "" {
+			return nil, errors.New("storage.local-directory is not set")
+		}
+		return &LocalProvider{Dir: dir}, nil
+	case PROVIDER_S3:
+		return NewS3ProviderFromConfig()
+	default:
+		return nil, errors.Errorf("Unknown storage provider %s", p)
+	}
+}
+
+// HTTPProvider is the storage backend API
+type HTTPProvider struct {
+	BaseURL string
+}
+
+func (p *HTTPProvider) Name() string {
+	return PROVIDER_HTTP
+}
+
+func (p *HTTPProvider) Storages() ([]StorageDevice, error) {
+	url := fmt.Sprintf("%sstorages", p.BaseURL)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "http.NewRequest")
+	}
+
+	req.Header.Set("User-Agent", fmt.Sprintf("MDB_%s", version.Version))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Do http request")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Read http response body")
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, errors.Errorf("Http error %d: %s", resp.StatusCode, string(body))
+	}
+
+	var storages []StorageDevice
+	err = json.Unmarshal(body, &storages)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return storages, nil
+}
+
+func (p *HTTPProvider) FetchCatalog(output string) error {
+	return utils.DownloadUrl(fmt.Sprintf("%scatalog", p.BaseURL), output)
+}
+
+// LocalProvider reads storages and catalog from files in a local directory.
+// Useful for offline imports and for catalogs pushed to us by other means.
+type LocalProvider struct {
+	Dir string
+}
+
+func (p *LocalProvider) Name() string {
+	return PROVIDER_LOCAL
+}
+
+func (p *LocalProvider) Storages() ([]StorageDevice, error) {
+	b, err := ioutil.ReadFile(filepath.Join(p.Dir, LOCAL_STORAGES_FILE))
+	if err != nil {
+		return nil, errors.Wrap(err, "Read storages file")
+	}
+
+	var storages []StorageDevice
+	if err := json.Unmarshal(b, &storages); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return storages, nil
+}
+
+func (p *LocalProvider) FetchCatalog(output string) error {
+	in, err := os.Open(filepath.Join(p.Dir, LOCAL_CATALOG_FILE))
+	if err != nil {
+		return errors.Wrap(err, "Open catalog file")
+	}
+	defer in.Close()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return errors.Wrap(err, "Create output file")
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Wrap(err, "Copy catalog")
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"github.com/volatiletech/sqlboiler/boil"
+	"github.com/volatiletech/sqlboiler/queries"
+	"gopkg.in/volatiletech/null.v6"
+
+	"github.com/Bnei-Baruch/mdb/utils"
+)
+
+const (
+	RUN_MODE_FULL        = "full"
+	RUN_MODE_INCREMENTAL = "incremental"
+
+	RUN_STATUS_RUNNING = "running"
+	RUN_STATUS_SUCCESS = "success"
+	RUN_STATUS_FAILED  = "failed"
+)
+
+// ImportRun is a single run of the storage status import, see storage_import_runs table
+type ImportRun struct {
+	ID             int64       `boil:"id" json:"id"`
+	Provider       string      `boil:"provider" json:"provider"`
+	Mode           string      `boil:"mode" json:"mode"`
+	Status         string      `boil:"status" json:"status"`
+	CatalogPath    null.String `boil:"catalog_path" json:"catalog_path"`
+	BaseRunID      null.Int64  `boil:"base_run_id" json:"base_run_id"`
+	LinesTotal     int64       `boil:"lines_total" json:"lines_total"`
+	FilesProcessed int64       `boil:"files_processed" json:"files_processed"`
+	FilesCleared   int64       `boil:"files_cleared" json:"files_cleared"`
+	HashConflicts  int64       `boil:"hash_conflicts" json:"hash_conflicts"`
+	Error          null.String `boil:"error" json:"error"`
+	StartedAt      time.Time   `boil:"started_at" json:"started_at"`
+	FinishedAt     null.Time   `boil:"finished_at" json:"finished_at"`
+}
+
+func startRun(exec boil.Executor, provider string) (*ImportRun, error) {
+	run := &ImportRun{
+		Provider: provider,
+		Mode:     RUN_MODE_FULL,
+		Status:   RUN_STATUS_RUNNING,
+	}
+
+	err := queries.Raw(exec,
+		`INSERT INTO storage_import_runs (provider, mode, status) VALUES ($1, $2, $3) RETURNING id, started_at`,
+		run.Provider, run.Mode, run.Status).
+		QueryRow().
+		Scan(&run.ID, &run.StartedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert run")
+	}
+
+	return run, nil
+}
+
+func finishRun(exec boil.Executor, run *ImportRun, runErr error) error {
+	run.Status = RUN_STATUS_SUCCESS
+	if runErr != nil {
+		run.Status = RUN_STATUS_FAILED
+		run.Error = null.StringFrom(runErr.Error())
+	}
+
+	_, err := queries.Raw(exec,
+		`UPDATE storage_import_runs SET mode = $1, status = $2, catalog_path = $3, base_run_id = $4,
+		 lines_total = $5, files_processed = $6, files_cleared = $7, hash_conflicts = $8, error = $9,
+		 finished_at = now_utc()
+		 WHERE id = $10`,
+		run.Mode, run.Status, run.CatalogPath, run.BaseRunID,
+		run.LinesTotal, run.FilesProcessed, run.FilesCleared, run.HashConflicts, run.Error, run.ID).
+		Exec()
+	if err != nil {
+		return errors.Wrap(err, "Update run")
+	}
+
+	return nil
+}
+
+// recordHashConflict saves a file whose hash in the catalog differs from the one in MDB
+func recordHashConflict(exec boil.Executor, run *ImportRun, fileID int64, algo, catalogHash, mdbHash string) error {
+	_, err := queries.Raw(exec,
+		`INSERT INTO storage_hash_conflicts (run_id, file_id, algo, catalog_hash, mdb_hash)
+		 VALUES ($1, $2, $3, decode($4, 'hex'), decode($5, 'hex'))`,
+		run.ID, fileID, algo, catalogHash, mdbHash).
+		Exec()
+	if err != nil {
+		return errors.Wrap(err, "Insert hash conflict")
+	}
+
+	run.HashConflicts++
+	return nil
+}
+
+// lastSuccessfulRun returns the latest successful run of the given provider, nil if none
+func lastSuccessfulRun(exec boil.Executor, provider string) (*ImportRun, error) {
+	var run ImportRun
+	err := queries.Raw(exec,
+		`SELECT * FROM storage_import_runs WHERE provider = $1 AND status = $2 ORDER BY id DESC LIMIT 1`,
+		provider, RUN_STATUS_SUCCESS).
+		Bind(&run)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Load last run")
+	}
+
+	return &run, nil
+}
+
+// ImportRuns returns the latest runs, newest first
+func ImportRuns(exec boil.Executor, limit int) ([]*ImportRun, error) {
+	var runs []*ImportRun
+	err := queries.Raw(exec, `SELECT * FROM storage_import_runs ORDER BY id DESC LIMIT $1`, limit).Bind(&runs)
+	if err != nil {
+		return nil, errors.Wrap(err, "Load runs")
+	}
+	return runs, nil
+}
+
+// RunsCommand prints the latest runs of the storage status import
+func RunsCommand(limit int) {
+	db, err := sql.Open("postgres", viper.GetString("mdb.url"))
+	utils.Must(err)
+	utils.Must(db.Ping())
+	defer db.Close()
+
+	runs, err := ImportRuns(db, limit)
+	utils.Must(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPROVIDER\tMODE\tSTATUS\tSTARTED\tDURATION\tLINES\tPROCESSED\tCLEARED\tCONFLICTS\tERROR")
+	for _, run := range runs {
+		var duration string
+		if run.FinishedAt.Valid {
+			duration = run.FinishedAt.Time.Sub(run.StartedAt).String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			run.ID, run.Provider, run.Mode, run.Status, run.StartedAt.Format(time.RFC3339), duration,
+			run.LinesTotal, run.FilesProcessed, run.FilesCleared, run.HashConflicts, run.Error.String)
+	}
+	utils.Must(w.Flush())
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// S3 compatible object storage where each bucket is a storage device
+// and objects are named by the sha1 of their content (with optional prefix and extension).
+type S3Provider struct {
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Buckets   []S3Bucket
+	Client    *http.Client
+}
+
+type S3Bucket struct {
+	Name     string `mapstructure:"name"`
+	Prefix   string `mapstructure:"prefix"`
+	Country  string `mapstructure:"country"`
+	Location string `mapstructure:"location"`
+	Status   string `mapstructure:"status"`
+	Access   string `mapstructure:"access"`
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+func NewS3ProviderFromConfig() (*S3Provider, error) {
+	p := &S3Provider{
+		Endpoint:  viper.GetString("storage.s3.endpoint"),
+		Region:    viper.GetString("storage.s3.region"),
+		AccessKey: viper.GetString("storage.s3.access-key"),
+		SecretKey: viper.GetString("storage.s3.secret-key"),
+		Client:    http.DefaultClient,
+	}
+	if p.Endpoint == "" {
+		return nil, errors.New("storage.s3.endpoint is not set")
+	}
+	if p.Region == "" {
+		p.Region = "us-east-1"
+	}
+	if err := viper.UnmarshalKey("storage.s3.buckets", &p.Buckets); err != nil {
+		return nil, errors.Wrap(err, "viper.UnmarshalKey storage.s3.buckets")
+	}
+	if len(p.Buckets) == 0 {
+		return nil, errors.New("storage.s3.buckets is empty")
+	}
+
+	return p, nil
+}
+
+func (p *S3Provider) Name() string {
+	return PROVIDER_S3
+}
+
+func (p *S3Provider) Storages() ([]StorageDevice, error) {
+	storages := make([]StorageDevice, len(p.Buckets))
+	for i, b := range p.Buckets {
+		storages[i] = StorageDevice{
+			ID:       b.Name,
+			Country:  b.Country,
+			Location: b.Location,
+			Status:   b.Status,
+			Access:   b.Access,
+		}
+	}
+	return storages, nil
+}
+
+// FetchCatalog lists all buckets and writes a catalog line for every sha1 found
+func (p *S3Provider) FetchCatalog(output string) error {
+	locations := make(map[string][]string)
+	for _, b := range p.Buckets {
+		keys, err := p.listObjects(b.Name, b.Prefix)
+		if err != nil {
+			return errors.Wrapf(err, "List bucket %s", b.Name)
+		}
+
+		for _, key := range keys {
+			if sha1 := sha1FromKey(key); sha1 != "" {
+				locations[sha1] = append(locations[sha1], b.Name)
+			}
+		}
+	}
+
+	sha1s := make([]string, 0, len(locations))
+	for k := range locations {
+		sha1s = append(sha1s, k)
+	}
+	sort.Strings(sha1s)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return errors.Wrap(err, "Create output file")
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, sha1 := range sha1s {
+		fmt.Fprintf(w, "%s,\"%s\"\n", sha1, strings.Join(locations[sha1], ","))
+	}
+
+	return errors.Wrap(w.Flush(), "Flush catalog")
+}
+
+func (p *S3Provider) listObjects(bucket, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		u := fmt.Sprintf("%s/%s?%s", strings.TrimRight(p.Endpoint, "/"), bucket, q.Encode())
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "http.NewRequest")
+		}
+		if p.AccessKey != "" {
+			signS3Request(req, p.AccessKey, p.SecretKey, p.Region, time.Now().UTC())
+		}
+
+		resp, err := p.Client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "Do http request")
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Read http response body")
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("Http error %d: %s", resp.StatusCode, string(body))
+		}
+
+		var result s3ListBucketResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, errors.Wrap(err, "xml.Unmarshal")
+		}
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return keys, nil
+}
+
+// sha1FromKey extracts the sha1 from object keys like `prefix/<sha1>.mp4`.
+// Returns empty string if the key is not named by sha1.
+func sha1FromKey(key string) string {
+	name := path.Base(key)
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(name)
+	if len(name) != 40 {
+		return ""
+	}
+	if _, err := hex.DecodeString(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// signS3Request adds AWS signature version 4 headers to a request without body
+func signS3Request(req *http.Request, accessKey, secretKey, region string, t time.Time) {
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	payloadHash := hex.EncodeToString(sha256Sum(nil))
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", host, payloadHash, amzDate)
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.EscapedPath()),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+secretKey), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vs := q[k]
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape is RFC 3986 percent encoding as required by signature v4
+func s3Escape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func sha256Sum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:]
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
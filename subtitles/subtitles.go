@@ -0,0 +1,395 @@
+package subtitles
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/Bnei-Baruch/mdb/common"
+)
+
+const (
+	FORMAT_SRT = "srt"
+	FORMAT_VTT = "vtt"
+
+	// Below this ratio of the media duration covered by cues we warn
+	MIN_COVERAGE = 0.5
+
+	// Allowed slack for cues running past the end of the media
+	DURATION_TOLERANCE = 2 * time.Second
+)
+
+// 00:00:01,000 (srt) or 00:01.000 / 00:00:01.000 (vtt)
+var timestampRe = regexp.MustCompile(`^(?:(\d+):)?(\d{1,2}):(\d{2})[,.](\d{3})$`)
+
+type Cue struct {
+	Index int           `json:"index"`
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+}
+
+// Report is the outcome of validating a subtitles file.
+// Errors make the file unusable, Warnings are for human attention.
+type Report struct {
+	Format   string   `json:"format"`
+	CueCount int      `json:"cue_count"`
+	Covered  float64  `json:"covered"`
+	Coverage float64  `json:"coverage,omitempty"`
+	Script   string   `json:"script,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (r *Report) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// FormatByName returns the subtitles format of the given file name or empty string if unknown
+func FormatByName(name string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")) {
+	case FORMAT_SRT:
+		return FORMAT_SRT
+	case FORMAT_VTT:
+		return FORMAT_VTT
+	default:
+		return ""
+	}
+}
+
+// ValidateFile parses and validates a local subtitles file.
+// duration is that of the media in seconds, zero if unknown.
+func ValidateFile(path string, language string, duration float64) (*Report, error) {
+	format := FormatByName(path)
+	if format == "" {
+		return nil, errors.Errorf("Unknown subtitles format: %s", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "os.Open")
+	}
+	defer f.Close()
+
+	cues, err := Parse(f, format)
+	if err != nil {
+		return &Report{Format: format, Errors: []string{err.Error()}}, nil
+	}
+
+	return Validate(cues, format, language, duration), nil
+}
+
+func Parse(r io.Reader, format string) ([]*Cue, error) {
+	blocks, err := readBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FORMAT_SRT:
+		return parseSRT(blocks)
+	case FORMAT_VTT:
+		return parseVTT(blocks)
+	default:
+		return nil, errors.Errorf("Unknown subtitles format: %s", format)
+	}
+}
+
+func parseSRT(blocks [][]string) ([]*Cue, error) {
+	cues := make([]*Cue, 0, len(blocks))
+	for i, block := range blocks {
+		if len(block) < 2 {
+			return nil, errors.Errorf("Cue %d: expecting index and timing lines", i+1)
+		}
+
+		idx, err := strconv.Atoi(strings.TrimSpace(block[0]))
+		if err != nil {
+			return nil, errors.Errorf("Cue %d: bad index %q", i+1, block[0])
+		}
+
+		cue, err := parseCue(block[1], block[2:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cue %d", idx)
+		}
+		cue.Index = idx
+		cues = append(cues, cue)
+	}
+
+	return cues, nil
+}
+
+func parseVTT(blocks [][]string) ([]*Cue, error) {
+	if len(blocks) == 0 || !strings.HasPrefix(blocks[0][0], "WEBVTT") {
+		return nil, errors.New("Missing WEBVTT header")
+	}
+
+	cues := make([]*Cue, 0, len(blocks))
+	for _, block := range blocks[1:] {
+		if strings.HasPrefix(block[0], "NOTE") ||
+			strings.HasPrefix(block[0], "STYLE") ||
+			strings.HasPrefix(block[0], "REGION") {
+			continue
+		}
+
+		// optional cue identifier
+		timing := 0
+		if !strings.Contains(block[0], "-->") {
+			timing = 1
+		}
+		if timing >= len(block) {
+			return nil, errors.Errorf("Cue %d: missing timing line", len(cues)+1)
+		}
+
+		cue, err := parseCue(block[timing], block[timing+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cue %d", len(cues)+1)
+		}
+		cue.Index = len(cues) + 1
+		cues = append(cues, cue)
+	}
+
+	return cues, nil
+}
+
+func parseCue(timing string, text []string) (*Cue, error) {
+	parts := strings.SplitN(timing, "-->", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("bad timing line %q", timing)
+	}
+
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+
+	// vtt cue settings might follow the end timestamp
+	endFields := strings.Fields(parts[1])
+	if len(endFields) == 0 {
+		return nil, errors.Errorf("bad timing line %q", timing)
+	}
+	end, err := parseTimestamp(endFields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cue{
+		Start: start,
+		End:   end,
+		Text:  strings.Join(text, "\n"),
+	}, nil
+}
+
+func parseTimestamp(s string) (time.Duration, error) {
+	m := timestampRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, errors.Errorf("bad timestamp %q", s)
+	}
+
+	var h, min, sec, ms int
+	if m[1] != "" {
+		h, _ = strconv.Atoi(m[1])
+	}
+	min, _ = strconv.Atoi(m[2])
+	sec, _ = strconv.Atoi(m[3])
+	ms, _ = strconv.Atoi(m[4])
+	if min > 59 || sec > 59 {
+		return 0, errors.Errorf("bad timestamp %q", s)
+	}
+
+	return time.Duration(h)*time.Hour +
+		time.Duration(min)*time.Minute +
+		time.Duration(sec)*time.Second +
+		time.Duration(ms)*time.Millisecond, nil
+}
+
+// readBlocks splits input into blocks of non empty lines
+func readBlocks(r io.Reader) ([][]string, error) {
+	blocks := make([][]string, 0)
+	block := make([]string, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+				block = make([]string, 0)
+			}
+			continue
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "scanner.Err")
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
+
+// Validate checks cues timing, their coverage of the media and their script against the language.
+func Validate(cues []*Cue, format string, language string, duration float64) *Report {
+	r := &Report{
+		Format:   format,
+		CueCount: len(cues),
+		Errors:   make([]string, 0),
+		Warnings: make([]string, 0),
+	}
+
+	if len(cues) == 0 {
+		r.Errors = append(r.Errors, "No cues")
+		return r
+	}
+
+	// timing
+	var covered, prevEnd time.Duration
+	var prevStart time.Duration = -1
+	var text strings.Builder
+	for _, c := range cues {
+		if c.End <= c.Start {
+			r.Errors = append(r.Errors, fmt.Sprintf("Cue %d: ends before it starts", c.Index))
+			continue
+		}
+		if c.Start < prevStart {
+			r.Errors = append(r.Errors, fmt.Sprintf("Cue %d: out of order", c.Index))
+			continue
+		}
+		if c.Start < prevEnd {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("Cue %d: overlaps previous cue", c.Index))
+		}
+		if strings.TrimSpace(c.Text) == "" {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("Cue %d: empty text", c.Index))
+		}
+
+		// union of cue intervals
+		if c.End > prevEnd {
+			if c.Start > prevEnd {
+				covered += c.End - c.Start
+			} else {
+				covered += c.End - prevEnd
+			}
+			prevEnd = c.End
+		}
+		prevStart = c.Start
+
+		text.WriteString(c.Text)
+		text.WriteString(" ")
+	}
+	r.Covered = covered.Seconds()
+
+	// coverage
+	if duration > 0 {
+		r.Coverage = r.Covered / duration
+		if r.Coverage < MIN_COVERAGE {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("Low coverage %.2f", r.Coverage))
+		}
+		if prevEnd > time.Duration(duration*float64(time.Second))+DURATION_TOLERANCE {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("Cues run past media duration (%s > %.0fs)", prevEnd, duration))
+		}
+	}
+
+	// language
+	if language == "" {
+		r.Errors = append(r.Errors, "Missing language")
+	} else if l := common.StdLang(language); l == common.LANG_UNKNOWN {
+		r.Errors = append(r.Errors, fmt.Sprintf("Unknown language %s", language))
+	} else {
+		r.Script = DominantScript(text.String())
+		if expected := ExpectedScript(l); expected != "" && r.Script != "" && r.Script != expected {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("Language %s expects %s script, found %s", l, expected, r.Script))
+		}
+	}
+
+	return r
+}
+
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Hebrew", unicode.Hebrew},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Arabic", unicode.Arabic},
+	{"Georgian", unicode.Georgian},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Devanagari", unicode.Devanagari},
+	{"Ethiopic", unicode.Ethiopic},
+}
+
+// DominantScript returns the name of the unicode script most letters in s belong to
+func DominantScript(s string) string {
+	counts := make([]int, len(scripts))
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for i := range scripts {
+			if unicode.Is(scripts[i].table, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+
+	best := -1
+	for i := range counts {
+		if counts[i] > 0 && (best < 0 || counts[i] > counts[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+
+	// japanese is mostly a mix of these
+	name := scripts[best].name
+	if name == "Hiragana" || name == "Katakana" {
+		return "Han"
+	}
+	return name
+}
+
+// ExpectedScript returns the script a language is written in, empty if we don't know
+func ExpectedScript(language string) string {
+	switch language {
+	case common.LANG_HEBREW:
+		return "Hebrew"
+	case common.LANG_RUSSIAN, common.LANG_UKRAINIAN, common.LANG_BULGARIAN, common.LANG_MACEDONIAN:
+		return "Cyrillic"
+	case common.LANG_ARABIC, common.LANG_PERSIAN:
+		return "Arabic"
+	case common.LANG_GEORGIAN:
+		return "Georgian"
+	case common.LANG_CHINESE, common.LANG_JAPANESE:
+		return "Han"
+	case common.LANG_HINDI:
+		return "Devanagari"
+	case common.LANG_AMHARIC:
+		return "Ethiopic"
+	case common.LANG_MULTI, common.LANG_UNKNOWN:
+		return ""
+	default:
+		return "Latin"
+	}
+}
@@ -0,0 +1,79 @@
+package subtitles
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleSRT = "\ufeff1\r\n00:00:01,000 --> 00:00:04,000\r\nHello world\r\n\r\n2\r\n00:00:05,500 --> 00:00:08,000\r\nSecond line\r\nwith two rows\r\n"
+
+const sampleVTT = `WEBVTT - some title
+
+NOTE a comment
+spanning lines
+
+intro
+00:01.000 --> 00:04.000 align:start
+שלום עולם
+
+00:00:05.500 --> 00:00:08.000
+עוד שורה
+`
+
+func TestParseSRT(t *testing.T) {
+	cues, err := Parse(strings.NewReader(sampleSRT), FORMAT_SRT)
+	assert.Nil(t, err)
+	if assert.Len(t, cues, 2) {
+		assert.Equal(t, 1, cues[0].Index, "Index")
+		assert.Equal(t, time.Second, cues[0].Start, "Start")
+		assert.Equal(t, 4*time.Second, cues[0].End, "End")
+		assert.Equal(t, "Hello world", cues[0].Text, "Text")
+		assert.Equal(t, 5500*time.Millisecond, cues[1].Start, "Start")
+		assert.Equal(t, "Second line\nwith two rows", cues[1].Text, "Text")
+	}
+
+	_, err = Parse(strings.NewReader("1\n00:00:01,000 -> 00:00:04,000\nbad\n"), FORMAT_SRT)
+	assert.NotNil(t, err, "bad timing")
+}
+
+func TestParseVTT(t *testing.T) {
+	cues, err := Parse(strings.NewReader(sampleVTT), FORMAT_VTT)
+	assert.Nil(t, err)
+	if assert.Len(t, cues, 2) {
+		assert.Equal(t, time.Second, cues[0].Start, "Start")
+		assert.Equal(t, "שלום עולם", cues[0].Text, "Text")
+		assert.Equal(t, 8*time.Second, cues[1].End, "End")
+	}
+
+	_, err = Parse(strings.NewReader("00:01.000 --> 00:04.000\nno header\n"), FORMAT_VTT)
+	assert.NotNil(t, err, "missing header")
+}
+
+func TestValidate(t *testing.T) {
+	cues, err := Parse(strings.NewReader(sampleSRT), FORMAT_SRT)
+	assert.Nil(t, err)
+
+	r := Validate(cues, FORMAT_SRT, "en", 10)
+	assert.True(t, r.Valid(), "Valid")
+	assert.Equal(t, 2, r.CueCount, "CueCount")
+	assert.Equal(t, 5.5, r.Covered, "Covered")
+	assert.Equal(t, 0.55, r.Coverage, "Coverage")
+	assert.Equal(t, "Latin", r.Script, "Script")
+	assert.Empty(t, r.Warnings, "Warnings")
+
+	r = Validate(cues, FORMAT_SRT, "he", 60)
+	assert.True(t, r.Valid(), "Valid")
+	assert.Len(t, r.Warnings, 2, "low coverage and script mismatch")
+
+	r = Validate(cues, FORMAT_SRT, "", 0)
+	assert.False(t, r.Valid(), "missing language")
+
+	r = Validate([]*Cue{{Index: 1, Start: 2 * time.Second, End: time.Second, Text: "x"}}, FORMAT_SRT, "en", 0)
+	assert.False(t, r.Valid(), "bad timing")
+
+	r = Validate(nil, FORMAT_SRT, "en", 0)
+	assert.False(t, r.Valid(), "no cues")
+}
@@ -2,9 +2,13 @@ package utils
 
 import (
 	"math/rand"
-	"time"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 	"unicode/utf8"
+
+	"github.com/pkg/errors"
 )
 
 const uidBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -83,6 +87,34 @@ func ConvertArgsBytes(args [][]byte) []interface{} {
 	return c
 }
 
+// UniqueInt64 returns the distinct values of s in order of first appearance
+func UniqueInt64(s []int64) []int64 {
+	seen := make(map[int64]bool, len(s))
+	res := make([]int64, 0, len(s))
+	for _, x := range s {
+		if !seen[x] {
+			seen[x] = true
+			res = append(res, x)
+		}
+	}
+	return res
+}
+
+// PathUnder resolves path (absolute or relative to root) and rejects paths escaping root
+func PathUnder(root, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.Errorf("Path %s is not under %s", path, root)
+	}
+
+	return path, nil
+}
+
 // Taken AS IS from
 // https://stackoverflow.com/a/34521190
 // Note that this implementation DOES NOT handle combining marks correctly